@@ -0,0 +1,146 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// TenantRole is the database role tenant-scoped queries run as. Row-level security policies on every
+// tenant table limit it to the rows of app.tenant_id (migration 036), so a query that forgets its
+// tenant_id filter still cannot read or change another tenant's data. DB itself is the table owner and
+// bypasses the policies; it stays in use for logins, the platform console and background jobs.
+const TenantRole = "rukunos_tenant"
+
+// TenantDB runs queries for one tenant. Every statement runs in its own transaction (or in the
+// transaction from Beginx) with app.tenant_id and the role set locally, so nothing leaks to pooled connections.
+type TenantDB struct {
+	TenantID string
+}
+
+// ForTenant returns a handle whose queries can only see rows of the given tenant.
+// An empty tenant ID sees no tenant rows at all.
+func ForTenant(tenantID string) *TenantDB {
+	return &TenantDB{TenantID: tenantID}
+}
+
+// Beginx starts a transaction limited to the tenant
+func (t *TenantDB) Beginx() (*sqlx.Tx, error) {
+	tx, err := DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`SELECT set_config('app.tenant_id', $1, true), set_config('role', $2, true)`, t.TenantID, TenantRole); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// run runs fn in a tenant transaction and commits it unless fn fails
+func (t *TenantDB) run(fn func(tx *sqlx.Tx) error) error {
+	tx, err := t.Beginx()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (t *TenantDB) Get(dest interface{}, query string, args ...interface{}) error {
+	return t.run(func(tx *sqlx.Tx) error { return tx.Get(dest, query, args...) })
+}
+
+func (t *TenantDB) Select(dest interface{}, query string, args ...interface{}) error {
+	return t.run(func(tx *sqlx.Tx) error { return tx.Select(dest, query, args...) })
+}
+
+func (t *TenantDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	var result sql.Result
+	err := t.run(func(tx *sqlx.Tx) error {
+		var err error
+		result, err = tx.Exec(query, args...)
+		return err
+	})
+	return result, err
+}
+
+// Query returns rows whose transaction ends when they are closed
+func (t *TenantDB) Query(query string, args ...interface{}) (*Rows, error) {
+	tx, err := t.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return &Rows{Rows: rows, tx: tx}, nil
+}
+
+// QueryRow returns a row whose transaction ends when it is scanned
+func (t *TenantDB) QueryRow(query string, args ...interface{}) *Row {
+	tx, err := t.Beginx()
+	if err != nil {
+		return &Row{err: err}
+	}
+	return &Row{row: tx.QueryRowx(query, args...), tx: tx}
+}
+
+// QueryRowx is QueryRow with sqlx struct scanning
+func (t *TenantDB) QueryRowx(query string, args ...interface{}) *Row {
+	return t.QueryRow(query, args...)
+}
+
+// Rows are the result of TenantDB.Query
+type Rows struct {
+	*sql.Rows
+	tx *sqlx.Tx
+}
+
+// Close closes the rows and commits their transaction
+func (r *Rows) Close() error {
+	err := r.Rows.Close()
+	if r.tx != nil {
+		r.tx.Commit()
+		r.tx = nil
+	}
+	return err
+}
+
+// Row is the result of TenantDB.QueryRow
+type Row struct {
+	row *sqlx.Row
+	tx  *sqlx.Tx
+	err error
+}
+
+func (r *Row) finish(err error) error {
+	if r.tx != nil {
+		if err != nil && err != sql.ErrNoRows {
+			r.tx.Rollback()
+		} else {
+			r.tx.Commit()
+		}
+		r.tx = nil
+	}
+	return err
+}
+
+func (r *Row) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.finish(r.row.Scan(dest...))
+}
+
+func (r *Row) StructScan(dest interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.finish(r.row.StructScan(dest))
+}
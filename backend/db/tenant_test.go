@@ -0,0 +1,226 @@
+package db_test
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"rukunos-backend/db"
+	"rukunos-backend/dbtest"
+)
+
+// These tests run the tenant_isolation policies of migration 036 through db.ForTenant the way handlers do,
+// with queries that deliberately leave out their tenant_id filter.
+
+// count returns how many rows of query the tenant sees
+func count(t *testing.T, tdb *db.TenantDB, query string, args ...interface{}) int {
+	t.Helper()
+	var n int
+	if err := tdb.Get(&n, query, args...); err != nil {
+		t.Fatalf("Count failed: %v\n%s", err, query)
+	}
+	return n
+}
+
+// affected runs a write as the tenant and returns the number of rows it changed
+func affected(t *testing.T, tdb *db.TenantDB, query string, args ...interface{}) int64 {
+	t.Helper()
+	result, err := tdb.Exec(query, args...)
+	if err != nil {
+		t.Fatalf("Write failed: %v\n%s", err, query)
+	}
+	n, _ := result.RowsAffected()
+	return n
+}
+
+// rejected asserts the write fails on a row-level security check
+func rejected(t *testing.T, tdb *db.TenantDB, query string, args ...interface{}) {
+	t.Helper()
+	_, err := tdb.Exec(query, args...)
+	if err == nil || !strings.Contains(err.Error(), "row-level security") {
+		t.Fatalf("Write error = %v, want a row-level security violation\n%s", err, query)
+	}
+}
+
+func TestTenantIsolationFamilyMembers(t *testing.T) {
+	dbtest.Open(t)
+	tenantA, tenantB := dbtest.CreateTenant(t), dbtest.CreateTenant(t)
+	unitA, unitB := dbtest.CreateUnit(t, tenantA, "A-1"), dbtest.CreateUnit(t, tenantB, "B-1")
+	userA, userB := dbtest.CreateUser(t, ""), dbtest.CreateUser(t, "")
+	dbtest.AddMember(t, tenantA, userA, "")
+	dbtest.AddMember(t, tenantB, userB, "")
+	dbtest.Exec(t, `UPDATE tenant_users SET unit_id = $1 WHERE tenant_id = $2 AND user_id = $3`, unitA, tenantA, userA)
+	dbtest.Exec(t, `UPDATE tenant_users SET unit_id = $1 WHERE tenant_id = $2 AND user_id = $3`, unitB, tenantB, userB)
+	tdb := db.ForTenant(tenantA)
+
+	// The GetFamilyMembers query without its tenant filter, pointed at the other tenant's unit
+	family := `
+		SELECT COUNT(*) FROM tenant_users tu
+		INNER JOIN users u ON tu.user_id = u.id
+		WHERE tu.unit_id = $1 AND tu.deleted_at IS NULL`
+	if n := count(t, tdb, family, unitA); n != 1 {
+		t.Fatalf("Own unit members = %d, want 1", n)
+	}
+	if n := count(t, tdb, family, unitB); n != 0 {
+		t.Fatalf("Other tenant's unit members = %d, want 0", n)
+	}
+
+	var unitID sql.NullString
+	if err := tdb.Get(&unitID, `SELECT unit_id FROM tenant_users WHERE user_id = $1`, userB); err != sql.ErrNoRows {
+		t.Fatalf("Other tenant's membership: unit %v, error %v; want sql.ErrNoRows", unitID, err)
+	}
+	if n := count(t, tdb, `SELECT COUNT(*) FROM units WHERE id IN ($1, $2)`, unitA, unitB); n != 1 {
+		t.Fatalf("Visible units = %d, want 1", n)
+	}
+	if n := count(t, tdb, `SELECT COUNT(*) FROM tenant_users`); n != 1 {
+		t.Fatalf("Visible memberships = %d, want 1", n)
+	}
+
+	// Updates and deletes of the other tenant's rows change nothing
+	if n := affected(t, tdb, `UPDATE units SET address = 'hijacked' WHERE id = $1`, unitB); n != 0 {
+		t.Fatalf("Updated %d units of the other tenant", n)
+	}
+	if n := affected(t, tdb, `UPDATE tenant_users SET unit_id = $1 WHERE user_id = $2`, unitA, userB); n != 0 {
+		t.Fatalf("Updated %d memberships of the other tenant", n)
+	}
+	if n := affected(t, tdb, `DELETE FROM units WHERE id = $1`, unitB); n != 0 {
+		t.Fatalf("Deleted %d units of the other tenant", n)
+	}
+	var address sql.NullString
+	dbtest.Get(t, &address, `SELECT address FROM units WHERE id = $1`, unitB)
+	if address.String == "hijacked" {
+		t.Fatal("The other tenant's unit was changed")
+	}
+
+	// Inserting into, or moving an own row to, the other tenant violates the policy
+	rejected(t, tdb, `INSERT INTO units (tenant_id, code, type) VALUES ($1, 'B-2', 'rumah')`, tenantB)
+	rejected(t, tdb, `INSERT INTO tenant_users (tenant_id, user_id, unit_id, status) VALUES ($1, $2, $3, 'active')`, tenantB, userA, unitB)
+	rejected(t, tdb, `UPDATE units SET tenant_id = $1 WHERE id = $2`, tenantB, unitA)
+
+	// Without a tenant nothing is visible
+	if n := count(t, db.ForTenant(""), `SELECT COUNT(*) FROM units WHERE id IN ($1, $2)`, unitA, unitB); n != 0 {
+		t.Fatalf("Units visible without a tenant = %d, want 0", n)
+	}
+}
+
+func TestTenantIsolationBillingTemplateAmountRules(t *testing.T) {
+	dbtest.Open(t)
+	tenantA, tenantB := dbtest.CreateTenant(t), dbtest.CreateTenant(t)
+	var templateA, templateB, ruleB string
+	dbtest.Get(t, &templateA, `INSERT INTO billing_templates (tenant_id, name, category, type, amount) VALUES ($1, 'Iuran A', 'iuran', 'monthly', 50000) RETURNING id`, tenantA)
+	dbtest.Get(t, &templateB, `INSERT INTO billing_templates (tenant_id, name, category, type, amount) VALUES ($1, 'Iuran B', 'iuran', 'monthly', 50000) RETURNING id`, tenantB)
+	dbtest.Get(t, &ruleB, `INSERT INTO billing_template_amount_rules (template_id, unit_type, amount) VALUES ($1, 'ruko', 75000) RETURNING id`, templateB)
+	tdb := db.ForTenant(tenantA)
+
+	if n := affected(t, tdb, `INSERT INTO billing_template_amount_rules (template_id, unit_type, amount) VALUES ($1, 'ruko', 60000)`, templateA); n != 1 {
+		t.Fatalf("Inserted %d rules on the own template, want 1", n)
+	}
+	if n := count(t, tdb, `SELECT COUNT(*) FROM billing_template_amount_rules WHERE template_id IN ($1, $2)`, templateA, templateB); n != 1 {
+		t.Fatalf("Visible rules = %d, want 1", n)
+	}
+	if n := affected(t, tdb, `UPDATE billing_template_amount_rules SET amount = 0 WHERE id = $1`, ruleB); n != 0 {
+		t.Fatalf("Updated %d rules of the other tenant", n)
+	}
+	if n := affected(t, tdb, `DELETE FROM billing_template_amount_rules WHERE id = $1`, ruleB); n != 0 {
+		t.Fatalf("Deleted %d rules of the other tenant", n)
+	}
+	rejected(t, tdb, `INSERT INTO billing_template_amount_rules (template_id, unit_type, amount) VALUES ($1, 'kios', 1)`, templateB)
+	rejected(t, tdb, `UPDATE billing_template_amount_rules SET template_id = $1 WHERE template_id = $2`, templateB, templateA)
+	rejected(t, tdb, `INSERT INTO billing_templates (tenant_id, name, category, type, amount) VALUES ($1, 'Injected', 'iuran', 'monthly', 1)`, tenantB)
+}
+
+func TestTenantIsolationRolePermissions(t *testing.T) {
+	dbtest.Open(t)
+	tenantA, tenantB := dbtest.CreateTenant(t), dbtest.CreateTenant(t)
+	roleA, roleB := dbtest.CreateRole(t, tenantA, "Test Role A"), dbtest.CreateRole(t, tenantB, "Test Role B")
+	var permissionID string
+	dbtest.Get(t, &permissionID, `SELECT id FROM permissions WHERE key = 'resident.view'`)
+	dbtest.Exec(t, `INSERT INTO role_permissions (role_id, permission_id) VALUES ($1, $2)`, roleB, permissionID)
+	tdb := db.ForTenant(tenantA)
+
+	// The permissions catalogue is global and readable
+	if n := count(t, tdb, `SELECT COUNT(*) FROM permissions WHERE id = $1`, permissionID); n != 1 {
+		t.Fatalf("Visible permissions = %d, want 1", n)
+	}
+	if n := affected(t, tdb, `INSERT INTO role_permissions (role_id, permission_id) VALUES ($1, $2)`, roleA, permissionID); n != 1 {
+		t.Fatalf("Granted %d permissions to the own role, want 1", n)
+	}
+	if n := count(t, tdb, `SELECT COUNT(*) FROM role_permissions WHERE role_id IN ($1, $2)`, roleA, roleB); n != 1 {
+		t.Fatalf("Visible role permissions = %d, want 1", n)
+	}
+	if n := affected(t, tdb, `DELETE FROM role_permissions WHERE role_id = $1`, roleB); n != 0 {
+		t.Fatalf("Revoked %d permissions of the other tenant's role", n)
+	}
+	if n := affected(t, tdb, `UPDATE roles SET name = 'hijacked' WHERE id = $1`, roleB); n != 0 {
+		t.Fatalf("Renamed %d roles of the other tenant", n)
+	}
+
+	// Granting anything to the other tenant's role, directly or by moving a grant, is refused
+	rejected(t, tdb, `INSERT INTO role_permissions (role_id, permission_id) VALUES ($1, $2)`, roleB, permissionID)
+	rejected(t, tdb, `UPDATE role_permissions SET role_id = $1 WHERE role_id = $2`, roleB, roleA)
+	rejected(t, tdb, `INSERT INTO roles (tenant_id, name) VALUES ($1, 'Injected')`, tenantB)
+}
+
+func TestTenantIsolationAnnouncementReads(t *testing.T) {
+	dbtest.Open(t)
+	tenantA, tenantB := dbtest.CreateTenant(t), dbtest.CreateTenant(t)
+	userA, userB := dbtest.CreateUser(t, ""), dbtest.CreateUser(t, "")
+	var announcementA, announcementB string
+	dbtest.Get(t, &announcementA, `INSERT INTO announcements (tenant_id, author_id, title, content) VALUES ($1, $2, 'A', 'A') RETURNING id`, tenantA, userA)
+	dbtest.Get(t, &announcementB, `INSERT INTO announcements (tenant_id, author_id, title, content) VALUES ($1, $2, 'B', 'B') RETURNING id`, tenantB, userB)
+	dbtest.Exec(t, `INSERT INTO announcement_reads (announcement_id, user_id) VALUES ($1, $2)`, announcementB, userB)
+	tdb := db.ForTenant(tenantA)
+
+	if n := affected(t, tdb, `INSERT INTO announcement_reads (announcement_id, user_id) VALUES ($1, $2)`, announcementA, userA); n != 1 {
+		t.Fatalf("Marked %d own announcements read, want 1", n)
+	}
+	if n := count(t, tdb, `SELECT COUNT(*) FROM announcement_reads WHERE announcement_id IN ($1, $2)`, announcementA, announcementB); n != 1 {
+		t.Fatalf("Visible reads = %d, want 1", n)
+	}
+	if n := affected(t, tdb, `DELETE FROM announcement_reads WHERE announcement_id = $1`, announcementB); n != 0 {
+		t.Fatalf("Deleted %d reads of the other tenant", n)
+	}
+	if n := affected(t, tdb, `UPDATE announcements SET title = 'hijacked' WHERE id = $1`, announcementB); n != 0 {
+		t.Fatalf("Updated %d announcements of the other tenant", n)
+	}
+	rejected(t, tdb, `INSERT INTO announcement_reads (announcement_id, user_id) VALUES ($1, $2)`, announcementB, userA)
+	rejected(t, tdb, `INSERT INTO announcements (tenant_id, author_id, title, content) VALUES ($1, $2, 'X', 'X')`, tenantB, userA)
+}
+
+func TestTenantCascadeRead(t *testing.T) {
+	dbtest.Open(t)
+	rw, rt, otherRT := dbtest.CreateTenant(t), dbtest.CreateTenant(t), dbtest.CreateTenant(t)
+	dbtest.Exec(t, `UPDATE tenants SET level = 'rw' WHERE id = $1`, rw)
+	dbtest.Exec(t, `UPDATE tenants SET parent_tenant_id = $1 WHERE id = $2`, rw, rt)
+	author, reader := dbtest.CreateUser(t, ""), dbtest.CreateUser(t, "")
+	var cascaded, internal string
+	dbtest.Get(t, &cascaded, `INSERT INTO announcements (tenant_id, author_id, title, content, cascade_to_children) VALUES ($1, $2, 'RW', 'RW', true) RETURNING id`, rw, author)
+	dbtest.Get(t, &internal, `INSERT INTO announcements (tenant_id, author_id, title, content) VALUES ($1, $2, 'RW only', 'RW only') RETURNING id`, rw, author)
+	visible := `SELECT COUNT(*) FROM announcements WHERE id = $1`
+
+	// Children of the RW read its cascaded announcements, and only those
+	tdb := db.ForTenant(rt)
+	if n := count(t, tdb, visible, cascaded); n != 1 {
+		t.Fatalf("Cascaded announcement visible to the RT %d times, want 1", n)
+	}
+	if n := count(t, tdb, visible, internal); n != 0 {
+		t.Fatal("An RW announcement that does not cascade is visible to the RT")
+	}
+	if n := count(t, db.ForTenant(otherRT), visible, cascaded); n != 0 {
+		t.Fatal("The cascaded announcement is visible to a tenant outside the RW")
+	}
+
+	// The cascade is read-only: the RT cannot change or delete it
+	if n := affected(t, tdb, `UPDATE announcements SET title = 'hijacked' WHERE id = $1`, cascaded); n != 0 {
+		t.Fatalf("The RT updated %d RW announcements", n)
+	}
+	if n := affected(t, tdb, `DELETE FROM announcements WHERE id = $1`, cascaded); n != 0 {
+		t.Fatalf("The RT deleted %d RW announcements", n)
+	}
+	rejected(t, tdb, `INSERT INTO announcements (tenant_id, author_id, title, content, cascade_to_children) VALUES ($1, $2, 'X', 'X', true)`, rw, reader)
+
+	// RT residents can still mark it read, as the read policy follows the announcement's visibility
+	if n := affected(t, tdb, `INSERT INTO announcement_reads (announcement_id, user_id) VALUES ($1, $2)`, cascaded, reader); n != 1 {
+		t.Fatalf("Marked %d cascaded announcements read, want 1", n)
+	}
+	rejected(t, db.ForTenant(otherRT), `INSERT INTO announcement_reads (announcement_id, user_id) VALUES ($1, $2)`, cascaded, reader)
+}
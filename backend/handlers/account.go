@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"rukunos-backend/db"
+	"rukunos-backend/middleware"
+	"rukunos-backend/models"
+	"rukunos-backend/services"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	tokenPurposePasswordReset     = "password_reset"
+	tokenPurposeEmailVerification = "email_verification"
+
+	passwordResetTTL     = time.Hour
+	emailVerificationTTL = 48 * time.Hour
+
+	// authTokenResendInterval throttles how often a new reset/verification email can be requested
+	authTokenResendInterval = time.Minute
+)
+
+// createAuthToken issues a single-use token for purpose, invalidating earlier unused tokens of the same purpose
+func createAuthToken(q sqlx.Execer, userID, purpose string, ttl time.Duration) (string, error) {
+	token, tokenHash, err := newSecureToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = q.Exec(`
+		UPDATE auth_tokens SET used_at = NOW()
+		WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL
+	`, userID, purpose)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = q.Exec(`
+		INSERT INTO auth_tokens (user_id, purpose, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, userID, purpose, tokenHash, time.Now().Add(ttl))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// recentlyIssuedAuthToken reports whether a token for purpose was issued within authTokenResendInterval
+func recentlyIssuedAuthToken(userID, purpose string) bool {
+	var recent bool
+	db.DB.Get(&recent, `
+		SELECT EXISTS(
+			SELECT 1 FROM auth_tokens
+			WHERE user_id = $1 AND purpose = $2 AND created_at > $3
+		)
+	`, userID, purpose, time.Now().Add(-authTokenResendInterval))
+	return recent
+}
+
+// sendVerificationEmail issues a verification token and emails the link to the user
+func sendVerificationEmail(userID, email, fullName string) error {
+	token, err := createAuthToken(db.DB, userID, tokenPurposeEmailVerification, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := frontendBaseURL() + "/verify-email?token=" + url.QueryEscape(token)
+	return services.SendEmail(services.Message{
+		UserID:    userID,
+		Recipient: email,
+		Subject:   "Verifikasi email akun RukunOS Anda",
+		Body: fmt.Sprintf("Halo %s,\n\nSilakan verifikasi alamat email Anda dengan membuka tautan berikut "+
+			"(berlaku %d jam):\n%s\n\nAbaikan email ini jika Anda tidak mendaftar di RukunOS.\n",
+			fullName, int(emailVerificationTTL.Hours()), link),
+	})
+}
+
+// sendPasswordResetEmail issues a password reset token and emails the link to the user
+func sendPasswordResetEmail(userID, email, fullName string) error {
+	token, err := createAuthToken(db.DB, userID, tokenPurposePasswordReset, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	link := frontendBaseURL() + "/reset-password?token=" + url.QueryEscape(token)
+	return services.SendEmail(services.Message{
+		UserID:    userID,
+		Recipient: email,
+		Subject:   "Atur ulang kata sandi RukunOS",
+		Body: fmt.Sprintf("Halo %s,\n\nKami menerima permintaan untuk mengatur ulang kata sandi akun Anda. "+
+			"Buka tautan berikut (berlaku %d menit, hanya sekali pakai):\n%s\n\n"+
+			"Abaikan email ini jika Anda tidak memintanya.\n",
+			fullName, int(passwordResetTTL.Minutes()), link),
+	})
+}
+
+// consumeAuthToken locks and validates a token inside tx and marks it used.
+// It returns the token's user ID, or a non-zero HTTP status with an error message.
+func consumeAuthToken(tx *sqlx.Tx, token, purpose string) (string, int, string) {
+	var row struct {
+		ID        string       `db:"id"`
+		UserID    string       `db:"user_id"`
+		ExpiresAt time.Time    `db:"expires_at"`
+		UsedAt    sql.NullTime `db:"used_at"`
+	}
+	err := tx.Get(&row, `
+		SELECT id, user_id, expires_at, used_at
+		FROM auth_tokens
+		WHERE token_hash = $1 AND purpose = $2
+		FOR UPDATE
+	`, hashToken(token), purpose)
+	if err == sql.ErrNoRows {
+		return "", http.StatusBadRequest, "Invalid or expired token"
+	} else if err != nil {
+		return "", http.StatusInternalServerError, "Database error"
+	}
+	if row.UsedAt.Valid || time.Now().After(row.ExpiresAt) {
+		return "", http.StatusBadRequest, "Invalid or expired token"
+	}
+
+	if _, err := tx.Exec(`UPDATE auth_tokens SET used_at = NOW() WHERE id = $1`, row.ID); err != nil {
+		return "", http.StatusInternalServerError, "Failed to use token"
+	}
+	return row.UserID, 0, ""
+}
+
+// ForgotPassword emails a password reset link. It always answers the same way so it cannot be used to probe emails.
+func ForgotPassword(c echo.Context) error {
+	req := new(models.ForgotPasswordRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	if req.Email == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "email is required"})
+	}
+
+	response := map[string]string{"message": "If the email is registered, a password reset link has been sent"}
+
+	var user struct {
+		ID       string `db:"id"`
+		Email    string `db:"email"`
+		FullName string `db:"full_name"`
+	}
+	err := db.DB.Get(&user, `
+		SELECT id, email, full_name FROM users
+		WHERE LOWER(email) = LOWER($1) AND deleted_at IS NULL AND status = 'active'
+		AND (auth_provider = 'email' OR auth_provider = 'both')
+		LIMIT 1
+	`, strings.TrimSpace(req.Email))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			c.Logger().Errorf("Failed to look up user for password reset: %v", err)
+		}
+		return c.JSON(http.StatusOK, response)
+	}
+
+	if recentlyIssuedAuthToken(user.ID, tokenPurposePasswordReset) {
+		return c.JSON(http.StatusOK, response)
+	}
+
+	if err := sendPasswordResetEmail(user.ID, user.Email, user.FullName); err != nil {
+		c.Logger().Errorf("Failed to send password reset email: %v", err)
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// ResetPassword sets a new password using a reset token and logs the user out everywhere
+func ResetPassword(c echo.Context) error {
+	req := new(models.ResetPasswordRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	if req.Token == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "token is required"})
+	}
+	if len(req.Password) < 6 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "password must be at least 6 characters"})
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to hash password"})
+	}
+
+	tx, err := db.DB.Beginx()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
+	}
+	defer tx.Rollback()
+
+	userID, status, message := consumeAuthToken(tx, req.Token, tokenPurposePasswordReset)
+	if status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+
+	// Receiving the reset email also proves ownership of the address
+	_, err = tx.Exec(`
+		UPDATE users
+		SET password_hash = $1, email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()
+		WHERE id = $2
+	`, string(hashedPassword), userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update password"})
+	}
+
+	if err := middleware.RevokeUserSessions(tx, userID, "", middleware.RevokePasswordReset); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to revoke sessions"})
+	}
+
+	if err = tx.Commit(); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit transaction"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Password has been reset. Please log in again."})
+}
+
+// VerifyEmail marks the account's email as verified using a verification token
+func VerifyEmail(c echo.Context) error {
+	req := new(models.VerifyEmailRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	if req.Token == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "token is required"})
+	}
+
+	tx, err := db.DB.Beginx()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
+	}
+	defer tx.Rollback()
+
+	userID, status, message := consumeAuthToken(tx, req.Token, tokenPurposeEmailVerification)
+	if status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+
+	_, err = tx.Exec(`
+		UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()
+		WHERE id = $1
+	`, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to verify email"})
+	}
+
+	if err = tx.Commit(); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit transaction"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Email verified successfully"})
+}
+
+// ResendVerificationEmail sends a new verification link to the current user
+func ResendVerificationEmail(c echo.Context) error {
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+
+	var user struct {
+		Email      string       `db:"email"`
+		FullName   string       `db:"full_name"`
+		VerifiedAt sql.NullTime `db:"email_verified_at"`
+	}
+	err := db.DB.Get(&user, `SELECT email, full_name, email_verified_at FROM users WHERE id = $1`, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if user.VerifiedAt.Valid {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Email is already verified"})
+	}
+	if recentlyIssuedAuthToken(userID, tokenPurposeEmailVerification) {
+		return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "Please wait a minute before requesting another email"})
+	}
+
+	if err := sendVerificationEmail(userID, user.Email, user.FullName); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to send verification email"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Verification email sent"})
+}
@@ -5,17 +5,24 @@ import (
 	"net/http"
 	"strconv"
 	"time"
-	"rukunos-backend/db"
 	"rukunos-backend/middleware"
 	"rukunos-backend/models"
+	"rukunos-backend/services"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
-// ListAnnouncements lists all announcements for the tenant
+// announcementVisibleIn matches announcements of the tenant in arg plus those its RW cascades down to it
+func announcementVisibleIn(arg string) string {
+	return `(a.tenant_id = ` + arg + ` OR (a.cascade_to_children = true AND a.tenant_id = (
+		SELECT parent_tenant_id FROM tenants WHERE id = ` + arg + `)))`
+}
+
+// ListAnnouncements lists all announcements for the tenant, including those cascaded from its RW
 func ListAnnouncements(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Get(string(middleware.CtxUserID)).(string)
 
 	// Get query parameters
@@ -40,11 +47,13 @@ func ListAnnouncements(c echo.Context) error {
 			a.category, a.is_pinned, a.sent_notification, a.sent_whatsapp,
 			a.sent_at, a.expires_at, a.metadata, a.created_at, a.updated_at,
 			u.full_name as author_name, u.email as author_email,
-			CASE WHEN ar.id IS NOT NULL THEN true ELSE false END as is_read
+			CASE WHEN ar.id IS NOT NULL THEN true ELSE false END as is_read,
+			a.cascade_to_children, t.name as tenant_name
 		FROM announcements a
+		INNER JOIN tenants t ON a.tenant_id = t.id
 		LEFT JOIN users u ON a.author_id = u.id
 		LEFT JOIN announcement_reads ar ON a.id = ar.announcement_id AND ar.user_id = $1
-		WHERE a.tenant_id = $2 AND a.deleted_at IS NULL
+		WHERE ` + announcementVisibleIn("$2") + ` AND a.deleted_at IS NULL
 	`
 	args := []interface{}{userID, tenantID}
 	argIndex := 3
@@ -72,7 +81,7 @@ func ListAnnouncements(c echo.Context) error {
 	query += ` ORDER BY a.is_pinned DESC, a.created_at DESC LIMIT $` + strconv.Itoa(argIndex) + ` OFFSET $` + strconv.Itoa(argIndex+1)
 	args = append(args, limit, offset)
 
-	rows, err := db.DB.Query(query, args...)
+	rows, err := tdb.Query(query, args...)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
 	}
@@ -84,28 +93,35 @@ func ListAnnouncements(c echo.Context) error {
 		var category, metadata sql.NullString
 		var sentAt, expiresAt sql.NullTime
 		var isRead bool
+		var tenantName string
 
 		err := rows.Scan(
 			&ann.ID, &ann.TenantID, &ann.AuthorID, &ann.Title, &ann.Content, &ann.Priority,
 			&category, &ann.IsPinned, &ann.SentNotification, &ann.SentWhatsApp,
 			&sentAt, &expiresAt, &metadata, &ann.CreatedAt, &ann.UpdatedAt,
 			&ann.AuthorName, &ann.AuthorEmail, &isRead,
+			&ann.CascadeToChildren, &tenantName,
 		)
 		if err != nil {
 			continue
 		}
 
 		annData := map[string]interface{}{
-			"id":                ann.ID,
-			"title":             ann.Title,
-			"content":           ann.Content,
-			"priority":          ann.Priority,
-			"is_pinned":         ann.IsPinned,
-			"sent_notification": ann.SentNotification,
-			"sent_whatsapp":     ann.SentWhatsApp,
-			"created_at":        ann.CreatedAt.Format(time.RFC3339),
-			"updated_at":        ann.UpdatedAt.Format(time.RFC3339),
-			"is_read":           isRead,
+			"id":                  ann.ID,
+			"title":               ann.Title,
+			"content":             ann.Content,
+			"priority":            ann.Priority,
+			"is_pinned":           ann.IsPinned,
+			"sent_notification":   ann.SentNotification,
+			"sent_whatsapp":       ann.SentWhatsApp,
+			"created_at":          ann.CreatedAt.Format(time.RFC3339),
+			"updated_at":          ann.UpdatedAt.Format(time.RFC3339),
+			"is_read":             isRead,
+			"cascade_to_children": ann.CascadeToChildren,
+			"from_parent":         ann.TenantID != tenantID, // Cascaded from the RW; read-only in the RT
+		}
+		if ann.TenantID != tenantID {
+			annData["tenant_name"] = tenantName
 		}
 
 		if category.Valid {
@@ -129,12 +145,12 @@ func ListAnnouncements(c echo.Context) error {
 
 	// Get total count
 	var total int
-	countQuery := `SELECT COUNT(*) FROM announcements WHERE tenant_id = $1 AND deleted_at IS NULL`
+	countQuery := `SELECT COUNT(*) FROM announcements a WHERE ` + announcementVisibleIn("$1") + ` AND a.deleted_at IS NULL`
 	if priority != "" {
-		countQuery += ` AND priority = $2`
-		err = db.DB.Get(&total, countQuery, tenantID, priority)
+		countQuery += ` AND a.priority = $2`
+		err = tdb.Get(&total, countQuery, tenantID, priority)
 	} else {
-		err = db.DB.Get(&total, countQuery, tenantID)
+		err = tdb.Get(&total, countQuery, tenantID)
 	}
 	if err != nil {
 		total = len(announcements)
@@ -154,6 +170,7 @@ func ListAnnouncements(c echo.Context) error {
 // GetAnnouncement gets an announcement by ID
 func GetAnnouncement(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Get(string(middleware.CtxUserID)).(string)
 	announcementID := c.Param("announcement_id")
 
@@ -161,23 +178,27 @@ func GetAnnouncement(c echo.Context) error {
 	var category, metadata sql.NullString
 	var sentAt, expiresAt sql.NullTime
 	var isRead bool
+	var tenantName string
 
-	err := db.DB.QueryRow(`
+	err := tdb.QueryRow(`
 		SELECT 
 			a.id, a.tenant_id, a.author_id, a.title, a.content, a.priority,
 			a.category, a.is_pinned, a.sent_notification, a.sent_whatsapp,
 			a.sent_at, a.expires_at, a.metadata, a.created_at, a.updated_at,
 			u.full_name as author_name, u.email as author_email,
-			CASE WHEN ar.id IS NOT NULL THEN true ELSE false END as is_read
+			CASE WHEN ar.id IS NOT NULL THEN true ELSE false END as is_read,
+			a.cascade_to_children, t.name as tenant_name
 		FROM announcements a
+		INNER JOIN tenants t ON a.tenant_id = t.id
 		LEFT JOIN users u ON a.author_id = u.id
 		LEFT JOIN announcement_reads ar ON a.id = ar.announcement_id AND ar.user_id = $1
-		WHERE a.id = $2 AND a.tenant_id = $3 AND a.deleted_at IS NULL
+		WHERE a.id = $2 AND `+announcementVisibleIn("$3")+` AND a.deleted_at IS NULL
 	`, userID, announcementID, tenantID).Scan(
 		&ann.ID, &ann.TenantID, &ann.AuthorID, &ann.Title, &ann.Content, &ann.Priority,
 		&category, &ann.IsPinned, &ann.SentNotification, &ann.SentWhatsApp,
 		&sentAt, &expiresAt, &metadata, &ann.CreatedAt, &ann.UpdatedAt,
 		&ann.AuthorName, &ann.AuthorEmail, &isRead,
+		&ann.CascadeToChildren, &tenantName,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -188,7 +209,7 @@ func GetAnnouncement(c echo.Context) error {
 
 	// Mark as read if not already read
 	if !isRead {
-		_, _ = db.DB.Exec(`
+		_, _ = tdb.Exec(`
 			INSERT INTO announcement_reads (announcement_id, user_id)
 			VALUES ($1, $2)
 			ON CONFLICT (announcement_id, user_id) DO NOTHING
@@ -196,16 +217,21 @@ func GetAnnouncement(c echo.Context) error {
 	}
 
 	annData := map[string]interface{}{
-		"id":                ann.ID,
-		"title":             ann.Title,
-		"content":           ann.Content,
-		"priority":          ann.Priority,
-		"is_pinned":         ann.IsPinned,
-		"sent_notification": ann.SentNotification,
-		"sent_whatsapp":     ann.SentWhatsApp,
-		"created_at":        ann.CreatedAt.Format(time.RFC3339),
-		"updated_at":        ann.UpdatedAt.Format(time.RFC3339),
-		"is_read":           true, // Marked as read
+		"id":                  ann.ID,
+		"title":               ann.Title,
+		"content":             ann.Content,
+		"priority":            ann.Priority,
+		"is_pinned":           ann.IsPinned,
+		"sent_notification":   ann.SentNotification,
+		"sent_whatsapp":       ann.SentWhatsApp,
+		"created_at":          ann.CreatedAt.Format(time.RFC3339),
+		"updated_at":          ann.UpdatedAt.Format(time.RFC3339),
+		"is_read":             true, // Marked as read
+		"cascade_to_children": ann.CascadeToChildren,
+		"from_parent":         ann.TenantID != tenantID,
+	}
+	if ann.TenantID != tenantID {
+		annData["tenant_name"] = tenantName
 	}
 
 	if category.Valid {
@@ -230,6 +256,7 @@ func GetAnnouncement(c echo.Context) error {
 // CreateAnnouncement creates a new announcement (admin/sekretariat only)
 func CreateAnnouncement(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Get(string(middleware.CtxUserID)).(string)
 
 	req := new(models.CreateAnnouncementRequest)
@@ -255,6 +282,13 @@ func CreateAnnouncement(c echo.Context) error {
 		isPinned = *req.IsPinned
 	}
 
+	cascade := req.CascadeToChildren != nil && *req.CascadeToChildren
+	if cascade {
+		if status, message := requireRWTenant(tenantID); status != 0 {
+			return c.JSON(status, map[string]string{"error": message})
+		}
+	}
+
 	// Parse expires_at if provided
 	var expiresAt sql.NullTime
 	if req.ExpiresAt != nil && *req.ExpiresAt != "" {
@@ -268,8 +302,9 @@ func CreateAnnouncement(c echo.Context) error {
 	// Create announcement
 	announcementID := uuid.New().String()
 	query := `
-		INSERT INTO announcements (id, tenant_id, author_id, title, content, priority, category, is_pinned, expires_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		INSERT INTO announcements (id, tenant_id, author_id, title, content, priority, category, is_pinned, expires_at,
+		                           cascade_to_children)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 		RETURNING id, created_at
 	`
 
@@ -284,9 +319,9 @@ func CreateAnnouncement(c echo.Context) error {
 		categoryValue = nil
 	}
 	
-	err := db.DB.QueryRow(query,
+	err := tdb.QueryRow(query,
 		announcementID, tenantID, userID, req.Title, req.Content, priority,
-		categoryValue, isPinned, expiresAt,
+		categoryValue, isPinned, expiresAt, cascade,
 	).Scan(&returnedID, &createdAt)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create announcement: " + err.Error()})
@@ -302,6 +337,7 @@ func CreateAnnouncement(c echo.Context) error {
 // UpdateAnnouncement updates an announcement
 func UpdateAnnouncement(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	announcementID := c.Param("announcement_id")
 
 	req := new(models.UpdateAnnouncementRequest)
@@ -311,7 +347,7 @@ func UpdateAnnouncement(c echo.Context) error {
 
 	// Check if announcement exists and belongs to tenant
 	var exists bool
-	err := db.DB.Get(&exists, `
+	err := tdb.Get(&exists, `
 		SELECT EXISTS(
 			SELECT 1 FROM announcements 
 			WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
@@ -358,6 +394,16 @@ func UpdateAnnouncement(c echo.Context) error {
 		args = append(args, *req.IsPinned)
 		argIndex++
 	}
+	if req.CascadeToChildren != nil {
+		if *req.CascadeToChildren {
+			if status, message := requireRWTenant(tenantID); status != 0 {
+				return c.JSON(status, map[string]string{"error": message})
+			}
+		}
+		updates = append(updates, "cascade_to_children = $"+strconv.Itoa(argIndex))
+		args = append(args, *req.CascadeToChildren)
+		argIndex++
+	}
 	if req.ExpiresAt != nil {
 		if *req.ExpiresAt == "" {
 			updates = append(updates, "expires_at = NULL")
@@ -385,7 +431,7 @@ func UpdateAnnouncement(c echo.Context) error {
 	query += ` WHERE id = $` + strconv.Itoa(argIndex) + ` AND tenant_id = $` + strconv.Itoa(argIndex+1)
 	args = append(args, announcementID, tenantID)
 
-	_, err = db.DB.Exec(query, args...)
+	_, err = tdb.Exec(query, args...)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update announcement: " + err.Error()})
 	}
@@ -399,11 +445,12 @@ func UpdateAnnouncement(c echo.Context) error {
 // DeleteAnnouncement deletes an announcement (soft delete)
 func DeleteAnnouncement(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	announcementID := c.Param("announcement_id")
 
 	// Check if announcement exists and belongs to tenant
 	var exists bool
-	err := db.DB.Get(&exists, `
+	err := tdb.Get(&exists, `
 		SELECT EXISTS(
 			SELECT 1 FROM announcements 
 			WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
@@ -417,7 +464,7 @@ func DeleteAnnouncement(c echo.Context) error {
 	}
 
 	// Soft delete
-	_, err = db.DB.Exec(`
+	_, err = tdb.Exec(`
 		UPDATE announcements 
 		SET deleted_at = CURRENT_TIMESTAMP 
 		WHERE id = $1 AND tenant_id = $2
@@ -430,3 +477,116 @@ func DeleteAnnouncement(c echo.Context) error {
 		"message": "Announcement deleted successfully",
 	})
 }
+
+// BroadcastAnnouncement sends an announcement to every active resident with a phone number over WhatsApp or SMS.
+// Each broadcast counts towards the plan's monthly limit of paid announcements.
+func BroadcastAnnouncement(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+	announcementID := c.Param("announcement_id")
+
+	req := new(models.BroadcastAnnouncementRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	if req.Channel == "" {
+		req.Channel = "whatsapp"
+	}
+	if req.Channel != "whatsapp" && req.Channel != "sms" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "channel must be whatsapp or sms"})
+	}
+
+	var ann models.Announcement
+	err := tdb.Get(&ann, `
+		SELECT id, tenant_id, title, content FROM announcements
+		WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
+	`, announcementID, tenantID)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Announcement not found"})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	channel, err := services.GetChannel(req.Channel)
+	if err != nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "Channel " + req.Channel + " is not configured"})
+	}
+
+	var recipients []struct {
+		UserID string `db:"id"`
+		Phone  string `db:"phone"`
+	}
+	err = tdb.Select(&recipients, `
+		SELECT u.id, u.phone
+		FROM tenant_users tu
+		INNER JOIN users u ON tu.user_id = u.id
+		WHERE tu.tenant_id = $1 AND tu.status = 'active'
+		AND tu.deleted_at IS NULL AND u.deleted_at IS NULL
+		AND COALESCE(u.phone, '') <> ''
+	`, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch recipients"})
+	}
+	if len(recipients) == 0 {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": "No residents have a phone number"})
+	}
+
+	// The broadcast is recorded before sending, in the transaction that checks the quota,
+	// so concurrent broadcasts cannot both pass the check
+	tx, err := tdb.Beginx()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
+	}
+	defer tx.Rollback()
+
+	quota, err := services.CheckQuota(tx, tenantID, services.QuotaPaidAnnouncements, 1)
+	if err != nil {
+		return quotaErrorResponse(c, err)
+	}
+	var broadcast models.AnnouncementBroadcast
+	err = tx.Get(&broadcast, `
+		INSERT INTO announcement_broadcasts (tenant_id, announcement_id, channel, recipients, delivered, sent_by)
+		VALUES ($1, $2, $3, $4, 0, $5)
+		RETURNING id, tenant_id, announcement_id, channel, recipients, delivered, sent_by, created_at
+	`, tenantID, ann.ID, req.Channel, len(recipients), userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to record broadcast"})
+	}
+	if err = tx.Commit(); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit transaction"})
+	}
+
+	delivered := 0
+	for _, r := range recipients {
+		err := channel.Send(services.Message{
+			TenantID:  tenantID,
+			UserID:    r.UserID,
+			Recipient: r.Phone,
+			Subject:   ann.Title,
+			Body:      ann.Title + "\n\n" + ann.Content,
+		})
+		if err != nil {
+			c.Logger().Warnf("Failed to send announcement %s to %s: %v", ann.ID, r.Phone, err)
+			continue
+		}
+		delivered++
+	}
+
+	broadcast.Delivered = delivered
+	_, err = tdb.Exec(`UPDATE announcement_broadcasts SET delivered = $1 WHERE id = $2`, delivered, broadcast.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to record broadcast"})
+	}
+	_, err = tdb.Exec(`
+		UPDATE announcements
+		SET sent_whatsapp = sent_whatsapp OR $1, sent_at = NOW(), updated_at = NOW()
+		WHERE id = $2 AND tenant_id = $3
+	`, req.Channel == "whatsapp", ann.ID, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update announcement"})
+	}
+
+	setQuotaWarning(c, quota, 1)
+	return c.JSON(http.StatusOK, broadcast)
+}
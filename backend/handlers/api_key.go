@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+	"rukunos-backend/middleware"
+	"rukunos-backend/models"
+
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+const apiKeyColumns = `id, tenant_id, name, key_prefix, permissions, created_by, expires_at, last_used_at, last_used_ip,
+	revoked_at, revoked_by, created_at`
+
+// ListAPIKeys lists the tenant's API keys (the keys themselves are never shown again)
+func ListAPIKeys(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+
+	keys := []models.APIKey{}
+	err := middleware.TenantDB(c).Select(&keys, `
+		SELECT `+apiKeyColumns+`
+		FROM api_keys
+		WHERE tenant_id = $1
+		ORDER BY revoked_at IS NOT NULL, created_at DESC
+	`, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch API keys"})
+	}
+
+	return c.JSON(http.StatusOK, keys)
+}
+
+// CreateAPIKey creates a key limited to a subset of the creator's permissions and returns it once
+func CreateAPIKey(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+
+	req := new(models.CreateAPIKeyRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "name is required"})
+	}
+	if len(req.Permissions) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "permissions must not be empty"})
+	}
+
+	// A key can never do more than the person creating it
+	ownPermissions, _ := c.Get(string(middleware.CtxUserPermissions)).([]string)
+	granted := make(map[string]bool, len(ownPermissions))
+	for _, p := range ownPermissions {
+		granted[p] = true
+	}
+	seen := map[string]bool{}
+	permissions := []string{}
+	for _, p := range req.Permissions {
+		if !granted[p] {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "You cannot grant a permission you do not have: " + p})
+		}
+		if !seen[p] {
+			seen[p] = true
+			permissions = append(permissions, p)
+		}
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays != nil {
+		if *req.ExpiresInDays < 1 || *req.ExpiresInDays > 730 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "expires_in_days must be between 1 and 730"})
+		}
+		t := time.Now().Add(time.Duration(*req.ExpiresInDays) * 24 * time.Hour)
+		expiresAt = &t
+	}
+
+	secret, _, err := newSecureToken()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate API key"})
+	}
+	key := middleware.APIKeyPrefix + secret
+	keyPrefix := key[:len(middleware.APIKeyPrefix)+8]
+
+	var apiKey models.APIKey
+	err = middleware.TenantDB(c).Get(&apiKey, `
+		INSERT INTO api_keys (tenant_id, name, key_prefix, key_hash, permissions, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+apiKeyColumns,
+		tenantID, req.Name, keyPrefix, hashToken(key), pq.Array(permissions), userID, expiresAt)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create API key"})
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"api_key": apiKey,
+		"key":     key,
+		"message": "Store this key now, it will not be shown again",
+	})
+}
+
+// RevokeAPIKey permanently disables a key
+func RevokeAPIKey(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+
+	var apiKey models.APIKey
+	err := middleware.TenantDB(c).Get(&apiKey, `
+		UPDATE api_keys SET revoked_at = NOW(), revoked_by = $1
+		WHERE id = $2 AND tenant_id = $3 AND revoked_at IS NULL
+		RETURNING `+apiKeyColumns,
+		userID, c.Param("key_id"), tenantID)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "API key not found or already revoked"})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to revoke API key"})
+	}
+
+	return c.JSON(http.StatusOK, apiKey)
+}
@@ -3,13 +3,11 @@ package handlers
 import (
 	"database/sql"
 	"net/http"
-	"os"
 	"strings"
-	"time"
+	"sync"
 	"rukunos-backend/db"
 	"rukunos-backend/models"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -56,6 +54,7 @@ func Register(c echo.Context) error {
 	var tenantID string
 	var roleID string
 	var tenantName string
+	emailVerified := false
 
 	if req.RegistrationType == "tenant" {
 		// Register as Tenant - create new tenant and assign Admin role
@@ -104,6 +103,13 @@ func Register(c echo.Context) error {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create default roles: " + err.Error()})
 		}
 
+		// Create default billing reminder rules for the new tenant
+		_, err = tx.Exec(`SELECT create_default_reminder_rules_for_tenant($1)`, tenantID)
+		if err != nil {
+			tx.Rollback()
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create default reminder rules: " + err.Error()})
+		}
+
 		// Get Admin role for the new tenant
 		err = tx.Get(&roleID, `
 			SELECT id FROM roles 
@@ -117,8 +123,31 @@ func Register(c echo.Context) error {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to find Admin role"})
 		}
 
+	} else if req.InvitationToken != nil && *req.InvitationToken != "" {
+		// Register as Warga with an invitation - join immediately with the invited unit and role
+		invitation, status, message := lockUsableInvitation(tx, *req.InvitationToken)
+		if status != 0 {
+			return c.JSON(status, map[string]string{"error": message})
+		}
+		roleID, status, message = joinWithInvitation(tx, invitation, user.ID, user.Email)
+		if status != 0 {
+			return c.JSON(status, map[string]string{"error": message})
+		}
+		tenantID = invitation.TenantID
+		if err = tx.Get(&tenantName, `SELECT name FROM tenants WHERE id = $1`, tenantID); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to find tenant"})
+		}
+
+		// A personal invitation was delivered to this address, so it is verified
+		if invitation.Email.Valid {
+			_, err = tx.Exec(`UPDATE users SET email_verified_at = NOW() WHERE id = $1`, user.ID)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to verify email"})
+			}
+			emailVerified = true
+		}
 	} else {
-		// Register as Warga - join existing tenant with code
+		// Register as Warga with the tenant code - wait in the join request queue for admin approval
 		var tenantCode string
 		if req.TenantCodeJoin != nil && *req.TenantCodeJoin != "" {
 			tenantCode = strings.ToUpper(*req.TenantCodeJoin)
@@ -144,28 +173,41 @@ func Register(c echo.Context) error {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to find tenant"})
 		}
 
-		// Get Warga role for the tenant
-		err = tx.Get(&roleID, `
-			SELECT id FROM roles 
-			WHERE tenant_id = $1 
-			AND name = 'Warga' 
-			AND is_system = true 
-			AND deleted_at IS NULL
-		`, tenantID)
-		if err != nil {
-			tx.Rollback()
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to find Warga role"})
+		joinRequest, status, message := createJoinRequest(tx, tenantID, user.ID, req.JoinMessage)
+		if status != 0 {
+			return c.JSON(status, map[string]string{"error": message})
+		}
+
+		if err = tx.Commit(); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit transaction"})
+		}
+
+		if err := sendVerificationEmail(user.ID, user.Email, user.FullName); err != nil {
+			c.Logger().Errorf("Failed to send verification email to %s: %v", user.Email, err)
 		}
+
+		// No session yet: the account can sign in once an admin approves the request
+		return c.JSON(http.StatusAccepted, map[string]interface{}{
+			"message":      "Registration received. You can sign in once an admin of " + tenantName + " approves your request.",
+			"join_request": joinRequest,
+			"user": map[string]interface{}{
+				"id":        user.ID,
+				"email":     user.Email,
+				"full_name": user.FullName,
+			},
+		})
 	}
 
-	// Add user to tenant with assigned role
-	_, err = tx.Exec(`
-		INSERT INTO tenant_users (tenant_id, user_id, role_id, status)
-		VALUES ($1, $2, $3, 'active')
-	`, tenantID, user.ID, roleID)
-	if err != nil {
-		tx.Rollback()
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to add user to tenant: " + err.Error()})
+	// Tenant founders join as Admin (invited warga were added by joinWithInvitation)
+	if req.RegistrationType == "tenant" {
+		_, err = tx.Exec(`
+			INSERT INTO tenant_users (tenant_id, user_id, role_id, status)
+			VALUES ($1, $2, $3, 'active')
+		`, tenantID, user.ID, roleID)
+		if err != nil {
+			tx.Rollback()
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to add user to tenant: " + err.Error()})
+		}
 	}
 
 	user.TenantID = &tenantID
@@ -176,22 +218,19 @@ func Register(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit transaction"})
 	}
 
-	// Generate JWT token
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
-	claims["user_id"] = user.ID
-	claims["tenant_id"] = tenantID
-	claims["exp"] = time.Now().Add(time.Hour * 72).Unix() // 3 days
-
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		jwtSecret = "secret" // Default for development only
+	// New accounts stay restricted until the email address is verified
+	if !emailVerified {
+		if err := sendVerificationEmail(user.ID, user.Email, user.FullName); err != nil {
+			c.Logger().Errorf("Failed to send verification email to %s: %v", user.Email, err)
+		}
 	}
 
-	t, err := token.SignedString([]byte(jwtSecret))
+	// Start a session (short-lived access token + refresh token)
+	session, err := issueSession(c, user.ID, tenantID)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate token"})
 	}
+	t := session.AccessToken
 
 	// Get user permissions
 	permissions, _ := GetUserPermissions(user.ID, tenantID)
@@ -224,13 +263,29 @@ func Register(c echo.Context) error {
 		"role_id":     roleID,
 		"role_name":   roleName,
 		"permissions": permissions,
+		"email_verified": emailVerified,
 	}
 
 	return c.JSON(http.StatusCreated, map[string]interface{}{
-		"token": t,
-		"user":  userWithTenant,
-		"tenant_id": tenantID,
+		"token":         t,
+		"refresh_token": session.RefreshToken,
+		"expires_in":    session.ExpiresIn,
+		"user":          userWithTenant,
+		"tenant_id":     tenantID,
+	})
+}
+
+var (
+	dummyPasswordHash     []byte
+	dummyPasswordHashOnce sync.Once
+)
+
+// compareDummyPassword spends the time of a real password check, so unknown emails are not answered faster
+func compareDummyPassword(password string) {
+	dummyPasswordHashOnce.Do(func() {
+		dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("rukunos-dummy-password"), bcrypt.DefaultCost)
 	})
+	bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
 }
 
 func Login(c echo.Context) error {
@@ -244,7 +299,7 @@ func Login(c echo.Context) error {
 	var googleID sql.NullString
 	var authProvider sql.NullString
 	var status sql.NullString
-	query := `SELECT id, email, password_hash, full_name, google_id, auth_provider, status
+	query := `SELECT id, email, COALESCE(password_hash, ''), full_name, google_id, auth_provider, status
 	          FROM users 
 	          WHERE email = $1 
 	          AND deleted_at IS NULL
@@ -253,7 +308,17 @@ func Login(c echo.Context) error {
 		&user.ID, &user.Email, &user.PasswordHash, &user.FullName, 
 		&googleID, &authProvider, &status)
 	if err == sql.ErrNoRows {
-		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "User belum terdaftar"})
+		// Answer exactly like a wrong password, so the response does not tell which emails have an account
+		compareDummyPassword(req.Password)
+		if until, err := getLoginLockout().LockedUntil(emailLockoutID(req.Email)); err != nil {
+			c.Logger().Warnf("Failed to check login lockout for email: %v", err)
+		} else if !until.IsZero() {
+			return lockedOutResponse(c, until)
+		}
+		if _, _, err := getLoginLockout().Fail(emailLockoutID(req.Email)); err != nil {
+			c.Logger().Warnf("Failed to record login failure for email: %v", err)
+		}
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid credentials"})
 	} else if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
 	}
@@ -278,50 +343,89 @@ func Login(c echo.Context) error {
 		return c.JSON(http.StatusForbidden, map[string]string{"error": "User account is inactive"})
 	}
 
+	// Refuse while the account is locked, before looking at the password
+	if until, err := getLoginLockout().LockedUntil(lockoutID(user.ID)); err != nil {
+		c.Logger().Warnf("Failed to check login lockout for user %s: %v", user.ID, err)
+	} else if !until.IsZero() {
+		return lockedOutResponse(c, until)
+	}
+
 	// Check password
 	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password))
 	if err != nil {
+		recordLoginFailure(c, user)
 		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid credentials"})
 	}
+	if err := getLoginLockout().Succeed(lockoutID(user.ID)); err != nil {
+		c.Logger().Warnf("Failed to reset login failures for user %s: %v", user.ID, err)
+	}
 
-	// Get user's tenants
-	var tenantIDs []string
-	err = db.DB.Select(&tenantIDs, `
-		SELECT tenant_id 
-		FROM tenant_users 
-		WHERE user_id = $1 
-		AND deleted_at IS NULL 
-		AND status = 'active'
-	`, user.ID)
+	return completeLogin(c, user, req.TenantID)
+}
+
+// completeLogin selects the tenant, starts a session (or a second-factor challenge) and writes the login response.
+// It is shared by every login method once the user has been authenticated.
+func completeLogin(c echo.Context, user models.User, requestedTenantID *string) error {
+	status, response := buildLoginResponse(c, user, requestedTenantID)
+	return c.JSON(status, response)
+}
+
+// buildLoginResponse returns the HTTP status and body of a successful first login step
+func buildLoginResponse(c echo.Context, user models.User, requestedTenantID *string) (int, map[string]interface{}) {
+	// Get user's tenants (default tenant first)
+	tenantIDs, err := activeTenantIDs(user.ID)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get user tenants"})
+		return http.StatusInternalServerError, map[string]interface{}{"error": "Failed to get user tenants"}
 	}
 
 	if len(tenantIDs) == 0 {
-		return c.JSON(http.StatusForbidden, map[string]string{"error": "User is not a member of any tenant"})
+		if pending, err := hasPendingJoinRequest(user.ID); err == nil && pending {
+			return http.StatusForbidden, map[string]interface{}{
+				"error":                "Your request to join is waiting for admin approval",
+				"join_request_pending": true,
+			}
+		}
+		return http.StatusForbidden, map[string]interface{}{"error": "User is not a member of any tenant"}
 	}
 
 	// Determine which tenant to use
 	var selectedTenantID string
-	if req.TenantID != nil {
+	if requestedTenantID != nil {
 		// Check if user is member of requested tenant
 		for _, tid := range tenantIDs {
-			if tid == *req.TenantID {
+			if tid == *requestedTenantID {
 				selectedTenantID = tid
 				break
 			}
 		}
 		if selectedTenantID == "" {
-			return c.JSON(http.StatusForbidden, map[string]string{"error": "User is not a member of the specified tenant"})
+			return http.StatusForbidden, map[string]interface{}{"error": "User is not a member of the specified tenant"}
 		}
 	} else {
-		// Use first tenant (or primary tenant in future)
+		// Use the default tenant, or the oldest membership
 		selectedTenantID = tenantIDs[0]
 	}
 
+	// Accounts with 2FA (or whose role requires it in this tenant) must pass a second step first
+	challenge, err := startMFAChallenge(user.ID, selectedTenantID)
+	if err != nil {
+		return http.StatusInternalServerError, map[string]interface{}{"error": "Failed to start two-factor challenge"}
+	}
+	if challenge != nil {
+		if len(tenantIDs) > 1 {
+			challenge["tenants"] = tenantIDs
+		}
+		return http.StatusOK, challenge
+	}
+
+	return sessionLoginResponse(c, user, selectedTenantID, tenantIDs)
+}
+
+// sessionLoginResponse starts a session in the selected tenant and builds the token response
+func sessionLoginResponse(c echo.Context, user models.User, selectedTenantID string, tenantIDs []string) (int, map[string]interface{}) {
 	// Get user's role in selected tenant
 	var roleID sql.NullString
-	err = db.DB.Get(&roleID, `
+	err := db.DB.Get(&roleID, `
 		SELECT role_id 
 		FROM tenant_users 
 		WHERE user_id = $1 
@@ -329,28 +433,18 @@ func Login(c echo.Context) error {
 		AND deleted_at IS NULL
 	`, user.ID, selectedTenantID)
 	if err != nil && err != sql.ErrNoRows {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get user role"})
+		return http.StatusInternalServerError, map[string]interface{}{"error": "Failed to get user role"}
 	}
 	if roleID.Valid {
 		user.RoleID = &roleID.String
 	}
 
-	// Generate JWT with tenant_id
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
-	claims["user_id"] = user.ID
-	claims["tenant_id"] = selectedTenantID
-	claims["exp"] = time.Now().Add(time.Hour * 72).Unix() // 3 days
-
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		jwtSecret = "secret" // Default for development only
-	}
-
-	t, err := token.SignedString([]byte(jwtSecret))
+	// Start a session bound to the selected tenant
+	session, err := issueSession(c, user.ID, selectedTenantID)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate token"})
+		return http.StatusInternalServerError, map[string]interface{}{"error": "Failed to generate token"}
 	}
+	t := session.AccessToken
 
 	// Get tenant name
 	var tenantName string
@@ -384,13 +478,15 @@ func Login(c echo.Context) error {
 	}
 
 	response := map[string]interface{}{
-		"token":     t,
-		"user":      userWithTenant,
-		"tenant_id": selectedTenantID,
+		"token":         t,
+		"refresh_token": session.RefreshToken,
+		"expires_in":    session.ExpiresIn,
+		"user":          userWithTenant,
+		"tenant_id":     selectedTenantID,
 	}
 	if len(tenantIDs) > 1 {
 		response["tenants"] = tenantIDs
 	}
 
-	return c.JSON(http.StatusOK, response)
+	return http.StatusOK, response
 }
@@ -8,6 +8,7 @@ import (
 	"rukunos-backend/db"
 	"rukunos-backend/middleware"
 	"rukunos-backend/models"
+	"rukunos-backend/services"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -16,6 +17,7 @@ import (
 // ListBills lists all bills for the tenant (admin) or current user (warga)
 func ListBills(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Get(string(middleware.CtxUserID)).(string)
 
 	// Get query parameters
@@ -27,9 +29,7 @@ func ListBills(c echo.Context) error {
 	if limit < 1 {
 		limit = 20
 	}
-	status := c.QueryParam("status")
-	unitID := c.QueryParam("unit_id")
-	search := c.QueryParam("search")
+	filter := billFilterFromQuery(c)
 
 	offset := (page - 1) * limit
 
@@ -45,59 +45,16 @@ func ListBills(c echo.Context) error {
 		INNER JOIN units u ON b.unit_id = u.id
 		WHERE b.tenant_id = $1 AND b.deleted_at IS NULL
 	`
-	args := []interface{}{tenantID}
-	argIndex := 2
-
-	// Filter by user (for warga - only show their bills)
-	// Check if user has permission to view all bills (admin/bendahara)
-	// For now, if status is not provided and user is not admin, filter by user's unit
-	var isAdmin bool
-	err := db.DB.Get(&isAdmin, `
-		SELECT EXISTS(
-			SELECT 1 FROM tenant_users tu
-			JOIN roles r ON tu.role_id = r.id
-			WHERE tu.user_id = $1 AND tu.tenant_id = $2
-			AND (r.name = 'Admin' OR r.name = 'Bendahara')
-			AND tu.deleted_at IS NULL AND r.deleted_at IS NULL
-		)
-	`, userID, tenantID)
-	if err == nil && !isAdmin {
-		// Filter by user's unit
-		var userUnitID sql.NullString
-		err = db.DB.Get(&userUnitID, `
-			SELECT unit_id FROM tenant_users
-			WHERE user_id = $1 AND tenant_id = $2 AND deleted_at IS NULL
-		`, userID, tenantID)
-		if err == nil && userUnitID.Valid {
-			query += ` AND b.unit_id = $` + strconv.Itoa(argIndex)
-			args = append(args, userUnitID.String)
-			argIndex++
-		}
-	}
-
-	if status != "" {
-		query += ` AND b.status = $` + strconv.Itoa(argIndex)
-		args = append(args, status)
-		argIndex++
-	}
-
-	if unitID != "" {
-		query += ` AND b.unit_id = $` + strconv.Itoa(argIndex)
-		args = append(args, unitID)
-		argIndex++
-	}
-
-	if search != "" {
-		searchPattern := "%" + search + "%"
-		query += ` AND (u.code ILIKE $` + strconv.Itoa(argIndex) + ` OR b.category ILIKE $` + strconv.Itoa(argIndex) + `)`
-		args = append(args, searchPattern)
-		argIndex++
+	query, args, err := appendBillFilters(query, []interface{}{tenantID}, tenantID, userID, filter)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
 	}
+	argIndex := len(args) + 1
 
 	query += ` ORDER BY b.due_date DESC NULLS LAST, b.created_at DESC LIMIT $` + strconv.Itoa(argIndex) + ` OFFSET $` + strconv.Itoa(argIndex+1)
 	args = append(args, limit, offset)
 
-	rows, err := db.DB.Query(query, args...)
+	rows, err := tdb.Query(query, args...)
 	if err != nil {
 		c.Logger().Errorf("Error executing bills query: %v, query: %s, args: %v", err, query, args)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error: " + err.Error()})
@@ -170,41 +127,12 @@ func ListBills(c echo.Context) error {
 	countQuery := `SELECT COUNT(*) FROM bills b
 		INNER JOIN units u ON b.unit_id = u.id
 		WHERE b.tenant_id = $1 AND b.deleted_at IS NULL`
-	countArgs := []interface{}{tenantID}
-	countArgIndex := 2
-
-	if !isAdmin {
-		var userUnitID sql.NullString
-		err = db.DB.Get(&userUnitID, `
-			SELECT unit_id FROM tenant_users
-			WHERE user_id = $1 AND tenant_id = $2 AND deleted_at IS NULL
-		`, userID, tenantID)
-		if err == nil && userUnitID.Valid {
-			countQuery += ` AND b.unit_id = $` + strconv.Itoa(countArgIndex)
-			countArgs = append(countArgs, userUnitID.String)
-			countArgIndex++
-		}
-	}
-
-	if status != "" {
-		countQuery += ` AND b.status = $` + strconv.Itoa(countArgIndex)
-		countArgs = append(countArgs, status)
-		countArgIndex++
-	}
-	if unitID != "" {
-		countQuery += ` AND b.unit_id = $` + strconv.Itoa(countArgIndex)
-		countArgs = append(countArgs, unitID)
-		countArgIndex++
-	}
-	if search != "" {
-		searchPattern := "%" + search + "%"
-		countQuery += ` AND (u.code ILIKE $` + strconv.Itoa(countArgIndex) + ` OR b.category ILIKE $` + strconv.Itoa(countArgIndex) + `)`
-		countArgs = append(countArgs, searchPattern)
-		countArgIndex++
-	}
+	countQuery, countArgs, err := appendBillFilters(countQuery, []interface{}{tenantID}, tenantID, userID, filter)
 
 	var total int
-	err = db.DB.Get(&total, countQuery, countArgs...)
+	if err == nil {
+		err = tdb.Get(&total, countQuery, countArgs...)
+	}
 	if err != nil {
 		total = len(bills)
 	}
@@ -222,13 +150,86 @@ func ListBills(c echo.Context) error {
 	})
 }
 
+// billFilter holds the bill list filters shared by ListBills and the bill exports
+type billFilter struct {
+	Status string
+	UnitID string
+	Search string
+	Period string
+}
+
+func billFilterFromQuery(c echo.Context) billFilter {
+	return billFilter{
+		Status: c.QueryParam("status"),
+		UnitID: c.QueryParam("unit_id"),
+		Search: c.QueryParam("search"),
+		Period: c.QueryParam("period"),
+	}
+}
+
+// appendBillFilters adds the filter conditions to a query over "bills b INNER JOIN units u".
+// Users without the Admin or Bendahara role only see bills of their own unit, and none when they have no unit.
+func appendBillFilters(query string, args []interface{}, tenantID, userID string, filter billFilter) (string, []interface{}, error) {
+	tdb := db.ForTenant(tenantID)
+	var isAdmin bool
+	err := tdb.Get(&isAdmin, `
+		SELECT EXISTS(
+			SELECT 1 FROM tenant_users tu
+			JOIN roles r ON tu.role_id = r.id
+			WHERE tu.user_id = $1 AND tu.tenant_id = $2
+			AND (r.name = 'Admin' OR r.name = 'Bendahara')
+			AND tu.deleted_at IS NULL AND r.deleted_at IS NULL
+		)
+	`, userID, tenantID)
+	if err != nil {
+		return query, args, err
+	}
+	if !isAdmin {
+		// Filter by user's unit
+		var userUnitID sql.NullString
+		err = tdb.Get(&userUnitID, `
+			SELECT unit_id FROM tenant_users
+			WHERE user_id = $1 AND tenant_id = $2 AND deleted_at IS NULL
+		`, userID, tenantID)
+		if err != nil && err != sql.ErrNoRows {
+			return query, args, err
+		}
+		if !userUnitID.Valid {
+			query += ` AND false`
+		} else {
+			args = append(args, userUnitID.String)
+			query += ` AND b.unit_id = $` + strconv.Itoa(len(args))
+		}
+	}
+
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		query += ` AND b.status = $` + strconv.Itoa(len(args))
+	}
+	if filter.UnitID != "" {
+		args = append(args, filter.UnitID)
+		query += ` AND b.unit_id = $` + strconv.Itoa(len(args))
+	}
+	if filter.Period != "" {
+		args = append(args, filter.Period)
+		query += ` AND b.period = $` + strconv.Itoa(len(args))
+	}
+	if filter.Search != "" {
+		args = append(args, "%"+filter.Search+"%")
+		query += ` AND (u.code ILIKE $` + strconv.Itoa(len(args)) + ` OR b.category ILIKE $` + strconv.Itoa(len(args)) + `)`
+	}
+
+	return query, args, nil
+}
+
 // GetBill gets a bill by ID
 func GetBill(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	billID := c.Param("bill_id")
 
 	var bill models.Bill
-	err := db.DB.QueryRow(`
+	err := tdb.QueryRow(`
 		SELECT 
 			b.id, b.tenant_id, b.unit_id, b.category, b.period, b.amount, b.late_fee,
 			b.due_date, b.status, b.paid_at, b.payment_method, b.payment_reference,
@@ -292,6 +293,7 @@ func GetBill(c echo.Context) error {
 // CreateBill creates a new bill (admin/bendahara only)
 func CreateBill(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Get(string(middleware.CtxUserID)).(string)
 
 	req := new(models.CreateBillRequest)
@@ -301,7 +303,7 @@ func CreateBill(c echo.Context) error {
 
 	// Validate unit belongs to tenant
 	var unitExists bool
-	err := db.DB.Get(&unitExists, `
+	err := tdb.Get(&unitExists, `
 		SELECT EXISTS(
 			SELECT 1 FROM units 
 			WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
@@ -314,7 +316,7 @@ func CreateBill(c echo.Context) error {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "Unit not found"})
 	}
 
-	// Parse due date (optional)
+	// Parse due date (optional; defaults to the tenant's default due day of the period)
 	var dueDate sql.NullTime
 	if req.DueDate != nil && *req.DueDate != "" {
 		parsedDate, err := time.Parse("2006-01-02", *req.DueDate)
@@ -322,6 +324,8 @@ func CreateBill(c echo.Context) error {
 			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid due_date format. Use YYYY-MM-DD"})
 		}
 		dueDate = sql.NullTime{Time: parsedDate, Valid: true}
+	} else if settings, err := services.LoadTenantSettings(tenantID); err == nil {
+		dueDate = defaultDueDate(req.Period, settings)
 	}
 
 	lateFee := 0.0
@@ -350,7 +354,7 @@ func CreateBill(c echo.Context) error {
 	
 	var createdAt time.Time
 	var returnedBillID string
-	err = db.DB.QueryRow(query, args...).Scan(&returnedBillID, &createdAt)
+	err = tdb.QueryRow(query, args...).Scan(&returnedBillID, &createdAt)
 	if returnedBillID != "" {
 		billID = returnedBillID
 	}
@@ -367,6 +371,7 @@ func CreateBill(c echo.Context) error {
 // BulkCreateBills creates multiple bills at once (for mass generation)
 func BulkCreateBills(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Get(string(middleware.CtxUserID)).(string)
 
 	var req struct {
@@ -396,7 +401,7 @@ func BulkCreateBills(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "unit_ids is required and must contain at least one unit"})
 	}
 
-	// Parse due date (optional)
+	// Parse due date (optional; defaults to the tenant's default due day of the period)
 	var dueDate sql.NullTime
 	if req.DueDate != nil && *req.DueDate != "" {
 		parsedDate, err := time.Parse("2006-01-02", *req.DueDate)
@@ -404,6 +409,8 @@ func BulkCreateBills(c echo.Context) error {
 			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid due_date format. Use YYYY-MM-DD"})
 		}
 		dueDate = sql.NullTime{Time: parsedDate, Valid: true}
+	} else if settings, err := services.LoadTenantSettings(tenantID); err == nil {
+		dueDate = defaultDueDate(req.Period, settings)
 	}
 
 	lateFee := 0.0
@@ -412,7 +419,7 @@ func BulkCreateBills(c echo.Context) error {
 	}
 
 	// Start transaction
-	tx, err := db.DB.Beginx()
+	tx, err := tdb.Beginx()
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
 	}
@@ -485,6 +492,7 @@ func BulkCreateBills(c echo.Context) error {
 // UpdateBill updates a bill
 func UpdateBill(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	billID := c.Param("bill_id")
 
 	req := new(models.UpdateBillRequest)
@@ -494,7 +502,7 @@ func UpdateBill(c echo.Context) error {
 
 	// Check if bill exists and belongs to tenant
 	var exists bool
-	err := db.DB.Get(&exists, `
+	err := tdb.Get(&exists, `
 		SELECT EXISTS(
 			SELECT 1 FROM bills 
 			WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
@@ -570,7 +578,7 @@ func UpdateBill(c echo.Context) error {
 	}
 	query += " WHERE id = $" + strconv.Itoa(argIndex) + " AND tenant_id = $" + strconv.Itoa(argIndex+1)
 
-	_, err = db.DB.Exec(query, args...)
+	_, err = tdb.Exec(query, args...)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update bill: " + err.Error()})
 	}
@@ -581,11 +589,12 @@ func UpdateBill(c echo.Context) error {
 // DeleteBill deletes a bill (soft delete)
 func DeleteBill(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	billID := c.Param("bill_id")
 
 	// Check if bill exists and belongs to tenant
 	var exists bool
-	err := db.DB.Get(&exists, `
+	err := tdb.Get(&exists, `
 		SELECT EXISTS(
 			SELECT 1 FROM bills 
 			WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
@@ -599,7 +608,7 @@ func DeleteBill(c echo.Context) error {
 	}
 
 	// Soft delete
-	_, err = db.DB.Exec(`
+	_, err = tdb.Exec(`
 		UPDATE bills 
 		SET deleted_at = NOW(), updated_at = NOW()
 		WHERE id = $1 AND tenant_id = $2
@@ -616,6 +625,7 @@ func DeleteBill(c echo.Context) error {
 // ProcessPayment processes a payment for a bill
 func ProcessPayment(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	billID := c.Param("bill_id")
 
 	req := new(models.ProcessPaymentRequest)
@@ -626,7 +636,7 @@ func ProcessPayment(c echo.Context) error {
 	// Check if bill exists and belongs to tenant
 	var billStatus string
 	var billAmount float64
-	err := db.DB.QueryRow(`
+	err := tdb.QueryRow(`
 		SELECT status, amount FROM bills 
 		WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
 	`, billID, tenantID).Scan(&billStatus, &billAmount)
@@ -646,7 +656,7 @@ func ProcessPayment(c echo.Context) error {
 		paymentRef = *req.PaymentReference
 	}
 
-	_, err = db.DB.Exec(`
+	_, err = tdb.Exec(`
 		UPDATE bills 
 		SET status = 'paid', 
 		    paid_at = NOW(),
@@ -659,6 +669,16 @@ func ProcessPayment(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process payment: " + err.Error()})
 	}
 
+	// Close any open dunning escalation for this bill
+	_, err = tdb.Exec(`
+		UPDATE treasurer_tasks
+		SET status = 'done', resolved_at = NOW(), notes = COALESCE(notes, 'Tagihan telah dibayar'), updated_at = NOW()
+		WHERE bill_id = $1 AND tenant_id = $2 AND status IN ('open', 'in_progress')
+	`, billID, tenantID)
+	if err != nil {
+		c.Logger().Warnf("Failed to close treasurer tasks for bill %s: %v", billID, err)
+	}
+
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message": "Payment processed successfully",
 		"id":      billID,
@@ -0,0 +1,393 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"rukunos-backend/middleware"
+	"rukunos-backend/models"
+	"rukunos-backend/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ListBillingReminderRules lists the reminder (dunning) rules of the tenant ordered by offset
+func ListBillingReminderRules(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
+
+	rules := []models.BillingReminderRule{}
+	err := tdb.Select(&rules, `
+		SELECT id, tenant_id, name, offset_days, channel, message_template, is_final, is_active, created_at, updated_at
+		FROM billing_reminder_rules
+		WHERE tenant_id = $1 AND deleted_at IS NULL
+		ORDER BY offset_days ASC
+	`, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch reminder rules: " + err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"rules":    rules,
+		"channels": services.ChannelNames(),
+	})
+}
+
+// CreateBillingReminderRule creates a reminder rule for the tenant
+func CreateBillingReminderRule(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
+
+	req := new(models.CreateBillingReminderRuleRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	if req.Name == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "name is required"})
+	}
+	if req.OffsetDays < -60 || req.OffsetDays > 365 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "offset_days must be between -60 and 365"})
+	}
+
+	channel := "log"
+	if req.Channel != nil && *req.Channel != "" {
+		channel = *req.Channel
+	}
+	if _, err := services.GetChannel(channel); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	isFinal := false
+	if req.IsFinal != nil {
+		isFinal = *req.IsFinal
+	}
+	isActive := true
+	if req.IsActive != nil {
+		isActive = *req.IsActive
+	}
+
+	// Check if a rule with the same offset already exists
+	var exists bool
+	err := tdb.Get(&exists, `
+		SELECT EXISTS(
+			SELECT 1 FROM billing_reminder_rules
+			WHERE tenant_id = $1 AND offset_days = $2 AND deleted_at IS NULL
+		)
+	`, tenantID, req.OffsetDays)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if exists {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "A reminder rule with this offset_days already exists"})
+	}
+
+	var rule models.BillingReminderRule
+	err = tdb.QueryRowx(`
+		INSERT INTO billing_reminder_rules (tenant_id, name, offset_days, channel, message_template, is_final, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, tenant_id, name, offset_days, channel, message_template, is_final, is_active, created_at, updated_at
+	`, tenantID, req.Name, req.OffsetDays, channel, req.MessageTemplate, isFinal, isActive).StructScan(&rule)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create reminder rule: " + err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateBillingReminderRule updates a reminder rule
+func UpdateBillingReminderRule(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
+	ruleID := c.Param("rule_id")
+
+	req := new(models.UpdateBillingReminderRuleRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	var exists bool
+	err := tdb.Get(&exists, `
+		SELECT EXISTS(
+			SELECT 1 FROM billing_reminder_rules
+			WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
+		)
+	`, ruleID, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if !exists {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Reminder rule not found"})
+	}
+
+	// Build update query dynamically
+	updates := []string{}
+	args := []interface{}{}
+	argIndex := 1
+
+	if req.Name != nil {
+		if *req.Name == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "name cannot be empty"})
+		}
+		updates = append(updates, "name = $"+strconv.Itoa(argIndex))
+		args = append(args, *req.Name)
+		argIndex++
+	}
+	if req.OffsetDays != nil {
+		if *req.OffsetDays < -60 || *req.OffsetDays > 365 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "offset_days must be between -60 and 365"})
+		}
+		var taken bool
+		err = tdb.Get(&taken, `
+			SELECT EXISTS(
+				SELECT 1 FROM billing_reminder_rules
+				WHERE tenant_id = $1 AND offset_days = $2 AND id != $3 AND deleted_at IS NULL
+			)
+		`, tenantID, *req.OffsetDays, ruleID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		if taken {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "A reminder rule with this offset_days already exists"})
+		}
+		updates = append(updates, "offset_days = $"+strconv.Itoa(argIndex))
+		args = append(args, *req.OffsetDays)
+		argIndex++
+	}
+	if req.Channel != nil {
+		if _, err := services.GetChannel(*req.Channel); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		updates = append(updates, "channel = $"+strconv.Itoa(argIndex))
+		args = append(args, *req.Channel)
+		argIndex++
+	}
+	if req.MessageTemplate != nil {
+		updates = append(updates, "message_template = $"+strconv.Itoa(argIndex))
+		args = append(args, *req.MessageTemplate)
+		argIndex++
+	}
+	if req.IsFinal != nil {
+		updates = append(updates, "is_final = $"+strconv.Itoa(argIndex))
+		args = append(args, *req.IsFinal)
+		argIndex++
+	}
+	if req.IsActive != nil {
+		updates = append(updates, "is_active = $"+strconv.Itoa(argIndex))
+		args = append(args, *req.IsActive)
+		argIndex++
+	}
+
+	if len(updates) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "No fields to update"})
+	}
+
+	updates = append(updates, "updated_at = NOW()")
+	args = append(args, ruleID, tenantID)
+
+	query := "UPDATE billing_reminder_rules SET " + updates[0]
+	for i := 1; i < len(updates); i++ {
+		query += ", " + updates[i]
+	}
+	query += " WHERE id = $" + strconv.Itoa(argIndex) + " AND tenant_id = $" + strconv.Itoa(argIndex+1) +
+		` RETURNING id, tenant_id, name, offset_days, channel, message_template, is_final, is_active, created_at, updated_at`
+
+	var rule models.BillingReminderRule
+	err = tdb.QueryRowx(query, args...).StructScan(&rule)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update reminder rule: " + err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, rule)
+}
+
+// DeleteBillingReminderRule deletes a reminder rule (soft delete)
+func DeleteBillingReminderRule(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
+	ruleID := c.Param("rule_id")
+
+	result, err := tdb.Exec(`
+		UPDATE billing_reminder_rules
+		SET deleted_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
+	`, ruleID, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete reminder rule: " + err.Error()})
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Reminder rule not found"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Reminder rule deleted successfully",
+	})
+}
+
+// ListBillReminders lists the reminders already sent for a bill
+func ListBillReminders(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
+	billID := c.Param("bill_id")
+
+	var exists bool
+	err := tdb.Get(&exists, `
+		SELECT EXISTS(
+			SELECT 1 FROM bills
+			WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
+		)
+	`, billID, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if !exists {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Bill not found"})
+	}
+
+	reminders := []models.BillReminderLog{}
+	err = tdb.Select(&reminders, `
+		SELECT l.id, l.tenant_id, l.bill_id, l.rule_id, l.channel, l.status, l.recipients_count,
+		       l.error, l.sent_at, r.name as rule_name, r.offset_days
+		FROM bill_reminder_logs l
+		LEFT JOIN billing_reminder_rules r ON l.rule_id = r.id
+		WHERE l.bill_id = $1 AND l.tenant_id = $2
+		ORDER BY l.sent_at ASC
+	`, billID, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch reminders: " + err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"reminders": reminders,
+	})
+}
+
+// UpdateMyReminderPreference lets a resident opt out of (or back into) billing reminders
+func UpdateMyReminderPreference(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+
+	req := new(models.UpdateReminderPreferenceRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	result, err := tdb.Exec(`
+		UPDATE tenant_users
+		SET billing_reminder_opt_out = $1, updated_at = NOW()
+		WHERE user_id = $2 AND tenant_id = $3 AND deleted_at IS NULL
+	`, req.OptOut, userID, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update reminder preference"})
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found or not a member of this tenant"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"billing_reminder_opt_out": req.OptOut,
+	})
+}
+
+// ListTreasurerTasks lists treasurer tasks (e.g. dunning escalations) for the tenant
+func ListTreasurerTasks(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
+
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	offset := (page - 1) * limit
+	status := c.QueryParam("status")
+
+	query := `
+		SELECT id, tenant_id, bill_id, type, title, description, status, resolved_by, resolved_at, notes, created_at, updated_at
+		FROM treasurer_tasks
+		WHERE tenant_id = $1`
+	countQuery := `SELECT COUNT(*) FROM treasurer_tasks WHERE tenant_id = $1`
+	args := []interface{}{tenantID}
+	argIndex := 2
+
+	if status != "" {
+		query += ` AND status = $` + strconv.Itoa(argIndex)
+		countQuery += ` AND status = $` + strconv.Itoa(argIndex)
+		args = append(args, status)
+		argIndex++
+	}
+
+	var total int
+	if err := tdb.Get(&total, countQuery, args...); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to count tasks"})
+	}
+
+	query += ` ORDER BY created_at DESC LIMIT $` + strconv.Itoa(argIndex) + ` OFFSET $` + strconv.Itoa(argIndex+1)
+	args = append(args, limit, offset)
+
+	tasks := []models.TreasurerTask{}
+	if err := tdb.Select(&tasks, query, args...); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch tasks: " + err.Error()})
+	}
+
+	totalPages := (total + limit - 1) / limit
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"tasks": tasks,
+		"pagination": map[string]interface{}{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": totalPages,
+		},
+	})
+}
+
+// UpdateTreasurerTask updates the status or notes of a treasurer task
+func UpdateTreasurerTask(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+	taskID := c.Param("task_id")
+
+	req := new(models.UpdateTreasurerTaskRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	if req.Status == nil && req.Notes == nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "No fields to update"})
+	}
+	if req.Status != nil {
+		switch *req.Status {
+		case "open", "in_progress", "done", "dismissed":
+		default:
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "status must be one of open, in_progress, done, dismissed"})
+		}
+	}
+
+	var task models.TreasurerTask
+	err := tdb.QueryRowx(`
+		UPDATE treasurer_tasks
+		SET status = COALESCE($1, status),
+		    notes = COALESCE($2, notes),
+		    resolved_by = CASE WHEN $1 IN ('done', 'dismissed') THEN $3::uuid ELSE resolved_by END,
+		    resolved_at = CASE WHEN $1 IN ('done', 'dismissed') THEN NOW() ELSE resolved_at END,
+		    updated_at = NOW()
+		WHERE id = $4 AND tenant_id = $5
+		RETURNING id, tenant_id, bill_id, type, title, description, status, resolved_by, resolved_at, notes, created_at, updated_at
+	`, req.Status, req.Notes, userID, taskID, tenantID).StructScan(&task)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Task not found"})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update task: " + err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, task)
+}
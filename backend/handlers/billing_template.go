@@ -16,6 +16,7 @@ import (
 // ListBillingTemplates lists all billing templates for the tenant with pagination
 func ListBillingTemplates(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 
 	// Parse query parameters
 	page, _ := strconv.Atoi(c.QueryParam("page"))
@@ -66,7 +67,7 @@ func ListBillingTemplates(c echo.Context) error {
 	query += ` ORDER BY is_system DESC, name ASC LIMIT $` + strconv.Itoa(argIndex) + ` OFFSET $` + strconv.Itoa(argIndex+1)
 	args = append(args, limit, offset)
 
-	rows, err := db.DB.Query(query, args...)
+	rows, err := tdb.Query(query, args...)
 	if err != nil {
 		c.Logger().Errorf("Error querying billing templates: %v", err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error: " + err.Error()})
@@ -117,7 +118,7 @@ func ListBillingTemplates(c echo.Context) error {
 		}
 
 		// Get amount rules for this template
-		amountRules, err := getAmountRules(template.ID)
+		amountRules, err := getAmountRules(tdb, template.ID)
 		if err == nil && len(amountRules) > 0 {
 			templateData["amount_rules"] = amountRules
 		}
@@ -151,7 +152,7 @@ func ListBillingTemplates(c echo.Context) error {
 	}
 
 	var total int
-	err = db.DB.Get(&total, countQuery, countArgs...)
+	err = tdb.Get(&total, countQuery, countArgs...)
 	if err != nil {
 		total = len(templates)
 	}
@@ -172,10 +173,11 @@ func ListBillingTemplates(c echo.Context) error {
 // GetBillingTemplate gets a billing template by ID
 func GetBillingTemplate(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	templateID := c.Param("template_id")
 
 	var template models.BillingTemplate
-	err := db.DB.QueryRow(`
+	err := tdb.QueryRow(`
 		SELECT id, tenant_id, name, category, type, description, amount, late_fee, 
 		       due_day, recurring_type, late_fee_type, late_fee_percentage, late_fee_max, 
 		       is_active, is_system, created_by, created_at, updated_at
@@ -225,7 +227,7 @@ func GetBillingTemplate(c echo.Context) error {
 	}
 
 	// Get amount rules
-	amountRules, err := getAmountRules(templateID)
+	amountRules, err := getAmountRules(tdb, templateID)
 	if err == nil {
 		templateData["amount_rules"] = amountRules
 	}
@@ -233,14 +235,15 @@ func GetBillingTemplate(c echo.Context) error {
 	return c.JSON(http.StatusOK, templateData)
 }
 
-// getAmountRules retrieves amount rules for a template
-func getAmountRules(templateID string) ([]map[string]interface{}, error) {
-	rows, err := db.DB.Query(`
-		SELECT unit_type, amount
-		FROM billing_template_amount_rules
-		WHERE template_id = $1
-		ORDER BY unit_type
-	`, templateID)
+// getAmountRules retrieves amount rules for a template of the tenant
+func getAmountRules(tdb *db.TenantDB, templateID string) ([]map[string]interface{}, error) {
+	rows, err := tdb.Query(`
+		SELECT r.unit_type, r.amount
+		FROM billing_template_amount_rules r
+		INNER JOIN billing_templates bt ON bt.id = r.template_id
+		WHERE r.template_id = $1 AND bt.tenant_id = $2
+		ORDER BY r.unit_type
+	`, templateID, tdb.TenantID)
 	if err != nil {
 		return nil, err
 	}
@@ -264,6 +267,7 @@ func getAmountRules(templateID string) ([]map[string]interface{}, error) {
 // CreateBillingTemplate creates a new billing template
 func CreateBillingTemplate(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Get(string(middleware.CtxUserID)).(string)
 
 	req := new(models.CreateBillingTemplateRequest)
@@ -285,7 +289,7 @@ func CreateBillingTemplate(c echo.Context) error {
 
 	// Check if template name already exists in tenant
 	var exists bool
-	err := db.DB.Get(&exists, `
+	err := tdb.Get(&exists, `
 		SELECT EXISTS(
 			SELECT 1 FROM billing_templates 
 			WHERE tenant_id = $1 AND name = $2 AND deleted_at IS NULL
@@ -334,7 +338,7 @@ func CreateBillingTemplate(c echo.Context) error {
 	}
 
 	// Start transaction
-	tx, err := db.DB.Beginx()
+	tx, err := tdb.Beginx()
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
 	}
@@ -397,6 +401,7 @@ func CreateBillingTemplate(c echo.Context) error {
 // UpdateBillingTemplate updates a billing template
 func UpdateBillingTemplate(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	templateID := c.Param("template_id")
 
 	req := new(models.UpdateBillingTemplateRequest)
@@ -407,7 +412,7 @@ func UpdateBillingTemplate(c echo.Context) error {
 	// Check if template exists and belongs to tenant
 	var exists bool
 	var isSystem bool
-	err := db.DB.QueryRow(`
+	err := tdb.QueryRow(`
 		SELECT EXISTS(
 			SELECT 1 FROM billing_templates 
 			WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
@@ -433,7 +438,7 @@ func UpdateBillingTemplate(c echo.Context) error {
 	if req.Name != nil {
 		// Check if new name conflicts with existing template
 		var nameExists bool
-		err = db.DB.Get(&nameExists, `
+		err = tdb.Get(&nameExists, `
 			SELECT EXISTS(
 				SELECT 1 FROM billing_templates 
 				WHERE tenant_id = $1 AND name = $2 AND id != $3 AND deleted_at IS NULL
@@ -511,7 +516,7 @@ func UpdateBillingTemplate(c echo.Context) error {
 	}
 
 	// Start transaction
-	tx, err := db.DB.Beginx()
+	tx, err := tdb.Beginx()
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
 	}
@@ -569,12 +574,13 @@ func UpdateBillingTemplate(c echo.Context) error {
 // DeleteBillingTemplate deletes a billing template (soft delete)
 func DeleteBillingTemplate(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	templateID := c.Param("template_id")
 
 	// Check if template exists and is not system template
 	var exists bool
 	var isSystem bool
-	err := db.DB.QueryRow(`
+	err := tdb.QueryRow(`
 		SELECT EXISTS(
 			SELECT 1 FROM billing_templates 
 			WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
@@ -593,7 +599,7 @@ func DeleteBillingTemplate(c echo.Context) error {
 	}
 
 	// Soft delete
-	_, err = db.DB.Exec(`
+	_, err = tdb.Exec(`
 		UPDATE billing_templates 
 		SET deleted_at = NOW(), updated_at = NOW()
 		WHERE id = $1 AND tenant_id = $2
@@ -8,6 +8,7 @@ import (
 	"rukunos-backend/db"
 	"rukunos-backend/middleware"
 	"rukunos-backend/models"
+	"rukunos-backend/services"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -16,6 +17,7 @@ import (
 // GenerateBillsFromTemplate generates bills from a template for specified units
 func GenerateBillsFromTemplate(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Get(string(middleware.CtxUserID)).(string)
 
 	req := new(models.GenerateBillsFromTemplateRequest)
@@ -25,7 +27,7 @@ func GenerateBillsFromTemplate(c echo.Context) error {
 
 	// Validate template exists and belongs to tenant
 	var template models.BillingTemplate
-	err := db.DB.QueryRow(`
+	err := tdb.QueryRow(`
 		SELECT id, tenant_id, name, category, type, amount, due_day, recurring_type, is_active
 		FROM billing_templates
 		WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
@@ -45,7 +47,7 @@ func GenerateBillsFromTemplate(c echo.Context) error {
 	}
 
 	// Get units to generate bills for
-	var unitRows *sql.Rows
+	var unitRows *db.Rows
 	if len(req.UnitIDs) > 0 {
 		// Generate for specific units - build IN clause manually
 		placeholders := ""
@@ -62,13 +64,13 @@ func GenerateBillsFromTemplate(c echo.Context) error {
 			FROM units
 			WHERE tenant_id = $1 AND id IN (%s) AND deleted_at IS NULL
 		`, placeholders)
-		unitRows, err = db.DB.Query(query, args...)
+		unitRows, err = tdb.Query(query, args...)
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
 		}
 	} else {
 		// Generate for all units
-		unitRows, err = db.DB.Query(`
+		unitRows, err = tdb.Query(`
 			SELECT id, code, type
 			FROM units
 			WHERE tenant_id = $1 AND deleted_at IS NULL
@@ -79,11 +81,15 @@ func GenerateBillsFromTemplate(c echo.Context) error {
 	}
 	defer unitRows.Close()
 
-	// Calculate due date based on period and due_day
-	dueDate := calculateDueDate(req.Period, template.DueDay)
+	// Calculate due date based on period and due_day (or the tenant's default due day)
+	settings, err := services.LoadTenantSettings(tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load settings"})
+	}
+	dueDate := calculateDueDate(req.Period, template.DueDay, settings)
 
 	// Start transaction
-	tx, err := db.DB.Beginx()
+	tx, err := tdb.Beginx()
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
 	}
@@ -104,10 +110,11 @@ func GenerateBillsFromTemplate(c echo.Context) error {
 		// Check if there's a specific amount rule for this unit type
 		var ruleAmount sql.NullFloat64
 		err := tx.Get(&ruleAmount, `
-			SELECT amount
-			FROM billing_template_amount_rules
-			WHERE template_id = $1 AND unit_type = $2
-		`, req.TemplateID, unitType)
+			SELECT r.amount
+			FROM billing_template_amount_rules r
+			INNER JOIN billing_templates bt ON bt.id = r.template_id
+			WHERE r.template_id = $1 AND r.unit_type = $2 AND bt.tenant_id = $3
+		`, req.TemplateID, unitType, tenantID)
 		if err == nil && ruleAmount.Valid {
 			amount = ruleAmount.Float64
 		}
@@ -159,26 +166,39 @@ func GenerateBillsFromTemplate(c echo.Context) error {
 	return c.JSON(http.StatusOK, response)
 }
 
-// calculateDueDate calculates the due date based on period and due_day
-func calculateDueDate(period string, dueDay sql.NullInt64) time.Time {
+// defaultDueDate is the due date of a bill created without one: the tenant's default due day in the
+// period's month. Periods that are not YYYY-MM get no due date.
+func defaultDueDate(period string, settings models.TenantSettings) sql.NullTime {
+	if _, err := time.Parse("2006-01", period); err != nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: calculateDueDate(period, sql.NullInt64{}, settings), Valid: true}
+}
+
+// calculateDueDate calculates the due date based on period and due_day, falling back to the tenant's
+// default due day. The result is a calendar date (midnight UTC), like the bills.due_date column.
+func calculateDueDate(period string, dueDay sql.NullInt64, settings models.TenantSettings) time.Time {
 	// Parse period (YYYY-MM)
 	periodTime, err := time.Parse("2006-01", period)
 	if err != nil {
-		// Default to current month if parsing fails
-		periodTime = time.Now()
+		// Default to the tenant's current month if parsing fails
+		periodTime = services.LocalDate(time.Now(), services.TenantLocation(settings))
 	}
 
-	day := 1
+	day := settings.Billing.DefaultDueDay
+	if day < 1 {
+		day = 1
+	}
 	if dueDay.Valid && dueDay.Int64 >= 1 && dueDay.Int64 <= 31 {
 		day = int(dueDay.Int64)
 	}
 
 	// Get last day of month
-	lastDay := time.Date(periodTime.Year(), periodTime.Month()+1, 0, 0, 0, 0, 0, periodTime.Location()).Day()
+	lastDay := time.Date(periodTime.Year(), periodTime.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
 	if day > lastDay {
 		day = lastDay
 	}
 
-	return time.Date(periodTime.Year(), periodTime.Month(), day, 0, 0, 0, 0, periodTime.Location())
+	return time.Date(periodTime.Year(), periodTime.Month(), day, 0, 0, 0, 0, time.UTC)
 }
 
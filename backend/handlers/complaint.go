@@ -5,7 +5,6 @@ import (
 	"net/http"
 	"strconv"
 	"time"
-	"rukunos-backend/db"
 	"rukunos-backend/middleware"
 	"rukunos-backend/models"
 
@@ -17,6 +16,7 @@ import (
 // ListComplaints lists all complaints for the tenant (admin) or current user (warga)
 func ListComplaints(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Get(string(middleware.CtxUserID)).(string)
 
 	// Get query parameters
@@ -36,7 +36,7 @@ func ListComplaints(c echo.Context) error {
 
 	// Check if user is admin (can see all complaints)
 	var isAdmin bool
-	err := db.DB.Get(&isAdmin, `
+	err := tdb.Get(&isAdmin, `
 		SELECT EXISTS(
 			SELECT 1 FROM tenant_users tu
 			JOIN roles r ON tu.role_id = r.id
@@ -92,7 +92,7 @@ func ListComplaints(c echo.Context) error {
 	query += ` ORDER BY c.created_at DESC LIMIT $` + strconv.Itoa(argIndex) + ` OFFSET $` + strconv.Itoa(argIndex+1)
 	args = append(args, limit, offset)
 
-	rows, err := db.DB.Query(query, args...)
+	rows, err := tdb.Query(query, args...)
 	if err != nil {
 		c.Logger().Errorf("Error executing query: %v, query: %s", err, query)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error: " + err.Error()})
@@ -195,7 +195,7 @@ func ListComplaints(c echo.Context) error {
 	}
 
 	var total int
-	err = db.DB.Get(&total, countQuery, countArgs...)
+	err = tdb.Get(&total, countQuery, countArgs...)
 	if err != nil {
 		total = len(complaints)
 	}
@@ -216,12 +216,13 @@ func ListComplaints(c echo.Context) error {
 // GetComplaint gets a single complaint by ID
 func GetComplaint(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Get(string(middleware.CtxUserID)).(string)
 	complaintID := c.Param("complaint_id")
 
 	// Check if user is admin or owns the complaint
 	var isAdmin bool
-	err := db.DB.Get(&isAdmin, `
+	err := tdb.Get(&isAdmin, `
 		SELECT EXISTS(
 			SELECT 1 FROM tenant_users tu
 			JOIN roles r ON tu.role_id = r.id
@@ -258,7 +259,7 @@ func GetComplaint(c echo.Context) error {
 	var resolutionNotes sql.NullString
 	var attachmentURLs pq.StringArray
 
-	err = db.DB.QueryRow(query, args...).Scan(
+	err = tdb.QueryRow(query, args...).Scan(
 		&complaint.ID, &complaint.TenantID, &complaint.UserID, &unitID, &complaint.Category, &complaint.Priority,
 		&complaint.Title, &complaint.Description, &complaint.Status, &assignedTo, &resolvedAt,
 		&resolutionNotes, &attachmentURLs, &complaint.CreatedAt, &complaint.UpdatedAt,
@@ -317,6 +318,7 @@ func GetComplaint(c echo.Context) error {
 // CreateComplaint creates a new complaint
 func CreateComplaint(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Get(string(middleware.CtxUserID)).(string)
 
 	var req models.CreateComplaintRequest
@@ -337,7 +339,7 @@ func CreateComplaint(c echo.Context) error {
 
 	// Get user's unit_id
 	var unitID sql.NullString
-	err := db.DB.Get(&unitID, `
+	err := tdb.Get(&unitID, `
 		SELECT unit_id FROM tenant_users
 		WHERE user_id = $1 AND tenant_id = $2 AND deleted_at IS NULL
 	`, userID, tenantID)
@@ -352,7 +354,7 @@ func CreateComplaint(c echo.Context) error {
 
 	var createdAt time.Time
 	var returnedID string
-	err = db.DB.QueryRow(query,
+	err = tdb.QueryRow(query,
 		complaintID, tenantID, userID, unitID, req.Category, priority, req.Title, req.Description, pq.Array(req.AttachmentURLs),
 	).Scan(&returnedID, &createdAt)
 	if err != nil {
@@ -368,6 +370,7 @@ func CreateComplaint(c echo.Context) error {
 // UpdateComplaint updates a complaint (admin only for status/assignment)
 func UpdateComplaint(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Get(string(middleware.CtxUserID)).(string)
 	complaintID := c.Param("complaint_id")
 
@@ -378,7 +381,7 @@ func UpdateComplaint(c echo.Context) error {
 
 	// Check if user is admin
 	var isAdmin bool
-	err := db.DB.Get(&isAdmin, `
+	err := tdb.Get(&isAdmin, `
 		SELECT EXISTS(
 			SELECT 1 FROM tenant_users tu
 			JOIN roles r ON tu.role_id = r.id
@@ -431,7 +434,7 @@ func UpdateComplaint(c echo.Context) error {
 	query += ` WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL RETURNING id`
 
 	var returnedID string
-	err = db.DB.QueryRow(query, args...).Scan(&returnedID)
+	err = tdb.QueryRow(query, args...).Scan(&returnedID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return c.JSON(http.StatusNotFound, map[string]string{"error": "Complaint not found"})
@@ -445,12 +448,13 @@ func UpdateComplaint(c echo.Context) error {
 // DeleteComplaint soft deletes a complaint
 func DeleteComplaint(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Get(string(middleware.CtxUserID)).(string)
 	complaintID := c.Param("complaint_id")
 
 	// Check if user is admin or owns the complaint
 	var isAdmin bool
-	err := db.DB.Get(&isAdmin, `
+	err := tdb.Get(&isAdmin, `
 		SELECT EXISTS(
 			SELECT 1 FROM tenant_users tu
 			JOIN roles r ON tu.role_id = r.id
@@ -468,7 +472,7 @@ func DeleteComplaint(c echo.Context) error {
 		args = append(args, userID)
 	}
 
-	result, err := db.DB.Exec(query, args...)
+	result, err := tdb.Exec(query, args...)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
 	}
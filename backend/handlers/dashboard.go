@@ -5,8 +5,8 @@ import (
 	"fmt"
 	"net/http"
 	"time"
-	"rukunos-backend/db"
 	"rukunos-backend/middleware"
+	"rukunos-backend/services"
 
 	"github.com/labstack/echo/v4"
 )
@@ -14,18 +14,19 @@ import (
 // GetWargaDashboardSummary returns summary data for warga dashboard
 func GetWargaDashboardSummary(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Get(string(middleware.CtxUserID)).(string)
 
 	// Get user's unit_id
 	var unitID sql.NullString
-	err := db.DB.Get(&unitID, `
+	err := tdb.Get(&unitID, `
 		SELECT unit_id FROM tenant_users
 		WHERE user_id = $1 AND tenant_id = $2 AND deleted_at IS NULL
 	`, userID, tenantID)
 
 	var unitCode sql.NullString
 	if err == nil && unitID.Valid {
-		db.DB.Get(&unitCode, `SELECT code FROM units WHERE id = $1`, unitID.String)
+		tdb.Get(&unitCode, `SELECT code FROM units WHERE id = $1`, unitID.String)
 	}
 
 	// Get active bills (pending)
@@ -33,7 +34,7 @@ func GetWargaDashboardSummary(c echo.Context) error {
 	var pendingBillsCount int
 	var activeBill map[string]interface{}
 
-	err = db.DB.QueryRow(`
+	err = tdb.QueryRow(`
 		SELECT 
 			COALESCE(SUM(amount + COALESCE(late_fee, 0)), 0) as total_amount,
 			COUNT(*) as count
@@ -47,7 +48,7 @@ func GetWargaDashboardSummary(c echo.Context) error {
 		var amount, lateFee float64
 		var dueDate sql.NullTime
 
-		err = db.DB.QueryRow(`
+		err = tdb.QueryRow(`
 			SELECT id, category, period, amount, late_fee, due_date
 			FROM bills
 			WHERE tenant_id = $1 AND unit_id = $2 AND status = 'pending' AND deleted_at IS NULL
@@ -71,7 +72,7 @@ func GetWargaDashboardSummary(c echo.Context) error {
 
 	// Get recent announcements (last 3)
 	announcements := []map[string]interface{}{}
-	rows, err := db.DB.Query(`
+	rows, err := tdb.Query(`
 		SELECT 
 			a.id, a.title, a.content, a.priority, a.category, a.created_at,
 			u.full_name as author_name
@@ -113,7 +114,7 @@ func GetWargaDashboardSummary(c echo.Context) error {
 	activities := []map[string]interface{}{}
 
 	// Recent paid bills
-	billRows, err := db.DB.Query(`
+	billRows, err := tdb.Query(`
 		SELECT category, period, paid_at, amount
 		FROM bills
 		WHERE tenant_id = $1 AND unit_id = $2 AND status = 'paid' AND deleted_at IS NULL
@@ -145,7 +146,7 @@ func GetWargaDashboardSummary(c echo.Context) error {
 	}
 
 	// Recent document requests
-	docRows, err := db.DB.Query(`
+	docRows, err := tdb.Query(`
 		SELECT document_type, status, created_at
 		FROM document_requests
 		WHERE tenant_id = $1 AND user_id = $2 AND deleted_at IS NULL
@@ -218,22 +219,29 @@ func min(a, b int) int {
 // GetBillingDashboard returns financial dashboard data for admin/bendahara
 func GetBillingDashboard(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 
 	// Get period filter (optional)
 	// If period is provided, filter by created_at month instead of period field
 	// because period field might be in different format (e.g., "Januari 2025")
 	periodFilter := c.QueryParam("period") // Format: YYYY-MM or YYYY
 
+	// Months and years are those of the tenant's timezone, not the database server's
+	settings, err := services.LoadTenantSettings(tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load settings"})
+	}
+
 	// Build period filter for SQL - use created_at instead of period field
 	var periodWhere string
 	var periodArgs []interface{}
 	if periodFilter != "" {
 		if len(periodFilter) == 7 { // YYYY-MM
-			periodWhere = "AND TO_CHAR(b.created_at, 'YYYY-MM') = $1"
-			periodArgs = []interface{}{periodFilter}
+			periodWhere = "AND TO_CHAR(b.created_at::timestamptz AT TIME ZONE $2, 'YYYY-MM') = $1"
+			periodArgs = []interface{}{periodFilter, settings.Timezone}
 		} else if len(periodFilter) == 4 { // YYYY
-			periodWhere = "AND TO_CHAR(b.created_at, 'YYYY') = $1"
-			periodArgs = []interface{}{periodFilter}
+			periodWhere = "AND TO_CHAR(b.created_at::timestamptz AT TIME ZONE $2, 'YYYY') = $1"
+			periodArgs = []interface{}{periodFilter, settings.Timezone}
 		}
 	} else {
 		// Default: no filter (show all data)
@@ -271,7 +279,7 @@ func GetBillingDashboard(c echo.Context) error {
 	`, argIndex, periodWhere)
 
 	args := append(periodArgs, tenantID)
-	err := db.DB.Get(&summary, query, args...)
+	err = tdb.Get(&summary, query, args...)
 	if err != nil {
 		c.Logger().Errorf("Error executing dashboard summary query: %v, query: %s, args: %v", err, query, args)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error: " + err.Error()})
@@ -286,12 +294,12 @@ func GetBillingDashboard(c echo.Context) error {
 	// Get monthly trend (last 12 months)
 	// Generate all 12 months and LEFT JOIN with bills data to ensure all months are shown
 	monthlyTrend := []map[string]interface{}{}
-	trendRows, err := db.DB.Query(`
+	trendRows, err := tdb.Query(`
 		WITH months AS (
 			SELECT TO_CHAR(month_series, 'YYYY-MM') as month
 			FROM generate_series(
-				DATE_TRUNC('month', CURRENT_DATE - INTERVAL '11 months'),
-				DATE_TRUNC('month', CURRENT_DATE),
+				DATE_TRUNC('month', (NOW() AT TIME ZONE $2) - INTERVAL '11 months'),
+				DATE_TRUNC('month', NOW() AT TIME ZONE $2),
 				INTERVAL '1 month'
 			) AS month_series
 		)
@@ -304,12 +312,12 @@ func GetBillingDashboard(c echo.Context) error {
 			COALESCE(COUNT(CASE WHEN b.status = 'overdue' THEN 1 END), 0) as overdue_count,
 			COALESCE(SUM(CASE WHEN b.status = 'overdue' THEN b.amount + COALESCE(b.late_fee, 0) ELSE 0 END), 0) as overdue_amount
 		FROM months m
-		LEFT JOIN bills b ON TO_CHAR(b.created_at, 'YYYY-MM') = m.month
+		LEFT JOIN bills b ON TO_CHAR(b.created_at::timestamptz AT TIME ZONE $2, 'YYYY-MM') = m.month
 			AND b.tenant_id = $1 
 			AND b.deleted_at IS NULL
 		GROUP BY m.month
 		ORDER BY m.month ASC
-	`, tenantID)
+	`, tenantID, settings.Timezone)
 	if err != nil {
 		c.Logger().Errorf("Error executing monthly trend query: %v", err)
 		// Continue with empty trend data
@@ -341,7 +349,7 @@ func GetBillingDashboard(c echo.Context) error {
 
 	// Get top 10 overdue units
 	topOverdue := []map[string]interface{}{}
-	overdueRows, err := db.DB.Query(`
+	overdueRows, err := tdb.Query(`
 		SELECT 
 			u.code as unit_code,
 			u.type as unit_type,
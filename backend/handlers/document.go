@@ -5,9 +5,9 @@ import (
 	"net/http"
 	"strconv"
 	"time"
-	"rukunos-backend/db"
 	"rukunos-backend/middleware"
 	"rukunos-backend/models"
+	"rukunos-backend/services"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -17,6 +17,7 @@ import (
 // ListDocumentRequests lists all document requests for the tenant (admin) or current user (warga)
 func ListDocumentRequests(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Get(string(middleware.CtxUserID)).(string)
 
 	// Get query parameters
@@ -35,7 +36,7 @@ func ListDocumentRequests(c echo.Context) error {
 
 	// Check if user is admin (can see all requests)
 	var isAdmin bool
-	err := db.DB.Get(&isAdmin, `
+	err := tdb.Get(&isAdmin, `
 		SELECT EXISTS(
 			SELECT 1 FROM tenant_users tu
 			JOIN roles r ON tu.role_id = r.id
@@ -84,7 +85,7 @@ func ListDocumentRequests(c echo.Context) error {
 	query += ` ORDER BY d.created_at DESC LIMIT $` + strconv.Itoa(argIndex) + ` OFFSET $` + strconv.Itoa(argIndex+1)
 	args = append(args, limit, offset)
 
-	rows, err := db.DB.Query(query, args...)
+	rows, err := tdb.Query(query, args...)
 	if err != nil {
 		c.Logger().Errorf("Error executing query: %v, query: %s", err, query)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error: " + err.Error()})
@@ -175,7 +176,7 @@ func ListDocumentRequests(c echo.Context) error {
 	}
 
 	var total int
-	err = db.DB.Get(&total, countQuery, countArgs...)
+	err = tdb.Get(&total, countQuery, countArgs...)
 	if err != nil {
 		total = len(requests)
 	}
@@ -196,12 +197,13 @@ func ListDocumentRequests(c echo.Context) error {
 // GetDocumentRequest gets a single document request by ID
 func GetDocumentRequest(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Get(string(middleware.CtxUserID)).(string)
 	requestID := c.Param("request_id")
 
 	// Check if user is admin or owns the request
 	var isAdmin bool
-	err := db.DB.Get(&isAdmin, `
+	err := tdb.Get(&isAdmin, `
 		SELECT EXISTS(
 			SELECT 1 FROM tenant_users tu
 			JOIN roles r ON tu.role_id = r.id
@@ -236,7 +238,7 @@ func GetDocumentRequest(c echo.Context) error {
 	var approvedAt sql.NullTime
 	var attachmentIDs pq.StringArray
 
-	err = db.DB.QueryRow(query, args...).Scan(
+	err = tdb.QueryRow(query, args...).Scan(
 		&d.ID, &d.TenantID, &d.UserID, &d.DocumentType, &d.Purpose, &d.Status,
 		&approvedBy, &approvedAt, &rejectedReason, &attachmentIDs,
 		&notes, &d.CreatedAt, &d.UpdatedAt,
@@ -284,12 +286,25 @@ func GetDocumentRequest(c echo.Context) error {
 		requestData["attachment_ids"] = attachmentIDs
 	}
 
+	// The letter is printed on the tenant's letterhead and signed by its chairperson
+	if settings, err := services.LoadTenantSettings(tenantID); err == nil {
+		requestData["letterhead"] = settings.Letterhead
+	}
+
+	// Issued letters carry a link anyone can open to check they are genuine
+	if d.Status == "approved" || d.Status == "completed" {
+		if siteURL, err := tenantPublicURL(tenantID); err == nil {
+			requestData["verification_url"] = siteURL + "/verify/documents/" + d.ID
+		}
+	}
+
 	return c.JSON(http.StatusOK, requestData)
 }
 
 // CreateDocumentRequest creates a new document request
 func CreateDocumentRequest(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Get(string(middleware.CtxUserID)).(string)
 
 	var req models.CreateDocumentRequestRequest
@@ -312,7 +327,7 @@ func CreateDocumentRequest(c echo.Context) error {
 
 	var createdAt time.Time
 	var returnedID string
-	err := db.DB.QueryRow(query,
+	err := tdb.QueryRow(query,
 		requestID, tenantID, userID, req.DocumentType, req.Purpose, pq.Array(req.AttachmentIDs),
 	).Scan(&returnedID, &createdAt)
 	if err != nil {
@@ -328,6 +343,7 @@ func CreateDocumentRequest(c echo.Context) error {
 // UpdateDocumentRequest updates a document request (admin only for approval)
 func UpdateDocumentRequest(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Get(string(middleware.CtxUserID)).(string)
 	requestID := c.Param("request_id")
 
@@ -338,7 +354,7 @@ func UpdateDocumentRequest(c echo.Context) error {
 
 	// Check if user is admin
 	var isAdmin bool
-	err := db.DB.Get(&isAdmin, `
+	err := tdb.Get(&isAdmin, `
 		SELECT EXISTS(
 			SELECT 1 FROM tenant_users tu
 			JOIN roles r ON tu.role_id = r.id
@@ -394,7 +410,7 @@ func UpdateDocumentRequest(c echo.Context) error {
 	query += ` WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL RETURNING id`
 
 	var returnedID string
-	err = db.DB.QueryRow(query, args...).Scan(&returnedID)
+	err = tdb.QueryRow(query, args...).Scan(&returnedID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return c.JSON(http.StatusNotFound, map[string]string{"error": "Document request not found"})
@@ -408,12 +424,13 @@ func UpdateDocumentRequest(c echo.Context) error {
 // DeleteDocumentRequest soft deletes a document request
 func DeleteDocumentRequest(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Get(string(middleware.CtxUserID)).(string)
 	requestID := c.Param("request_id")
 
 	// Check if user is admin or owns the request
 	var isAdmin bool
-	err := db.DB.Get(&isAdmin, `
+	err := tdb.Get(&isAdmin, `
 		SELECT EXISTS(
 			SELECT 1 FROM tenant_users tu
 			JOIN roles r ON tu.role_id = r.id
@@ -431,7 +448,7 @@ func DeleteDocumentRequest(c echo.Context) error {
 		args = append(args, userID)
 	}
 
-	result, err := db.DB.Exec(query, args...)
+	result, err := tdb.Exec(query, args...)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
 	}
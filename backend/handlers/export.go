@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"rukunos-backend/middleware"
+	"rukunos-backend/services"
+	"rukunos-backend/spreadsheet"
+
+	"github.com/labstack/echo/v4"
+)
+
+// exportColumn describes one selectable column of an export.
+// Expr must produce a value that can be cast to text.
+type exportColumn struct {
+	Key      string
+	HeaderID string
+	HeaderEN string
+	Expr     string
+	Numeric  bool
+}
+
+var billExportColumns = []exportColumn{
+	{"bill_number", "No. Tagihan", "Bill Number", "b.bill_number", false},
+	{"unit_code", "Kode Unit", "Unit Code", "u.code", false},
+	{"unit_type", "Tipe Unit", "Unit Type", "u.type", false},
+	{"category", "Kategori", "Category", "b.category", false},
+	{"period", "Periode", "Period", "b.period", false},
+	{"amount", "Jumlah", "Amount", "b.amount", true},
+	{"late_fee", "Denda", "Late Fee", "COALESCE(b.late_fee, 0)", true},
+	{"total_amount", "Total", "Total", "(b.amount + COALESCE(b.late_fee, 0))", true},
+	{"due_date", "Jatuh Tempo", "Due Date", "TO_CHAR(b.due_date, 'YYYY-MM-DD')", false},
+	{"status", "Status", "Status", "b.status", false},
+	{"paid_at", "Tanggal Bayar", "Paid At", "TO_CHAR(b.paid_at, 'YYYY-MM-DD HH24:MI')", false},
+	{"payment_method", "Metode Pembayaran", "Payment Method", "b.payment_method", false},
+	{"notes", "Catatan", "Notes", "b.notes", false},
+	{"created_at", "Dibuat", "Created At", "TO_CHAR(b.created_at, 'YYYY-MM-DD HH24:MI')", false},
+}
+
+var paymentExportColumns = []exportColumn{
+	{"paid_at", "Tanggal Bayar", "Paid At", "TO_CHAR(b.paid_at, 'YYYY-MM-DD HH24:MI')", false},
+	{"bill_number", "No. Tagihan", "Bill Number", "b.bill_number", false},
+	{"unit_code", "Kode Unit", "Unit Code", "u.code", false},
+	{"category", "Kategori", "Category", "b.category", false},
+	{"period", "Periode", "Period", "b.period", false},
+	{"amount", "Jumlah", "Amount", "b.amount", true},
+	{"late_fee", "Denda", "Late Fee", "COALESCE(b.late_fee, 0)", true},
+	{"total_amount", "Total Dibayar", "Total Paid", "(b.amount + COALESCE(b.late_fee, 0))", true},
+	{"payment_method", "Metode Pembayaran", "Payment Method", "b.payment_method", false},
+	{"payment_reference", "Referensi Pembayaran", "Payment Reference", "b.payment_reference", false},
+}
+
+var unitExportColumns = []exportColumn{
+	{"code", "Kode Unit", "Unit Code", "code", false},
+	{"type", "Tipe", "Type", "type", false},
+	{"owner_name", "Nama Pemilik", "Owner Name", "owner_name", false},
+	{"owner_phone", "Telepon Pemilik", "Owner Phone", "owner_phone", false},
+	{"owner_email", "Email Pemilik", "Owner Email", "owner_email", false},
+	{"address", "Alamat", "Address", "address", false},
+	{"status", "Status", "Status", "status", false},
+	{"created_at", "Dibuat", "Created At", "TO_CHAR(created_at, 'YYYY-MM-DD HH24:MI')", false},
+}
+
+var userExportColumns = []exportColumn{
+	{"full_name", "Nama Lengkap", "Full Name", "u.full_name", false},
+	{"email", "Email", "Email", "u.email", false},
+	{"phone", "Telepon", "Phone", "u.phone", false},
+	{"role", "Peran", "Role", "r.name", false},
+	{"unit_code", "Kode Unit", "Unit Code", "un.code", false},
+	{"status", "Status", "Status", "tu.status", false},
+	{"joined_at", "Bergabung", "Joined At", "TO_CHAR(tu.created_at, 'YYYY-MM-DD HH24:MI')", false},
+}
+
+// ExportBills streams the bill list as CSV or XLSX using the same filters as ListBills
+func ExportBills(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+
+	columns, err := selectExportColumns(billExportColumns, c.QueryParam("columns"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	query := `FROM bills b
+		INNER JOIN units u ON b.unit_id = u.id
+		WHERE b.tenant_id = $1 AND b.deleted_at IS NULL`
+	query, args, err := appendBillFilters(query, []interface{}{tenantID}, tenantID, userID, billFilterFromQuery(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	query += ` ORDER BY b.due_date DESC NULLS LAST, b.created_at DESC`
+
+	return streamExport(c, "tagihan", columns, query, args)
+}
+
+// ExportPayments streams paid bills as CSV or XLSX.
+// Supports the bill filters (unit_id, search, period) plus paid_from and paid_to (YYYY-MM-DD).
+func ExportPayments(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+
+	columns, err := selectExportColumns(paymentExportColumns, c.QueryParam("columns"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	filter := billFilterFromQuery(c)
+	filter.Status = "paid"
+
+	query := `FROM bills b
+		INNER JOIN units u ON b.unit_id = u.id
+		WHERE b.tenant_id = $1 AND b.deleted_at IS NULL`
+	query, args, err := appendBillFilters(query, []interface{}{tenantID}, tenantID, userID, filter)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	// paid_from and paid_to are days in the tenant's timezone
+	settings, err := services.LoadTenantSettings(tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load settings"})
+	}
+	loc := services.TenantLocation(settings)
+
+	if paidFrom := c.QueryParam("paid_from"); paidFrom != "" {
+		from, err := time.Parse("2006-01-02", paidFrom)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid paid_from format. Use YYYY-MM-DD"})
+		}
+		args = append(args, services.LocalDayStart(from, loc))
+		query += ` AND b.paid_at::timestamptz >= $` + strconv.Itoa(len(args))
+	}
+	if paidTo := c.QueryParam("paid_to"); paidTo != "" {
+		to, err := time.Parse("2006-01-02", paidTo)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid paid_to format. Use YYYY-MM-DD"})
+		}
+		args = append(args, services.LocalDayStart(to.AddDate(0, 0, 1), loc))
+		query += ` AND b.paid_at::timestamptz < $` + strconv.Itoa(len(args))
+	}
+	query += ` ORDER BY b.paid_at DESC`
+
+	return streamExport(c, "pembayaran", columns, query, args)
+}
+
+// ExportUnits streams the unit list as CSV or XLSX using the same filters as ListUnits
+func ExportUnits(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+
+	columns, err := selectExportColumns(unitExportColumns, c.QueryParam("columns"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	query := `FROM units WHERE tenant_id = $1 AND deleted_at IS NULL`
+	query, args := appendUnitFilters(query, []interface{}{tenantID}, c.QueryParam("type"), c.QueryParam("search"))
+	query += ` ORDER BY code ASC`
+
+	return streamExport(c, "unit", columns, query, args)
+}
+
+// ExportUsers streams the tenant's users as CSV or XLSX using the same filters as ListUsers
+func ExportUsers(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+
+	columns, err := selectExportColumns(userExportColumns, c.QueryParam("columns"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	query := `FROM users u
+		INNER JOIN tenant_users tu ON u.id = tu.user_id
+		LEFT JOIN roles r ON tu.role_id = r.id AND r.deleted_at IS NULL
+		LEFT JOIN units un ON tu.unit_id = un.id AND un.deleted_at IS NULL
+		WHERE tu.tenant_id = $1
+		AND u.deleted_at IS NULL
+		AND tu.deleted_at IS NULL`
+	query, args := appendUserFilters(query, []interface{}{tenantID}, c.QueryParam("role_id"), c.QueryParam("unit_id"), c.QueryParam("search"))
+	query += ` ORDER BY u.full_name ASC`
+
+	return streamExport(c, "warga", columns, query, args)
+}
+
+// selectExportColumns returns the columns named in a comma-separated list, or all columns if empty
+func selectExportColumns(available []exportColumn, requested string) ([]exportColumn, error) {
+	if strings.TrimSpace(requested) == "" {
+		return available, nil
+	}
+
+	byKey := map[string]exportColumn{}
+	for _, col := range available {
+		byKey[col.Key] = col
+	}
+
+	selected := []exportColumn{}
+	for _, key := range strings.Split(requested, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		col, ok := byKey[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q", key)
+		}
+		selected = append(selected, col)
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("columns must contain at least one column")
+	}
+	return selected, nil
+}
+
+// streamExport runs "SELECT <columns> <fromWhere>" and writes each row to the response as it is read.
+// Query params: format=csv|xlsx (default csv), lang=id|en (default id).
+func streamExport(c echo.Context, name string, columns []exportColumn, fromWhere string, args []interface{}) error {
+	tdb := middleware.TenantDB(c)
+	format := c.QueryParam("format")
+	if format == "" {
+		format = spreadsheet.FormatCSV
+	}
+	if format != spreadsheet.FormatCSV && format != spreadsheet.FormatXLSX {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "format must be 'csv' or 'xlsx'"})
+	}
+	lang := c.QueryParam("lang")
+	if lang == "" {
+		lang = "id"
+	}
+	if lang != "id" && lang != "en" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "lang must be 'id' or 'en'"})
+	}
+
+	exprs := make([]string, len(columns))
+	header := make([]spreadsheet.Cell, len(columns))
+	for i, col := range columns {
+		exprs[i] = "(" + col.Expr + ")::text"
+		if lang == "en" {
+			header[i] = spreadsheet.Cell{Value: col.HeaderEN}
+		} else {
+			header[i] = spreadsheet.Cell{Value: col.HeaderID}
+		}
+	}
+
+	rows, err := tdb.Query("SELECT "+strings.Join(exprs, ", ")+" "+fromWhere, args...)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error: " + err.Error()})
+	}
+	defer rows.Close()
+
+	filename := fmt.Sprintf("%s-%s.%s", name, time.Now().Format("20060102-150405"), format)
+	resp := c.Response()
+	resp.Header().Set(echo.HeaderContentType, spreadsheet.ContentType(format))
+	resp.Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	resp.WriteHeader(http.StatusOK)
+
+	w, err := spreadsheet.NewWriter(resp, format)
+	if err != nil {
+		return err
+	}
+	if err := w.WriteRow(header); err != nil {
+		return err
+	}
+
+	values := make([]*string, len(columns))
+	scanArgs := make([]interface{}, len(columns))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+
+	count := 0
+	for rows.Next() {
+		if err := rows.Scan(scanArgs...); err != nil {
+			c.Logger().Errorf("Error scanning export row: %v", err)
+			continue
+		}
+		cells := make([]spreadsheet.Cell, len(columns))
+		for i, v := range values {
+			if v != nil {
+				cells[i] = spreadsheet.Cell{Value: *v, Numeric: columns[i].Numeric}
+			}
+		}
+		if err := w.WriteRow(cells); err != nil {
+			return err
+		}
+
+		// Flush periodically so large exports reach the client without buffering
+		count++
+		if count%500 == 0 {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			resp.Flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		c.Logger().Errorf("Error reading export rows: %v", err)
+	}
+
+	return w.Close()
+}
@@ -5,33 +5,111 @@ import (
 	"net/http"
 	"rukunos-backend/db"
 	"rukunos-backend/middleware"
+	"rukunos-backend/models"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
 )
 
-// GetFamilyMembers gets all family members (users) in the same unit
+// householdMembers returns the registered residents on the user's family cards: the cards the user is a
+// member of and the cards of the unit they live in. NIKs and KK numbers are masked.
+func householdMembers(tdb *db.TenantDB, tenantID, userID string, unitID sql.NullString) ([]map[string]interface{}, []map[string]interface{}, error) {
+	members := []map[string]interface{}{}
+	households := []map[string]interface{}{}
+
+	var cards []models.Household
+	err := tdb.Select(&cards, `SELECT `+householdColumns+`
+		WHERE h.tenant_id = $1 AND h.deleted_at IS NULL
+		AND (h.unit_id = $3 OR h.id IN (
+			SELECT household_id FROM residents WHERE tenant_id = $1 AND user_id = $2 AND deleted_at IS NULL
+		))
+		ORDER BY h.created_at ASC
+	`, tenantID, userID, unitID)
+	if err != nil || len(cards) == 0 {
+		return members, households, err
+	}
+
+	ids := []string{}
+	for i := range cards {
+		if err := decryptHousehold(&cards[i], false); err != nil {
+			return members, households, err
+		}
+		ids = append(ids, cards[i].ID)
+		households = append(households, map[string]interface{}{
+			"id":           cards[i].ID,
+			"kk_number":    cards[i].KKNumber,
+			"unit_code":    cards[i].UnitCode,
+			"head_name":    cards[i].HeadName,
+			"member_count": cards[i].MemberCount,
+		})
+	}
+
+	var residents []models.Resident
+	err = tdb.Select(&residents, `SELECT `+residentColumns+`
+		WHERE r.tenant_id = $1 AND r.household_id = ANY($2) AND r.deleted_at IS NULL
+		ORDER BY r.household_id, r.relationship = 'kepala_keluarga' DESC, r.birth_date ASC
+	`, tenantID, pq.Array(ids))
+	if err != nil {
+		return members, households, err
+	}
+	for i := range residents {
+		r := &residents[i]
+		if err := decryptResident(r, false); err != nil {
+			return members, households, err
+		}
+		members = append(members, map[string]interface{}{
+			"id":                 r.ID,
+			"household_id":       r.HouseholdID,
+			"user_id":            r.UserID,
+			"full_name":          r.FullName,
+			"nik":                r.NIK,
+			"gender":             r.Gender,
+			"birth_date":         r.BirthDate,
+			"relationship":       r.Relationship,
+			"relationship_label": residentRelationships[r.Relationship],
+			"occupation":         r.Occupation,
+			"domicile_status":    r.DomicileStatus,
+		})
+	}
+	return members, households, nil
+}
+
+// GetFamilyMembers gets all family members: users in the same unit, and the residents registered on the
+// user's family cards (most of whom have no login)
 func GetFamilyMembers(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Get(string(middleware.CtxUserID)).(string)
 
 	// Get user's unit_id
 	var unitID sql.NullString
-	err := db.DB.Get(&unitID, `
+	err := tdb.Get(&unitID, `
 		SELECT unit_id FROM tenant_users
 		WHERE user_id = $1 AND tenant_id = $2 AND deleted_at IS NULL
 	`, userID, tenantID)
 
-	if err != nil || !unitID.Valid {
+	if err != nil && err != sql.ErrNoRows {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	members, households, err := householdMembers(tdb, tenantID, userID, unitID)
+	if err != nil {
+		return piiErrorResponse(c, err)
+	}
+
+	if !unitID.Valid {
 		return c.JSON(http.StatusOK, map[string]interface{}{
-			"family_members": []interface{}{},
-			"unit_code":      nil,
+			"family_members":    []interface{}{},
+			"unit_code":         nil,
+			"household_members": members,
+			"households":        households,
 		})
 	}
 
 	// Get unit code
 	var unitCode sql.NullString
-	db.DB.Get(&unitCode, `SELECT code FROM units WHERE id = $1`, unitID.String)
+	tdb.Get(&unitCode, `SELECT code FROM units WHERE id = $1 AND tenant_id = $2`, unitID.String, tenantID)
 
 	// Get all users in the same unit
 	query := `
@@ -47,7 +125,7 @@ func GetFamilyMembers(c echo.Context) error {
 		ORDER BY tu.created_at ASC
 	`
 
-	rows, err := db.DB.Query(query, tenantID, unitID.String)
+	rows, err := tdb.Query(query, tenantID, unitID.String)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
 	}
@@ -103,8 +181,10 @@ func GetFamilyMembers(c echo.Context) error {
 	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"family_members": familyMembers,
-		"unit_code":      unitCode.String,
+		"family_members":    familyMembers,
+		"unit_code":         unitCode.String,
+		"household_members": members,
+		"households":        households,
 	})
 }
 
@@ -7,12 +7,12 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
-	"time"
 	"rukunos-backend/db"
+	"rukunos-backend/middleware"
 	"rukunos-backend/models"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 	"golang.org/x/oauth2"
 )
@@ -30,7 +30,8 @@ func init() {
 	}
 	
 	if redirectURL == "" {
-		redirectURL = "http://localhost:3000/auth/google/callback"
+		// Google must call back the API (GoogleAuthCallback), which then redirects to the frontend
+		redirectURL = "http://localhost:8080/api/auth/google/callback"
 	}
 
 	googleOAuthConfig = &oauth2.Config{
@@ -45,6 +46,54 @@ func init() {
 	}
 }
 
+// googleFlow keeps Google sign-in state; the cookie path covers /api/auth/google and its callback
+var googleFlow = oauthFlow{provider: "google", cookieName: "google_oauth_state", cookiePath: "/api/auth/google"}
+
+// startGoogleAuth stores a new state for purpose ("login" or "link") and returns the Google consent URL
+func startGoogleAuth(c echo.Context, purpose string, userID *string) (string, error) {
+	state, challenge, err := createOAuthState(c, googleFlow, purpose, userID, nil, "")
+	if err != nil {
+		return "", err
+	}
+
+	return googleOAuthConfig.AuthCodeURL(state, oauth2.AccessTypeOnline,
+		oauth2.SetAuthURLParam("code_challenge", challenge),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	), nil
+}
+
+// redirectToFrontend sends the browser to a frontend page. Tokens go in the URL fragment,
+// which browsers never send to servers, so they do not end up in access logs or Referer headers.
+func redirectToFrontend(c echo.Context, path string, query, fragment url.Values) error {
+	target := frontendBaseURL() + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	if len(fragment) > 0 {
+		target += "#" + fragment.Encode()
+	}
+	return c.Redirect(http.StatusFound, target)
+}
+
+// redirectLoginResponse hands a successful external login to the frontend page at callbackPath,
+// or to the 2FA step when a second factor is required
+func redirectLoginResponse(c echo.Context, callbackPath string, responseData map[string]interface{}) error {
+	redirectPath, tokenParam := callbackPath, "token"
+	if responseData["mfa_required"] == true {
+		redirectPath, tokenParam = "/auth/2fa", "mfa_token"
+	}
+
+	data, _ := json.Marshal(responseData)
+	tokenValue, _ := responseData[tokenParam].(string)
+	fragment := url.Values{tokenParam: {tokenValue}, "data": {string(data)}}
+	if refreshToken, ok := responseData["refresh_token"].(string); ok {
+		fragment.Set("refresh_token", refreshToken)
+	}
+	return redirectToFrontend(c, redirectPath, nil, fragment)
+}
+
+// GetGoogleAuthURL starts Google sign-in. It returns the consent URL as JSON,
+// or redirects to it directly with ?redirect=true.
 func GetGoogleAuthURL(c echo.Context) error {
 	if googleOAuthConfig == nil {
 		return c.JSON(http.StatusServiceUnavailable, map[string]string{
@@ -52,126 +101,170 @@ func GetGoogleAuthURL(c echo.Context) error {
 		})
 	}
 
-	state := generateStateToken()
-	url := googleOAuthConfig.AuthCodeURL(state, oauth2.AccessTypeOnline)
-	
+	authURL, err := startGoogleAuth(c, "login", nil)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start Google sign-in"})
+	}
+
+	if c.QueryParam("redirect") == "true" {
+		return c.Redirect(http.StatusFound, authURL)
+	}
 	return c.JSON(http.StatusOK, map[string]string{
-		"auth_url": url,
-		"state":    state,
+		"auth_url": authURL,
 	})
 }
 
+// GoogleAuthCallback completes Google sign-in or account linking and redirects back to the frontend:
+//   - login: /auth/google/callback#token=...&data=... (or /auth/2fa#mfa_token=... when a second factor is required)
+//   - link: /settings?google=linked
+//   - errors: /login?error=... (or /settings?google_error=... for linking)
 func GoogleAuthCallback(c echo.Context) error {
 	if googleOAuthConfig == nil {
-		return c.JSON(http.StatusServiceUnavailable, map[string]string{
-			"error": "Google OAuth is not configured",
-		})
+		return redirectToFrontend(c, "/login", url.Values{"error": {"Google OAuth is not configured"}}, nil)
+	}
+
+	stored, message := consumeOAuthState(c, googleFlow, c.QueryParam("state"))
+	if stored == nil {
+		return redirectToFrontend(c, "/login", url.Values{"error": {message}}, nil)
+	}
+
+	failPath, failParam := "/login", "error"
+	if stored.Purpose == "link" {
+		failPath, failParam = "/settings", "google_error"
+	}
+	fail := func(message string) error {
+		return redirectToFrontend(c, failPath, url.Values{failParam: {message}}, nil)
+	}
+
+	// The user declined consent or Google reported an error
+	if errParam := c.QueryParam("error"); errParam != "" {
+		return fail("Google sign-in was cancelled: " + errParam)
 	}
 
 	code := c.QueryParam("code")
 	if code == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Authorization code not provided",
-		})
+		return fail("Authorization code not provided")
 	}
 
-	// Exchange code for token
-	token, err := googleOAuthConfig.Exchange(context.Background(), code)
+	// Exchange code for token, proving possession of the PKCE verifier
+	token, err := googleOAuthConfig.Exchange(context.Background(), code,
+		oauth2.SetAuthURLParam("code_verifier", stored.CodeVerifier))
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to exchange token: " + err.Error(),
-		})
+		return fail("Failed to exchange token")
 	}
 
 	// Get user info from Google
 	userInfo, err := getGoogleUserInfo(token.AccessToken)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to get user info: " + err.Error(),
-		})
+	if err != nil || userInfo.ID == "" {
+		return fail("Failed to get Google user info")
+	}
+
+	if stored.Purpose == "link" {
+		if message := linkGoogleAccount(stored.UserID.String, userInfo); message != "" {
+			return fail(message)
+		}
+		return redirectToFrontend(c, "/settings", url.Values{"google": {"linked"}}, nil)
 	}
 
 	// Find or create user
 	user, err := findOrCreateGoogleUser(userInfo)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to create/find user: " + err.Error(),
-		})
+		return fail(err.Error())
+	}
+	if user.Status != "active" {
+		return fail("User account is inactive")
 	}
 
-	// Get user's tenants (for now, we'll use first tenant or create one)
-	// TODO: Implement proper tenant selection for OAuth users
-	var tenantIDs []string
-	err = db.DB.Select(&tenantIDs, `
-		SELECT tenant_id 
-		FROM tenant_users 
-		WHERE user_id = $1 
-		AND deleted_at IS NULL 
-		AND status = 'active'
-	`, user.ID)
-	
-	var selectedTenantID string
-	if len(tenantIDs) > 0 {
-		selectedTenantID = tenantIDs[0]
-	} else {
-		// If user has no tenant, we can't generate token
-		// This should be handled by creating a tenant or joining one
-		return c.JSON(http.StatusForbidden, map[string]string{
-			"error": "User is not a member of any tenant",
-		})
+	// Same tenant selection, second factor and session as password login; the user can switch tenants later
+	status, responseData := buildLoginResponse(c, *user, nil)
+	if status != http.StatusOK {
+		message, _ := responseData["error"].(string)
+		return fail(message)
 	}
 
-	// Generate JWT
-	jwtToken := jwt.New(jwt.SigningMethodHS256)
-	claims := jwtToken.Claims.(jwt.MapClaims)
-	claims["user_id"] = user.ID
-	claims["tenant_id"] = selectedTenantID
-	claims["exp"] = time.Now().Add(time.Hour * 72).Unix()
+	return redirectLoginResponse(c, "/auth/google/callback", responseData)
+}
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		jwtSecret = "secret"
+// linkGoogleAccount attaches a Google identity to an existing account (auth_provider becomes 'both').
+// It returns an error message, or "" on success.
+func linkGoogleAccount(userID string, googleUser *GoogleUserInfo) string {
+	var ownerID string
+	err := db.DB.Get(&ownerID, `
+		SELECT id FROM users WHERE google_id = $1 AND deleted_at IS NULL
+	`, googleUser.ID)
+	if err == nil && ownerID != userID {
+		return "This Google account is already linked to another user"
+	} else if err != nil && err != sql.ErrNoRows {
+		return "Database error"
 	}
 
-	t, err := jwtToken.SignedString([]byte(jwtSecret))
+	result, err := db.DB.Exec(`
+		UPDATE users
+		SET google_id = $1,
+		    auth_provider = CASE WHEN auth_provider = 'email' THEN 'both' ELSE auth_provider END,
+		    updated_at = NOW()
+		WHERE id = $2 AND deleted_at IS NULL
+	`, googleUser.ID, userID)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to generate token",
+		return "Failed to link Google account"
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return "User not found"
+	}
+	return ""
+}
+
+// LinkGoogleAccount starts linking Google to the signed-in account; open the returned auth_url in the browser
+// It also sets the cookie binding the flow to this browser, so the request must be sent with credentials.
+func LinkGoogleAccount(c echo.Context) error {
+	if googleOAuthConfig == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{
+			"error": "Google OAuth is not configured",
 		})
 	}
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+
+	authURL, err := startGoogleAuth(c, "link", &userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start Google linking"})
+	}
 
-	// Redirect to frontend
-	frontendURL := os.Getenv("FRONTEND_URL")
-	if frontendURL == "" {
-		frontendURL = "http://localhost:3000"
+	return c.JSON(http.StatusOK, map[string]string{
+		"auth_url": authURL,
+	})
+}
+
+// UnlinkGoogleAccount removes the Google identity; the account must have a password to keep a way to sign in
+func UnlinkGoogleAccount(c echo.Context) error {
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+
+	var googleID sql.NullString
+	var hasPassword bool
+	err := db.DB.QueryRow(`
+		SELECT google_id, COALESCE(password_hash, '') <> ''
+		FROM users WHERE id = $1 AND deleted_at IS NULL
+	`, userID).Scan(&googleID, &hasPassword)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
 	}
-	
-	// Get user tenants for response (reuse tenantIDs from above)
-	responseData := map[string]interface{}{
-		"token":     t,
-		"user":      user,
-		"tenant_id": selectedTenantID,
+	if !googleID.Valid {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "No Google account is linked"})
 	}
-	if len(tenantIDs) > 1 {
-		responseData["tenants"] = tenantIDs
+	if !hasPassword {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Set a password before unlinking Google, otherwise you cannot sign in"})
 	}
-	
-	userJSON, _ := json.Marshal(responseData)
-	redirectHTML := fmt.Sprintf(`
-		<!DOCTYPE html>
-		<html>
-		<head><title>Redirecting...</title></head>
-		<body>
-			<script>
-				const data = %s;
-				window.location.href = '%s/auth/google/callback?token=' + encodeURIComponent(data.token) + '&data=' + encodeURIComponent(JSON.stringify(data));
-			</script>
-			<p>Redirecting...</p>
-		</body>
-		</html>
-	`, userJSON, frontendURL)
-
-	return c.HTML(http.StatusOK, redirectHTML)
+
+	_, err = db.DB.Exec(`
+		UPDATE users SET google_id = NULL, auth_provider = 'email', updated_at = NOW()
+		WHERE id = $1
+	`, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to unlink Google account"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Google account unlinked"})
 }
 
 type GoogleUserInfo struct {
@@ -246,7 +339,7 @@ func findOrCreateGoogleUser(googleUser *GoogleUserInfo) (*models.User, error) {
 	
 	if err == nil {
 		if authProvider.Valid && authProvider.String != "google" {
-			return nil, fmt.Errorf("Email sudah terdaftar dengan akun email/password")
+			return nil, fmt.Errorf("Email sudah terdaftar dengan akun email/password. Masuk dengan password lalu hubungkan Google di pengaturan akun")
 		}
 		if googleID.Valid {
 			user.GoogleID = &googleID.String
@@ -269,11 +362,12 @@ func findOrCreateGoogleUser(googleUser *GoogleUserInfo) (*models.User, error) {
 		fullName = googleUser.Email
 	}
 	
-	insertQuery := `INSERT INTO users (email, full_name, google_id, auth_provider, status) 
-	                VALUES ($1, $2, $3, 'google', 'active') 
+	// Google has already verified the address when verified_email is set
+	insertQuery := `INSERT INTO users (email, full_name, google_id, auth_provider, status, email_verified_at) 
+	                VALUES ($1, $2, $3, 'google', 'active', CASE WHEN $4 THEN NOW() END) 
 	                RETURNING id, email, full_name, auth_provider, status, created_at, updated_at`
 	var insertedStatus sql.NullString
-	err = db.DB.QueryRow(insertQuery, googleUser.Email, fullName, googleUser.ID).Scan(
+	err = db.DB.QueryRow(insertQuery, googleUser.Email, fullName, googleUser.ID, googleUser.VerifiedEmail).Scan(
 		&user.ID, &user.Email, &user.FullName, &authProvider, &insertedStatus, &user.CreatedAt, &user.UpdatedAt)
 	
 	if err != nil {
@@ -290,8 +384,3 @@ func findOrCreateGoogleUser(googleUser *GoogleUserInfo) (*models.User, error) {
 	
 	return &user, nil
 }
-
-func generateStateToken() string {
-	return fmt.Sprintf("%d", time.Now().UnixNano())
-}
-
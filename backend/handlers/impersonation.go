@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"rukunos-backend/db"
+	"rukunos-backend/middleware"
+	"rukunos-backend/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// impersonationTTL is deliberately short; the admin starts a new impersonation if they need more time
+func impersonationTTL() time.Duration {
+	return durationFromEnv("IMPERSONATION_TTL", 15*time.Minute)
+}
+
+// impersonationBanner is the text the frontend shows on every page while impersonating
+func impersonationBanner(actorName, targetName string) string {
+	return fmt.Sprintf("%s sedang melihat RukunOS sebagai %s. Pembayaran dan pengaturan keamanan akun dinonaktifkan.",
+		actorName, targetName)
+}
+
+// StartImpersonation issues a short-lived token to view the app as another member of the tenant
+func StartImpersonation(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
+	actorID := c.Get(string(middleware.CtxUserID)).(string)
+	targetID := c.Param("user_id")
+
+	// Impersonation is tied to a person's session so it ends when they log out; API keys have none
+	actorSessionID, _ := c.Get(string(middleware.CtxSessionID)).(string)
+	if middleware.IsAPIKeyRequest(c) || actorSessionID == "" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Impersonation requires a user session"})
+	}
+
+	req := new(models.StartImpersonationRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "reason is required"})
+	}
+	if _, err := uuid.Parse(targetID); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found or not a member of this tenant"})
+	}
+	if targetID == actorID {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "You cannot impersonate yourself"})
+	}
+
+	var target struct {
+		ID       string `db:"id"`
+		Email    string `db:"email"`
+		FullName string `db:"full_name"`
+	}
+	err := tdb.Get(&target, `
+		SELECT u.id, u.email, u.full_name
+		FROM users u
+		INNER JOIN tenant_users tu ON tu.user_id = u.id
+		WHERE u.id = $1 AND tu.tenant_id = $2 AND tu.status = 'active'
+		AND tu.deleted_at IS NULL AND u.deleted_at IS NULL AND u.status = 'active'
+	`, targetID, tenantID)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found or not a member of this tenant"})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	// Impersonating someone must never grant more than the admin already has
+	ownPermissions, _ := c.Get(string(middleware.CtxUserPermissions)).([]string)
+	granted := make(map[string]bool, len(ownPermissions))
+	for _, p := range ownPermissions {
+		granted[p] = true
+	}
+	targetPermissions, err := middleware.GetUserPermissions(target.ID, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	for _, p := range targetPermissions {
+		if !granted[p] {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "You cannot impersonate a user with permissions you do not have"})
+		}
+	}
+
+	var actorName string
+	if err := tdb.Get(&actorName, `SELECT full_name FROM users WHERE id = $1`, actorID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	expiresAt := time.Now().Add(impersonationTTL())
+	var impersonationID string
+	err = tdb.QueryRow(`
+		INSERT INTO impersonation_sessions (tenant_id, actor_user_id, actor_session_id, target_user_id, reason,
+		                                    ip_address, user_agent, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`, tenantID, actorID, actorSessionID, target.ID, req.Reason, c.RealIP(), c.Request().UserAgent(), expiresAt).Scan(&impersonationID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start impersonation"})
+	}
+
+	banner := impersonationBanner(actorName, target.FullName)
+	token := jwt.New(jwt.SigningMethodHS256)
+	claims := token.Claims.(jwt.MapClaims)
+	claims["user_id"] = target.ID
+	claims["tenant_id"] = tenantID
+	claims["imp"] = impersonationID
+	claims["act"] = map[string]interface{}{"user_id": actorID, "name": actorName}
+	claims["banner"] = banner
+	claims["exp"] = expiresAt.Unix()
+	signed, err := token.SignedString(jwtSecret())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate token"})
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"token":      signed,
+		"expires_in": int64(impersonationTTL().Seconds()),
+		"impersonation": map[string]interface{}{
+			"id":         impersonationID,
+			"banner":     banner,
+			"expires_at": expiresAt,
+			"target_user": map[string]interface{}{
+				"id":        target.ID,
+				"email":     target.Email,
+				"full_name": target.FullName,
+			},
+		},
+	})
+}
+
+// getImpersonationInfo describes the current impersonation for GetCurrentUser
+func getImpersonationInfo(tdb *db.TenantDB, impersonationID string) (map[string]interface{}, error) {
+	var row struct {
+		ActorID    string    `db:"actor_user_id"`
+		ActorName  string    `db:"actor_name"`
+		TargetName string    `db:"target_name"`
+		ExpiresAt  time.Time `db:"expires_at"`
+	}
+	err := tdb.Get(&row, `
+		SELECT i.actor_user_id, a.full_name AS actor_name, t.full_name AS target_name, i.expires_at
+		FROM impersonation_sessions i
+		INNER JOIN users a ON a.id = i.actor_user_id
+		INNER JOIN users t ON t.id = i.target_user_id
+		WHERE i.id = $1
+	`, impersonationID)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"id":         impersonationID,
+		"actor_id":   row.ActorID,
+		"actor_name": row.ActorName,
+		"banner":     impersonationBanner(row.ActorName, row.TargetName),
+		"expires_at": row.ExpiresAt,
+	}, nil
+}
+
+// EndImpersonation ends the impersonation behind the current impersonation token
+func EndImpersonation(c echo.Context) error {
+	if !middleware.IsImpersonating(c) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Not impersonating"})
+	}
+	impersonationID := c.Get(string(middleware.CtxImpersonationID)).(string)
+
+	_, err := middleware.TenantDB(c).Exec(`UPDATE impersonation_sessions SET ended_at = NOW() WHERE id = $1 AND ended_at IS NULL`, impersonationID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to end impersonation"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Impersonation ended"})
+}
+
+// RevokeImpersonation lets an admin end an impersonation from their own session (e.g. a lost browser tab)
+func RevokeImpersonation(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
+	impersonationID := c.Param("impersonation_id")
+	if _, err := uuid.Parse(impersonationID); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Impersonation not found"})
+	}
+
+	result, err := tdb.Exec(`
+		UPDATE impersonation_sessions SET ended_at = NOW()
+		WHERE id = $1 AND tenant_id = $2 AND ended_at IS NULL
+	`, impersonationID, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to end impersonation"})
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Impersonation not found or already ended"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Impersonation ended"})
+}
+
+// ListImpersonations lists who impersonated whom in the tenant, newest first
+func ListImpersonations(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
+
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	where := ` WHERE i.tenant_id = $1`
+	args := []interface{}{tenantID}
+	for param, column := range map[string]string{"actor_user_id": "i.actor_user_id", "target_user_id": "i.target_user_id"} {
+		value := c.QueryParam(param)
+		if value == "" {
+			continue
+		}
+		if _, err := uuid.Parse(value); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid " + param})
+		}
+		args = append(args, value)
+		where += ` AND ` + column + ` = $` + strconv.Itoa(len(args))
+	}
+
+	var total int
+	if err := tdb.Get(&total, `SELECT COUNT(*) FROM impersonation_sessions i`+where, args...); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	sessions := []models.ImpersonationSession{}
+	query := `
+		SELECT i.id, i.tenant_id, i.actor_user_id, a.full_name AS actor_name, i.target_user_id, t.full_name AS target_name,
+		       i.reason, i.ip_address, i.created_at, i.expires_at, i.ended_at,
+		       (SELECT COUNT(*) FROM impersonation_audit_logs l WHERE l.impersonation_id = i.id) AS request_count
+		FROM impersonation_sessions i
+		INNER JOIN users a ON a.id = i.actor_user_id
+		INNER JOIN users t ON t.id = i.target_user_id` + where + `
+		ORDER BY i.created_at DESC
+		LIMIT $` + strconv.Itoa(len(args)+1) + ` OFFSET $` + strconv.Itoa(len(args)+2)
+	if err := tdb.Select(&sessions, query, append(args, limit, (page-1)*limit)...); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch impersonations"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"impersonations": sessions,
+		"pagination": map[string]interface{}{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": (total + limit - 1) / limit,
+		},
+	})
+}
+
+// ListImpersonationRequests returns the audit trail of every request made during an impersonation
+func ListImpersonationRequests(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
+	impersonationID := c.Param("impersonation_id")
+	if _, err := uuid.Parse(impersonationID); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Impersonation not found"})
+	}
+
+	var exists bool
+	err := tdb.Get(&exists, `SELECT EXISTS(SELECT 1 FROM impersonation_sessions WHERE id = $1 AND tenant_id = $2)`,
+		impersonationID, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if !exists {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Impersonation not found"})
+	}
+
+	logs := []models.ImpersonationRequestLog{}
+	err = tdb.Select(&logs, `
+		SELECT id, method, path, query, status_code, ip_address, created_at
+		FROM impersonation_audit_logs
+		WHERE impersonation_id = $1 AND tenant_id = $2
+		ORDER BY created_at
+	`, impersonationID, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch requests"})
+	}
+
+	return c.JSON(http.StatusOK, logs)
+}
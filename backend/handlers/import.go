@@ -0,0 +1,629 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"rukunos-backend/db"
+	"rukunos-backend/middleware"
+	"rukunos-backend/models"
+	"rukunos-backend/services"
+	"rukunos-backend/spreadsheet"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// maxImportFileSize limits uploaded spreadsheets to 5 MB
+const maxImportFileSize = 5 << 20
+
+// importColumnAliases maps accepted header names (normalised) to canonical field names
+var importColumnAliases = map[string]map[string]string{
+	"units": {
+		"code": "code", "kode": "code", "kode_unit": "code", "unit_code": "code",
+		"type": "type", "tipe": "type", "jenis": "type", "tipe_unit": "type",
+		"owner_name": "owner_name", "nama_pemilik": "owner_name", "pemilik": "owner_name",
+		"owner_phone": "owner_phone", "telepon_pemilik": "owner_phone", "no_hp_pemilik": "owner_phone",
+		"owner_email": "owner_email", "email_pemilik": "owner_email",
+		"address": "address", "alamat": "address",
+	},
+	"residents": {
+		"full_name": "full_name", "nama": "full_name", "nama_lengkap": "full_name", "name": "full_name",
+		"email": "email",
+		"phone": "phone", "telepon": "phone", "no_hp": "phone", "whatsapp": "phone",
+		"unit_code": "unit_code", "kode_unit": "unit_code", "unit": "unit_code",
+		"role": "role", "peran": "role",
+	},
+}
+
+var importRequiredColumns = map[string][]string{
+	"units":     {"code", "type"},
+	"residents": {"full_name", "email", "unit_code"},
+}
+
+// CreateImportJob uploads a CSV/XLSX of units or residents, validates every row and stores the job.
+// Form fields: file, type (units|residents), dry_run (default true). With dry_run=false a clean file is applied immediately.
+func CreateImportJob(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+
+	importType := c.FormValue("type")
+	if _, ok := importColumnAliases[importType]; !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "type must be 'units' or 'residents'"})
+	}
+	dryRun := c.FormValue("dry_run") != "false"
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "file is required"})
+	}
+	tx, err := middleware.TenantDB(c).Beginx()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
+	}
+	defer tx.Rollback()
+
+	// Import jobs keep the parsed rows, so a tenant over its storage limit cannot upload more
+	if _, err := services.CheckQuota(tx, tenantID, services.QuotaStorage, 0); err != nil {
+		return quotaErrorResponse(c, err)
+	}
+	if fileHeader.Size > maxImportFileSize {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "File is too large (max 5 MB)"})
+	}
+	format, err := spreadsheet.DetectFormat(fileHeader.Filename)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Failed to read file"})
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxImportFileSize+1))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Failed to read file"})
+	}
+
+	sheetRows, err := spreadsheet.ReadAll(data, format)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Failed to parse file: " + err.Error()})
+	}
+
+	records, rowErrors := parseImportRows(importType, sheetRows)
+	if len(records) == 0 && len(rowErrors) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "File contains no data rows"})
+	}
+	if len(rowErrors) == 0 {
+		rowErrors, err = validateImportRows(tx, tenantID, importType, records)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to validate rows: " + err.Error()})
+		}
+	}
+
+	rowsJSON, _ := json.Marshal(records)
+	reportJSON, _ := json.Marshal(rowErrors)
+	errorRows := countErrorRows(rowErrors)
+
+	var job models.ImportJob
+	err = tx.QueryRowx(`
+		INSERT INTO import_jobs (tenant_id, type, filename, status, total_rows, valid_rows, error_rows, rows, report, created_by)
+		VALUES ($1, $2, $3, 'validated', $4, $5, $6, $7, $8, $9)
+		RETURNING id, tenant_id, type, filename, status, total_rows, valid_rows, error_rows, rows, report,
+		          error, created_by, applied_by, applied_at, created_at, updated_at
+	`, tenantID, importType, fileHeader.Filename, len(records), len(records)-errorRows, errorRows,
+		rowsJSON, reportJSON, userID).StructScan(&job)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save import job: " + err.Error()})
+	}
+	if err = tx.Commit(); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit transaction"})
+	}
+
+	if dryRun || errorRows > 0 {
+		status := http.StatusCreated
+		if !dryRun {
+			status = http.StatusUnprocessableEntity
+		}
+		return c.JSON(status, importJobResponse(job, rowErrors))
+	}
+
+	return applyImportJob(c, job)
+}
+
+// ListImportJobs lists the import jobs of the tenant
+func ListImportJobs(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+
+	jobs := []models.ImportJob{}
+	err := middleware.TenantDB(c).Select(&jobs, `
+		SELECT id, tenant_id, type, filename, status, total_rows, valid_rows, error_rows, error,
+		       created_by, applied_by, applied_at, created_at, updated_at
+		FROM import_jobs
+		WHERE tenant_id = $1
+		ORDER BY created_at DESC
+		LIMIT 50
+	`, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch import jobs: " + err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"jobs": jobs,
+	})
+}
+
+// GetImportJob returns an import job with its row-level error report
+func GetImportJob(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+
+	job, err := getImportJob(tenantID, c.Param("job_id"))
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Import job not found"})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	var rowErrors []models.ImportRowError
+	json.Unmarshal(job.Report, &rowErrors)
+	return c.JSON(http.StatusOK, importJobResponse(job, rowErrors))
+}
+
+// ApplyImportJob applies a previously validated (dry-run) import job
+func ApplyImportJob(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+
+	job, err := getImportJob(tenantID, c.Param("job_id"))
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Import job not found"})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	if job.Status != "validated" {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Import job has already been " + job.Status})
+	}
+	if job.ErrorRows > 0 {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": "Import job has validation errors. Fix the file and upload it again."})
+	}
+
+	return applyImportJob(c, job)
+}
+
+func getImportJob(tenantID, jobID string) (models.ImportJob, error) {
+	var job models.ImportJob
+	err := db.ForTenant(tenantID).Get(&job, `
+		SELECT id, tenant_id, type, filename, status, total_rows, valid_rows, error_rows, rows, report,
+		       error, created_by, applied_by, applied_at, created_at, updated_at
+		FROM import_jobs
+		WHERE id = $1 AND tenant_id = $2
+	`, jobID, tenantID)
+	return job, err
+}
+
+func importJobResponse(job models.ImportJob, rowErrors []models.ImportRowError) map[string]interface{} {
+	if rowErrors == nil {
+		rowErrors = []models.ImportRowError{}
+	}
+	return map[string]interface{}{
+		"job":    job,
+		"errors": rowErrors,
+	}
+}
+
+// applyImportJob re-validates the stored rows against the current data and inserts them in a single transaction
+func applyImportJob(c echo.Context, job models.ImportJob) error {
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+
+	var records []map[string]string
+	if err := json.Unmarshal(job.Rows, &records); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to read import rows"})
+	}
+
+	tdb := middleware.TenantDB(c)
+	tx, err := tdb.Beginx()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
+	}
+	defer tx.Rollback()
+
+	// Lock the job so it cannot be applied twice concurrently
+	var status string
+	if err := tx.Get(&status, `SELECT status FROM import_jobs WHERE id = $1 FOR UPDATE`, job.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if status != "validated" {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Import job has already been " + status})
+	}
+
+	// Data may have changed since the dry run
+	rowErrors, err := validateImportRows(tx, job.TenantID, job.Type, records)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to validate rows: " + err.Error()})
+	}
+	if len(rowErrors) > 0 {
+		tx.Rollback()
+		reportJSON, _ := json.Marshal(rowErrors)
+		errorRows := countErrorRows(rowErrors)
+		tdb.Exec(`
+			UPDATE import_jobs SET report = $1, error_rows = $2, valid_rows = total_rows - $2, updated_at = NOW()
+			WHERE id = $3
+		`, reportJSON, errorRows, job.ID)
+		job.ErrorRows = errorRows
+		job.ValidRows = job.TotalRows - errorRows
+		return c.JSON(http.StatusUnprocessableEntity, importJobResponse(job, rowErrors))
+	}
+
+	// Every unit row is a new unit; residents who already hold a seat in the tenant do not count again
+	quotaName, added := services.QuotaUnits, len(records)
+	if job.Type == "residents" {
+		quotaName = services.QuotaUsers
+		emails := make([]string, 0, len(records))
+		for _, r := range records {
+			emails = append(emails, strings.ToLower(r["email"]))
+		}
+		err = tx.Get(&added, `
+			SELECT COUNT(DISTINCT e) FROM unnest($1::text[]) AS e
+			WHERE NOT EXISTS (
+				SELECT 1 FROM users u
+				INNER JOIN tenant_users tu ON tu.user_id = u.id
+				WHERE LOWER(u.email) = e AND tu.tenant_id = $2
+				AND tu.status IN ('active', 'invited') AND tu.deleted_at IS NULL AND u.deleted_at IS NULL
+			)
+		`, pq.Array(emails), job.TenantID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check plan quota"})
+		}
+	}
+	if _, err := services.CheckQuota(tx, job.TenantID, quotaName, added); err != nil {
+		return quotaErrorResponse(c, err)
+	}
+
+	var invites []pendingInvitation
+	switch job.Type {
+	case "units":
+		err = applyUnitImport(tx, job.TenantID, records)
+	case "residents":
+		invites, err = applyResidentImport(tx, job.TenantID, userID, records)
+	}
+	if err != nil {
+		tx.Rollback()
+		tdb.Exec(`UPDATE import_jobs SET status = 'failed', error = $1, updated_at = NOW() WHERE id = $2`, err.Error(), job.ID)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Import failed, no rows were imported: " + err.Error()})
+	}
+
+	_, err = tx.Exec(`
+		UPDATE import_jobs SET status = 'applied', applied_by = $1, applied_at = NOW(), updated_at = NOW()
+		WHERE id = $2
+	`, userID, job.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update import job"})
+	}
+
+	if err = tx.Commit(); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit transaction"})
+	}
+
+	// Invitations are sent only after the data is committed
+	invitationErrors := 0
+	for _, inv := range invites {
+		if err := sendInvitation(job.TenantID, inv.UserID, inv.Email, inv.FullName, inv.Token); err != nil {
+			c.Logger().Warnf("Failed to send invitation to %s: %v", inv.Email, err)
+			invitationErrors++
+		}
+	}
+
+	updated, err := getImportJob(job.TenantID, job.ID)
+	if err != nil {
+		updated = job
+	}
+	response := importJobResponse(updated, nil)
+	response["imported_count"] = len(records)
+	if job.Type == "residents" {
+		response["invitations_sent"] = len(invites) - invitationErrors
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// parseImportRows maps the header row to canonical fields and returns one record per non-empty data row
+func parseImportRows(importType string, rows [][]string) ([]map[string]string, []models.ImportRowError) {
+	if len(rows) == 0 {
+		return nil, []models.ImportRowError{{Row: 1, Message: "File is empty"}}
+	}
+
+	aliases := importColumnAliases[importType]
+	fields := make([]string, len(rows[0]))
+	present := map[string]bool{}
+	for i, header := range rows[0] {
+		key := strings.ToLower(strings.TrimSpace(header))
+		key = strings.NewReplacer(" ", "_", ".", "", "-", "_").Replace(key)
+		if field, ok := aliases[key]; ok {
+			fields[i] = field
+			present[field] = true
+		}
+	}
+
+	rowErrors := []models.ImportRowError{}
+	for _, required := range importRequiredColumns[importType] {
+		if !present[required] {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: 1, Field: required, Message: "Required column is missing"})
+		}
+	}
+	if len(rowErrors) > 0 {
+		return nil, rowErrors
+	}
+
+	records := []map[string]string{}
+	for i, row := range rows[1:] {
+		record := map[string]string{"_row": strconv.Itoa(i + 2)}
+		empty := true
+		for col, value := range row {
+			if col >= len(fields) || fields[col] == "" {
+				continue
+			}
+			value = strings.TrimSpace(value)
+			if value != "" {
+				empty = false
+			}
+			record[fields[col]] = value
+		}
+		if !empty {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// validateImportRows checks every record against the file itself and the tenant's current data
+func validateImportRows(q sqlx.Queryer, tenantID, importType string, records []map[string]string) ([]models.ImportRowError, error) {
+	switch importType {
+	case "units":
+		return validateUnitRows(q, tenantID, records)
+	case "residents":
+		return validateResidentRows(q, tenantID, records)
+	}
+	return nil, fmt.Errorf("unknown import type %q", importType)
+}
+
+func validateUnitRows(q sqlx.Queryer, tenantID string, records []map[string]string) ([]models.ImportRowError, error) {
+	var existingCodes []string
+	err := sqlx.Select(q, &existingCodes, `SELECT code FROM units WHERE tenant_id = $1`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	taken := map[string]bool{}
+	for _, code := range existingCodes {
+		taken[strings.ToUpper(code)] = true
+	}
+
+	rowErrors := []models.ImportRowError{}
+	seen := map[string]int{}
+	for _, r := range records {
+		row, _ := strconv.Atoi(r["_row"])
+		code := r["code"]
+
+		if code == "" {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: row, Field: "code", Message: "Code is required"})
+		} else if taken[strings.ToUpper(code)] {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: row, Field: "code", Value: code, Message: "Unit code already exists"})
+		} else if first, dup := seen[strings.ToUpper(code)]; dup {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: row, Field: "code", Value: code, Message: fmt.Sprintf("Duplicate unit code (first seen on row %d)", first)})
+		} else {
+			seen[strings.ToUpper(code)] = row
+		}
+
+		switch strings.ToLower(r["type"]) {
+		case "rumah", "ruko", "kios":
+		case "":
+			rowErrors = append(rowErrors, models.ImportRowError{Row: row, Field: "type", Message: "Type is required"})
+		default:
+			rowErrors = append(rowErrors, models.ImportRowError{Row: row, Field: "type", Value: r["type"], Message: "Type must be one of rumah, ruko, kios"})
+		}
+
+		if email := r["owner_email"]; email != "" {
+			if _, err := mail.ParseAddress(email); err != nil {
+				rowErrors = append(rowErrors, models.ImportRowError{Row: row, Field: "owner_email", Value: email, Message: "Invalid email address"})
+			}
+		}
+	}
+	return rowErrors, nil
+}
+
+func validateResidentRows(q sqlx.Queryer, tenantID string, records []map[string]string) ([]models.ImportRowError, error) {
+	unitCodes, err := tenantUnitCodes(q, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := tenantRoleNames(q, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	var memberEmails []string
+	err = sqlx.Select(q, &memberEmails, `
+		SELECT LOWER(u.email)
+		FROM users u
+		INNER JOIN tenant_users tu ON u.id = tu.user_id
+		WHERE tu.tenant_id = $1 AND tu.deleted_at IS NULL AND u.deleted_at IS NULL
+	`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	members := map[string]bool{}
+	for _, email := range memberEmails {
+		members[email] = true
+	}
+
+	rowErrors := []models.ImportRowError{}
+	seen := map[string]int{}
+	for _, r := range records {
+		row, _ := strconv.Atoi(r["_row"])
+
+		if r["full_name"] == "" {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: row, Field: "full_name", Message: "Full name is required"})
+		}
+
+		email := strings.ToLower(r["email"])
+		if email == "" {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: row, Field: "email", Message: "Email is required"})
+		} else if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: row, Field: "email", Value: r["email"], Message: "Invalid email address"})
+		} else if members[email] {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: row, Field: "email", Value: r["email"], Message: "User is already a member of this tenant"})
+		} else if first, dup := seen[email]; dup {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: row, Field: "email", Value: r["email"], Message: fmt.Sprintf("Duplicate email (first seen on row %d)", first)})
+		} else {
+			seen[email] = row
+		}
+
+		if code := r["unit_code"]; code == "" {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: row, Field: "unit_code", Message: "Unit code is required"})
+		} else if _, ok := unitCodes[strings.ToUpper(code)]; !ok {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: row, Field: "unit_code", Value: code, Message: "Unit not found"})
+		}
+
+		if role := r["role"]; role != "" {
+			if _, ok := roles[strings.ToLower(role)]; !ok {
+				rowErrors = append(rowErrors, models.ImportRowError{Row: row, Field: "role", Value: role, Message: "Role not found"})
+			}
+		}
+	}
+	return rowErrors, nil
+}
+
+// tenantUnitCodes maps upper-cased unit codes to unit IDs
+func tenantUnitCodes(q sqlx.Queryer, tenantID string) (map[string]string, error) {
+	var units []struct {
+		ID   string `db:"id"`
+		Code string `db:"code"`
+	}
+	err := sqlx.Select(q, &units, `SELECT id, code FROM units WHERE tenant_id = $1 AND deleted_at IS NULL`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	codes := map[string]string{}
+	for _, u := range units {
+		codes[strings.ToUpper(u.Code)] = u.ID
+	}
+	return codes, nil
+}
+
+// tenantRoleNames maps lower-cased role names to role IDs
+func tenantRoleNames(q sqlx.Queryer, tenantID string) (map[string]string, error) {
+	var roles []struct {
+		ID   string `db:"id"`
+		Name string `db:"name"`
+	}
+	err := sqlx.Select(q, &roles, `SELECT id, name FROM roles WHERE tenant_id = $1 AND deleted_at IS NULL`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]string{}
+	for _, r := range roles {
+		names[strings.ToLower(r.Name)] = r.ID
+	}
+	return names, nil
+}
+
+func countErrorRows(rowErrors []models.ImportRowError) int {
+	rows := map[int]bool{}
+	for _, e := range rowErrors {
+		rows[e.Row] = true
+	}
+	return len(rows)
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func applyUnitImport(tx *sqlx.Tx, tenantID string, records []map[string]string) error {
+	for _, r := range records {
+		_, err := tx.Exec(`
+			INSERT INTO units (tenant_id, code, type, owner_name, owner_phone, owner_email, address, status)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, 'active')
+		`, tenantID, r["code"], strings.ToLower(r["type"]), nullIfEmpty(r["owner_name"]), nullIfEmpty(r["owner_phone"]),
+			nullIfEmpty(r["owner_email"]), nullIfEmpty(r["address"]))
+		if err != nil {
+			return fmt.Errorf("row %s: %v", r["_row"], err)
+		}
+	}
+	return nil
+}
+
+type pendingInvitation struct {
+	UserID   string
+	Email    string
+	FullName string
+	Token    string
+}
+
+// applyResidentImport creates invited accounts (or links existing accounts), assigns them to units and creates invitations
+func applyResidentImport(tx *sqlx.Tx, tenantID, createdBy string, records []map[string]string) ([]pendingInvitation, error) {
+	unitCodes, err := tenantUnitCodes(tx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := tenantRoleNames(tx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defaultRoleID, ok := roles["warga"]
+	if !ok {
+		defaultRoleID, ok = roles["member"]
+	}
+	if !ok {
+		return nil, fmt.Errorf("default Warga role not found")
+	}
+
+	invites := []pendingInvitation{}
+	for _, r := range records {
+		email := strings.ToLower(r["email"])
+		unitID := unitCodes[strings.ToUpper(r["unit_code"])]
+		roleID := defaultRoleID
+		if r["role"] != "" {
+			roleID = roles[strings.ToLower(r["role"])]
+		}
+
+		// Reuse an existing account with this email (e.g. member of another RT)
+		var userID string
+		err := tx.Get(&userID, `SELECT id FROM users WHERE LOWER(email) = $1 AND deleted_at IS NULL LIMIT 1`, email)
+		if err == sql.ErrNoRows {
+			err = tx.QueryRow(`
+				INSERT INTO users (email, full_name, phone, auth_provider, status)
+				VALUES ($1, $2, $3, 'email', 'invited')
+				RETURNING id
+			`, email, r["full_name"], nullIfEmpty(r["phone"])).Scan(&userID)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("row %s: %v", r["_row"], err)
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO tenant_users (tenant_id, user_id, role_id, unit_id, status)
+			VALUES ($1, $2, $3, $4, 'invited')
+			ON CONFLICT (tenant_id, user_id) DO UPDATE
+			SET role_id = EXCLUDED.role_id, unit_id = EXCLUDED.unit_id, status = 'invited',
+			    deleted_at = NULL, updated_at = NOW()
+		`, tenantID, userID, roleID, unitID)
+		if err != nil {
+			return nil, fmt.Errorf("row %s: %v", r["_row"], err)
+		}
+
+		token, err := createUserInvitation(tx, tenantID, userID, email, &unitID, &roleID, createdBy)
+		if err != nil {
+			return nil, fmt.Errorf("row %s: %v", r["_row"], err)
+		}
+		invites = append(invites, pendingInvitation{UserID: userID, Email: email, FullName: r["full_name"], Token: token})
+	}
+	return invites, nil
+}
@@ -0,0 +1,608 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"rukunos-backend/db"
+	"rukunos-backend/middleware"
+	"rukunos-backend/models"
+	"rukunos-backend/services"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// invitationTTL is how long an invitation link stays valid
+const invitationTTL = 7 * 24 * time.Hour
+
+// newSecureToken returns a random URL-safe token and its SHA-256 hash (the hash is what gets stored)
+func newSecureToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := hex.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// frontendBaseURL returns the public URL of the web app
+func frontendBaseURL() string {
+	frontendURL := os.Getenv("FRONTEND_URL")
+	if frontendURL == "" {
+		frontendURL = "http://localhost:3000"
+	}
+	return frontendURL
+}
+
+// createUserInvitation creates an invitation for a pre-created (invited) user inside tx and returns the plain token
+func createUserInvitation(tx *sqlx.Tx, tenantID, userID, email string, unitID, roleID *string, createdBy string) (string, error) {
+	token, tokenHash, err := newSecureToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO invitations (tenant_id, user_id, email, unit_id, role_id, token_hash, expires_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, tenantID, userID, email, unitID, roleID, tokenHash, time.Now().Add(invitationTTL), createdBy)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// sendInvitation emails the invitation link to the invitee
+func sendInvitation(tenantID, userID, email, fullName, token string) error {
+	var tenantName string
+	if err := db.ForTenant(tenantID).Get(&tenantName, `SELECT name FROM tenants WHERE id = $1`, tenantID); err != nil {
+		return err
+	}
+
+	link := frontendBaseURL() + "/invitations/accept?token=" + url.QueryEscape(token)
+	return services.SendEmail(services.Message{
+		TenantID:  tenantID,
+		UserID:    userID,
+		Recipient: email,
+		Subject:   fmt.Sprintf("Undangan bergabung dengan %s di RukunOS", tenantName),
+		Body: fmt.Sprintf("Halo %s,\n\nAnda diundang untuk bergabung dengan %s di RukunOS. "+
+			"Buka tautan berikut untuk mengaktifkan akun Anda (berlaku %d hari):\n%s\n",
+			fullName, tenantName, int(invitationTTL.Hours()/24), link),
+	})
+}
+
+// AcceptInvitation activates an invited account and its tenant membership
+func AcceptInvitation(c echo.Context) error {
+	req := new(models.AcceptInvitationRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	if req.Token == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "token is required"})
+	}
+
+	tx, err := db.DB.Beginx()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
+	}
+	defer tx.Rollback()
+
+	invitation, status, message := lockUsableInvitation(tx, req.Token)
+	if status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+	if !invitation.UserID.Valid {
+		// Shareable links and email invitations without a pre-created account are used by
+		// registering with invitation_token or, for existing accounts, POST /api/me/invitations/join
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invitation is not linked to an account, register or sign in to use it"})
+	}
+
+	var userStatus string
+	var email string
+	err = tx.QueryRow(`
+		SELECT status, email FROM users WHERE id = $1 AND deleted_at IS NULL
+	`, invitation.UserID.String).Scan(&userStatus, &email)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	// A brand-new invited account has no password yet and must choose one
+	if userStatus == "invited" {
+		if req.Password == nil || len(*req.Password) < 6 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "password is required and must be at least 6 characters"})
+		}
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to hash password"})
+		}
+		_, err = tx.Exec(`
+			UPDATE users
+			SET password_hash = $1, status = 'active', updated_at = NOW()
+			WHERE id = $2
+		`, string(hashedPassword), invitation.UserID.String)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to activate user"})
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE tenant_users
+		SET status = 'active', updated_at = NOW()
+		WHERE tenant_id = $1 AND user_id = $2 AND deleted_at IS NULL
+	`, invitation.TenantID, invitation.UserID.String)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to activate membership"})
+	}
+
+	// The invitation link was delivered to this address, so it is verified
+	_, err = tx.Exec(`
+		UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()
+		WHERE id = $1
+	`, invitation.UserID.String)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to activate user"})
+	}
+
+	if err = consumeInvitation(tx, invitation); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to accept invitation"})
+	}
+
+	if err = tx.Commit(); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit transaction"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":   "Invitation accepted. You can now log in.",
+		"email":     email,
+		"tenant_id": invitation.TenantID,
+	})
+}
+
+// lockUsableInvitation locks the invitation for token inside tx and checks that it can still be used.
+// It returns the invitation, or a non-zero HTTP status with an error message.
+func lockUsableInvitation(tx *sqlx.Tx, token string) (models.Invitation, int, string) {
+	var invitation models.Invitation
+	err := tx.Get(&invitation, `
+		SELECT id, tenant_id, user_id, email, unit_id, role_id, token_hash, expires_at, accepted_at, revoked_at,
+		       max_uses, use_count, note, created_by, created_at
+		FROM invitations
+		WHERE token_hash = $1
+		FOR UPDATE
+	`, hashToken(token))
+	if err == sql.ErrNoRows {
+		return invitation, http.StatusNotFound, "Invitation not found"
+	} else if err != nil {
+		return invitation, http.StatusInternalServerError, "Database error"
+	}
+	if invitation.RevokedAt.Valid {
+		return invitation, http.StatusGone, "Invitation has been revoked"
+	}
+	if invitation.AcceptedAt.Valid || (invitation.MaxUses.Valid && int64(invitation.UseCount) >= invitation.MaxUses.Int64) {
+		return invitation, http.StatusGone, "Invitation has already been used"
+	}
+	if time.Now().After(invitation.ExpiresAt) {
+		return invitation, http.StatusGone, "Invitation has expired"
+	}
+	return invitation, 0, ""
+}
+
+// consumeInvitation records one use; the invitation is marked accepted once its uses run out
+func consumeInvitation(tx *sqlx.Tx, invitation models.Invitation) error {
+	_, err := tx.Exec(`
+		UPDATE invitations
+		SET use_count = use_count + 1,
+		    accepted_at = CASE WHEN max_uses IS NOT NULL AND use_count + 1 >= max_uses THEN NOW() END
+		WHERE id = $1
+	`, invitation.ID)
+	return err
+}
+
+// defaultMemberRoleID returns the tenant's system Warga (or Member) role
+func defaultMemberRoleID(q sqlx.Queryer, tenantID string) (string, error) {
+	var roleID string
+	err := sqlx.Get(q, &roleID, `
+		SELECT id FROM roles 
+		WHERE tenant_id = $1 
+		AND (name = 'Warga' OR name = 'Member')
+		AND is_system = true 
+		AND deleted_at IS NULL
+		LIMIT 1
+	`, tenantID)
+	return roleID, err
+}
+
+// resolveUnitAndRole checks that the optional unit and role belong to the tenant and defaults the role to Warga.
+// It returns the role ID, or a non-zero HTTP status with an error message.
+func resolveUnitAndRole(q sqlx.Queryer, tenantID string, unitID, roleID *string) (string, int, string) {
+	if unitID != nil && *unitID != "" {
+		var unitExists bool
+		err := sqlx.Get(q, &unitExists, `
+			SELECT EXISTS(
+				SELECT 1 FROM units 
+				WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
+			)
+		`, *unitID, tenantID)
+		if err != nil {
+			return "", http.StatusInternalServerError, "Database error"
+		}
+		if !unitExists {
+			return "", http.StatusNotFound, "Unit not found"
+		}
+	}
+
+	if roleID != nil && *roleID != "" {
+		var roleExists bool
+		err := sqlx.Get(q, &roleExists, `
+			SELECT EXISTS(
+				SELECT 1 FROM roles 
+				WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
+			)
+		`, *roleID, tenantID)
+		if err != nil {
+			return "", http.StatusInternalServerError, "Database error"
+		}
+		if !roleExists {
+			return "", http.StatusNotFound, "Role not found"
+		}
+		return *roleID, 0, ""
+	}
+
+	defaultRoleID, err := defaultMemberRoleID(q, tenantID)
+	if err != nil {
+		return "", http.StatusInternalServerError, "Failed to find default Warga role"
+	}
+	return defaultRoleID, 0, ""
+}
+
+// addTenantMember makes userID an active member of the tenant inside tx, reactivating a removed membership.
+// It returns false when the user is already an active member, and a *services.QuotaExceededError when a new
+// member would go over the plan's user limit (an invited member already holds a seat).
+func addTenantMember(tx *sqlx.Tx, tenantID, userID, roleID string, unitID *string) (bool, error) {
+	var holdsSeat bool
+	err := tx.Get(&holdsSeat, `
+		SELECT EXISTS(
+			SELECT 1 FROM tenant_users
+			WHERE tenant_id = $1 AND user_id = $2 AND status IN ('active', 'invited') AND deleted_at IS NULL
+		)
+	`, tenantID, userID)
+	if err != nil {
+		return false, err
+	}
+	if !holdsSeat {
+		if _, err := services.CheckQuota(tx, tenantID, services.QuotaUsers, 1); err != nil {
+			return false, err
+		}
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO tenant_users (tenant_id, user_id, role_id, unit_id, status)
+		VALUES ($1, $2, $3, $4, 'active')
+		ON CONFLICT (tenant_id, user_id) DO UPDATE
+		SET role_id = EXCLUDED.role_id, unit_id = EXCLUDED.unit_id, status = 'active',
+		    deleted_at = NULL, joined_at = NOW(), updated_at = NOW()
+		WHERE tenant_users.deleted_at IS NOT NULL OR tenant_users.status <> 'active'
+	`, tenantID, userID, roleID, unitID)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected > 0, err
+}
+
+// joinWithInvitation adds userID to the invitation's tenant with its unit and role and records the use.
+// It returns the role ID, or a non-zero HTTP status with an error message.
+func joinWithInvitation(tx *sqlx.Tx, invitation models.Invitation, userID, email string) (string, int, string) {
+	if invitation.UserID.Valid && invitation.UserID.String != userID {
+		return "", http.StatusForbidden, "This invitation belongs to another account"
+	}
+	if invitation.Email.Valid && !strings.EqualFold(invitation.Email.String, email) {
+		return "", http.StatusForbidden, "This invitation was sent to a different email address"
+	}
+
+	var unitID, roleID *string
+	if invitation.UnitID.Valid {
+		unitID = &invitation.UnitID.String
+	}
+	if invitation.RoleID.Valid {
+		roleID = &invitation.RoleID.String
+	}
+	resolvedRoleID, status, message := resolveUnitAndRole(tx, invitation.TenantID, unitID, roleID)
+	if status != 0 {
+		return "", status, message
+	}
+
+	added, err := addTenantMember(tx, invitation.TenantID, userID, resolvedRoleID, unitID)
+	if err != nil {
+		status, message := quotaStatus(err, "Failed to add user to tenant")
+		return "", status, message
+	}
+	if !added {
+		return "", http.StatusConflict, "You are already a member of this tenant"
+	}
+
+	// The invitation replaces any pending request to join the same tenant
+	_, err = tx.Exec(`
+		UPDATE join_requests SET status = 'cancelled', updated_at = NOW()
+		WHERE tenant_id = $1 AND user_id = $2 AND status = 'pending'
+	`, invitation.TenantID, userID)
+	if err != nil {
+		return "", http.StatusInternalServerError, "Failed to update join requests"
+	}
+
+	if err := consumeInvitation(tx, invitation); err != nil {
+		return "", http.StatusInternalServerError, "Failed to accept invitation"
+	}
+	return resolvedRoleID, 0, ""
+}
+
+// invitationLink returns the frontend page where an invitation token is redeemed
+func invitationLink(token string) string {
+	return frontendBaseURL() + "/register?invitation=" + url.QueryEscape(token)
+}
+
+// CreateInvitation invites someone by email, or creates a shareable link (single- or multi-use) when no email is given
+func CreateInvitation(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	createdBy := c.Get(string(middleware.CtxUserID)).(string)
+
+	req := new(models.CreateInvitationRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	var email *string
+	if req.Email != nil && strings.TrimSpace(*req.Email) != "" {
+		trimmed := strings.ToLower(strings.TrimSpace(*req.Email))
+		if !strings.Contains(trimmed, "@") {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid email"})
+		}
+		email = &trimmed
+	}
+
+	// Email invitations are personal (single use); links default to single use, 0 means unlimited
+	one := 1
+	maxUses := &one
+	if email == nil && req.MaxUses != nil {
+		if *req.MaxUses < 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "max_uses must not be negative"})
+		}
+		if *req.MaxUses == 0 {
+			maxUses = nil
+		} else {
+			maxUses = req.MaxUses
+		}
+	}
+
+	ttl := invitationTTL
+	if req.ExpiresInDays != nil {
+		if *req.ExpiresInDays < 1 || *req.ExpiresInDays > 90 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "expires_in_days must be between 1 and 90"})
+		}
+		ttl = time.Duration(*req.ExpiresInDays) * 24 * time.Hour
+	}
+
+	tx, err := middleware.TenantDB(c).Beginx()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
+	}
+	defer tx.Rollback()
+
+	roleID, status, message := resolveUnitAndRole(tx, tenantID, req.UnitID, req.RoleID)
+	if status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+	unitID := req.UnitID
+	if unitID != nil && *unitID == "" {
+		unitID = nil
+	}
+
+	if email != nil {
+		var isMember bool
+		err := tx.Get(&isMember, `
+			SELECT EXISTS(
+				SELECT 1 FROM tenant_users tu
+				INNER JOIN users u ON u.id = tu.user_id
+				WHERE tu.tenant_id = $1 AND LOWER(u.email) = $2
+				AND tu.status = 'active' AND tu.deleted_at IS NULL AND u.deleted_at IS NULL
+			)
+		`, tenantID, *email)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		if isMember {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "User is already a member of this tenant"})
+		}
+	}
+
+	token, tokenHash, err := newSecureToken()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate invitation token"})
+	}
+
+	var invitation models.Invitation
+	err = tx.Get(&invitation, `
+		INSERT INTO invitations (tenant_id, email, unit_id, role_id, token_hash, expires_at, max_uses, note, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, tenant_id, user_id, email, unit_id, role_id, token_hash, expires_at, accepted_at, revoked_at,
+		          max_uses, use_count, note, created_by, created_at
+	`, tenantID, email, unitID, roleID, tokenHash, time.Now().Add(ttl), maxUses, req.Note, createdBy)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create invitation"})
+	}
+	if err = tx.Commit(); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit transaction"})
+	}
+
+	link := invitationLink(token)
+	if email != nil {
+		if err := sendInvitationLink(tenantID, *email, link, ttl); err != nil {
+			c.Logger().Warnf("Failed to send invitation to %s: %v", *email, err)
+		}
+	}
+
+	// The token is only returned here; it is stored hashed
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"invitation": invitation,
+		"token":      token,
+		"link":       link,
+	})
+}
+
+// sendInvitationLink emails an invitation to someone who may not have an account yet
+func sendInvitationLink(tenantID, email, link string, ttl time.Duration) error {
+	var tenantName string
+	if err := db.ForTenant(tenantID).Get(&tenantName, `SELECT name FROM tenants WHERE id = $1`, tenantID); err != nil {
+		return err
+	}
+
+	return services.SendEmail(services.Message{
+		TenantID:  tenantID,
+		Recipient: email,
+		Subject:   fmt.Sprintf("Undangan bergabung dengan %s di RukunOS", tenantName),
+		Body: fmt.Sprintf("Halo,\n\nAnda diundang untuk bergabung dengan %s di RukunOS. "+
+			"Buka tautan berikut untuk mendaftar atau masuk dengan akun Anda (berlaku %d hari):\n%s\n",
+			tenantName, int(ttl.Hours()/24), link),
+	})
+}
+
+// ListInvitations lists the tenant's invitations with their state (active, used, revoked, expired)
+func ListInvitations(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+
+	query := `
+		SELECT * FROM (
+			SELECT i.id, i.tenant_id, i.user_id, i.email, i.unit_id, i.role_id, i.token_hash, i.expires_at,
+			       i.accepted_at, i.revoked_at, i.max_uses, i.use_count, i.note, i.created_by, i.created_at,
+			       CASE
+			           WHEN i.revoked_at IS NOT NULL THEN 'revoked'
+			           WHEN i.accepted_at IS NOT NULL OR (i.max_uses IS NOT NULL AND i.use_count >= i.max_uses) THEN 'used'
+			           WHEN i.expires_at < NOW() THEN 'expired'
+			           ELSE 'active'
+			       END AS state,
+			       un.code AS unit_code, r.name AS role_name
+			FROM invitations i
+			LEFT JOIN units un ON un.id = i.unit_id
+			LEFT JOIN roles r ON r.id = i.role_id
+			WHERE i.tenant_id = $1
+		) invitations
+	`
+	args := []interface{}{tenantID}
+	if state := c.QueryParam("state"); state != "" {
+		query += ` WHERE state = $2`
+		args = append(args, state)
+	}
+	query += ` ORDER BY created_at DESC`
+
+	invitations := []models.InvitationListItem{}
+	if err := middleware.TenantDB(c).Select(&invitations, query, args...); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch invitations"})
+	}
+
+	return c.JSON(http.StatusOK, invitations)
+}
+
+// RevokeInvitation stops an invitation from being used
+func RevokeInvitation(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	invitationID := c.Param("invitation_id")
+
+	result, err := middleware.TenantDB(c).Exec(`
+		UPDATE invitations SET revoked_at = NOW()
+		WHERE id = $1 AND tenant_id = $2 AND revoked_at IS NULL AND accepted_at IS NULL
+	`, invitationID, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to revoke invitation"})
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Invitation not found or no longer active"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Invitation revoked successfully"})
+}
+
+// GetInvitationPreview describes an invitation (tenant, unit, role) so the join page can show it before sign-up
+func GetInvitationPreview(c echo.Context) error {
+	var preview struct {
+		TenantName string         `json:"tenant_name" db:"tenant_name"`
+		Email      sql.NullString `json:"email,omitempty" db:"email"`
+		UnitCode   sql.NullString `json:"unit_code,omitempty" db:"unit_code"`
+		RoleName   sql.NullString `json:"role_name,omitempty" db:"role_name"`
+		ExpiresAt  time.Time      `json:"expires_at" db:"expires_at"`
+		Usable     bool           `json:"usable" db:"usable"`
+	}
+	err := db.DB.Get(&preview, `
+		SELECT t.name AS tenant_name, i.email, un.code AS unit_code, r.name AS role_name, i.expires_at,
+		       (i.revoked_at IS NULL AND i.accepted_at IS NULL AND i.expires_at > NOW()
+		        AND (i.max_uses IS NULL OR i.use_count < i.max_uses)) AS usable
+		FROM invitations i
+		INNER JOIN tenants t ON t.id = i.tenant_id
+		LEFT JOIN units un ON un.id = i.unit_id
+		LEFT JOIN roles r ON r.id = i.role_id
+		WHERE i.token_hash = $1
+	`, hashToken(c.Param("token")))
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Invitation not found"})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	return c.JSON(http.StatusOK, preview)
+}
+
+// JoinWithInvitation adds the signed-in user to the invitation's tenant; switch to it with /auth/switch-tenant
+func JoinWithInvitation(c echo.Context) error {
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+
+	req := new(models.JoinWithInvitationRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	if req.Token == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "token is required"})
+	}
+
+	var email string
+	if err := db.DB.Get(&email, `SELECT email FROM users WHERE id = $1`, userID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	tx, err := db.DB.Beginx()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
+	}
+	defer tx.Rollback()
+
+	invitation, status, message := lockUsableInvitation(tx, req.Token)
+	if status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+	roleID, status, message := joinWithInvitation(tx, invitation, userID, email)
+	if status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+
+	if err = tx.Commit(); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit transaction"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":   "Joined tenant successfully",
+		"tenant_id": invitation.TenantID,
+		"role_id":   roleID,
+	})
+}
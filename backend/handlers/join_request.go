@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"rukunos-backend/db"
+	"rukunos-backend/middleware"
+	"rukunos-backend/models"
+	"rukunos-backend/services"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+)
+
+const joinRequestSelect = `
+	SELECT jr.id, jr.tenant_id, jr.user_id, jr.message, jr.status, jr.unit_id, jr.role_id,
+	       jr.reviewed_by, jr.reviewed_at, jr.rejection_reason, jr.created_at, jr.updated_at,
+	       u.email AS user_email, u.full_name AS user_full_name, u.phone AS user_phone, t.name AS tenant_name
+	FROM join_requests jr
+	INNER JOIN users u ON u.id = jr.user_id
+	INNER JOIN tenants t ON t.id = jr.tenant_id
+`
+
+// createJoinRequest queues a request for userID to join the tenant inside tx.
+// It returns the request, or a non-zero HTTP status with an error message.
+func createJoinRequest(tx *sqlx.Tx, tenantID, userID string, message *string) (models.JoinRequest, int, string) {
+	var request models.JoinRequest
+
+	var isMember bool
+	err := tx.Get(&isMember, `
+		SELECT EXISTS(
+			SELECT 1 FROM tenant_users
+			WHERE tenant_id = $1 AND user_id = $2 AND status = 'active' AND deleted_at IS NULL
+		)
+	`, tenantID, userID)
+	if err != nil {
+		return request, http.StatusInternalServerError, "Database error"
+	}
+	if isMember {
+		return request, http.StatusConflict, "You are already a member of this tenant"
+	}
+
+	err = tx.Get(&request, `
+		INSERT INTO join_requests (tenant_id, user_id, message)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (tenant_id, user_id) WHERE status = 'pending' DO NOTHING
+		RETURNING id, tenant_id, user_id, message, status, unit_id, role_id, reviewed_by, reviewed_at,
+		          rejection_reason, created_at, updated_at
+	`, tenantID, userID, message)
+	if err == sql.ErrNoRows {
+		return request, http.StatusConflict, "A join request for this tenant is already pending"
+	} else if err != nil {
+		return request, http.StatusInternalServerError, "Failed to create join request"
+	}
+	return request, 0, ""
+}
+
+// hasPendingJoinRequest reports whether the user is waiting for approval in any tenant
+func hasPendingJoinRequest(userID string) (bool, error) {
+	var pending bool
+	err := db.DB.Get(&pending, `
+		SELECT EXISTS(SELECT 1 FROM join_requests WHERE user_id = $1 AND status = 'pending')
+	`, userID)
+	return pending, err
+}
+
+// CreateJoinRequest asks to join another tenant by its code (for users who already have an account)
+func CreateJoinRequest(c echo.Context) error {
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+
+	req := new(models.CreateJoinRequestRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	if req.TenantCode == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "tenant_code is required"})
+	}
+
+	tx, err := db.DB.Beginx()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
+	}
+	defer tx.Rollback()
+
+	var tenantID string
+	err = tx.Get(&tenantID, `
+		SELECT id FROM tenants 
+		WHERE code = $1 AND deleted_at IS NULL AND status = 'active'
+	`, strings.ToUpper(req.TenantCode))
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Tenant not found. Please check the tenant code."})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to find tenant"})
+	}
+
+	request, status, message := createJoinRequest(tx, tenantID, userID, req.Message)
+	if status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+
+	if err = tx.Commit(); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit transaction"})
+	}
+
+	return c.JSON(http.StatusCreated, request)
+}
+
+// ListMyJoinRequests lists the current user's join requests across tenants
+func ListMyJoinRequests(c echo.Context) error {
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+
+	requests := []models.JoinRequestListItem{}
+	err := db.DB.Select(&requests, joinRequestSelect+` WHERE jr.user_id = $1 ORDER BY jr.created_at DESC`, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch join requests"})
+	}
+
+	return c.JSON(http.StatusOK, requests)
+}
+
+// ListJoinRequests lists the tenant's join requests, pending ones by default
+func ListJoinRequests(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+
+	status := c.QueryParam("status")
+	if status == "" {
+		status = "pending"
+	}
+
+	query := joinRequestSelect + ` WHERE jr.tenant_id = $1`
+	args := []interface{}{tenantID}
+	if status != "all" {
+		query += ` AND jr.status = $2`
+		args = append(args, status)
+	}
+	query += ` ORDER BY jr.created_at ASC`
+
+	requests := []models.JoinRequestListItem{}
+	if err := middleware.TenantDB(c).Select(&requests, query, args...); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch join requests"})
+	}
+
+	return c.JSON(http.StatusOK, requests)
+}
+
+// lockPendingJoinRequest locks a pending request of the tenant inside tx
+func lockPendingJoinRequest(tx *sqlx.Tx, tenantID, requestID string) (models.JoinRequest, int, string) {
+	var request models.JoinRequest
+	err := tx.Get(&request, `
+		SELECT id, tenant_id, user_id, message, status, unit_id, role_id, reviewed_by, reviewed_at,
+		       rejection_reason, created_at, updated_at
+		FROM join_requests
+		WHERE id = $1 AND tenant_id = $2
+		FOR UPDATE
+	`, requestID, tenantID)
+	if err == sql.ErrNoRows {
+		return request, http.StatusNotFound, "Join request not found"
+	} else if err != nil {
+		return request, http.StatusInternalServerError, "Database error"
+	}
+	if request.Status != "pending" {
+		return request, http.StatusConflict, "Join request has already been " + request.Status
+	}
+	return request, 0, ""
+}
+
+// ApproveJoinRequest adds the requester to the tenant with the unit and role chosen by the admin
+func ApproveJoinRequest(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	reviewerID := c.Get(string(middleware.CtxUserID)).(string)
+
+	req := new(models.ApproveJoinRequestRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	unitID := req.UnitID
+	if unitID != nil && *unitID == "" {
+		unitID = nil
+	}
+
+	tx, err := middleware.TenantDB(c).Beginx()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
+	}
+	defer tx.Rollback()
+
+	request, status, message := lockPendingJoinRequest(tx, tenantID, c.Param("request_id"))
+	if status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+
+	roleID, status, message := resolveUnitAndRole(tx, tenantID, unitID, req.RoleID)
+	if status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+
+	if _, err := addTenantMember(tx, tenantID, request.UserID, roleID, unitID); err != nil {
+		status, message := quotaStatus(err, "Failed to add user to tenant")
+		return c.JSON(status, map[string]string{"error": message})
+	}
+
+	err = tx.Get(&request, `
+		UPDATE join_requests
+		SET status = 'approved', unit_id = $1, role_id = $2, reviewed_by = $3, reviewed_at = NOW(), updated_at = NOW()
+		WHERE id = $4
+		RETURNING id, tenant_id, user_id, message, status, unit_id, role_id, reviewed_by, reviewed_at,
+		          rejection_reason, created_at, updated_at
+	`, unitID, roleID, reviewerID, request.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to approve join request"})
+	}
+
+	if err = tx.Commit(); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit transaction"})
+	}
+
+	if err := notifyJoinRequestReviewed(request); err != nil {
+		c.Logger().Warnf("Failed to notify user %s about join request: %v", request.UserID, err)
+	}
+
+	return c.JSON(http.StatusOK, request)
+}
+
+// RejectJoinRequest declines a join request with an optional reason
+func RejectJoinRequest(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	reviewerID := c.Get(string(middleware.CtxUserID)).(string)
+
+	req := new(models.RejectJoinRequestRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	tx, err := middleware.TenantDB(c).Beginx()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
+	}
+	defer tx.Rollback()
+
+	request, status, message := lockPendingJoinRequest(tx, tenantID, c.Param("request_id"))
+	if status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+
+	err = tx.Get(&request, `
+		UPDATE join_requests
+		SET status = 'rejected', rejection_reason = $1, reviewed_by = $2, reviewed_at = NOW(), updated_at = NOW()
+		WHERE id = $3
+		RETURNING id, tenant_id, user_id, message, status, unit_id, role_id, reviewed_by, reviewed_at,
+		          rejection_reason, created_at, updated_at
+	`, req.Reason, reviewerID, request.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to reject join request"})
+	}
+
+	if err = tx.Commit(); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit transaction"})
+	}
+
+	if err := notifyJoinRequestReviewed(request); err != nil {
+		c.Logger().Warnf("Failed to notify user %s about join request: %v", request.UserID, err)
+	}
+
+	return c.JSON(http.StatusOK, request)
+}
+
+// notifyJoinRequestReviewed emails the requester the outcome of their join request
+func notifyJoinRequestReviewed(request models.JoinRequest) error {
+	var email, fullName, tenantName string
+	err := db.ForTenant(request.TenantID).QueryRow(`
+		SELECT u.email, u.full_name, t.name
+		FROM users u, tenants t
+		WHERE u.id = $1 AND t.id = $2
+	`, request.UserID, request.TenantID).Scan(&email, &fullName, &tenantName)
+	if err != nil {
+		return err
+	}
+
+	msg := services.Message{
+		TenantID:  request.TenantID,
+		UserID:    request.UserID,
+		Recipient: email,
+	}
+	if request.Status == "approved" {
+		msg.Subject = fmt.Sprintf("Permintaan bergabung dengan %s disetujui", tenantName)
+		msg.Body = fmt.Sprintf("Halo %s,\n\nPermintaan Anda untuk bergabung dengan %s di RukunOS telah disetujui. "+
+			"Silakan masuk di %s\n", fullName, tenantName, frontendBaseURL()+"/login")
+	} else {
+		reason := ""
+		if request.RejectionReason.Valid && request.RejectionReason.String != "" {
+			reason = "\nAlasan: " + request.RejectionReason.String + "\n"
+		}
+		msg.Subject = fmt.Sprintf("Permintaan bergabung dengan %s ditolak", tenantName)
+		msg.Body = fmt.Sprintf("Halo %s,\n\nPermintaan Anda untuk bergabung dengan %s di RukunOS ditolak oleh pengurus.\n%s"+
+			"\nHubungi pengurus lingkungan Anda untuk informasi lebih lanjut.\n", fullName, tenantName, reason)
+	}
+	return services.SendEmail(msg)
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"rukunos-backend/db"
+	"rukunos-backend/middleware"
+	"rukunos-backend/models"
+	"rukunos-backend/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+// tenantModuleList describes every registered module in registry order
+func tenantModuleList(enabled map[string]bool, plan models.Plan) []models.TenantModule {
+	modules := make([]models.TenantModule, 0, len(middleware.Modules))
+	for _, m := range middleware.Modules {
+		modules = append(modules, models.TenantModule{
+			Key:         m.Key,
+			Name:        m.Name,
+			Description: m.Description,
+			Enabled:     enabled[m.Key],
+			InPlan:      services.PlanAllowsModule(plan, m.Key),
+		})
+	}
+	return modules
+}
+
+// ListTenantModules returns the tenant's modules and whether each is enabled
+func ListTenantModules(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+
+	enabled, err := middleware.GetTenantModules(tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load tenant modules"})
+	}
+	plan, err := services.TenantPlan(db.DB, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load tenant plan"})
+	}
+	return c.JSON(http.StatusOK, tenantModuleList(enabled, plan))
+}
+
+// UpdateTenantModules switches tenant modules on or off
+func UpdateTenantModules(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+
+	req := new(models.UpdateTenantModulesRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	if len(req.Modules) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "modules is required"})
+	}
+	plan, err := services.TenantPlan(db.DB, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load tenant plan"})
+	}
+	for key, enable := range req.Modules {
+		module, ok := middleware.FindModule(key)
+		if !ok {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Unknown module: " + key})
+		}
+		if enable && !services.PlanAllowsModule(plan, key) {
+			return c.JSON(http.StatusForbidden, map[string]string{
+				"error":  fmt.Sprintf("Modul %s tidak termasuk dalam paket %s. Hubungi admin RukunOS untuk meningkatkan paket.", module.Name, plan.Name),
+				"code":   "module_not_in_plan",
+				"module": key,
+			})
+		}
+	}
+
+	changes, _ := json.Marshal(req.Modules)
+	_, err = db.DB.Exec(`
+		UPDATE tenants
+		SET modules = COALESCE(modules, '{}'::jsonb) || $1::jsonb, updated_at = NOW()
+		WHERE id = $2
+	`, string(changes), tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update modules"})
+	}
+
+	enabled, err := middleware.GetTenantModules(tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load tenant modules"})
+	}
+	return c.JSON(http.StatusOK, tenantModuleList(enabled, plan))
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"net/http"
+	"time"
+	"rukunos-backend/db"
+
+	"github.com/labstack/echo/v4"
+)
+
+// oauthStateTTL is how long the user has to complete the provider's consent screen
+const oauthStateTTL = 10 * time.Minute
+
+// oauthFlow names an OAuth provider and the cookie that binds its flows to the browser (prevents login and linking CSRF)
+type oauthFlow struct {
+	provider   string
+	cookieName string
+	cookiePath string
+}
+
+// oauthState is a pending authorization (server-side state + PKCE verifier)
+type oauthState struct {
+	ID                 string         `db:"id"`
+	Purpose            string         `db:"purpose"`
+	BrowserBindingHash sql.NullString `db:"browser_binding_hash"`
+	CodeVerifier       string         `db:"code_verifier"`
+	UserID             sql.NullString `db:"user_id"`
+	IdentityProviderID sql.NullString `db:"identity_provider_id"`
+	Nonce              sql.NullString `db:"nonce"`
+	ExpiresAt          time.Time      `db:"expires_at"`
+	UsedAt             sql.NullTime   `db:"used_at"`
+}
+
+// newPKCEVerifier returns a PKCE code verifier and its S256 challenge (RFC 7636)
+func newPKCEVerifier() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	verifier := base64.RawURLEncoding.EncodeToString(b)
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// createOAuthState stores a new state for purpose ("login" or "link") and returns the state and PKCE challenge.
+// It also sets a cookie binding the state to this browser, so a callback URL sent to someone else is rejected.
+func createOAuthState(c echo.Context, flow oauthFlow, purpose string, userID, identityProviderID *string, nonce string) (string, string, error) {
+	state, stateHash, err := newSecureToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, challenge, err := newPKCEVerifier()
+	if err != nil {
+		return "", "", err
+	}
+
+	binding, bindingHash, err := newSecureToken()
+	if err != nil {
+		return "", "", err
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     flow.cookieName,
+		Value:    binding,
+		Path:     flow.cookiePath,
+		MaxAge:   int(oauthStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	_, err = db.DB.Exec(`
+		INSERT INTO oauth_states (provider, purpose, state_hash, browser_binding_hash, code_verifier, user_id,
+		                          identity_provider_id, nonce, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9)
+	`, flow.provider, purpose, stateHash, bindingHash, verifier, userID, identityProviderID, nonce, time.Now().Add(oauthStateTTL))
+	if err != nil {
+		return "", "", err
+	}
+	return state, challenge, nil
+}
+
+// consumeOAuthState validates the state returned by the provider and marks it used.
+// It returns the stored state, or an error message for the frontend.
+func consumeOAuthState(c echo.Context, flow oauthFlow, state string) (*oauthState, string) {
+	if state == "" {
+		return nil, "Missing OAuth state"
+	}
+
+	tx, err := db.DB.Beginx()
+	if err != nil {
+		return nil, "Failed to start transaction"
+	}
+	defer tx.Rollback()
+
+	var stored oauthState
+	err = tx.Get(&stored, `
+		SELECT id, purpose, browser_binding_hash, code_verifier, user_id, identity_provider_id, nonce, expires_at, used_at
+		FROM oauth_states
+		WHERE state_hash = $1 AND provider = $2
+		FOR UPDATE
+	`, hashToken(state), flow.provider)
+	if err == sql.ErrNoRows {
+		return nil, "Invalid OAuth state"
+	} else if err != nil {
+		return nil, "Database error"
+	}
+	if stored.UsedAt.Valid {
+		return nil, "OAuth state has already been used"
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, "OAuth state has expired, please try again"
+	}
+	cookie, err := c.Cookie(flow.cookieName)
+	if err != nil || !stored.BrowserBindingHash.Valid || hashToken(cookie.Value) != stored.BrowserBindingHash.String {
+		return nil, "OAuth state does not belong to this browser"
+	}
+
+	if _, err = tx.Exec(`UPDATE oauth_states SET used_at = NOW() WHERE id = $1`, stored.ID); err != nil {
+		return nil, "Failed to update OAuth state"
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, "Failed to commit transaction"
+	}
+
+	c.SetCookie(&http.Cookie{Name: flow.cookieName, Path: flow.cookiePath, MaxAge: -1, HttpOnly: true})
+	return &stored, ""
+}
@@ -0,0 +1,527 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"rukunos-backend/db"
+	"rukunos-backend/middleware"
+	"rukunos-backend/models"
+	"rukunos-backend/oidc"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/oauth2"
+)
+
+// oidcFlow keeps OIDC sign-in state; the cookie path covers /api/auth/oidc and its callback
+var oidcFlow = oauthFlow{provider: "oidc", cookieName: "oidc_oauth_state", cookiePath: "/api/auth/oidc"}
+
+// defaultClaimMapping maps our user fields to standard OIDC claims; providers override single entries.
+// email_verified is deliberately not mappable: it decides whether an existing account may be linked.
+var defaultClaimMapping = map[string]string{
+	"email": "email",
+	"name":  "name",
+	"phone": "phone_number",
+}
+
+const identityProviderColumns = `id, tenant_id, name, issuer_url, client_id, client_secret, scopes, claim_mapping,
+	default_role_id, enabled, created_at, updated_at`
+
+// oidcRedirectURL is the callback registered with every provider (OIDC_REDIRECT_URL)
+func oidcRedirectURL() string {
+	if redirectURL := os.Getenv("OIDC_REDIRECT_URL"); redirectURL != "" {
+		return redirectURL
+	}
+	return "http://localhost:8080/api/auth/oidc/callback"
+}
+
+// loadIdentityProvider decodes the JSON columns of a provider read from the database
+func loadIdentityProvider(provider *models.IdentityProvider) {
+	provider.HasClientSecret = provider.ClientSecret.Valid && provider.ClientSecret.String != ""
+	provider.ClaimMapping = map[string]string{}
+	if len(provider.ClaimMappingJSON) > 0 {
+		json.Unmarshal(provider.ClaimMappingJSON, &provider.ClaimMapping)
+	}
+}
+
+func getIdentityProvider(q sqlx.Queryer, providerID string) (models.IdentityProvider, error) {
+	var provider models.IdentityProvider
+	err := sqlx.Get(q, &provider, `
+		SELECT `+identityProviderColumns+`
+		FROM tenant_identity_providers
+		WHERE id = $1 AND deleted_at IS NULL
+	`, providerID)
+	if err == nil {
+		loadIdentityProvider(&provider)
+	}
+	return provider, err
+}
+
+// claimName returns the claim that holds field for provider
+func claimName(provider models.IdentityProvider, field string) string {
+	if name := provider.ClaimMapping[field]; name != "" {
+		return name
+	}
+	return defaultClaimMapping[field]
+}
+
+// claimString reads a claim as a string (numbers and booleans are formatted)
+func claimString(claims map[string]interface{}, name string) string {
+	switch value := claims[name].(type) {
+	case string:
+		return strings.TrimSpace(value)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+func oauthConfigFor(provider models.IdentityProvider, metadata *oidc.Metadata) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     provider.ClientID,
+		ClientSecret: provider.ClientSecret.String,
+		RedirectURL:  oidcRedirectURL(),
+		Scopes:       strings.Fields(provider.Scopes),
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  metadata.AuthorizationEndpoint,
+			TokenURL: metadata.TokenEndpoint,
+		},
+	}
+}
+
+// ListIdentityProviders lists the tenant's OIDC providers (client secrets are never returned)
+func ListIdentityProviders(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+
+	providers := []models.IdentityProvider{}
+	err := middleware.TenantDB(c).Select(&providers, `
+		SELECT `+identityProviderColumns+`
+		FROM tenant_identity_providers
+		WHERE tenant_id = $1 AND deleted_at IS NULL
+		ORDER BY name
+	`, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch identity providers"})
+	}
+	for i := range providers {
+		loadIdentityProvider(&providers[i])
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"providers":    providers,
+		"redirect_url": oidcRedirectURL(),
+	})
+}
+
+// validateIdentityProviderRequest checks the default role and that the issuer answers discovery
+func validateIdentityProviderRequest(tdb *db.TenantDB, req *models.IdentityProviderRequest) (int, string) {
+	if req.IssuerURL != nil {
+		*req.IssuerURL = strings.TrimSuffix(strings.TrimSpace(*req.IssuerURL), "/")
+		// The cause stays generic so the issuer URL cannot be used to probe other hosts
+		if _, err := oidc.Discover(*req.IssuerURL); errors.Is(err, oidc.ErrInsecureURL) {
+			return http.StatusBadRequest, "issuer_url must be an https URL"
+		} else if err != nil {
+			return http.StatusBadRequest, "Issuer discovery failed"
+		}
+	}
+	if req.DefaultRoleID != nil && *req.DefaultRoleID != "" {
+		tx, err := tdb.Beginx()
+		if err != nil {
+			return http.StatusInternalServerError, "Database error"
+		}
+		defer tx.Rollback()
+		if _, status, message := resolveUnitAndRole(tx, tdb.TenantID, nil, req.DefaultRoleID); status != 0 {
+			return status, message
+		}
+	}
+	for field := range req.ClaimMapping {
+		if _, ok := defaultClaimMapping[field]; !ok {
+			return http.StatusBadRequest, "Unknown claim_mapping field: " + field
+		}
+	}
+	return 0, ""
+}
+
+// CreateIdentityProvider adds an OIDC provider to the tenant
+func CreateIdentityProvider(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+
+	req := new(models.IdentityProviderRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	if req.Name == nil || *req.Name == "" || req.IssuerURL == nil || *req.IssuerURL == "" || req.ClientID == nil || *req.ClientID == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "name, issuer_url and client_id are required"})
+	}
+	if status, message := validateIdentityProviderRequest(middleware.TenantDB(c), req); status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+
+	scopes := "openid email profile"
+	if req.Scopes != nil && strings.TrimSpace(*req.Scopes) != "" {
+		scopes = strings.TrimSpace(*req.Scopes)
+	}
+	if !strings.Contains(" "+scopes+" ", " openid ") {
+		scopes = "openid " + scopes
+	}
+	claimMapping, _ := json.Marshal(req.ClaimMapping)
+	if req.ClaimMapping == nil {
+		claimMapping = []byte("{}")
+	}
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	var provider models.IdentityProvider
+	err := middleware.TenantDB(c).Get(&provider, `
+		INSERT INTO tenant_identity_providers (tenant_id, name, issuer_url, client_id, client_secret, scopes, claim_mapping, default_role_id, enabled)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, '')::uuid, $9)
+		RETURNING `+identityProviderColumns,
+		tenantID, *req.Name, *req.IssuerURL, *req.ClientID, req.ClientSecret, scopes, claimMapping, req.DefaultRoleID, enabled)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create identity provider"})
+	}
+	loadIdentityProvider(&provider)
+
+	return c.JSON(http.StatusCreated, provider)
+}
+
+// UpdateIdentityProvider changes a provider; omitted fields keep their value
+func UpdateIdentityProvider(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	providerID := c.Param("provider_id")
+
+	req := new(models.IdentityProviderRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	if status, message := validateIdentityProviderRequest(middleware.TenantDB(c), req); status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+
+	var claimMapping []byte
+	if req.ClaimMapping != nil {
+		claimMapping, _ = json.Marshal(req.ClaimMapping)
+	}
+
+	var provider models.IdentityProvider
+	err := middleware.TenantDB(c).Get(&provider, `
+		UPDATE tenant_identity_providers
+		SET name = COALESCE($1, name),
+		    issuer_url = COALESCE($2, issuer_url),
+		    client_id = COALESCE($3, client_id),
+		    client_secret = COALESCE($4, client_secret),
+		    scopes = COALESCE($5, scopes),
+		    claim_mapping = COALESCE($6::jsonb, claim_mapping),
+		    default_role_id = CASE WHEN $7::text IS NULL THEN default_role_id ELSE NULLIF($7, '')::uuid END,
+		    enabled = COALESCE($8, enabled),
+		    updated_at = NOW()
+		WHERE id = $9 AND tenant_id = $10 AND deleted_at IS NULL
+		RETURNING `+identityProviderColumns,
+		req.Name, req.IssuerURL, req.ClientID, req.ClientSecret, req.Scopes, claimMapping, req.DefaultRoleID, req.Enabled,
+		providerID, tenantID)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Identity provider not found"})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update identity provider"})
+	}
+	loadIdentityProvider(&provider)
+
+	return c.JSON(http.StatusOK, provider)
+}
+
+// DeleteIdentityProvider removes a provider; users it provisioned keep their accounts
+func DeleteIdentityProvider(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+
+	result, err := middleware.TenantDB(c).Exec(`
+		UPDATE tenant_identity_providers SET deleted_at = NOW(), enabled = false
+		WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
+	`, c.Param("provider_id"), tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete identity provider"})
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Identity provider not found"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Identity provider deleted successfully"})
+}
+
+// ListTenantIdentityProviders lists the enabled providers of a tenant for the login page
+// (?tenant_code=, or the tenant of the page's subdomain or custom domain)
+func ListTenantIdentityProviders(c echo.Context) error {
+	tenantCode := strings.ToUpper(c.QueryParam("tenant_code"))
+	if tenantCode == "" {
+		// Login pages on a tenant's subdomain or custom domain need no code
+		if tenantID := hostTenantID(c); tenantID != "" {
+			if err := db.DB.Get(&tenantCode, `SELECT UPPER(code) FROM tenants WHERE id = $1`, tenantID); err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+			}
+		}
+	}
+	if tenantCode == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "tenant_code is required"})
+	}
+
+	providers := []models.PublicIdentityProvider{}
+	err := db.DB.Select(&providers, `
+		SELECT p.id, p.name
+		FROM tenant_identity_providers p
+		INNER JOIN tenants t ON t.id = p.tenant_id
+		WHERE t.code = $1 AND t.status = 'active' AND t.deleted_at IS NULL
+		AND p.enabled = true AND p.deleted_at IS NULL
+		ORDER BY p.name
+	`, tenantCode)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch identity providers"})
+	}
+
+	return c.JSON(http.StatusOK, providers)
+}
+
+// StartOIDCLogin redirects to the provider's authorization endpoint (or returns the URL as JSON with ?redirect=false)
+func StartOIDCLogin(c echo.Context) error {
+	provider, err := getIdentityProvider(db.DB, c.Param("provider_id"))
+	if err == sql.ErrNoRows || (err == nil && !provider.Enabled) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Identity provider not found"})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	metadata, err := oidc.Discover(provider.IssuerURL)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": "Identity provider is unavailable"})
+	}
+
+	nonce, _, err := newSecureToken()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start sign-in"})
+	}
+	state, challenge, err := createOAuthState(c, oidcFlow, "login", nil, &provider.ID, nonce)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start sign-in"})
+	}
+
+	authURL := oauthConfigFor(provider, metadata).AuthCodeURL(state,
+		oauth2.SetAuthURLParam("nonce", nonce),
+		oauth2.SetAuthURLParam("code_challenge", challenge),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	)
+
+	if c.QueryParam("redirect") == "false" {
+		return c.JSON(http.StatusOK, map[string]string{"auth_url": authURL})
+	}
+	return c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback validates the ID token, provisions the user into the provider's tenant and redirects to the frontend
+func OIDCCallback(c echo.Context) error {
+	fail := func(message string) error {
+		return redirectToFrontend(c, "/login", url.Values{"error": {message}}, nil)
+	}
+
+	stored, message := consumeOAuthState(c, oidcFlow, c.QueryParam("state"))
+	if stored == nil {
+		return fail(message)
+	}
+	if errParam := c.QueryParam("error"); errParam != "" {
+		return fail("Sign-in was cancelled: " + errParam)
+	}
+	code := c.QueryParam("code")
+	if code == "" {
+		return fail("Authorization code not provided")
+	}
+
+	provider, err := getIdentityProvider(db.DB, stored.IdentityProviderID.String)
+	if err != nil || !provider.Enabled {
+		return fail("Identity provider not found")
+	}
+	metadata, err := oidc.Discover(provider.IssuerURL)
+	if err != nil {
+		return fail("Identity provider is unavailable")
+	}
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, oidc.HTTPClient())
+	token, err := oauthConfigFor(provider, metadata).Exchange(ctx, code,
+		oauth2.SetAuthURLParam("code_verifier", stored.CodeVerifier))
+	if err != nil {
+		return fail("Failed to exchange token")
+	}
+	rawIDToken, _ := token.Extra("id_token").(string)
+	if rawIDToken == "" {
+		return fail("Identity provider did not return an ID token")
+	}
+
+	claims, err := oidc.VerifyIDToken(metadata, provider.ClientID, rawIDToken, stored.Nonce.String)
+	if err != nil {
+		return fail(err.Error())
+	}
+	merged := map[string]interface{}(claims)
+
+	// Some providers only put profile claims in userinfo
+	if claimString(merged, claimName(provider, "email")) == "" || claimString(merged, claimName(provider, "name")) == "" {
+		if userinfo, err := oidc.FetchUserinfo(metadata, token.AccessToken); err == nil {
+			// userinfo "sub" must match the ID token (OIDC Core 5.3.2)
+			if claimString(userinfo, "sub") == claimString(merged, "sub") {
+				for name, value := range userinfo {
+					if _, exists := merged[name]; !exists {
+						merged[name] = value
+					}
+				}
+			}
+		}
+	}
+
+	user, status, message := findOrProvisionOIDCUser(provider, merged)
+	if status != 0 {
+		return fail(message)
+	}
+
+	// Log into the provider's tenant; the user can switch tenants later
+	status, responseData := buildLoginResponse(c, user, &provider.TenantID)
+	if status != http.StatusOK {
+		message, _ := responseData["error"].(string)
+		return fail(message)
+	}
+	return redirectLoginResponse(c, "/auth/oidc/callback", responseData)
+}
+
+// findOrProvisionOIDCUser resolves the external identity to a user, creating the user and
+// the tenant membership just in time. It returns the user, or a non-zero HTTP status with an error message.
+func findOrProvisionOIDCUser(provider models.IdentityProvider, claims map[string]interface{}) (models.User, int, string) {
+	var user models.User
+
+	subject := claimString(claims, "sub")
+	email := strings.ToLower(claimString(claims, claimName(provider, "email")))
+	fullName := claimString(claims, claimName(provider, "name"))
+	phone := claimString(claims, claimName(provider, "phone"))
+	emailVerified := claimString(claims, "email_verified") == "true"
+	if subject == "" {
+		return user, http.StatusBadRequest, "ID token has no subject"
+	}
+
+	tx, err := db.DB.Beginx()
+	if err != nil {
+		return user, http.StatusInternalServerError, "Failed to start transaction"
+	}
+	defer tx.Rollback()
+
+	// 1. Known identity
+	var userID string
+	err = tx.Get(&userID, `
+		SELECT user_id FROM user_identities WHERE identity_provider_id = $1 AND subject = $2
+	`, provider.ID, subject)
+	if err != nil && err != sql.ErrNoRows {
+		return user, http.StatusInternalServerError, "Database error"
+	}
+
+	if userID == "" {
+		if email == "" {
+			return user, http.StatusBadRequest, "Identity provider did not return an email address"
+		}
+
+		// 2. Existing account with the same email. Providers are configured by tenant admins and may run on
+		// their own issuer, so the email claim proves nothing outside the provider's tenant: an account is only
+		// linked when the provider verified the address and the account belongs to no other tenant.
+		var existing struct {
+			ID           string `db:"id"`
+			SuperAdmin   bool   `db:"is_super_admin"`
+			OtherTenants bool   `db:"other_tenants"`
+		}
+		err = tx.Get(&existing, `
+			SELECT u.id, COALESCE(u.is_super_admin, false) AS is_super_admin,
+			       EXISTS(SELECT 1 FROM tenant_users tu
+			              WHERE tu.user_id = u.id AND tu.tenant_id != $2 AND tu.deleted_at IS NULL) AS other_tenants
+			FROM users u WHERE LOWER(u.email) = $1 AND u.deleted_at IS NULL
+			ORDER BY u.created_at LIMIT 1
+		`, email, provider.TenantID)
+		userID = existing.ID
+		if err == sql.ErrNoRows {
+			// 3. Just-in-time provisioning
+			if fullName == "" {
+				fullName = email
+			}
+			err = tx.Get(&userID, `
+				INSERT INTO users (email, full_name, phone, auth_provider, status, email_verified_at)
+				VALUES ($1, $2, NULLIF($3, ''), 'oidc', 'active', CASE WHEN $4 THEN NOW() END)
+				RETURNING id
+			`, email, fullName, phone, emailVerified)
+			if err != nil {
+				return user, http.StatusInternalServerError, "Failed to create user"
+			}
+		} else if err != nil {
+			return user, http.StatusInternalServerError, "Database error"
+		} else if !emailVerified {
+			return user, http.StatusConflict, "An account with this email already exists and the provider did not verify the email"
+		} else if existing.SuperAdmin || existing.OtherTenants {
+			return user, http.StatusConflict, "An account with this email already exists. Sign in with your password or Google instead."
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO user_identities (identity_provider_id, subject, user_id)
+			VALUES ($1, $2, $3)
+		`, provider.ID, subject, userID)
+		if err != nil {
+			return user, http.StatusInternalServerError, "Failed to link identity"
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE user_identities SET last_login_at = NOW() WHERE identity_provider_id = $1 AND subject = $2
+	`, provider.ID, subject)
+	if err != nil {
+		return user, http.StatusInternalServerError, "Database error"
+	}
+
+	// Membership in the provider's tenant: created with the default role, but a membership
+	// an admin deactivated is not reactivated by signing in
+	var membershipStatus sql.NullString
+	err = tx.Get(&membershipStatus, `
+		SELECT status FROM tenant_users WHERE tenant_id = $1 AND user_id = $2 AND deleted_at IS NULL
+	`, provider.TenantID, userID)
+	if err == sql.ErrNoRows {
+		var defaultRoleID *string
+		if provider.DefaultRoleID.Valid {
+			defaultRoleID = &provider.DefaultRoleID.String
+		}
+		roleID, status, message := resolveUnitAndRole(tx, provider.TenantID, nil, defaultRoleID)
+		if status != 0 {
+			return user, status, message
+		}
+		if _, err := addTenantMember(tx, provider.TenantID, userID, roleID, nil); err != nil {
+			status, message := quotaStatus(err, "Failed to add user to tenant")
+			return user, status, message
+		}
+	} else if err != nil {
+		return user, http.StatusInternalServerError, "Database error"
+	} else if membershipStatus.String != "active" {
+		return user, http.StatusForbidden, "Your membership in this tenant is not active"
+	}
+
+	var status sql.NullString
+	err = tx.QueryRow(`
+		SELECT id, email, full_name, COALESCE(auth_provider, 'email'), status FROM users WHERE id = $1
+	`, userID).Scan(&user.ID, &user.Email, &user.FullName, &user.AuthProvider, &status)
+	if err != nil {
+		return user, http.StatusInternalServerError, "Database error"
+	}
+	user.Status = status.String
+	if user.Status != "active" {
+		return user, http.StatusForbidden, "User account is inactive"
+	}
+
+	if err = tx.Commit(); err != nil {
+		return user, http.StatusInternalServerError, "Failed to commit transaction"
+	}
+	return user, 0, ""
+}
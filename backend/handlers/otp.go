@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+	"rukunos-backend/db"
+	"rukunos-backend/models"
+	"rukunos-backend/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	otpLength         = 6
+	otpTTL            = 5 * time.Minute
+	otpMaxAttempts    = 5           // Wrong guesses allowed per code
+	otpResendInterval = time.Minute // Minimum time between two codes for one number
+	otpMaxPerHour     = 5           // Codes per number per hour
+)
+
+// normalizePhone converts Indonesian phone numbers to digits-only international form (08xx / +628xx -> 628xx)
+func normalizePhone(phone string) string {
+	var digits strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	normalized := digits.String()
+	if strings.HasPrefix(normalized, "0") {
+		normalized = "62" + normalized[1:]
+	}
+	return normalized
+}
+
+// normalizedPhoneSQL is the SQL equivalent of normalizePhone for users.phone
+const normalizedPhoneSQL = `regexp_replace(regexp_replace(u.phone, '\D', '', 'g'), '^0', '62')`
+
+func generateOTPCode() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < otpLength; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", otpLength, n.Int64()), nil
+}
+
+func hashOTP(phone, code string) string {
+	return hashToken(phone + ":" + code)
+}
+
+// RequestLoginOTP sends a one-time login code to the resident's phone over WhatsApp or SMS
+func RequestLoginOTP(c echo.Context) error {
+	req := new(models.RequestOTPRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	phone := normalizePhone(req.Phone)
+	if len(phone) < 9 || len(phone) > 15 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid phone number"})
+	}
+
+	// Login codes must never end up in the server log, so there is no fallback to the log channel
+	channel, ok := services.RegisteredChannel("whatsapp", "sms")
+	if req.Channel == "sms" {
+		channel, ok = services.RegisteredChannel("sms", "whatsapp")
+	}
+	if !ok {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "Login with a phone code is not available. Please log in with email."})
+	}
+
+	// Every outcome below answers with the same response, so callers cannot tell which numbers are registered
+	response := map[string]interface{}{
+		"message":      "If the number is registered, a login code has been sent",
+		"channel":      channel.Name(),
+		"expires_in":   int(otpTTL.Seconds()),
+		"resend_after": int(otpResendInterval.Seconds()),
+	}
+
+	var userIDs []string
+	err := db.DB.Select(&userIDs, `
+		SELECT u.id FROM users u
+		WHERE `+normalizedPhoneSQL+` = $1
+		AND u.deleted_at IS NULL AND u.status = 'active'
+	`, phone)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	// A number shared by several accounts cannot tell whom to log in; those residents log in with email
+	if len(userIDs) != 1 {
+		return c.JSON(http.StatusOK, response)
+	}
+
+	// Resend throttling
+	var recent struct {
+		LastSentAt sql.NullTime `db:"last_sent_at"`
+		LastHour   int          `db:"last_hour"`
+	}
+	err = db.DB.Get(&recent, `
+		SELECT MAX(created_at) as last_sent_at,
+		       COUNT(*) FILTER (WHERE created_at > NOW() - INTERVAL '1 hour') as last_hour
+		FROM otp_codes
+		WHERE phone = $1 AND created_at > NOW() - INTERVAL '1 hour'
+	`, phone)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	// Throttled requests send nothing; only registered numbers have codes, so a 429 here would reveal them
+	if recent.LastSentAt.Valid && time.Since(recent.LastSentAt.Time) < otpResendInterval {
+		return c.JSON(http.StatusOK, response)
+	}
+	if recent.LastHour >= otpMaxPerHour {
+		return c.JSON(http.StatusOK, response)
+	}
+
+	code, err := generateOTPCode()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate code"})
+	}
+
+	// Only the newest code is valid
+	_, err = db.DB.Exec(`UPDATE otp_codes SET consumed_at = NOW() WHERE phone = $1 AND consumed_at IS NULL`, phone)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	_, err = db.DB.Exec(`
+		INSERT INTO otp_codes (phone, user_id, purpose, code_hash, channel, expires_at)
+		VALUES ($1, $2, 'login', $3, $4, $5)
+	`, phone, userIDs[0], hashOTP(phone, code), channel.Name(), time.Now().Add(otpTTL))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save code"})
+	}
+
+	err = channel.Send(services.Message{
+		UserID:    userIDs[0],
+		Recipient: phone,
+		Subject:   "Kode masuk RukunOS",
+		Body: fmt.Sprintf("Kode masuk RukunOS Anda: %s. Berlaku %d menit. Jangan berikan kode ini kepada siapa pun.",
+			code, int(otpTTL.Minutes())),
+	})
+	if err != nil {
+		c.Logger().Errorf("Failed to send OTP via %s: %v", channel.Name(), err)
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// VerifyLoginOTP checks a login code and returns the same token response as Login
+func VerifyLoginOTP(c echo.Context) error {
+	req := new(models.VerifyOTPRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	phone := normalizePhone(req.Phone)
+	code := strings.TrimSpace(req.Code)
+	if phone == "" || code == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "phone and code are required"})
+	}
+
+	tx, err := db.DB.Beginx()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
+	}
+	defer tx.Rollback()
+
+	var otp struct {
+		ID        string    `db:"id"`
+		UserID    string    `db:"user_id"`
+		CodeHash  string    `db:"code_hash"`
+		Attempts  int       `db:"attempts"`
+		ExpiresAt time.Time `db:"expires_at"`
+	}
+	err = tx.Get(&otp, `
+		SELECT id, user_id, code_hash, attempts, expires_at
+		FROM otp_codes
+		WHERE phone = $1 AND purpose = 'login' AND consumed_at IS NULL
+		ORDER BY created_at DESC
+		LIMIT 1
+		FOR UPDATE
+	`, phone)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid or expired code"})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if time.Now().After(otp.ExpiresAt) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid or expired code"})
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashOTP(phone, code)), []byte(otp.CodeHash)) != 1 {
+		attempts := otp.Attempts + 1
+		// The code is burned once the attempt limit is reached
+		_, err = tx.Exec(`
+			UPDATE otp_codes
+			SET attempts = $1, consumed_at = CASE WHEN $1 >= $2 THEN NOW() ELSE consumed_at END
+			WHERE id = $3
+		`, attempts, otpMaxAttempts, otp.ID)
+		if err != nil || tx.Commit() != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		if attempts >= otpMaxAttempts {
+			return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "Too many wrong attempts. Please request a new code."})
+		}
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error":              "Invalid or expired code",
+			"attempts_remaining": otpMaxAttempts - attempts,
+		})
+	}
+
+	if _, err = tx.Exec(`UPDATE otp_codes SET consumed_at = NOW() WHERE id = $1`, otp.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if err = tx.Commit(); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit transaction"})
+	}
+
+	var user models.User
+	err = db.DB.QueryRow(`
+		SELECT id, email, full_name, COALESCE(auth_provider, 'email'), COALESCE(status, 'active')
+		FROM users WHERE id = $1 AND deleted_at IS NULL
+	`, otp.UserID).Scan(&user.ID, &user.Email, &user.FullName, &user.AuthProvider, &user.Status)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "User belum terdaftar"})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if user.Status != "active" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "User account is inactive"})
+	}
+
+	return completeLogin(c, user, req.TenantID)
+}
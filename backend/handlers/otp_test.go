@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"rukunos-backend/dbtest"
+	"rukunos-backend/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+// otpChannel receives the login codes of every test in this file
+var otpChannel = services.NewFakeChannel("whatsapp")
+
+var otpCodePattern = regexp.MustCompile(`\b[0-9]{6}\b`)
+
+// callJSON runs a handler with a JSON body and returns the status and decoded response
+func callJSON(t *testing.T, handler echo.HandlerFunc, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(payload)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	if err := handler(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatalf("Handler returned an error: %v", err)
+	}
+	response := map[string]interface{}{}
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	return rec.Code, response
+}
+
+// otpResident creates a tenant member with a random phone number and returns the number in local (08..) form
+func otpResident(t *testing.T) string {
+	t.Helper()
+	dbtest.Open(t)
+	t.Setenv("JWT_SECRET", "test-secret")
+	services.RegisterChannel(otpChannel)
+
+	phone := fmt.Sprintf("0812%08d", rand.Intn(100000000))
+	tenantID := dbtest.CreateTenant(t)
+	userID := dbtest.CreateUser(t, phone)
+	dbtest.AddMember(t, tenantID, userID, dbtest.CreateRole(t, tenantID, "Warga"))
+	return phone
+}
+
+// requestOTP asks for a login code and returns the code that was sent
+func requestOTP(t *testing.T, phone string) string {
+	t.Helper()
+	status, response := callJSON(t, RequestLoginOTP, map[string]string{"phone": phone})
+	if status != http.StatusOK {
+		t.Fatalf("RequestLoginOTP = %d %v, want 200", status, response)
+	}
+	msg, ok := otpChannel.LastMessageTo(normalizePhone(phone))
+	if !ok {
+		t.Fatalf("No code was sent to %s", phone)
+	}
+	code := otpCodePattern.FindString(msg.Body)
+	if code == "" {
+		t.Fatalf("Message has no code: %q", msg.Body)
+	}
+	return code
+}
+
+func verifyOTP(t *testing.T, phone, code string) (int, map[string]interface{}) {
+	t.Helper()
+	return callJSON(t, VerifyLoginOTP, map[string]string{"phone": phone, "code": code})
+}
+
+// wrongCode returns a code that differs from code
+func wrongCode(code string) string {
+	if code == "000000" {
+		return "111111"
+	}
+	return "000000"
+}
+
+func TestLoginOTPSendAndVerify(t *testing.T) {
+	phone := otpResident(t)
+	code := requestOTP(t, phone)
+
+	status, response := verifyOTP(t, phone, code)
+	if status != http.StatusOK || response["token"] == nil || response["refresh_token"] == nil {
+		t.Fatalf("VerifyLoginOTP = %d %v, want 200 with tokens", status, response)
+	}
+
+	// A code logs in once
+	if status, _ := verifyOTP(t, phone, code); status != http.StatusUnauthorized {
+		t.Fatalf("Reusing the code = %d, want 401", status)
+	}
+}
+
+func TestLoginOTPWrongCode(t *testing.T) {
+	phone := otpResident(t)
+	code := requestOTP(t, phone)
+
+	status, response := verifyOTP(t, phone, wrongCode(code))
+	if status != http.StatusUnauthorized {
+		t.Fatalf("Wrong code = %d, want 401", status)
+	}
+	if remaining, _ := response["attempts_remaining"].(float64); int(remaining) != otpMaxAttempts-1 {
+		t.Fatalf("attempts_remaining = %v, want %d", response["attempts_remaining"], otpMaxAttempts-1)
+	}
+
+	// A wrong guess does not burn the code
+	if status, response := verifyOTP(t, phone, code); status != http.StatusOK {
+		t.Fatalf("Right code after a wrong one = %d %v, want 200", status, response)
+	}
+}
+
+func TestLoginOTPAttemptLimit(t *testing.T) {
+	phone := otpResident(t)
+	code := requestOTP(t, phone)
+
+	for i := 1; i <= otpMaxAttempts; i++ {
+		status, _ := verifyOTP(t, phone, wrongCode(code))
+		want := http.StatusUnauthorized
+		if i == otpMaxAttempts {
+			want = http.StatusTooManyRequests
+		}
+		if status != want {
+			t.Fatalf("Wrong attempt %d = %d, want %d", i, status, want)
+		}
+	}
+
+	if status, _ := verifyOTP(t, phone, code); status != http.StatusUnauthorized {
+		t.Fatalf("Right code after the attempt limit = %d, want 401", status)
+	}
+}
+
+func TestLoginOTPExpired(t *testing.T) {
+	phone := otpResident(t)
+	code := requestOTP(t, phone)
+	dbtest.Exec(t, `UPDATE otp_codes SET expires_at = NOW() - INTERVAL '1 second' WHERE phone = $1`, normalizePhone(phone))
+
+	if status, _ := verifyOTP(t, phone, code); status != http.StatusUnauthorized {
+		t.Fatalf("Expired code = %d, want 401", status)
+	}
+}
+
+func TestLoginOTPUnknownNumber(t *testing.T) {
+	registered := otpResident(t)
+	unknown := fmt.Sprintf("0813%08d", rand.Intn(100000000))
+
+	_, known := callJSON(t, RequestLoginOTP, map[string]string{"phone": registered})
+	status, response := callJSON(t, RequestLoginOTP, map[string]string{"phone": unknown})
+	if status != http.StatusOK || fmt.Sprint(response) != fmt.Sprint(known) {
+		t.Fatalf("Unknown number = %d %v, want the same response as a registered one: %v", status, response, known)
+	}
+	if _, sent := otpChannel.LastMessageTo(normalizePhone(unknown)); sent {
+		t.Fatal("A code was sent to an unknown number")
+	}
+
+	// A second request within the resend interval answers the same and sends nothing new
+	before := len(otpChannel.Messages())
+	status, response = callJSON(t, RequestLoginOTP, map[string]string{"phone": registered})
+	if status != http.StatusOK || fmt.Sprint(response) != fmt.Sprint(known) || len(otpChannel.Messages()) != before {
+		t.Fatalf("Throttled request = %d %v, want the same response and no message", status, response)
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"net/http"
 	"strconv"
 	"time"
-	"rukunos-backend/db"
 	"rukunos-backend/middleware"
 	"rukunos-backend/models"
 
@@ -16,6 +15,7 @@ import (
 // ListPanicAlerts lists all panic alerts for the tenant
 func ListPanicAlerts(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Get(string(middleware.CtxUserID)).(string)
 
 	// Get query parameters
@@ -33,7 +33,7 @@ func ListPanicAlerts(c echo.Context) error {
 
 	// Check if user is admin/security (can see all alerts) or just their own
 	var isAdmin bool
-	err := db.DB.Get(&isAdmin, `
+	err := tdb.Get(&isAdmin, `
 		SELECT EXISTS(
 			SELECT 1 FROM tenant_users tu
 			JOIN roles r ON tu.role_id = r.id
@@ -77,7 +77,7 @@ func ListPanicAlerts(c echo.Context) error {
 	query += ` ORDER BY p.created_at DESC LIMIT $` + strconv.Itoa(argIndex) + ` OFFSET $` + strconv.Itoa(argIndex+1)
 	args = append(args, limit, offset)
 
-	rows, err := db.DB.Query(query, args...)
+	rows, err := tdb.Query(query, args...)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
 	}
@@ -159,7 +159,7 @@ func ListPanicAlerts(c echo.Context) error {
 		countArgs = append(countArgs, status)
 	}
 
-	err = db.DB.Get(&total, countQuery, countArgs...)
+	err = tdb.Get(&total, countQuery, countArgs...)
 	if err != nil {
 		total = len(alerts)
 	}
@@ -178,6 +178,7 @@ func ListPanicAlerts(c echo.Context) error {
 // CreatePanicAlert creates a new panic alert
 func CreatePanicAlert(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Get(string(middleware.CtxUserID)).(string)
 
 	req := new(models.CreatePanicAlertRequest)
@@ -187,7 +188,7 @@ func CreatePanicAlert(c echo.Context) error {
 
 	// Get user's unit_id
 	var unitID sql.NullString
-	_ = db.DB.Get(&unitID, `
+	_ = tdb.Get(&unitID, `
 		SELECT unit_id FROM tenant_users
 		WHERE user_id = $1 AND tenant_id = $2 AND deleted_at IS NULL
 	`, userID, tenantID)
@@ -207,7 +208,7 @@ func CreatePanicAlert(c echo.Context) error {
 
 	var createdAt time.Time
 	var returnedID string
-	err := db.DB.QueryRow(query, alertID, tenantID, userID, unitID, location).Scan(&returnedID, &createdAt)
+	err := tdb.QueryRow(query, alertID, tenantID, userID, unitID, location).Scan(&returnedID, &createdAt)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create panic alert: " + err.Error()})
 	}
@@ -222,6 +223,7 @@ func CreatePanicAlert(c echo.Context) error {
 // UpdatePanicAlert updates a panic alert (for responding/resolving)
 func UpdatePanicAlert(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Get(string(middleware.CtxUserID)).(string)
 	alertID := c.Param("alert_id")
 
@@ -232,7 +234,7 @@ func UpdatePanicAlert(c echo.Context) error {
 
 	// Check if alert exists
 	var exists bool
-	err := db.DB.Get(&exists, `
+	err := tdb.Get(&exists, `
 		SELECT EXISTS(
 			SELECT 1 FROM panic_alerts 
 			WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
@@ -287,7 +289,7 @@ func UpdatePanicAlert(c echo.Context) error {
 	query += ` WHERE id = $` + strconv.Itoa(argIndex) + ` AND tenant_id = $` + strconv.Itoa(argIndex+1)
 	args = append(args, alertID, tenantID)
 
-	_, err = db.DB.Exec(query, args...)
+	_, err = tdb.Exec(query, args...)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update panic alert: " + err.Error()})
 	}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"rukunos-backend/db"
+	"rukunos-backend/middleware"
+	"rukunos-backend/models"
+	"rukunos-backend/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+// quotaErrorResponse answers a failed services.CheckQuota: 403 when the plan's limit is reached, 500 otherwise
+func quotaErrorResponse(c echo.Context, err error) error {
+	var exceeded *services.QuotaExceededError
+	if errors.As(err, &exceeded) {
+		return c.JSON(http.StatusForbidden, map[string]interface{}{
+			"error": exceeded.Error(),
+			"code":  "quota_exceeded",
+			"quota": exceeded.Usage.Quota,
+			"limit": exceeded.Usage.Limit,
+			"used":  exceeded.Usage.Used,
+			"plan":  exceeded.Plan.Key,
+		})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check plan quota"})
+}
+
+// quotaStatus is quotaErrorResponse for helpers that return an HTTP status and message
+func quotaStatus(err error, fallback string) (int, string) {
+	var exceeded *services.QuotaExceededError
+	if errors.As(err, &exceeded) {
+		return http.StatusForbidden, exceeded.Error()
+	}
+	return http.StatusInternalServerError, fallback
+}
+
+// setQuotaWarning tells the client that a quota is near its limit after n were added (X-Quota-Warning header)
+func setQuotaWarning(c echo.Context, usage models.QuotaUsage, n int) {
+	if warning := services.QuotaWarningAfter(usage, n); warning != "" {
+		c.Response().Header().Set("X-Quota-Warning", warning)
+	}
+}
+
+// GetTenantPlan returns the tenant's plan, its usage of every limit and the plans it can move to
+func GetTenantPlan(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+
+	usage, err := services.TenantPlanUsage(tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load plan usage"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"usage": usage,
+		"plans": services.Plans,
+	})
+}
+
+// ListPlatformPlans lists the subscription plans
+func ListPlatformPlans(c echo.Context) error {
+	setPlatformAudit(c, "plan.list", nil)
+	return c.JSON(http.StatusOK, map[string]interface{}{"plans": services.Plans})
+}
+
+// GetPlatformTenantPlan returns a tenant's plan and usage for the console
+func GetPlatformTenantPlan(c echo.Context) error {
+	setPlatformAudit(c, "tenant.plan.view", nil)
+	tenant, status, message := getPlatformTenant(c.Param("tenant_id"))
+	if status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+
+	usage, err := services.TenantPlanUsage(tenant.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load plan usage"})
+	}
+	return c.JSON(http.StatusOK, usage)
+}
+
+// ChangeTenantPlan moves a tenant to another plan. A downgrade keeps what the tenant already has over the new
+// limits, but nothing more can be created until usage is back under them; modules outside the plan switch off.
+func ChangeTenantPlan(c echo.Context) error {
+	req := new(models.ChangeTenantPlanRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	setPlatformAudit(c, "tenant.plan.change", map[string]interface{}{"plan": req.Plan, "reason": req.Reason})
+	plan, ok := services.FindPlan(req.Plan)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Unknown plan: " + req.Plan})
+	}
+
+	tenant, status, message := getPlatformTenant(c.Param("tenant_id"))
+	if status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+	if tenant.Plan == plan.Key {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Tenant is already on this plan"})
+	}
+
+	_, err := db.DB.Exec(`
+		UPDATE tenants SET plan = $1, plan_changed_at = NOW(), updated_at = NOW() WHERE id = $2
+	`, plan.Key, tenant.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to change plan"})
+	}
+
+	usage, err := services.TenantPlanUsage(tenant.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load plan usage"})
+	}
+	setPlatformAudit(c, "tenant.plan.change", map[string]interface{}{
+		"plan":          plan.Key,
+		"previous_plan": tenant.Plan,
+		"reason":        strings.TrimSpace(req.Reason),
+	})
+	return c.JSON(http.StatusOK, usage)
+}
@@ -0,0 +1,659 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"rukunos-backend/db"
+	"rukunos-backend/middleware"
+	"rukunos-backend/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// platformSessionTTL is how long a super-admin console login lasts; there is no refresh, admins log in again
+func platformSessionTTL() time.Duration {
+	return durationFromEnv("PLATFORM_SESSION_TTL", time.Hour)
+}
+
+// setPlatformAudit names the action the PlatformAudit middleware records for this request
+func setPlatformAudit(c echo.Context, action string, details map[string]interface{}) {
+	c.Set(string(middleware.CtxAuditAction), action)
+	if details != nil {
+		c.Set(string(middleware.CtxAuditDetails), details)
+	}
+}
+
+// platformPagination reads page/limit query params with the same defaults as the tenant list endpoints
+func platformPagination(c echo.Context) (int, int) {
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	return page, limit
+}
+
+// PlatformLogin signs a super admin into the platform console. Tenant tokens are not accepted there and
+// console tokens are not accepted by tenant routes (they carry no tenant_id).
+func PlatformLogin(c echo.Context) error {
+	req := new(models.PlatformLoginRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	if req.Email == "" || req.Password == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "email and password are required"})
+	}
+	setPlatformAudit(c, "auth.login_failed", map[string]interface{}{"email": req.Email})
+
+	var user struct {
+		models.User
+		IsSuperAdmin bool `db:"is_super_admin"`
+		HasTOTP      bool `db:"has_totp"`
+	}
+	err := db.DB.Get(&user, `
+		SELECT id, email, COALESCE(password_hash, '') AS password_hash, full_name, COALESCE(status, 'active') AS status,
+		       COALESCE(is_super_admin, false) AS is_super_admin, totp_enabled_at IS NOT NULL AS has_totp
+		FROM users
+		WHERE LOWER(email) = LOWER($1) AND deleted_at IS NULL
+		AND (auth_provider = 'email' OR auth_provider = 'both')
+		LIMIT 1
+	`, strings.TrimSpace(req.Email))
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid credentials"})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	c.Set(string(middleware.CtxAuditTargetUserID), user.ID)
+
+	if until, err := getLoginLockout().LockedUntil(lockoutID(user.ID)); err != nil {
+		c.Logger().Warnf("Failed to check login lockout for user %s: %v", user.ID, err)
+	} else if !until.IsZero() {
+		return lockedOutResponse(c, until)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		recordLoginFailure(c, user.User)
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid credentials"})
+	}
+	// Same answer as a wrong password so the console does not reveal who is a super admin
+	if !user.IsSuperAdmin || user.Status != "active" {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid credentials"})
+	}
+
+	tx, err := db.DB.Beginx()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
+	}
+	defer tx.Rollback()
+
+	if user.HasTOTP {
+		if req.Code == "" {
+			return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+				"error":               "Two-factor code is required",
+				"two_factor_required": true,
+			})
+		}
+		ok, err := verifySecondFactor(tx, user.ID, req.Code)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		if !ok {
+			recordLoginFailure(c, user.User)
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid code"})
+		}
+	}
+	if err := getLoginLockout().Succeed(lockoutID(user.ID)); err != nil {
+		c.Logger().Warnf("Failed to reset login failures for user %s: %v", user.ID, err)
+	}
+
+	expiresAt := time.Now().Add(platformSessionTTL())
+	var sessionID string
+	err = tx.QueryRow(`
+		INSERT INTO platform_sessions (user_id, user_agent, ip_address, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, user.ID, c.Request().UserAgent(), c.RealIP(), expiresAt).Scan(&sessionID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create session"})
+	}
+
+	token := jwt.New(jwt.SigningMethodHS256)
+	claims := token.Claims.(jwt.MapClaims)
+	claims["user_id"] = user.ID
+	claims["sid"] = sessionID
+	claims["aud"] = middleware.PlatformTokenAudience
+	claims["exp"] = expiresAt.Unix()
+	signed, err := token.SignedString(jwtSecret())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate token"})
+	}
+
+	if err = tx.Commit(); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit transaction"})
+	}
+
+	c.Set(string(middleware.CtxUserID), user.ID)
+	c.Set(string(middleware.CtxPlatformSessionID), sessionID)
+	setPlatformAudit(c, "auth.login", map[string]interface{}{})
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"token":      signed,
+		"expires_in": int64(platformSessionTTL().Seconds()),
+		"user": map[string]interface{}{
+			"id":        user.ID,
+			"email":     user.Email,
+			"full_name": user.FullName,
+		},
+	})
+}
+
+// PlatformLogout ends the current console session
+func PlatformLogout(c echo.Context) error {
+	sessionID := c.Get(string(middleware.CtxPlatformSessionID)).(string)
+	setPlatformAudit(c, "auth.logout", nil)
+
+	_, err := db.DB.Exec(`UPDATE platform_sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`, sessionID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to log out"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Logged out"})
+}
+
+// ListPlatformTenants lists and searches every tenant on the platform
+func ListPlatformTenants(c echo.Context) error {
+	setPlatformAudit(c, "tenant.list", nil)
+	page, limit := platformPagination(c)
+
+	where := ` WHERE t.deleted_at IS NULL`
+	args := []interface{}{}
+	if search := strings.TrimSpace(c.QueryParam("search")); search != "" {
+		args = append(args, "%"+search+"%")
+		where += ` AND (t.name ILIKE $` + strconv.Itoa(len(args)) + ` OR t.code ILIKE $` + strconv.Itoa(len(args)) +
+			` OR t.email ILIKE $` + strconv.Itoa(len(args)) + `)`
+	}
+	if status := c.QueryParam("status"); status != "" {
+		args = append(args, status)
+		where += ` AND t.status = $` + strconv.Itoa(len(args))
+	}
+	if plan := c.QueryParam("plan"); plan != "" {
+		args = append(args, plan)
+		where += ` AND t.plan = $` + strconv.Itoa(len(args))
+	}
+
+	var total int
+	if err := db.DB.Get(&total, `SELECT COUNT(*) FROM tenants t`+where, args...); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	tenants := []models.PlatformTenant{}
+	query := `
+		SELECT t.id, t.name, t.code, COALESCE(t.status, 'active') AS status, t.plan, t.email, t.phone,
+		       COALESCE(t.level, 'rt') AS level, t.parent_tenant_id,
+		       t.suspended_at, t.suspension_reason, t.created_at,
+		       (SELECT COUNT(*) FROM tenant_users tu
+		        WHERE tu.tenant_id = t.id AND tu.status = 'active' AND tu.deleted_at IS NULL) AS member_count,
+		       (SELECT COUNT(*) FROM units u WHERE u.tenant_id = t.id AND u.deleted_at IS NULL) AS unit_count
+		FROM tenants t` + where + `
+		ORDER BY t.created_at DESC
+		LIMIT $` + strconv.Itoa(len(args)+1) + ` OFFSET $` + strconv.Itoa(len(args)+2)
+	if err := db.DB.Select(&tenants, query, append(args, limit, (page-1)*limit)...); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"tenants": tenants,
+		"pagination": map[string]interface{}{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": (total + limit - 1) / limit,
+		},
+	})
+}
+
+// getPlatformTenant loads one tenant for the console, or a non-zero HTTP status with an error message
+func getPlatformTenant(tenantID string) (models.PlatformTenant, int, string) {
+	var tenant models.PlatformTenant
+	if _, err := uuid.Parse(tenantID); err != nil {
+		return tenant, http.StatusNotFound, "Tenant not found"
+	}
+	err := db.DB.Get(&tenant, `
+		SELECT t.id, t.name, t.code, COALESCE(t.status, 'active') AS status, t.plan, t.email, t.phone,
+		       COALESCE(t.level, 'rt') AS level, t.parent_tenant_id,
+		       t.suspended_at, t.suspension_reason, t.created_at,
+		       (SELECT COUNT(*) FROM tenant_users tu
+		        WHERE tu.tenant_id = t.id AND tu.status = 'active' AND tu.deleted_at IS NULL) AS member_count,
+		       (SELECT COUNT(*) FROM units u WHERE u.tenant_id = t.id AND u.deleted_at IS NULL) AS unit_count
+		FROM tenants t
+		WHERE t.id = $1 AND t.deleted_at IS NULL
+	`, tenantID)
+	if err == sql.ErrNoRows {
+		return tenant, http.StatusNotFound, "Tenant not found"
+	} else if err != nil {
+		return tenant, http.StatusInternalServerError, "Database error"
+	}
+	return tenant, 0, ""
+}
+
+// getTenantUsageStats counts what a tenant has in RukunOS and when it was last used
+func getTenantUsageStats(tenantID string) (models.TenantUsageStats, error) {
+	var stats models.TenantUsageStats
+	err := db.DB.Get(&stats, `
+		SELECT
+			(SELECT COUNT(*) FROM tenant_users WHERE tenant_id = $1 AND status = 'active' AND deleted_at IS NULL) AS active_members,
+			(SELECT COUNT(*) FROM units WHERE tenant_id = $1 AND deleted_at IS NULL) AS units,
+			(SELECT COUNT(*) FROM bills WHERE tenant_id = $1 AND deleted_at IS NULL) AS bills,
+			(SELECT COUNT(*) FROM bills WHERE tenant_id = $1 AND status = 'paid' AND deleted_at IS NULL) AS paid_bills,
+			(SELECT COALESCE(SUM(amount + COALESCE(late_fee, 0)), 0) FROM bills
+			 WHERE tenant_id = $1 AND status = 'paid' AND paid_at > NOW() - INTERVAL '30 days' AND deleted_at IS NULL) AS collected_30_days,
+			(SELECT COUNT(*) FROM announcements WHERE tenant_id = $1 AND deleted_at IS NULL) AS announcements,
+			(SELECT COUNT(*) FROM complaints WHERE tenant_id = $1 AND deleted_at IS NULL) AS complaints,
+			(SELECT COUNT(*) FROM panic_alerts WHERE tenant_id = $1 AND deleted_at IS NULL) AS panic_alerts,
+			(SELECT COUNT(*) FROM visitor_logs WHERE tenant_id = $1 AND deleted_at IS NULL) AS visitor_logs,
+			(SELECT COUNT(*) FROM user_sessions WHERE tenant_id = $1 AND revoked_at IS NULL AND expires_at > NOW()) AS active_sessions,
+			(SELECT MAX(last_used_at) FROM user_sessions WHERE tenant_id = $1) AS last_activity_at
+	`, tenantID)
+	return stats, err
+}
+
+// GetPlatformTenant returns a tenant with its usage stats and admins
+func GetPlatformTenant(c echo.Context) error {
+	setPlatformAudit(c, "tenant.view", nil)
+
+	tenant, status, message := getPlatformTenant(c.Param("tenant_id"))
+	if status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+
+	stats, err := getTenantUsageStats(tenant.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load usage stats"})
+	}
+
+	type tenantAdmin struct {
+		ID       string `json:"id" db:"id"`
+		Email    string `json:"email" db:"email"`
+		FullName string `json:"full_name" db:"full_name"`
+		Status   string `json:"status" db:"status"`
+	}
+	admins := []tenantAdmin{}
+	err = db.DB.Select(&admins, `
+		SELECT u.id, u.email, u.full_name, COALESCE(tu.status, 'active') AS status
+		FROM tenant_users tu
+		INNER JOIN users u ON u.id = tu.user_id
+		INNER JOIN roles r ON r.id = tu.role_id
+		WHERE tu.tenant_id = $1 AND r.name = 'Admin' AND tu.deleted_at IS NULL AND u.deleted_at IS NULL
+		ORDER BY u.full_name
+	`, tenant.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"tenant": tenant,
+		"stats":  stats,
+		"admins": admins,
+	})
+}
+
+// GetPlatformTenantStats returns only the usage stats of a tenant
+func GetPlatformTenantStats(c echo.Context) error {
+	setPlatformAudit(c, "tenant.stats", nil)
+
+	tenant, status, message := getPlatformTenant(c.Param("tenant_id"))
+	if status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+	stats, err := getTenantUsageStats(tenant.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load usage stats"})
+	}
+	return c.JSON(http.StatusOK, stats)
+}
+
+// GetPlatformStats returns totals across all tenants
+func GetPlatformStats(c echo.Context) error {
+	setPlatformAudit(c, "platform.stats", nil)
+
+	var stats struct {
+		Tenants          int     `json:"tenants" db:"tenants"`
+		ActiveTenants    int     `json:"active_tenants" db:"active_tenants"`
+		SuspendedTenants int     `json:"suspended_tenants" db:"suspended_tenants"`
+		Users            int     `json:"users" db:"users"`
+		Units            int     `json:"units" db:"units"`
+		Collected30Days  float64 `json:"collected_30_days" db:"collected_30_days"`
+		ActiveSessions   int     `json:"active_sessions" db:"active_sessions"`
+		NewTenants30Days int     `json:"new_tenants_30_days" db:"new_tenants_30_days"`
+	}
+	err := db.DB.Get(&stats, `
+		SELECT
+			(SELECT COUNT(*) FROM tenants WHERE deleted_at IS NULL) AS tenants,
+			(SELECT COUNT(*) FROM tenants WHERE status = 'active' AND deleted_at IS NULL) AS active_tenants,
+			(SELECT COUNT(*) FROM tenants WHERE status = 'suspended' AND deleted_at IS NULL) AS suspended_tenants,
+			(SELECT COUNT(*) FROM users WHERE deleted_at IS NULL) AS users,
+			(SELECT COUNT(*) FROM units WHERE deleted_at IS NULL) AS units,
+			(SELECT COALESCE(SUM(amount + COALESCE(late_fee, 0)), 0) FROM bills
+			 WHERE status = 'paid' AND paid_at > NOW() - INTERVAL '30 days' AND deleted_at IS NULL) AS collected_30_days,
+			(SELECT COUNT(*) FROM user_sessions WHERE revoked_at IS NULL AND expires_at > NOW()) AS active_sessions,
+			(SELECT COUNT(*) FROM tenants WHERE created_at > NOW() - INTERVAL '30 days' AND deleted_at IS NULL) AS new_tenants_30_days
+	`)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	return c.JSON(http.StatusOK, stats)
+}
+
+// SuspendTenant blocks a tenant: TenantMiddleware only admits active tenants, and all its sessions are revoked
+func SuspendTenant(c echo.Context) error {
+	req := new(models.SuspendTenantRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	setPlatformAudit(c, "tenant.suspend", map[string]interface{}{"reason": req.Reason})
+	if strings.TrimSpace(req.Reason) == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "reason is required"})
+	}
+
+	tenant, status, message := getPlatformTenant(c.Param("tenant_id"))
+	if status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+	if tenant.Status == "suspended" {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Tenant is already suspended"})
+	}
+
+	tx, err := db.DB.Beginx()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE tenants SET status = 'suspended', suspended_at = NOW(), suspension_reason = $1, updated_at = NOW()
+		WHERE id = $2
+	`, strings.TrimSpace(req.Reason), tenant.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to suspend tenant"})
+	}
+	result, err := tx.Exec(`
+		UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = 'tenant_suspended'
+		WHERE tenant_id = $1 AND revoked_at IS NULL
+	`, tenant.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to revoke sessions"})
+	}
+	if err = tx.Commit(); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit transaction"})
+	}
+
+	revoked, _ := result.RowsAffected()
+	setPlatformAudit(c, "tenant.suspend", map[string]interface{}{
+		"reason":           req.Reason,
+		"previous_status":  tenant.Status,
+		"revoked_sessions": revoked,
+	})
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":          "Tenant suspended",
+		"revoked_sessions": revoked,
+	})
+}
+
+// ReactivateTenant lets a suspended tenant's members log in again
+func ReactivateTenant(c echo.Context) error {
+	setPlatformAudit(c, "tenant.reactivate", nil)
+
+	tenant, status, message := getPlatformTenant(c.Param("tenant_id"))
+	if status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+	if tenant.Status == "active" {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Tenant is already active"})
+	}
+
+	_, err := db.DB.Exec(`
+		UPDATE tenants SET status = 'active', suspended_at = NULL, suspension_reason = NULL, updated_at = NOW()
+		WHERE id = $1
+	`, tenant.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to reactivate tenant"})
+	}
+
+	setPlatformAudit(c, "tenant.reactivate", map[string]interface{}{
+		"previous_status":   tenant.Status,
+		"suspension_reason": tenant.SuspensionReason.String,
+	})
+	return c.JSON(http.StatusOK, map[string]string{"message": "Tenant reactivated"})
+}
+
+// SetTenantHierarchy makes a tenant an RW, or an RT (optionally inside an RW)
+func SetTenantHierarchy(c echo.Context) error {
+	req := new(models.SetTenantHierarchyRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	setPlatformAudit(c, "tenant.hierarchy", map[string]interface{}{"level": req.Level, "parent_tenant_id": req.ParentTenantID})
+	if req.Level != models.TenantLevelRT && req.Level != models.TenantLevelRW {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "level must be rt or rw"})
+	}
+
+	tenant, status, message := getPlatformTenant(c.Param("tenant_id"))
+	if status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+
+	var parentID *string
+	if req.ParentTenantID != nil && *req.ParentTenantID != "" {
+		if req.Level == models.TenantLevelRW {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "An RW cannot have a parent"})
+		}
+		parent, status, message := getPlatformTenant(*req.ParentTenantID)
+		if status != 0 {
+			return c.JSON(status, map[string]string{"error": "Parent " + strings.ToLower(message)})
+		}
+		if parent.ID == tenant.ID {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "A tenant cannot be its own parent"})
+		}
+		if parent.Level != models.TenantLevelRW {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Parent tenant must be an RW"})
+		}
+		parentID = &parent.ID
+	}
+
+	if req.Level == models.TenantLevelRT {
+		var childCount int
+		if err := db.DB.Get(&childCount, `SELECT COUNT(*) FROM tenants WHERE parent_tenant_id = $1 AND deleted_at IS NULL`, tenant.ID); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		if childCount > 0 {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "This RW still has RTs; move them first"})
+		}
+	}
+
+	_, err := db.DB.Exec(`UPDATE tenants SET level = $1, parent_tenant_id = $2, updated_at = NOW() WHERE id = $3`,
+		req.Level, parentID, tenant.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update tenant hierarchy"})
+	}
+
+	setPlatformAudit(c, "tenant.hierarchy", map[string]interface{}{
+		"level":                     req.Level,
+		"parent_tenant_id":          parentID,
+		"previous_level":            tenant.Level,
+		"previous_parent_tenant_id": tenant.ParentTenantID.String,
+	})
+	return c.JSON(http.StatusOK, map[string]string{"message": "Tenant hierarchy updated"})
+}
+
+// ResetTenantAdminAccess recovers a tenant admin who is locked out of their account: it lifts the login
+// lockout, optionally removes two-factor and (re)grants the Admin role, ends their sessions and emails a
+// password reset link. The password itself is never seen or set by the super admin.
+func ResetTenantAdminAccess(c echo.Context) error {
+	req := new(models.ResetTenantAdminRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	sendReset := req.SendPasswordReset == nil || *req.SendPasswordReset
+	setPlatformAudit(c, "tenant.admin_access_reset", map[string]interface{}{
+		"grant_admin_role":    req.GrantAdminRole,
+		"disable_two_factor":  req.DisableTwoFactor,
+		"send_password_reset": sendReset,
+	})
+	c.Set(string(middleware.CtxAuditTargetUserID), req.UserID)
+
+	tenant, status, message := getPlatformTenant(c.Param("tenant_id"))
+	if status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+	if _, err := uuid.Parse(req.UserID); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "user_id is required"})
+	}
+
+	var user struct {
+		ID       string `db:"id"`
+		Email    string `db:"email"`
+		FullName string `db:"full_name"`
+		Provider string `db:"auth_provider"`
+	}
+	err := db.DB.Get(&user, `
+		SELECT u.id, u.email, u.full_name, COALESCE(u.auth_provider, 'email') AS auth_provider
+		FROM users u
+		INNER JOIN tenant_users tu ON tu.user_id = u.id
+		WHERE u.id = $1 AND tu.tenant_id = $2 AND tu.deleted_at IS NULL AND u.deleted_at IS NULL
+	`, req.UserID, tenant.ID)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found or not a member of this tenant"})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	tx, err := db.DB.Beginx()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
+	}
+	defer tx.Rollback()
+
+	if req.GrantAdminRole {
+		_, err = tx.Exec(`
+			UPDATE tenant_users SET role_id = (
+				SELECT id FROM roles WHERE tenant_id = $1 AND name = 'Admin' AND is_system = true AND deleted_at IS NULL
+			), status = 'active', updated_at = NOW()
+			WHERE tenant_id = $1 AND user_id = $2 AND deleted_at IS NULL
+		`, tenant.ID, user.ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to grant Admin role"})
+		}
+	}
+
+	if req.DisableTwoFactor {
+		_, err = tx.Exec(`
+			UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL, updated_at = NOW()
+			WHERE id = $1
+		`, user.ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to disable two-factor authentication"})
+		}
+		if _, err = tx.Exec(`DELETE FROM user_recovery_codes WHERE user_id = $1`, user.ID); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete recovery codes"})
+		}
+	}
+
+	if err := middleware.RevokeUserSessions(tx, user.ID, "", "access_reset"); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to revoke sessions"})
+	}
+	if err = tx.Commit(); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit transaction"})
+	}
+
+	if err := getLoginLockout().Unlock(lockoutID(user.ID)); err != nil {
+		c.Logger().Warnf("Failed to unlock user %s: %v", user.ID, err)
+	}
+
+	resetSent := false
+	if sendReset && user.Provider != "google" {
+		if err := sendPasswordResetEmail(user.ID, user.Email, user.FullName); err != nil {
+			c.Logger().Errorf("Failed to send password reset email: %v", err)
+		} else {
+			resetSent = true
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":             "Admin access reset",
+		"password_reset_sent": resetSent,
+	})
+}
+
+// ListPlatformAuditLogs lists the console audit log, newest first
+func ListPlatformAuditLogs(c echo.Context) error {
+	setPlatformAudit(c, "audit.list", nil)
+	page, limit := platformPagination(c)
+
+	where := ` WHERE 1=1`
+	args := []interface{}{}
+	for param, column := range map[string]string{
+		"tenant_id": "target_tenant_id",
+		"user_id":   "target_user_id",
+		"actor_id":  "actor_user_id",
+	} {
+		value := c.QueryParam(param)
+		if value == "" {
+			continue
+		}
+		if _, err := uuid.Parse(value); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid " + param})
+		}
+		args = append(args, value)
+		where += ` AND ` + column + ` = $` + strconv.Itoa(len(args))
+	}
+	if action := c.QueryParam("action"); action != "" {
+		args = append(args, action+"%")
+		where += ` AND action LIKE $` + strconv.Itoa(len(args))
+	}
+	if from := c.QueryParam("from"); from != "" {
+		args = append(args, from)
+		where += ` AND created_at >= $` + strconv.Itoa(len(args))
+	}
+	if to := c.QueryParam("to"); to != "" {
+		args = append(args, to)
+		where += ` AND created_at < $` + strconv.Itoa(len(args))
+	}
+
+	var total int
+	if err := db.DB.Get(&total, `SELECT COUNT(*) FROM platform_audit_logs`+where, args...); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid filter"})
+	}
+
+	logs := []models.PlatformAuditLog{}
+	query := `
+		SELECT id, actor_user_id, actor_email, action, method, path, status_code, target_tenant_id, target_user_id,
+		       details, ip_address, created_at
+		FROM platform_audit_logs` + where + `
+		ORDER BY created_at DESC
+		LIMIT $` + strconv.Itoa(len(args)+1) + ` OFFSET $` + strconv.Itoa(len(args)+2)
+	if err := db.DB.Select(&logs, query, append(args, limit, (page-1)*limit)...); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	for i := range logs {
+		json.Unmarshal(logs[i].DetailsJSON, &logs[i].Details)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"logs": logs,
+		"pagination": map[string]interface{}{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": (total + limit - 1) / limit,
+		},
+	})
+}
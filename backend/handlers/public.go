@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+	"rukunos-backend/db"
+	"rukunos-backend/middleware"
+	"rukunos-backend/models"
+	"rukunos-backend/services"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// Public endpoints need no login. ResolveTenantHost picks the tenant from the page's subdomain or custom domain.
+
+// hostTenantID returns the tenant resolved from the request host, or "" when the host is not a tenant's
+func hostTenantID(c echo.Context) string {
+	tenantID, _ := c.Get(string(middleware.CtxHostTenantID)).(string)
+	return tenantID
+}
+
+// maskName keeps the first two letters of every word, e.g. "Budi Santoso" becomes "Bu** Sa*****"
+func maskName(name string) string {
+	words := strings.Fields(name)
+	for i, word := range words {
+		runes := []rune(word)
+		if len(runes) <= 2 {
+			continue
+		}
+		words[i] = string(runes[:2]) + strings.Repeat("*", len(runes)-2)
+	}
+	return strings.Join(words, " ")
+}
+
+// GetPublicTenant returns the branding of the tenant the page belongs to, for the login and public pages
+func GetPublicTenant(c echo.Context) error {
+	tenantID := hostTenantID(c)
+	if tenantID == "" {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Tenant not found"})
+	}
+
+	var tenant models.Tenant
+	err := db.DB.Get(&tenant, `
+		SELECT id, name, code, address, phone, email, COALESCE(level, 'rt') AS level
+		FROM tenants WHERE id = $1
+	`, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	settings, err := services.LoadTenantSettings(tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load tenant settings"})
+	}
+
+	providers := []models.PublicIdentityProvider{}
+	err = db.DB.Select(&providers, `
+		SELECT id, name FROM tenant_identity_providers
+		WHERE tenant_id = $1 AND enabled = true AND deleted_at IS NULL
+		ORDER BY name
+	`, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch identity providers"})
+	}
+
+	return c.JSON(http.StatusOK, models.PublicTenant{
+		Name:              tenant.Name,
+		Code:              tenant.Code,
+		Level:             tenant.Level,
+		Address:           tenant.Address,
+		Phone:             tenant.Phone,
+		Email:             tenant.Email,
+		Letterhead:        settings.Letterhead,
+		IdentityProviders: providers,
+	})
+}
+
+// VerifyPublicDocument confirms that a letter (surat pengantar) with this ID was approved by the tenant.
+// The ID is printed on the letter; the applicant's name is masked.
+func VerifyPublicDocument(c echo.Context) error {
+	tenantID := hostTenantID(c)
+	if tenantID == "" {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Tenant not found"})
+	}
+	documentID := c.Param("document_id")
+	if _, err := uuid.Parse(documentID); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Document not found"})
+	}
+
+	var doc struct {
+		ID           string       `db:"id"`
+		DocumentType string       `db:"document_type"`
+		Status       string       `db:"status"`
+		ApprovedAt   sql.NullTime `db:"approved_at"`
+		UserName     string       `db:"user_name"`
+		TenantName   string       `db:"tenant_name"`
+	}
+	err := middleware.TenantDB(c).Get(&doc, `
+		SELECT d.id, d.document_type, d.status, d.approved_at,
+		       COALESCE(u.full_name, '') AS user_name, t.name AS tenant_name
+		FROM document_requests d
+		INNER JOIN tenants t ON t.id = d.tenant_id
+		LEFT JOIN users u ON u.id = d.user_id
+		WHERE d.id = $1 AND d.tenant_id = $2 AND d.deleted_at IS NULL
+		AND d.status IN ('approved', 'completed')
+	`, documentID, tenantID)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Document not found"})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	var approvedAt *time.Time
+	if doc.ApprovedAt.Valid {
+		approvedAt = &doc.ApprovedAt.Time
+	}
+	issuedBy := doc.TenantName
+	if settings, err := services.LoadTenantSettings(tenantID); err == nil && settings.Letterhead.Title != "" {
+		issuedBy = settings.Letterhead.Title
+	}
+
+	return c.JSON(http.StatusOK, models.PublicDocumentVerification{
+		ID:            doc.ID,
+		DocumentType:  doc.DocumentType,
+		Status:        doc.Status,
+		ApplicantName: maskName(doc.UserName),
+		ApprovedAt:    approvedAt,
+		IssuedBy:      issuedBy,
+	})
+}
@@ -0,0 +1,817 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"rukunos-backend/db"
+	"rukunos-backend/middleware"
+	"rukunos-backend/models"
+	"rukunos-backend/pii"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// residentRelationships are the relationships printed on a family card (hubungan dalam keluarga)
+var residentRelationships = map[string]string{
+	"kepala_keluarga": "Kepala Keluarga",
+	"suami":           "Suami",
+	"istri":           "Istri",
+	"anak":            "Anak",
+	"menantu":         "Menantu",
+	"cucu":            "Cucu",
+	"orang_tua":       "Orang Tua",
+	"mertua":          "Mertua",
+	"famili_lain":     "Famili Lain",
+	"lainnya":         "Lainnya",
+}
+
+// identityNumberPattern matches a NIK or KK number: 16 digits
+var identityNumberPattern = regexp.MustCompile(`^[0-9]{16}$`)
+
+const householdColumns = `
+	h.id, h.tenant_id, h.unit_id, u.code AS unit_code, h.kk_number_encrypted, h.address, h.notes,
+	(SELECT r.full_name FROM residents r
+	 WHERE r.household_id = h.id AND r.relationship = 'kepala_keluarga' AND r.deleted_at IS NULL
+	 ORDER BY r.created_at LIMIT 1) AS head_name,
+	(SELECT COUNT(*) FROM residents r WHERE r.household_id = h.id AND r.deleted_at IS NULL) AS member_count,
+	h.created_at, h.updated_at
+	FROM households h
+	LEFT JOIN units u ON u.id = h.unit_id AND u.deleted_at IS NULL`
+
+const residentColumns = `
+	r.id, r.tenant_id, r.household_id, h.unit_id, u.code AS unit_code, r.user_id, r.full_name, r.nik_encrypted,
+	r.gender, r.birth_place, TO_CHAR(r.birth_date, 'YYYY-MM-DD') AS birth_date, r.relationship, r.religion,
+	r.marital_status, r.occupation, r.domicile_status, r.phone, TO_CHAR(r.moved_in_at, 'YYYY-MM-DD') AS moved_in_at,
+	r.notes, r.created_at, r.updated_at
+	FROM residents r
+	INNER JOIN households h ON h.id = r.household_id
+	LEFT JOIN units u ON u.id = h.unit_id AND u.deleted_at IS NULL`
+
+// piiErrorResponse answers a failed encryption: the key is missing, or the stored value cannot be opened
+func piiErrorResponse(c echo.Context, err error) error {
+	if errors.Is(err, pii.ErrNoKey) {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Resident data encryption is not configured"})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to read resident data"})
+}
+
+// encryptIdentityNumber returns the ciphertext, bound to the tenant, and blind index of a NIK or KK number
+func encryptIdentityNumber(tenantID, number string) (string, string, error) {
+	encrypted, err := pii.Encrypt(number, tenantID)
+	if err != nil {
+		return "", "", err
+	}
+	hash, err := pii.BlindIndex(number)
+	if err != nil {
+		return "", "", err
+	}
+	return encrypted, hash, nil
+}
+
+// decryptHousehold fills in the KK number, masked unless full is set
+func decryptHousehold(h *models.Household, full bool) error {
+	number, err := pii.Decrypt(h.KKEncrypted, h.TenantID)
+	if err != nil {
+		return err
+	}
+	if !full {
+		number = pii.Mask(number)
+	}
+	h.KKNumber = number
+	return nil
+}
+
+// decryptResident fills in the NIK, masked unless full is set
+func decryptResident(r *models.Resident, full bool) error {
+	number, err := pii.Decrypt(r.NIKEncrypted, r.TenantID)
+	if err != nil {
+		return err
+	}
+	if !full {
+		number = pii.Mask(number)
+	}
+	r.NIK = number
+	return nil
+}
+
+// validDate reports whether s is a YYYY-MM-DD date not in the future
+func validDate(s string) bool {
+	t, err := time.Parse("2006-01-02", s)
+	return err == nil && !t.After(time.Now())
+}
+
+// checkResidentRefs verifies that the household, unit and linked user belong to the tenant.
+// Empty IDs are not checked. It returns an HTTP status and message, or 0 when everything exists.
+func checkResidentRefs(tdb *db.TenantDB, tenantID, householdID, unitID, userID string) (int, string) {
+	checks := []struct {
+		id, query, message string
+	}{
+		{householdID, `SELECT EXISTS(SELECT 1 FROM households WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL)`, "Household not found"},
+		{unitID, `SELECT EXISTS(SELECT 1 FROM units WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL)`, "Unit not found"},
+		{userID, `SELECT EXISTS(SELECT 1 FROM tenant_users WHERE user_id = $1 AND tenant_id = $2 AND deleted_at IS NULL)`, "User is not a member of this tenant"},
+	}
+	for _, check := range checks {
+		if check.id == "" {
+			continue
+		}
+		if _, err := uuid.Parse(check.id); err != nil {
+			return http.StatusBadRequest, check.message
+		}
+		var exists bool
+		if err := tdb.Get(&exists, check.query, check.id, tenantID); err != nil {
+			return http.StatusInternalServerError, "Database error"
+		}
+		if !exists {
+			return http.StatusBadRequest, check.message
+		}
+	}
+	return 0, ""
+}
+
+// ListHouseholds lists the family cards of the tenant. search matches a full KK number, a unit code or a member's name.
+func ListHouseholds(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
+
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	offset := (page - 1) * limit
+
+	where := ` WHERE h.tenant_id = $1 AND h.deleted_at IS NULL`
+	args := []interface{}{tenantID}
+	if unitID := c.QueryParam("unit_id"); unitID != "" {
+		args = append(args, unitID)
+		where += ` AND h.unit_id = $` + strconv.Itoa(len(args))
+	}
+	if search := strings.TrimSpace(c.QueryParam("search")); search != "" {
+		if identityNumberPattern.MatchString(search) {
+			hash, err := pii.BlindIndex(search)
+			if err != nil {
+				return piiErrorResponse(c, err)
+			}
+			args = append(args, hash)
+			where += ` AND h.kk_number_hash = $` + strconv.Itoa(len(args))
+		} else {
+			args = append(args, "%"+search+"%")
+			where += ` AND (u.code ILIKE $` + strconv.Itoa(len(args)) + ` OR EXISTS(
+				SELECT 1 FROM residents r WHERE r.household_id = h.id AND r.deleted_at IS NULL
+				AND r.full_name ILIKE $` + strconv.Itoa(len(args)) + `))`
+		}
+	}
+
+	var total int
+	err := tdb.Get(&total, `SELECT COUNT(*) FROM households h LEFT JOIN units u ON u.id = h.unit_id AND u.deleted_at IS NULL`+where, args...)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to count households"})
+	}
+
+	households := []models.Household{}
+	query := `SELECT ` + householdColumns + where +
+		` ORDER BY u.code ASC NULLS LAST, h.created_at ASC LIMIT $` + strconv.Itoa(len(args)+1) + ` OFFSET $` + strconv.Itoa(len(args)+2)
+	if err := tdb.Select(&households, query, append(args, limit, offset)...); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch households"})
+	}
+	for i := range households {
+		if err := decryptHousehold(&households[i], false); err != nil {
+			return piiErrorResponse(c, err)
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"households": households,
+		"pagination": map[string]interface{}{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": (total + limit - 1) / limit,
+		},
+	})
+}
+
+// getHousehold loads a household with its members, NIKs and KK number in full
+func getHousehold(tdb *db.TenantDB, tenantID, householdID string) (models.Household, error) {
+	var household models.Household
+	err := tdb.Get(&household, `SELECT `+householdColumns+`
+		WHERE h.id = $1 AND h.tenant_id = $2 AND h.deleted_at IS NULL
+	`, householdID, tenantID)
+	if err != nil {
+		return household, err
+	}
+	if err := decryptHousehold(&household, true); err != nil {
+		return household, err
+	}
+
+	household.Members = []models.Resident{}
+	err = tdb.Select(&household.Members, `SELECT `+residentColumns+`
+		WHERE r.household_id = $1 AND r.tenant_id = $2 AND r.deleted_at IS NULL
+		ORDER BY r.relationship = 'kepala_keluarga' DESC, r.birth_date ASC
+	`, householdID, tenantID)
+	if err != nil {
+		return household, err
+	}
+	for i := range household.Members {
+		if err := decryptResident(&household.Members[i], true); err != nil {
+			return household, err
+		}
+	}
+	return household, nil
+}
+
+// GetHousehold returns a family card with its members
+func GetHousehold(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
+
+	if _, err := uuid.Parse(c.Param("household_id")); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Household not found"})
+	}
+	household, err := getHousehold(tdb, tenantID, c.Param("household_id"))
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Household not found"})
+	} else if err != nil {
+		return piiErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, household)
+}
+
+// CreateHousehold registers a family card, optionally in a unit
+func CreateHousehold(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+
+	req := new(models.CreateHouseholdRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	req.KKNumber = strings.TrimSpace(req.KKNumber)
+	if !identityNumberPattern.MatchString(req.KKNumber) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "kk_number must be 16 digits"})
+	}
+	if req.UnitID != nil && *req.UnitID == "" {
+		req.UnitID = nil
+	}
+	unitID := ""
+	if req.UnitID != nil {
+		unitID = *req.UnitID
+	}
+	if status, message := checkResidentRefs(tdb, tenantID, "", unitID, ""); status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+
+	encrypted, hash, err := encryptIdentityNumber(tenantID, req.KKNumber)
+	if err != nil {
+		return piiErrorResponse(c, err)
+	}
+	var exists bool
+	err = tdb.Get(&exists, `
+		SELECT EXISTS(SELECT 1 FROM households WHERE tenant_id = $1 AND kk_number_hash = $2 AND deleted_at IS NULL)
+	`, tenantID, hash)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if exists {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "KK number is already registered"})
+	}
+
+	householdID := uuid.New().String()
+	_, err = tdb.Exec(`
+		INSERT INTO households (id, tenant_id, unit_id, kk_number_encrypted, kk_number_hash, address, notes, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, householdID, tenantID, req.UnitID, encrypted, hash, req.Address, req.Notes, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create household"})
+	}
+
+	household, err := getHousehold(tdb, tenantID, householdID)
+	if err != nil {
+		return piiErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusCreated, household)
+}
+
+// UpdateHousehold changes a family card's number, unit, address or notes
+func UpdateHousehold(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
+	householdID := c.Param("household_id")
+
+	req := new(models.UpdateHouseholdRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	unitID := ""
+	if req.UnitID != nil {
+		unitID = *req.UnitID
+	}
+	if status, message := checkResidentRefs(tdb, tenantID, householdID, unitID, ""); status != 0 {
+		if message == "Household not found" {
+			status = http.StatusNotFound
+		}
+		return c.JSON(status, map[string]string{"error": message})
+	}
+
+	updates := []string{}
+	args := []interface{}{}
+	set := func(column string, value interface{}) {
+		args = append(args, value)
+		updates = append(updates, column+" = $"+strconv.Itoa(len(args)))
+	}
+
+	if req.KKNumber != nil {
+		number := strings.TrimSpace(*req.KKNumber)
+		if !identityNumberPattern.MatchString(number) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "kk_number must be 16 digits"})
+		}
+		encrypted, hash, err := encryptIdentityNumber(tenantID, number)
+		if err != nil {
+			return piiErrorResponse(c, err)
+		}
+		var exists bool
+		err = tdb.Get(&exists, `
+			SELECT EXISTS(SELECT 1 FROM households
+			WHERE tenant_id = $1 AND kk_number_hash = $2 AND id != $3 AND deleted_at IS NULL)
+		`, tenantID, hash, householdID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		if exists {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "KK number is already registered"})
+		}
+		set("kk_number_encrypted", encrypted)
+		set("kk_number_hash", hash)
+	}
+	if req.UnitID != nil {
+		if unitID == "" {
+			set("unit_id", nil)
+		} else {
+			set("unit_id", unitID)
+		}
+	}
+	if req.Address != nil {
+		set("address", *req.Address)
+	}
+	if req.Notes != nil {
+		set("notes", *req.Notes)
+	}
+	if len(updates) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "No fields to update"})
+	}
+
+	args = append(args, householdID, tenantID)
+	_, err := tdb.Exec(`UPDATE households SET `+strings.Join(updates, ", ")+`, updated_at = NOW()
+		WHERE id = $`+strconv.Itoa(len(args)-1)+` AND tenant_id = $`+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update household"})
+	}
+
+	household, err := getHousehold(tdb, tenantID, householdID)
+	if err != nil {
+		return piiErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, household)
+}
+
+// DeleteHousehold soft deletes a family card together with its members
+func DeleteHousehold(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
+	householdID := c.Param("household_id")
+
+	if status, message := checkResidentRefs(tdb, tenantID, householdID, "", ""); status != 0 {
+		if message == "Household not found" {
+			status = http.StatusNotFound
+		}
+		return c.JSON(status, map[string]string{"error": message})
+	}
+
+	tx, err := tdb.Beginx()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		UPDATE residents SET deleted_at = NOW(), updated_at = NOW()
+		WHERE household_id = $1 AND tenant_id = $2 AND deleted_at IS NULL
+	`, householdID, tenantID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete household members"})
+	}
+	if _, err := tx.Exec(`
+		UPDATE households SET deleted_at = NOW(), updated_at = NOW() WHERE id = $1 AND tenant_id = $2
+	`, householdID, tenantID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete household"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete household"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Household deleted successfully"})
+}
+
+// ListResidents lists the data warga register with masked NIKs. search matches a full NIK or part of a name;
+// household_id, unit_id, domicile_status and linked (true/false: has a user account) filter the list.
+func ListResidents(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
+
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	offset := (page - 1) * limit
+
+	where := ` WHERE r.tenant_id = $1 AND r.deleted_at IS NULL AND h.deleted_at IS NULL`
+	args := []interface{}{tenantID}
+	filters := map[string]string{
+		"household_id":    "r.household_id",
+		"unit_id":         "h.unit_id",
+		"domicile_status": "r.domicile_status",
+		"relationship":    "r.relationship",
+	}
+	for _, param := range []string{"household_id", "unit_id", "domicile_status", "relationship"} {
+		if value := c.QueryParam(param); value != "" {
+			args = append(args, value)
+			where += ` AND ` + filters[param] + ` = $` + strconv.Itoa(len(args))
+		}
+	}
+	switch c.QueryParam("linked") {
+	case "true":
+		where += ` AND r.user_id IS NOT NULL`
+	case "false":
+		where += ` AND r.user_id IS NULL`
+	}
+	if search := strings.TrimSpace(c.QueryParam("search")); search != "" {
+		if identityNumberPattern.MatchString(search) {
+			hash, err := pii.BlindIndex(search)
+			if err != nil {
+				return piiErrorResponse(c, err)
+			}
+			args = append(args, hash)
+			where += ` AND r.nik_hash = $` + strconv.Itoa(len(args))
+		} else {
+			args = append(args, "%"+search+"%")
+			where += ` AND (r.full_name ILIKE $` + strconv.Itoa(len(args)) + ` OR u.code ILIKE $` + strconv.Itoa(len(args)) + `)`
+		}
+	}
+
+	var total int
+	err := tdb.Get(&total, `SELECT COUNT(*) FROM residents r
+		INNER JOIN households h ON h.id = r.household_id
+		LEFT JOIN units u ON u.id = h.unit_id AND u.deleted_at IS NULL`+where, args...)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to count residents"})
+	}
+
+	residents := []models.Resident{}
+	query := `SELECT ` + residentColumns + where +
+		` ORDER BY r.full_name ASC LIMIT $` + strconv.Itoa(len(args)+1) + ` OFFSET $` + strconv.Itoa(len(args)+2)
+	if err := tdb.Select(&residents, query, append(args, limit, offset)...); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch residents"})
+	}
+	for i := range residents {
+		if err := decryptResident(&residents[i], false); err != nil {
+			return piiErrorResponse(c, err)
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"residents": residents,
+		"pagination": map[string]interface{}{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": (total + limit - 1) / limit,
+		},
+	})
+}
+
+// getResident loads a resident with the NIK in full
+func getResident(tdb *db.TenantDB, tenantID, residentID string) (models.Resident, error) {
+	var resident models.Resident
+	err := tdb.Get(&resident, `SELECT `+residentColumns+`
+		WHERE r.id = $1 AND r.tenant_id = $2 AND r.deleted_at IS NULL
+	`, residentID, tenantID)
+	if err != nil {
+		return resident, err
+	}
+	return resident, decryptResident(&resident, true)
+}
+
+// GetResident returns one resident with the full NIK
+func GetResident(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
+
+	if _, err := uuid.Parse(c.Param("resident_id")); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Resident not found"})
+	}
+	resident, err := getResident(tdb, tenantID, c.Param("resident_id"))
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Resident not found"})
+	} else if err != nil {
+		return piiErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, resident)
+}
+
+// residentNIKTaken reports whether another resident of the tenant has the NIK (by blind index)
+func residentNIKTaken(tdb *db.TenantDB, tenantID, hash, exceptID string) (bool, error) {
+	var taken bool
+	err := tdb.Get(&taken, `
+		SELECT EXISTS(SELECT 1 FROM residents
+		WHERE tenant_id = $1 AND nik_hash = $2 AND id::text != $3 AND deleted_at IS NULL)
+	`, tenantID, hash, exceptID)
+	return taken, err
+}
+
+// residentUserTaken reports whether another resident of the tenant is linked to the user
+func residentUserTaken(tdb *db.TenantDB, tenantID, userID, exceptID string) (bool, error) {
+	var taken bool
+	err := tdb.Get(&taken, `
+		SELECT EXISTS(SELECT 1 FROM residents
+		WHERE tenant_id = $1 AND user_id = $2 AND id::text != $3 AND deleted_at IS NULL)
+	`, tenantID, userID, exceptID)
+	return taken, err
+}
+
+// CreateResident adds a person to a family card, optionally linked to their user account
+func CreateResident(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
+	createdBy := c.Get(string(middleware.CtxUserID)).(string)
+
+	req := new(models.CreateResidentRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	req.FullName = strings.TrimSpace(req.FullName)
+	req.NIK = strings.TrimSpace(req.NIK)
+	if req.FullName == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Full name is required"})
+	}
+	if !identityNumberPattern.MatchString(req.NIK) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "nik must be 16 digits"})
+	}
+	if req.Gender != "L" && req.Gender != "P" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "gender must be L or P"})
+	}
+	if !validDate(req.BirthDate) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "birth_date must be a past date (YYYY-MM-DD)"})
+	}
+	if req.MovedInAt != nil && *req.MovedInAt != "" && !validDate(*req.MovedInAt) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "moved_in_at must be a past date (YYYY-MM-DD)"})
+	}
+	if _, ok := residentRelationships[req.Relationship]; !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid relationship"})
+	}
+	if req.DomicileStatus == "" {
+		req.DomicileStatus = "tetap"
+	}
+	if req.DomicileStatus != "tetap" && req.DomicileStatus != "kontrak" && req.DomicileStatus != "kos" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "domicile_status must be tetap, kontrak or kos"})
+	}
+	if req.UserID != nil && *req.UserID == "" {
+		req.UserID = nil
+	}
+	if req.MovedInAt != nil && *req.MovedInAt == "" {
+		req.MovedInAt = nil
+	}
+	userID := ""
+	if req.UserID != nil {
+		userID = *req.UserID
+	}
+	if req.HouseholdID == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "household_id is required"})
+	}
+	if status, message := checkResidentRefs(tdb, tenantID, req.HouseholdID, "", userID); status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+
+	encrypted, hash, err := encryptIdentityNumber(tenantID, req.NIK)
+	if err != nil {
+		return piiErrorResponse(c, err)
+	}
+	if taken, err := residentNIKTaken(tdb, tenantID, hash, ""); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	} else if taken {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "NIK is already registered"})
+	}
+	if userID != "" {
+		if taken, err := residentUserTaken(tdb, tenantID, userID, ""); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		} else if taken {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "User is already linked to another resident"})
+		}
+	}
+
+	residentID := uuid.New().String()
+	_, err = tdb.Exec(`
+		INSERT INTO residents (id, tenant_id, household_id, user_id, full_name, nik_encrypted, nik_hash, gender,
+		                       birth_place, birth_date, relationship, religion, marital_status, occupation,
+		                       domicile_status, phone, moved_in_at, notes, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
+	`, residentID, tenantID, req.HouseholdID, req.UserID, req.FullName, encrypted, hash, req.Gender,
+		req.BirthPlace, req.BirthDate, req.Relationship, req.Religion, req.MaritalStatus, req.Occupation,
+		req.DomicileStatus, req.Phone, req.MovedInAt, req.Notes, createdBy)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create resident"})
+	}
+
+	resident, err := getResident(tdb, tenantID, residentID)
+	if err != nil {
+		return piiErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusCreated, resident)
+}
+
+// UpdateResident changes a resident's data; household_id moves them to another family card
+func UpdateResident(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
+	residentID := c.Param("resident_id")
+
+	req := new(models.UpdateResidentRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	if _, err := uuid.Parse(residentID); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Resident not found"})
+	}
+	var exists bool
+	err := tdb.Get(&exists, `
+		SELECT EXISTS(SELECT 1 FROM residents WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL)
+	`, residentID, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if !exists {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Resident not found"})
+	}
+
+	householdID, userID := "", ""
+	if req.HouseholdID != nil {
+		if *req.HouseholdID == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "household_id cannot be empty"})
+		}
+		householdID = *req.HouseholdID
+	}
+	if req.UserID != nil {
+		userID = *req.UserID
+	}
+	if status, message := checkResidentRefs(tdb, tenantID, householdID, "", userID); status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+
+	updates := []string{}
+	args := []interface{}{}
+	set := func(column string, value interface{}) {
+		args = append(args, value)
+		updates = append(updates, column+" = $"+strconv.Itoa(len(args)))
+	}
+
+	if req.HouseholdID != nil {
+		set("household_id", householdID)
+	}
+	if req.UserID != nil {
+		if userID == "" {
+			set("user_id", nil)
+		} else {
+			if taken, err := residentUserTaken(tdb, tenantID, userID, residentID); err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+			} else if taken {
+				return c.JSON(http.StatusConflict, map[string]string{"error": "User is already linked to another resident"})
+			}
+			set("user_id", userID)
+		}
+	}
+	if req.FullName != nil {
+		name := strings.TrimSpace(*req.FullName)
+		if name == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Full name is required"})
+		}
+		set("full_name", name)
+	}
+	if req.NIK != nil {
+		nik := strings.TrimSpace(*req.NIK)
+		if !identityNumberPattern.MatchString(nik) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "nik must be 16 digits"})
+		}
+		encrypted, hash, err := encryptIdentityNumber(tenantID, nik)
+		if err != nil {
+			return piiErrorResponse(c, err)
+		}
+		if taken, err := residentNIKTaken(tdb, tenantID, hash, residentID); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		} else if taken {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "NIK is already registered"})
+		}
+		set("nik_encrypted", encrypted)
+		set("nik_hash", hash)
+	}
+	if req.Gender != nil {
+		if *req.Gender != "L" && *req.Gender != "P" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "gender must be L or P"})
+		}
+		set("gender", *req.Gender)
+	}
+	if req.BirthPlace != nil {
+		set("birth_place", *req.BirthPlace)
+	}
+	if req.BirthDate != nil {
+		if !validDate(*req.BirthDate) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "birth_date must be a past date (YYYY-MM-DD)"})
+		}
+		set("birth_date", *req.BirthDate)
+	}
+	if req.Relationship != nil {
+		if _, ok := residentRelationships[*req.Relationship]; !ok {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid relationship"})
+		}
+		set("relationship", *req.Relationship)
+	}
+	if req.Religion != nil {
+		set("religion", *req.Religion)
+	}
+	if req.MaritalStatus != nil {
+		set("marital_status", *req.MaritalStatus)
+	}
+	if req.Occupation != nil {
+		set("occupation", *req.Occupation)
+	}
+	if req.DomicileStatus != nil {
+		if *req.DomicileStatus != "tetap" && *req.DomicileStatus != "kontrak" && *req.DomicileStatus != "kos" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "domicile_status must be tetap, kontrak or kos"})
+		}
+		set("domicile_status", *req.DomicileStatus)
+	}
+	if req.Phone != nil {
+		set("phone", *req.Phone)
+	}
+	if req.MovedInAt != nil {
+		if *req.MovedInAt == "" {
+			set("moved_in_at", nil)
+		} else if !validDate(*req.MovedInAt) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "moved_in_at must be a past date (YYYY-MM-DD)"})
+		} else {
+			set("moved_in_at", *req.MovedInAt)
+		}
+	}
+	if req.Notes != nil {
+		set("notes", *req.Notes)
+	}
+	if len(updates) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "No fields to update"})
+	}
+
+	args = append(args, residentID, tenantID)
+	_, err = tdb.Exec(`UPDATE residents SET `+strings.Join(updates, ", ")+`, updated_at = NOW()
+		WHERE id = $`+strconv.Itoa(len(args)-1)+` AND tenant_id = $`+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update resident"})
+	}
+
+	resident, err := getResident(tdb, tenantID, residentID)
+	if err != nil {
+		return piiErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, resident)
+}
+
+// DeleteResident soft deletes a resident, e.g. after they moved out
+func DeleteResident(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
+
+	if _, err := uuid.Parse(c.Param("resident_id")); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Resident not found"})
+	}
+	result, err := tdb.Exec(`
+		UPDATE residents SET deleted_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
+	`, c.Param("resident_id"), tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete resident"})
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Resident not found"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Resident deleted successfully"})
+}
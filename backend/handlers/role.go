@@ -15,6 +15,7 @@ import (
 // CreateRole creates a new custom role
 func CreateRole(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 
 	req := new(models.CreateRoleRequest)
 	if err := c.Bind(req); err != nil {
@@ -28,7 +29,7 @@ func CreateRole(c echo.Context) error {
 
 	// Check if role name already exists in tenant
 	var exists bool
-	err := db.DB.Get(&exists, `
+	err := tdb.Get(&exists, `
 		SELECT EXISTS(
 			SELECT 1 FROM roles 
 			WHERE tenant_id = $1 AND name = $2 AND deleted_at IS NULL
@@ -42,7 +43,7 @@ func CreateRole(c echo.Context) error {
 	}
 
 	// Start transaction
-	tx, err := db.DB.Beginx()
+	tx, err := tdb.Beginx()
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
 	}
@@ -132,9 +133,10 @@ func CreateRole(c echo.Context) error {
 // ListRoles lists all roles for a tenant
 func ListRoles(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 
 	var roles []models.Role
-	err := db.DB.Select(&roles, `
+	err := tdb.Select(&roles, `
 		SELECT id, tenant_id, name, description, is_system, created_at, updated_at
 		FROM roles
 		WHERE tenant_id = $1 AND deleted_at IS NULL
@@ -147,7 +149,7 @@ func ListRoles(c echo.Context) error {
 	// Get permissions for each role
 	rolesWithPerms := make([]map[string]interface{}, len(roles))
 	for i, role := range roles {
-		permissions, _ := getRolePermissionKeys(role.ID)
+		permissions, _ := getRolePermissionKeys(tenantID, role.ID)
 		roleData := map[string]interface{}{
 			"id":          role.ID,
 			"name":        role.Name,
@@ -186,6 +188,7 @@ func GetRole(c echo.Context) error {
 // UpdateRole updates a role and its permissions
 func UpdateRole(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	roleID := c.Param("role_id")
 
 	req := new(models.UpdateRoleRequest)
@@ -195,7 +198,7 @@ func UpdateRole(c echo.Context) error {
 
 	// Check if role exists and belongs to tenant
 	var role models.Role
-	err := db.DB.Get(&role, `
+	err := tdb.Get(&role, `
 		SELECT id, tenant_id, name, description, is_system
 		FROM roles
 		WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
@@ -212,7 +215,7 @@ func UpdateRole(c echo.Context) error {
 	}
 
 	// Start transaction
-	tx, err := db.DB.Beginx()
+	tx, err := tdb.Beginx()
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
 	}
@@ -341,11 +344,12 @@ func UpdateRole(c echo.Context) error {
 // DeleteRole soft deletes a role
 func DeleteRole(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	roleID := c.Param("role_id")
 
 	// Check if role exists and is not system role
 	var role models.Role
-	err := db.DB.Get(&role, `
+	err := tdb.Get(&role, `
 		SELECT id, tenant_id, is_system
 		FROM roles
 		WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
@@ -363,7 +367,7 @@ func DeleteRole(c echo.Context) error {
 
 	// Check if role is assigned to any users
 	var assignedCount int
-	err = db.DB.Get(&assignedCount, `
+	err = tdb.Get(&assignedCount, `
 		SELECT COUNT(*) FROM tenant_users 
 		WHERE role_id = $1 AND tenant_id = $2 AND deleted_at IS NULL
 	`, roleID, tenantID)
@@ -375,7 +379,7 @@ func DeleteRole(c echo.Context) error {
 	}
 
 	// Soft delete
-	_, err = db.DB.Exec(`
+	_, err = tdb.Exec(`
 		UPDATE roles 
 		SET deleted_at = NOW(), updated_at = NOW()
 		WHERE id = $1 AND tenant_id = $2
@@ -389,8 +393,9 @@ func DeleteRole(c echo.Context) error {
 
 // ListPermissions lists all available permissions
 func ListPermissions(c echo.Context) error {
+	tdb := middleware.TenantDB(c)
 	var permissions []models.Permission
-	err := db.DB.Select(&permissions, `
+	err := tdb.Select(&permissions, `
 		SELECT id, key, name, description, module, created_at
 		FROM permissions
 		ORDER BY module, key
@@ -407,6 +412,7 @@ func ListPermissions(c echo.Context) error {
 // AssignRoleToUser assigns a role to a user
 func AssignRoleToUser(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Param("user_id")
 
 	var req struct {
@@ -418,7 +424,7 @@ func AssignRoleToUser(c echo.Context) error {
 
 	// Verify user exists and is member of tenant
 	var userExists bool
-	err := db.DB.Get(&userExists, `
+	err := tdb.Get(&userExists, `
 		SELECT EXISTS(
 			SELECT 1 FROM tenant_users 
 			WHERE user_id = $1 AND tenant_id = $2 AND deleted_at IS NULL
@@ -433,7 +439,7 @@ func AssignRoleToUser(c echo.Context) error {
 
 	// Verify role exists and belongs to tenant
 	var roleExists bool
-	err = db.DB.Get(&roleExists, `
+	err = tdb.Get(&roleExists, `
 		SELECT EXISTS(
 			SELECT 1 FROM roles 
 			WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
@@ -447,15 +453,22 @@ func AssignRoleToUser(c echo.Context) error {
 	}
 
 	// Update tenant_users with new role_id
-	_, err = db.DB.Exec(`
+	result, err := tdb.Exec(`
 		UPDATE tenant_users 
 		SET role_id = $1, updated_at = NOW()
-		WHERE user_id = $2 AND tenant_id = $3
+		WHERE user_id = $2 AND tenant_id = $3 AND role_id IS DISTINCT FROM $1
 	`, req.RoleID, userID, tenantID)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to assign role to user"})
 	}
 
+	// A changed role ends the user's sessions in this tenant
+	if n, _ := result.RowsAffected(); n > 0 {
+		if err := middleware.RevokeUserSessions(tdb, userID, tenantID, middleware.RevokeRoleChanged); err != nil {
+			c.Logger().Warnf("Failed to revoke sessions for user %s: %v", userID, err)
+		}
+	}
+
 	return c.JSON(http.StatusOK, map[string]string{"message": "Role assigned to user successfully"})
 }
 
@@ -463,7 +476,7 @@ func AssignRoleToUser(c echo.Context) error {
 
 func getRoleWithPermissions(roleID, tenantID string) (map[string]interface{}, error) {
 	var role models.Role
-	err := db.DB.Get(&role, `
+	err := db.ForTenant(tenantID).Get(&role, `
 		SELECT id, tenant_id, name, description, is_system, created_at, updated_at
 		FROM roles
 		WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
@@ -472,7 +485,7 @@ func getRoleWithPermissions(roleID, tenantID string) (map[string]interface{}, er
 		return nil, err
 	}
 
-	permissions, _ := getRolePermissionKeys(roleID)
+	permissions, _ := getRolePermissionKeys(tenantID, roleID)
 
 	return map[string]interface{}{
 		"id":          role.ID,
@@ -485,9 +498,9 @@ func getRoleWithPermissions(roleID, tenantID string) (map[string]interface{}, er
 	}, nil
 }
 
-func getRolePermissionKeys(roleID string) ([]string, error) {
+func getRolePermissionKeys(tenantID, roleID string) ([]string, error) {
 	var permissions []string
-	err := db.DB.Select(&permissions, `
+	err := db.ForTenant(tenantID).Select(&permissions, `
 		SELECT p.key
 		FROM role_permissions rp
 		JOIN permissions p ON rp.permission_id = p.id
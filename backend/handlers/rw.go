@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"rukunos-backend/db"
+	"rukunos-backend/middleware"
+	"rukunos-backend/models"
+	"rukunos-backend/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+// requireRWTenant checks that a tenant is an RW; RT-level features like cascading need one
+func requireRWTenant(tenantID string) (int, string) {
+	var level sql.NullString
+	err := db.ForTenant(tenantID).Get(&level, `SELECT level FROM tenants WHERE id = $1 AND deleted_at IS NULL`, tenantID)
+	if err == sql.ErrNoRows {
+		return http.StatusNotFound, "Tenant not found"
+	} else if err != nil {
+		return http.StatusInternalServerError, "Database error"
+	}
+	if level.String != models.TenantLevelRW {
+		return http.StatusBadRequest, "Only an RW can share with its RTs"
+	}
+	return 0, ""
+}
+
+// rwTenantID is the RW of the token, also when the request is scoped to one of its RTs
+func rwTenantID(c echo.Context) string {
+	if parentID, ok := c.Get(string(middleware.CtxParentTenantID)).(string); ok && parentID != "" {
+		return parentID
+	}
+	return c.Get(string(middleware.CtxTenantID)).(string)
+}
+
+// ListRWTenants lists the RTs of the current RW
+func ListRWTenants(c echo.Context) error {
+	tenantID := rwTenantID(c)
+
+	tenants := []models.ChildTenant{}
+	err := db.DB.Select(&tenants, `
+		SELECT t.id, t.name, t.code, COALESCE(t.status, 'active') AS status,
+		       (SELECT COUNT(*) FROM tenant_users tu
+		        WHERE tu.tenant_id = t.id AND tu.status = 'active' AND tu.deleted_at IS NULL) AS member_count,
+		       (SELECT COUNT(*) FROM units u WHERE u.tenant_id = t.id AND u.deleted_at IS NULL) AS unit_count
+		FROM tenants t
+		WHERE t.parent_tenant_id = $1 AND t.deleted_at IS NULL
+		ORDER BY t.name
+	`, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch RTs"})
+	}
+
+	return c.JSON(http.StatusOK, tenants)
+}
+
+// GetRWSummary rolls up billing, complaints and panic alerts of the RW and each of its RTs
+func GetRWSummary(c echo.Context) error {
+	tenantID := rwTenantID(c)
+
+	// "This month" is each tenant's own calendar month
+	rows := []models.RWTenantSummary{}
+	err := db.DB.Select(&rows, `
+		SELECT t.id AS tenant_id, t.name AS tenant_name, COALESCE(t.level, 'rt') AS level,
+			COALESCE(b.pending_count, 0) AS pending_count,
+			COALESCE(b.overdue_count, 0) AS overdue_count,
+			COALESCE(b.outstanding_amount, 0) AS outstanding_amount,
+			COALESCE(b.collected_this_month, 0) AS collected_this_month,
+			COALESCE(cp.open_complaints, 0) AS open_complaints,
+			COALESCE(cp.complaints_30_days, 0) AS complaints_30_days,
+			COALESCE(pa.active_panic_alerts, 0) AS active_panic_alerts,
+			COALESCE(pa.panic_alerts_30_days, 0) AS panic_alerts_30_days
+		FROM tenants t
+		LEFT JOIN (
+			SELECT bl.tenant_id,
+				COUNT(*) FILTER (WHERE bl.status = 'pending') AS pending_count,
+				COUNT(*) FILTER (WHERE bl.status = 'overdue') AS overdue_count,
+				SUM(bl.amount + COALESCE(bl.late_fee, 0)) FILTER (WHERE bl.status IN ('pending', 'overdue')) AS outstanding_amount,
+				SUM(bl.amount + COALESCE(bl.late_fee, 0)) FILTER (WHERE bl.status = 'paid'
+					AND bl.paid_at::timestamptz >= date_trunc('month', NOW() AT TIME ZONE ` + services.TenantTimezoneSQL + `) AT TIME ZONE ` + services.TenantTimezoneSQL + `
+				) AS collected_this_month
+			FROM bills bl
+			INNER JOIN tenants t ON t.id = bl.tenant_id
+			WHERE bl.deleted_at IS NULL
+			GROUP BY bl.tenant_id
+		) b ON b.tenant_id = t.id
+		LEFT JOIN (
+			SELECT tenant_id,
+				COUNT(*) FILTER (WHERE status IN ('pending', 'in_progress')) AS open_complaints,
+				COUNT(*) FILTER (WHERE created_at > NOW() - INTERVAL '30 days') AS complaints_30_days
+			FROM complaints WHERE deleted_at IS NULL
+			GROUP BY tenant_id
+		) cp ON cp.tenant_id = t.id
+		LEFT JOIN (
+			SELECT tenant_id,
+				COUNT(*) FILTER (WHERE status = 'active') AS active_panic_alerts,
+				COUNT(*) FILTER (WHERE created_at > NOW() - INTERVAL '30 days') AS panic_alerts_30_days
+			FROM panic_alerts WHERE deleted_at IS NULL
+			GROUP BY tenant_id
+		) pa ON pa.tenant_id = t.id
+		WHERE (t.id = $1 OR t.parent_tenant_id = $1) AND t.deleted_at IS NULL
+		ORDER BY t.id = $1 DESC, t.name
+	`, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to build RW summary"})
+	}
+
+	var totals models.RWTenantSummary
+	totals.TenantName = "Total"
+	for _, row := range rows {
+		totals.PendingCount += row.PendingCount
+		totals.OverdueCount += row.OverdueCount
+		totals.OutstandingAmount += row.OutstandingAmount
+		totals.CollectedThisMonth += row.CollectedThisMonth
+		totals.OpenComplaints += row.OpenComplaints
+		totals.Complaints30Days += row.Complaints30Days
+		totals.ActivePanicAlerts += row.ActivePanicAlerts
+		totals.PanicAlerts30Days += row.PanicAlerts30Days
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"tenants": rows,
+		"totals":  totals,
+	})
+}
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+	"time"
+	"rukunos-backend/db"
+	"rukunos-backend/middleware"
+	"rukunos-backend/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// sessionTokens is the token pair returned by login, register, OAuth callback and refresh
+type sessionTokens struct {
+	SessionID    string
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64 // Access token lifetime in seconds
+}
+
+// jwtSecret returns the HS256 signing key
+func jwtSecret() []byte {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		secret = "secret" // Default for development only
+	}
+	return []byte(secret)
+}
+
+// durationFromEnv parses a Go duration (e.g. "15m", "720h") from env, falling back to def
+func durationFromEnv(key string, def time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return def
+}
+
+func accessTokenTTL() time.Duration {
+	return durationFromEnv("ACCESS_TOKEN_TTL", 15*time.Minute)
+}
+
+func refreshTokenTTL() time.Duration {
+	return durationFromEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+}
+
+// signAccessToken creates a short-lived JWT bound to a session
+func signAccessToken(userID, tenantID, sessionID string) (string, error) {
+	token := jwt.New(jwt.SigningMethodHS256)
+	claims := token.Claims.(jwt.MapClaims)
+	claims["user_id"] = userID
+	claims["tenant_id"] = tenantID
+	claims["sid"] = sessionID
+	claims["exp"] = time.Now().Add(accessTokenTTL()).Unix()
+	return token.SignedString(jwtSecret())
+}
+
+// issueSession creates a server-side session for the user in a tenant and returns its access/refresh token pair
+func issueSession(c echo.Context, userID, tenantID string) (*sessionTokens, error) {
+	refreshToken, refreshHash, err := newSecureToken()
+	if err != nil {
+		return nil, err
+	}
+
+	var sessionID string
+	err = db.DB.QueryRow(`
+		INSERT INTO user_sessions (user_id, tenant_id, refresh_token_hash, user_agent, ip_address, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, userID, tenantID, refreshHash, c.Request().UserAgent(), c.RealIP(), time.Now().Add(refreshTokenTTL())).Scan(&sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := signAccessToken(userID, tenantID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sessionTokens{
+		SessionID:    sessionID,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(accessTokenTTL().Seconds()),
+	}, nil
+}
+
+// RefreshToken exchanges a refresh token for a new access token and rotates the refresh token
+func RefreshToken(c echo.Context) error {
+	req := new(models.RefreshTokenRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	if req.RefreshToken == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "refresh_token is required"})
+	}
+	tokenHash := hashToken(req.RefreshToken)
+
+	tx, err := db.DB.Beginx()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
+	}
+	defer tx.Rollback()
+
+	var session struct {
+		ID        string       `db:"id"`
+		UserID    string       `db:"user_id"`
+		TenantID  string       `db:"tenant_id"`
+		ExpiresAt time.Time    `db:"expires_at"`
+		RevokedAt sql.NullTime `db:"revoked_at"`
+	}
+	err = tx.Get(&session, `
+		SELECT id, user_id, tenant_id, expires_at, revoked_at
+		FROM user_sessions
+		WHERE refresh_token_hash = $1
+		FOR UPDATE
+	`, tokenHash)
+	if err == sql.ErrNoRows {
+		// A rotated-out token being presented again means it was copied: kill the session
+		result, _ := db.DB.Exec(`
+			UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = $1
+			WHERE previous_token_hash = $2 AND revoked_at IS NULL
+		`, middleware.RevokeTokenReuse, tokenHash)
+		if result != nil {
+			if n, _ := result.RowsAffected(); n > 0 {
+				c.Logger().Warnf("Refresh token reuse detected, session revoked")
+			}
+		}
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid refresh token"})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	if session.RevokedAt.Valid {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Session has been revoked, please log in again"})
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Session expired, please log in again"})
+	}
+
+	// The user must still be an active member of an active tenant
+	var allowed bool
+	err = tx.Get(&allowed, `
+		SELECT EXISTS(
+			SELECT 1 FROM tenant_users tu
+			INNER JOIN users u ON u.id = tu.user_id
+			INNER JOIN tenants t ON t.id = tu.tenant_id
+			WHERE tu.user_id = $1 AND tu.tenant_id = $2
+			AND tu.status = 'active' AND tu.deleted_at IS NULL
+			AND u.status = 'active' AND u.deleted_at IS NULL
+			AND t.status = 'active' AND t.deleted_at IS NULL
+		)
+	`, session.UserID, session.TenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if !allowed {
+		middleware.RevokeUserSessions(tx, session.UserID, session.TenantID, middleware.RevokeDeactivated)
+		tx.Commit()
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Account or tenant is no longer active"})
+	}
+
+	newRefreshToken, newRefreshHash, err := newSecureToken()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate token"})
+	}
+	_, err = tx.Exec(`
+		UPDATE user_sessions
+		SET refresh_token_hash = $1, previous_token_hash = refresh_token_hash, last_used_at = NOW(),
+		    user_agent = $2, ip_address = $3
+		WHERE id = $4
+	`, newRefreshHash, c.Request().UserAgent(), c.RealIP(), session.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to rotate refresh token"})
+	}
+
+	accessToken, err := signAccessToken(session.UserID, session.TenantID, session.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate token"})
+	}
+
+	if err = tx.Commit(); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit transaction"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"token":         accessToken,
+		"refresh_token": newRefreshToken,
+		"expires_in":    int64(accessTokenTTL().Seconds()),
+		"tenant_id":     session.TenantID,
+	})
+}
+
+// Logout revokes the session of the current access token
+func Logout(c echo.Context) error {
+	sessionID := c.Get(string(middleware.CtxSessionID)).(string)
+
+	_, err := middleware.TenantDB(c).Exec(`
+		UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = $1
+		WHERE id = $2 AND revoked_at IS NULL
+	`, middleware.RevokeLogout, sessionID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to log out"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Logged out successfully"})
+}
+
+// LogoutAll revokes all sessions of the current user on every device and tenant
+func LogoutAll(c echo.Context) error {
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+	sessionID := c.Get(string(middleware.CtxSessionID)).(string)
+
+	req := new(models.LogoutAllRequest)
+	c.Bind(req)
+
+	query := `UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = $1 WHERE user_id = $2 AND revoked_at IS NULL`
+	args := []interface{}{middleware.RevokeLogoutAll, userID}
+	if req.KeepCurrent {
+		query += ` AND id <> $3`
+		args = append(args, sessionID)
+	}
+
+	result, err := db.DB.Exec(query, args...)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to log out sessions"})
+	}
+	revoked, _ := result.RowsAffected()
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":       "Logged out from all devices",
+		"revoked_count": revoked,
+	})
+}
+
+// ListMySessions lists the active sessions (devices) of the current user
+func ListMySessions(c echo.Context) error {
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+	sessionID := c.Get(string(middleware.CtxSessionID)).(string)
+
+	sessions := []models.UserSession{}
+	err := db.DB.Select(&sessions, `
+		SELECT s.id, s.user_id, s.tenant_id, t.name as tenant_name, s.user_agent, s.ip_address,
+		       s.created_at, s.last_used_at, s.expires_at, s.revoked_at, s.revoked_reason
+		FROM user_sessions s
+		INNER JOIN tenants t ON t.id = s.tenant_id
+		WHERE s.user_id = $1 AND s.revoked_at IS NULL AND s.expires_at > NOW()
+		ORDER BY s.last_used_at DESC
+	`, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch sessions: " + err.Error()})
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == sessionID
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"sessions": sessions,
+	})
+}
+
+// RevokeMySession logs out one of the current user's sessions (e.g. a lost phone)
+func RevokeMySession(c echo.Context) error {
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+
+	result, err := db.DB.Exec(`
+		UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = $1
+		WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL
+	`, middleware.RevokeLogout, c.Param("session_id"), userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to revoke session"})
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Session not found"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Session revoked successfully"})
+}
@@ -28,11 +28,11 @@ func CreateTenant(c echo.Context) error {
 	var tenant models.Tenant
 	query := `INSERT INTO tenants (name, code, address, phone, email, status)
 	          VALUES ($1, $2, $3, $4, $5, 'active')
-	          RETURNING id, name, code, address, phone, email, settings, modules, status, created_at, updated_at`
+	          RETURNING id, name, code, address, phone, email, settings, modules, status, plan, COALESCE(level, 'rt'), created_at, updated_at`
 	
 	err = tx.QueryRow(query, req.Name, req.Code, req.Address, req.Phone, req.Email).Scan(
 		&tenant.ID, &tenant.Name, &tenant.Code, &tenant.Address, &tenant.Phone, 
-		&tenant.Email, &tenant.Settings, &tenant.Modules, &tenant.Status, 
+		&tenant.Email, &tenant.Settings, &tenant.Modules, &tenant.Status, &tenant.Plan, &tenant.Level,
 		&tenant.CreatedAt, &tenant.UpdatedAt)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{
@@ -48,6 +48,14 @@ func CreateTenant(c echo.Context) error {
 		})
 	}
 
+	// Create default billing reminder rules for tenant
+	_, err = tx.Exec(`SELECT create_default_reminder_rules_for_tenant($1)`, tenant.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to create default reminder rules: " + err.Error(),
+		})
+	}
+
 	// Commit transaction
 	if err = tx.Commit(); err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{
@@ -58,45 +66,18 @@ func CreateTenant(c echo.Context) error {
 	return c.JSON(http.StatusCreated, tenant)
 }
 
-// GetTenant gets tenant information
-// If tenant_id is provided in URL param, use it (for admin viewing other tenants)
-// Otherwise, use tenant_id from context (for current user's tenant)
+// GetTenant gets the current user's tenant information
 func GetTenant(c echo.Context) error {
-	var tenantID string
-	var ok bool
-	
-	// Try to get tenant_id from URL parameter first
-	tenantIDParam := c.Param("tenant_id")
-	if tenantIDParam != "" {
-		// Verify that the requested tenant_id matches the context tenant_id
-		// (for security, users can only view their own tenant)
-		contextTenantIDInterface := c.Get("tenant_id")
-		if contextTenantIDInterface != nil {
-			contextTenantID, ok := contextTenantIDInterface.(string)
-			if ok && contextTenantID == tenantIDParam {
-				tenantID = tenantIDParam
-			} else {
-				// If param doesn't match context, use context tenant_id
-				tenantID = contextTenantID
-			}
-		} else {
-			tenantID = tenantIDParam
-		}
-	} else {
-		// Get tenant_id from context
-		tenantIDInterface := c.Get("tenant_id")
-		if tenantIDInterface == nil {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Tenant ID not found in context"})
-		}
-		tenantID, ok = tenantIDInterface.(string)
-		if !ok || tenantID == "" {
-			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid tenant ID in context"})
-		}
+	// Users can only view their own tenant; a different tenant_id in the URL falls back to it
+	tenantID, ok := c.Get(string(middleware.CtxTenantID)).(string)
+	if !ok || tenantID == "" {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Tenant ID not found in context"})
 	}
 
 	var tenant models.Tenant
-	err := db.DB.Get(&tenant, `
-		SELECT id, name, code, address, phone, email, settings, modules, status, created_at, updated_at
+	err := middleware.TenantDB(c).Get(&tenant, `
+		SELECT id, name, code, address, phone, email, settings, modules, status, plan,
+		       COALESCE(level, 'rt') AS level, parent_tenant_id, created_at, updated_at
 		FROM tenants
 		WHERE id = $1 AND deleted_at IS NULL
 	`, tenantID)
@@ -140,19 +121,23 @@ func GetCurrentUser(c echo.Context) error {
 	}
 
 	var userIDFromDB, email, fullName, status string
-	var phone, avatarURL, roleID, unitID sql.NullString
-	var createdAt, updatedAt sql.NullTime
-	
-	err := db.DB.QueryRow(`
+	var phone, avatarURL, roleID, unitID, authProvider sql.NullString
+	var createdAt, updatedAt, emailVerifiedAt sql.NullTime
+	var googleLinked bool
+	tdb := middleware.TenantDB(c)
+
+	err := tdb.QueryRow(`
 		SELECT u.id, u.email, u.full_name, u.phone, u.avatar_url, u.status, 
-		       u.created_at, u.updated_at, tu.role_id, tu.unit_id
+		       u.created_at, u.updated_at, u.email_verified_at, tu.role_id, tu.unit_id,
+		       u.auth_provider, u.google_id IS NOT NULL
 		FROM users u
 		JOIN tenant_users tu ON u.id = tu.user_id
 		WHERE u.id = $1 AND tu.tenant_id = $2 
 		AND u.deleted_at IS NULL AND tu.deleted_at IS NULL
 	`, userID, tenantID).Scan(
 		&userIDFromDB, &email, &fullName, &phone, &avatarURL, &status,
-		&createdAt, &updatedAt, &roleID, &unitID)
+		&createdAt, &updatedAt, &emailVerifiedAt, &roleID, &unitID,
+		&authProvider, &googleLinked)
 	
 	if err == sql.ErrNoRows {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
@@ -161,8 +146,10 @@ func GetCurrentUser(c echo.Context) error {
 	}
 
 	// Get tenant info
-	var tenantName, tenantCode string
-	err = db.DB.QueryRow(`SELECT name, code FROM tenants WHERE id = $1`, tenantID).Scan(&tenantName, &tenantCode)
+	var tenantName, tenantCode, tenantLevel string
+	var parentTenantID sql.NullString
+	err = tdb.QueryRow(`SELECT name, code, COALESCE(level, 'rt'), parent_tenant_id FROM tenants WHERE id = $1`, tenantID).Scan(
+		&tenantName, &tenantCode, &tenantLevel, &parentTenantID)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get tenant info: " + err.Error()})
 	}
@@ -173,7 +160,7 @@ func GetCurrentUser(c echo.Context) error {
 	// Get role info
 	var roleName string
 	if roleID.Valid {
-		err = db.DB.QueryRow(`SELECT name FROM roles WHERE id = $1`, roleID.String).Scan(&roleName)
+		err = tdb.QueryRow(`SELECT name FROM roles WHERE id = $1`, roleID.String).Scan(&roleName)
 		if err != nil {
 			// Log error but don't fail request
 			roleName = ""
@@ -188,10 +175,14 @@ func GetCurrentUser(c echo.Context) error {
 		"tenant_id":   tenantID,
 		"tenant_name": tenantName,
 		"tenant_code": tenantCode, // Add tenant_code to response
+		"tenant_level": tenantLevel, // rt or rw; RW users can open their RTs
 		"role_id":     nil,
 		"role_name":   roleName,
 		"unit_id":     nil,
 		"permissions": permissions,
+		"email_verified": emailVerifiedAt.Valid,
+		"auth_provider":  authProvider.String,
+		"google_linked":  googleLinked,
 	}
 
 	if phone.Valid {
@@ -203,6 +194,25 @@ func GetCurrentUser(c echo.Context) error {
 	if unitID.Valid {
 		response["unit_id"] = unitID.String
 	}
+	if parentTenantID.Valid {
+		response["parent_tenant_id"] = parentTenantID.String
+	}
+
+	// The frontend hides menus of disabled modules
+	modules, err := middleware.GetTenantModules(tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get tenant modules"})
+	}
+	response["modules"] = modules
+
+	// While impersonating, the frontend shows a banner on every page
+	if middleware.IsImpersonating(c) {
+		impersonation, err := getImpersonationInfo(tdb, c.Get(string(middleware.CtxImpersonationID)).(string))
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get impersonation info"})
+		}
+		response["impersonation"] = impersonation
+	}
 
 	return c.JSON(http.StatusOK, response)
 }
@@ -210,7 +220,7 @@ func GetCurrentUser(c echo.Context) error {
 // Helper function to get user permissions
 func GetUserPermissions(userID, tenantID string) ([]string, error) {
 	var permissions []string
-	err := db.DB.Select(&permissions, `
+	err := db.ForTenant(tenantID).Select(&permissions, `
 		SELECT DISTINCT p.key
 		FROM tenant_users tu
 		JOIN roles r ON tu.role_id = r.id
@@ -0,0 +1,559 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"rukunos-backend/db"
+	"rukunos-backend/middleware"
+	"rukunos-backend/models"
+	"rukunos-backend/services"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// maxTenantArchiveSize limits uploaded tenant archives to 50 MB
+const maxTenantArchiveSize = 50 << 20
+
+// sendTenantArchive builds the archive of a tenant and sends it as a download
+func sendTenantArchive(c echo.Context, tenantID string) error {
+	data, manifest, err := services.BuildTenantArchive(tenantID)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Tenant not found"})
+	} else if err != nil {
+		c.Logger().Errorf("Error building tenant archive for %s: %v", tenantID, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to export tenant"})
+	}
+
+	code := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
+			return r
+		}
+		if r >= 'A' && r <= 'Z' {
+			return r + ('a' - 'A')
+		}
+		return '-'
+	}, manifest.Source.Code)
+	filename := fmt.Sprintf("rukunos-%s-%s.zip", code, manifest.ExportedAt.Format("20060102-150405"))
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	return c.Blob(http.StatusOK, "application/zip", data)
+}
+
+// ExportTenantArchive downloads the current tenant as a portability archive
+func ExportTenantArchive(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	return sendTenantArchive(c, tenantID)
+}
+
+// ExportPlatformTenantArchive downloads the archive of any tenant from the platform console
+func ExportPlatformTenantArchive(c echo.Context) error {
+	setPlatformAudit(c, "tenant.export", nil)
+
+	tenant, status, message := getPlatformTenant(c.Param("tenant_id"))
+	if status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+	return sendTenantArchive(c, tenant.ID)
+}
+
+// tenantArchive is an uploaded archive, read into memory
+type tenantArchive struct {
+	Manifest models.TenantArchiveManifest
+	Tenant   models.TenantArchiveTenant
+	Files    map[string][]byte
+}
+
+// readTenantArchive opens an archive and checks it is one this server can import
+func readTenantArchive(data []byte) (*tenantArchive, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("file is not a ZIP archive")
+	}
+
+	archive := &tenantArchive{Files: map[string][]byte{}}
+	var total int64
+	for _, f := range reader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s", f.Name)
+		}
+		// Entries are decompressed under the same limit as the upload, so a small ZIP cannot expand without bound
+		content, err := io.ReadAll(io.LimitReader(rc, maxTenantArchiveSize-total+1))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s", f.Name)
+		}
+		total += int64(len(content))
+		if total > maxTenantArchiveSize {
+			return nil, fmt.Errorf("archive is too large when extracted (max 50 MB)")
+		}
+		archive.Files[f.Name] = content
+	}
+
+	manifest, ok := archive.Files["manifest.json"]
+	if !ok {
+		return nil, fmt.Errorf("manifest.json is missing")
+	}
+	if err := json.Unmarshal(manifest, &archive.Manifest); err != nil {
+		return nil, fmt.Errorf("manifest.json is invalid")
+	}
+	if archive.Manifest.Format != models.TenantArchiveFormat {
+		return nil, fmt.Errorf("not a RukunOS tenant archive")
+	}
+	if archive.Manifest.Version < 1 || archive.Manifest.Version > models.TenantArchiveVersion {
+		return nil, fmt.Errorf("archive version %d is not supported (this server reads up to version %d)",
+			archive.Manifest.Version, models.TenantArchiveVersion)
+	}
+
+	tenant, ok := archive.Files["tenant.json"]
+	if !ok {
+		return nil, fmt.Errorf("tenant.json is missing")
+	}
+	if err := json.Unmarshal(tenant, &archive.Tenant); err != nil {
+		return nil, fmt.Errorf("tenant.json is invalid")
+	}
+	if strings.TrimSpace(archive.Tenant.Name) == "" {
+		return nil, fmt.Errorf("tenant.json has no tenant name")
+	}
+	return archive, nil
+}
+
+// rows decodes an entity file; numbers are kept as written so amounts do not lose precision
+func (a *tenantArchive) rows(entity string) ([]map[string]interface{}, error) {
+	data, ok := a.Files[entity+".json"]
+	if !ok {
+		return nil, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var rows []map[string]interface{}
+	if err := decoder.Decode(&rows); err != nil {
+		return nil, fmt.Errorf("%s.json is invalid", entity)
+	}
+	return rows, nil
+}
+
+// tenantImporter recreates archive rows under a new tenant, remembering the new ID of every source ID
+type tenantImporter struct {
+	tx       *sqlx.Tx
+	tenantID string
+	ids      map[string]map[string]string // Entity name, source ID, new ID
+	results  map[string]*models.TenantArchiveEntityResult
+	report   *models.TenantImportReport
+}
+
+func (imp *tenantImporter) result(entity string) *models.TenantArchiveEntityResult {
+	if imp.results[entity] == nil {
+		imp.results[entity] = &models.TenantArchiveEntityResult{}
+		imp.ids[entity] = map[string]string{}
+	}
+	return imp.results[entity]
+}
+
+func (imp *tenantImporter) conflict(entity, sourceID, action, message string) {
+	imp.report.Conflicts = append(imp.report.Conflicts, models.TenantArchiveConflict{
+		Entity: entity, SourceID: sourceID, Action: action, Message: message,
+	})
+}
+
+// exec runs one statement under a savepoint, so a row that fails is reported without aborting the import
+func (imp *tenantImporter) exec(query string, args ...interface{}) error {
+	if _, err := imp.tx.Exec(`SAVEPOINT archive_row`); err != nil {
+		return err
+	}
+	if _, err := imp.tx.Exec(query, args...); err != nil {
+		imp.tx.Exec(`ROLLBACK TO SAVEPOINT archive_row`)
+		return err
+	}
+	_, err := imp.tx.Exec(`RELEASE SAVEPOINT archive_row`)
+	return err
+}
+
+// remapRefs points the references of a row at the imported rows; false means the row must be skipped
+func (imp *tenantImporter) remapRefs(entity services.ArchiveEntity, sourceID string, row map[string]interface{}) bool {
+	for _, ref := range entity.Refs {
+		value, ok := row[ref.Column].(string)
+		if !ok || value == "" {
+			continue
+		}
+		if newID, ok := imp.ids[ref.Entity][value]; ok {
+			row[ref.Column] = newID
+			continue
+		}
+		if ref.Required {
+			imp.conflict(entity.Name, sourceID, "skipped", fmt.Sprintf("%s %s was not imported", ref.Column, value))
+			return false
+		}
+		row[ref.Column] = nil
+		imp.conflict(entity.Name, sourceID, "cleared", fmt.Sprintf("%s %s was not imported, left empty", ref.Column, value))
+	}
+	return true
+}
+
+// importRows inserts the rows of an entity with new IDs
+func (imp *tenantImporter) importRows(entity services.ArchiveEntity, rows []map[string]interface{}) {
+	result := imp.result(entity.Name)
+
+	cols := append([]string{"id"}, entity.Columns...)
+	for _, secret := range entity.Secrets {
+		cols = append(cols, secret.Column, secret.Hash)
+	}
+	if entity.HasTenant {
+		cols = append(cols, "tenant_id")
+	}
+	list := strings.Join(cols, ", ")
+	query := `INSERT INTO ` + entity.Table + ` (` + list + `)
+	          SELECT ` + list + ` FROM jsonb_populate_record(NULL::` + entity.Table + `, $1::jsonb)`
+
+	for _, row := range rows {
+		sourceID, _ := row["id"].(string)
+		if !imp.remapRefs(entity, sourceID, row) {
+			result.Skipped++
+			continue
+		}
+		if err := services.SealArchiveSecrets(entity, row, imp.tenantID); err != nil {
+			imp.conflict(entity.Name, sourceID, "skipped", err.Error())
+			result.Skipped++
+			continue
+		}
+
+		newID := uuid.New().String()
+		row["id"] = newID
+		if entity.HasTenant {
+			row["tenant_id"] = imp.tenantID
+		}
+		payload, _ := json.Marshal(row)
+		if err := imp.exec(query, string(payload)); err != nil {
+			imp.conflict(entity.Name, sourceID, "skipped", err.Error())
+			result.Skipped++
+			continue
+		}
+		imp.ids[entity.Name][sourceID] = newID
+		result.Imported++
+	}
+}
+
+// importRoles maps system roles onto the ones created for the new tenant and creates custom roles.
+// Each role gets the archived permissions that exist on this instance.
+func (imp *tenantImporter) importRoles(rows []map[string]interface{}) {
+	result := imp.result("roles")
+
+	for _, row := range rows {
+		var role struct {
+			ID             string   `json:"id"`
+			Name           string   `json:"name"`
+			Description    *string  `json:"description"`
+			IsSystem       bool     `json:"is_system"`
+			CreatedAt      *string  `json:"created_at"`
+			PermissionKeys []string `json:"permission_keys"`
+		}
+		raw, _ := json.Marshal(row)
+		if err := json.Unmarshal(raw, &role); err != nil || strings.TrimSpace(role.Name) == "" {
+			imp.conflict("roles", role.ID, "skipped", "role has no name")
+			result.Skipped++
+			continue
+		}
+
+		var roleID string
+		if role.IsSystem {
+			err := imp.tx.Get(&roleID, `
+				SELECT id FROM roles WHERE tenant_id = $1 AND name = $2 AND is_system = true AND deleted_at IS NULL
+			`, imp.tenantID, role.Name)
+			if err != nil && err != sql.ErrNoRows {
+				imp.conflict("roles", role.ID, "skipped", err.Error())
+				result.Skipped++
+				continue
+			}
+		}
+		if roleID != "" {
+			result.Linked++
+		} else {
+			roleID = uuid.New().String()
+			err := imp.exec(`
+				INSERT INTO roles (id, tenant_id, name, description, is_system, created_at)
+				VALUES ($1, $2, $3, $4, false, COALESCE($5::timestamp, CURRENT_TIMESTAMP))
+			`, roleID, imp.tenantID, role.Name, role.Description, role.CreatedAt)
+			if err != nil {
+				imp.conflict("roles", role.ID, "skipped", err.Error())
+				result.Skipped++
+				continue
+			}
+			result.Imported++
+		}
+		imp.ids["roles"][role.ID] = roleID
+
+		keys := role.PermissionKeys
+		if keys == nil {
+			keys = []string{}
+		}
+		err := imp.exec(`
+			DELETE FROM role_permissions
+			WHERE role_id = $1 AND permission_id NOT IN (SELECT id FROM permissions WHERE key = ANY($2))
+		`, roleID, pq.Array(keys))
+		if err == nil {
+			err = imp.exec(`
+				INSERT INTO role_permissions (role_id, permission_id)
+				SELECT $1, id FROM permissions WHERE key = ANY($2)
+				ON CONFLICT DO NOTHING
+			`, roleID, pq.Array(keys))
+		}
+		if err != nil {
+			imp.conflict("roles", role.ID, "cleared", "permissions could not be restored: "+err.Error())
+			continue
+		}
+
+		var unknown []string
+		imp.tx.Select(&unknown, `
+			SELECT k FROM unnest($1::text[]) AS k
+			WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE key = k)
+		`, pq.Array(keys))
+		if len(unknown) > 0 {
+			imp.conflict("roles", role.ID, "cleared", "unknown permissions left out: "+strings.Join(unknown, ", "))
+		}
+	}
+}
+
+// importUsers links archived users to existing accounts with the same email and creates the rest.
+// Created accounts have no password; members sign in with Google or reset their password.
+func (imp *tenantImporter) importUsers(rows []map[string]interface{}) int {
+	result := imp.result("users")
+	created := 0
+
+	for _, row := range rows {
+		var user struct {
+			ID              string  `json:"id"`
+			Email           string  `json:"email"`
+			FullName        string  `json:"full_name"`
+			Phone           *string `json:"phone"`
+			AvatarURL       *string `json:"avatar_url"`
+			Status          *string `json:"status"`
+			EmailVerifiedAt *string `json:"email_verified_at"`
+			CreatedAt       *string `json:"created_at"`
+		}
+		raw, _ := json.Marshal(row)
+		if err := json.Unmarshal(raw, &user); err != nil || strings.TrimSpace(user.Email) == "" {
+			imp.conflict("users", user.ID, "skipped", "user has no email")
+			result.Skipped++
+			continue
+		}
+
+		var userID string
+		err := imp.tx.Get(&userID, `
+			SELECT id FROM users WHERE LOWER(email) = LOWER($1) AND deleted_at IS NULL ORDER BY created_at LIMIT 1
+		`, strings.TrimSpace(user.Email))
+		if err == nil {
+			imp.ids["users"][user.ID] = userID
+			result.Linked++
+			continue
+		} else if err != sql.ErrNoRows {
+			imp.conflict("users", user.ID, "skipped", err.Error())
+			result.Skipped++
+			continue
+		}
+
+		if strings.TrimSpace(user.FullName) == "" {
+			user.FullName = user.Email
+		}
+		userID = uuid.New().String()
+		err = imp.exec(`
+			INSERT INTO users (id, email, full_name, phone, avatar_url, status, email_verified_at, auth_provider,
+			                   default_tenant_id, created_at)
+			VALUES ($1, $2, $3, $4, $5, COALESCE($6, 'active'), $7::timestamp, 'email', $8,
+			        COALESCE($9::timestamp, CURRENT_TIMESTAMP))
+		`, userID, strings.TrimSpace(user.Email), user.FullName, user.Phone, user.AvatarURL, user.Status,
+			user.EmailVerifiedAt, imp.tenantID, user.CreatedAt)
+		if err != nil {
+			imp.conflict("users", user.ID, "skipped", err.Error())
+			result.Skipped++
+			continue
+		}
+		imp.ids["users"][user.ID] = userID
+		result.Imported++
+		created++
+	}
+	return created
+}
+
+// importAttachments counts the attachment references that came along with an imported complaint or document request
+func (imp *tenantImporter) importAttachments(archive *tenantArchive) error {
+	data, ok := archive.Files["attachments.json"]
+	if !ok {
+		return nil
+	}
+	var attachments []services.ArchiveAttachment
+	if err := json.Unmarshal(data, &attachments); err != nil {
+		return fmt.Errorf("attachments.json is invalid")
+	}
+
+	result := imp.result("attachments")
+	for _, a := range attachments {
+		if _, ok := imp.ids[a.Entity][a.SourceID]; ok {
+			result.Imported++
+		} else {
+			result.Skipped++
+		}
+	}
+	if len(attachments) > 0 {
+		imp.report.Notes = append(imp.report.Notes,
+			"Attachment files are not part of the archive; complaint URLs and document file IDs were kept as they were.")
+	}
+	return nil
+}
+
+// ImportTenantArchive recreates a tenant from an archive made by an export, on this or another instance.
+// Form fields: file, code (overrides the archived tenant code), dry_run (default true).
+// Every row gets a new ID; rows that cannot be imported are listed as conflicts instead of failing the import.
+func ImportTenantArchive(c echo.Context) error {
+	dryRun := c.FormValue("dry_run") != "false"
+	setPlatformAudit(c, "tenant.import", map[string]interface{}{"dry_run": dryRun})
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "file is required"})
+	}
+	if fileHeader.Size > maxTenantArchiveSize {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "File is too large (max 50 MB)"})
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Failed to read file"})
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxTenantArchiveSize+1))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Failed to read file"})
+	}
+	if len(data) > maxTenantArchiveSize {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "File is too large (max 50 MB)"})
+	}
+
+	archive, err := readTenantArchive(data)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	entityRows := map[string][]map[string]interface{}{}
+	for _, entity := range services.TenantArchiveEntities {
+		rows, err := archive.rows(entity.Name)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		entityRows[entity.Name] = rows
+	}
+
+	code := strings.TrimSpace(c.FormValue("code"))
+	if code == "" {
+		code = strings.TrimSpace(archive.Tenant.Code)
+	}
+	if code == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "code is required"})
+	}
+	var codeTaken bool
+	if err := db.DB.Get(&codeTaken, `SELECT EXISTS(SELECT 1 FROM tenants WHERE code = $1)`, code); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if codeTaken {
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error": "Tenant code " + code + " is already in use; import with another code",
+		})
+	}
+
+	level := archive.Tenant.Level
+	if level != "rw" {
+		level = "rt"
+	}
+	settings, modules := "{}", "{}"
+	if len(archive.Tenant.Settings) > 0 && string(archive.Tenant.Settings) != "null" {
+		settings = string(archive.Tenant.Settings)
+	}
+	if len(archive.Tenant.Modules) > 0 && string(archive.Tenant.Modules) != "null" {
+		modules = string(archive.Tenant.Modules)
+	}
+
+	tx, err := db.DB.Beginx()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
+	}
+	defer tx.Rollback()
+
+	tenantID := uuid.New().String()
+	_, err = tx.Exec(`
+		INSERT INTO tenants (id, name, code, address, phone, email, settings, modules, level, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7::jsonb, $8::jsonb, $9, 'active')
+	`, tenantID, archive.Tenant.Name, code, archive.Tenant.Address, archive.Tenant.Phone, archive.Tenant.Email,
+		settings, modules, level)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Failed to create tenant: " + err.Error()})
+	}
+	if _, err := tx.Exec(`SELECT create_default_roles_for_tenant($1)`, tenantID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create default roles"})
+	}
+
+	report := &models.TenantImportReport{
+		DryRun:    dryRun,
+		Name:      archive.Tenant.Name,
+		Code:      code,
+		Source:    archive.Manifest.Source,
+		Entities:  map[string]models.TenantArchiveEntityResult{},
+		Conflicts: []models.TenantArchiveConflict{},
+	}
+	if level == "rw" {
+		report.Notes = append(report.Notes, "The tenant is an RW; its RTs are separate tenants and must be imported and linked on their own.")
+	}
+	imp := &tenantImporter{
+		tx:       tx,
+		tenantID: tenantID,
+		ids:      map[string]map[string]string{},
+		results:  map[string]*models.TenantArchiveEntityResult{},
+		report:   report,
+	}
+
+	for _, entity := range services.TenantArchiveEntities {
+		switch entity.Name {
+		case "roles":
+			imp.importRoles(entityRows[entity.Name])
+		case "users":
+			if created := imp.importUsers(entityRows[entity.Name]); created > 0 {
+				report.Notes = append(report.Notes, fmt.Sprintf(
+					"%d user accounts were created without a password; they sign in with Google or use forgot password.", created))
+			}
+		default:
+			imp.importRows(entity, entityRows[entity.Name])
+		}
+	}
+	if err := imp.importAttachments(archive); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	for name, result := range imp.results {
+		report.Entities[name] = *result
+	}
+
+	if !dryRun {
+		if err := tx.Commit(); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit transaction"})
+		}
+		report.TenantID = tenantID
+	}
+
+	setPlatformAudit(c, "tenant.import", map[string]interface{}{
+		"dry_run":          dryRun,
+		"tenant_id":        report.TenantID,
+		"code":             code,
+		"source_tenant_id": archive.Manifest.Source.TenantID,
+		"conflicts":        len(report.Conflicts),
+	})
+	if dryRun {
+		return c.JSON(http.StatusOK, report)
+	}
+	return c.JSON(http.StatusCreated, report)
+}
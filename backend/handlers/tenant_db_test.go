@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// ownerDBAllowed lists the functions reachable from tenant routes that may use db.DB, the table owner
+// connection that bypasses row-level security. Everything else behind TenantMiddleware goes through
+// middleware.TenantDB, so tenant isolation does not depend on each query remembering its tenant filter.
+var ownerDBAllowed = map[string]string{
+	// The signed-in user's own account, sessions and tenants, across every tenant they belong to
+	"ListMyTenants":           "lists the user's memberships in every tenant",
+	"SetDefaultTenant":        "updates the user's memberships in every tenant",
+	"SwitchTenant":            "moves the user to another tenant",
+	"isActiveMember":          "checks membership of the tenant being switched to",
+	"issueSession":            "issues a session for the tenant being switched to",
+	"RefreshToken":            "rotates the session of the tenant being switched to",
+	"startMFAChallenge":       "2FA state lives on the user, shared by all tenants",
+	"startTOTPEnrolment":      "2FA state lives on the user, shared by all tenants",
+	"EnableTwoFactor":         "2FA state lives on the user, shared by all tenants",
+	"DisableTwoFactor":        "2FA state lives on the user, shared by all tenants",
+	"GetTwoFactorStatus":      "2FA state lives on the user, shared by all tenants",
+	"RegenerateRecoveryCodes": "2FA state lives on the user, shared by all tenants",
+	"ListMySessions":          "lists the user's sessions in every tenant",
+	"RevokeMySession":         "revokes one of the user's sessions in any tenant",
+	"LogoutAll":               "revokes the user's sessions in every tenant",
+	"UnlinkGoogleAccount":     "the Google link lives on the user",
+	"createOAuthState":        "OAuth states are not tenant rows",
+	"ResendVerificationEmail": "email verification belongs to the user",
+	"recentlyIssuedAuthToken": "auth tokens belong to the user",
+	"sendVerificationEmail":   "auth tokens belong to the user",
+
+	// Joining another tenant
+	"JoinWithInvitation": "the invitation belongs to the tenant being joined",
+	"CreateJoinRequest":  "the request goes to the tenant being joined",
+	"ListMyJoinRequests": "lists the user's requests to every tenant",
+
+	// RW features read their RTs
+	"ListRWTenants": "reads the RTs of the RW",
+	"GetRWSummary":  "rolls up the RTs of the RW",
+
+	// Shared with the platform console and background jobs
+	"getPendingTenantDeletion": "shared with the platform console and the purge job",
+	"createTenantDeletion":     "shared with the platform console",
+	"cancelTenantDeletion":     "shared with the platform console",
+	"notifyTenantDeletion":     "shared with the platform console and the purge job",
+	"ListTenantModules":        "plans are platform data",
+	"UpdateTenantModules":      "plans are platform data",
+	"CreateTenantDomain":       "domains are unique across tenants",
+}
+
+// tenantRouteHandlers returns the handlers main.go registers on the /api group and its subgroups
+func tenantRouteHandlers(t *testing.T) map[string]bool {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), filepath.Join("..", "main.go"), nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := map[string]bool{"api": true}
+	handlers := map[string]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			// x := api.Group(...) or x := <subgroup>.Group(...)
+			if len(n.Lhs) == 1 && len(n.Rhs) == 1 {
+				if call, ok := n.Rhs[0].(*ast.CallExpr); ok {
+					if sel, ok := call.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "Group" {
+						if x, ok := sel.X.(*ast.Ident); ok && groups[x.Name] {
+							groups[n.Lhs[0].(*ast.Ident).Name] = true
+						}
+					}
+				}
+			}
+		case *ast.CallExpr:
+			sel, ok := n.Fun.(*ast.SelectorExpr)
+			if !ok || len(n.Args) < 2 {
+				return true
+			}
+			if x, ok := sel.X.(*ast.Ident); !ok || !groups[x.Name] {
+				return true
+			}
+			switch sel.Sel.Name {
+			case "GET", "POST", "PUT", "PATCH", "DELETE":
+				if h, ok := n.Args[1].(*ast.SelectorExpr); ok {
+					if pkg, ok := h.X.(*ast.Ident); ok && pkg.Name == "handlers" {
+						handlers[h.Sel.Name] = true
+					}
+				}
+			}
+		}
+		return true
+	})
+	if len(handlers) == 0 {
+		t.Fatal("Found no tenant routes in main.go")
+	}
+	return handlers
+}
+
+// TestTenantRoutesUseTenantDB flags db.DB in tenant route handlers and the package functions they call
+func TestTenantRoutesUseTenantDB(t *testing.T) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(info fs.FileInfo) bool { return !strings.HasSuffix(info.Name(), "_test.go") }, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	funcs := map[string]*ast.FuncDecl{}
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Body != nil {
+					funcs[fn.Name.Name] = fn
+				}
+			}
+		}
+	}
+
+	for name := range ownerDBAllowed {
+		if _, ok := funcs[name]; !ok {
+			t.Errorf("ownerDBAllowed lists %s, which no longer exists", name)
+		}
+	}
+
+	violations := map[string]string{}
+	visited := map[string]bool{}
+	var visit func(name, route string)
+	visit = func(name, route string) {
+		fn, ok := funcs[name]
+		if !ok || visited[name] {
+			return
+		}
+		visited[name] = true
+		if _, allowed := ownerDBAllowed[name]; allowed {
+			return
+		}
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.SelectorExpr:
+				if pkg, ok := n.X.(*ast.Ident); ok && pkg.Name == "db" && n.Sel.Name == "DB" {
+					if _, seen := violations[name]; !seen {
+						violations[name] = fset.Position(n.Pos()).String() + " (via " + route + ")"
+					}
+				}
+			case *ast.Ident:
+				// Calls and function values of the same package
+				if _, ok := funcs[n.Name]; ok && n.Name != name {
+					visit(n.Name, route)
+				}
+			}
+			return true
+		})
+	}
+	for handler := range tenantRouteHandlers(t) {
+		visit(handler, handler)
+	}
+
+	names := make([]string, 0, len(violations))
+	for name := range violations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t.Errorf("%s uses db.DB behind TenantMiddleware at %s; use middleware.TenantDB(c) or list it in ownerDBAllowed", name, violations[name])
+	}
+}
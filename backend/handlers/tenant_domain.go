@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"rukunos-backend/db"
+	"rukunos-backend/middleware"
+	"rukunos-backend/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// domainPattern matches a lowercase DNS name with at least two labels
+var domainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+// domainVerificationPrefix is the TXT record (under the custom domain) that proves the tenant controls it
+const domainVerificationPrefix = "_rukunos."
+
+// maxTenantDomains caps the custom domains of one tenant
+const maxTenantDomains = 5
+
+// withVerificationRecord fills in the DNS record the tenant has to create
+func withVerificationRecord(d models.TenantDomain) models.TenantDomain {
+	d.RecordName = domainVerificationPrefix + d.Domain
+	d.RecordValue = "rukunos-verification=" + d.VerificationToken
+	return d
+}
+
+// tenantSubdomainURL is the tenant's address under the platform domain, e.g. https://rt05.rukunos.id
+func tenantSubdomainURL(code string) string {
+	return "https://" + strings.ToLower(code) + "." + middleware.TenantBaseDomain()
+}
+
+// tenantPublicURL is where the tenant's public pages live: its first verified custom domain, else its subdomain
+func tenantPublicURL(tenantID string) (string, error) {
+	var site struct {
+		Code   string         `db:"code"`
+		Domain sql.NullString `db:"domain"`
+	}
+	err := db.ForTenant(tenantID).Get(&site, `
+		SELECT t.code,
+		       (SELECT d.domain FROM tenant_domains d
+		        WHERE d.tenant_id = t.id AND d.verified_at IS NOT NULL
+		        ORDER BY d.verified_at LIMIT 1) AS domain
+		FROM tenants t WHERE t.id = $1
+	`, tenantID)
+	if err != nil {
+		return "", err
+	}
+	if site.Domain.Valid {
+		return "https://" + site.Domain.String, nil
+	}
+	return tenantSubdomainURL(site.Code), nil
+}
+
+// ListTenantDomains returns the tenant's subdomain and custom domains with their verification records
+func ListTenantDomains(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
+
+	var code string
+	if err := tdb.Get(&code, `SELECT code FROM tenants WHERE id = $1`, tenantID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	domains := []models.TenantDomain{}
+	err := tdb.Select(&domains, `
+		SELECT id, tenant_id, domain, verification_token, verified_at, last_checked_at, last_error, created_by, created_at
+		FROM tenant_domains
+		WHERE tenant_id = $1
+		ORDER BY created_at
+	`, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch domains"})
+	}
+	for i := range domains {
+		domains[i] = withVerificationRecord(domains[i])
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"subdomain": tenantSubdomainURL(code),
+		"domains":   domains,
+	})
+}
+
+// CreateTenantDomain adds a custom domain; it resolves to the tenant once its TXT record is verified
+func CreateTenantDomain(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+
+	req := new(models.CreateTenantDomainRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	domain := middleware.NormalizeHost(req.Domain)
+	if !domainPattern.MatchString(domain) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "domain must be a domain name such as rt05.example.com"})
+	}
+	base := middleware.TenantBaseDomain()
+	if domain == base || strings.HasSuffix(domain, "."+base) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Subdomains of " + base + " are assigned by tenant code"})
+	}
+
+	var count int
+	if err := tdb.Get(&count, `SELECT COUNT(*) FROM tenant_domains WHERE tenant_id = $1`, tenantID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if count >= maxTenantDomains {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "A tenant can have at most 5 custom domains"})
+	}
+
+	// Domains are unique across tenants, so the check cannot go through the tenant-scoped handle
+	var taken bool
+	if err := db.DB.Get(&taken, `SELECT EXISTS(SELECT 1 FROM tenant_domains WHERE domain = $1)`, domain); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if taken {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Domain is already registered"})
+	}
+
+	token, _, err := newSecureToken()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate verification token"})
+	}
+
+	var created models.TenantDomain
+	err = tdb.Get(&created, `
+		INSERT INTO tenant_domains (tenant_id, domain, verification_token, created_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, tenant_id, domain, verification_token, verified_at, last_checked_at, last_error, created_by, created_at
+	`, tenantID, domain, token, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to add domain"})
+	}
+	return c.JSON(http.StatusCreated, withVerificationRecord(created))
+}
+
+// lookupVerificationRecord reports whether the domain publishes the expected verification TXT record
+func lookupVerificationRecord(d models.TenantDomain) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	records, err := net.DefaultResolver.LookupTXT(ctx, domainVerificationPrefix+d.Domain)
+	if err != nil {
+		return false, err
+	}
+	expected := withVerificationRecord(d).RecordValue
+	for _, record := range records {
+		if strings.TrimSpace(record) == expected {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// VerifyTenantDomain checks the domain's TXT record and marks it verified when it matches
+func VerifyTenantDomain(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
+
+	var domain models.TenantDomain
+	err := tdb.Get(&domain, `
+		SELECT id, tenant_id, domain, verification_token, verified_at, last_checked_at, last_error, created_by, created_at
+		FROM tenant_domains
+		WHERE id = $1 AND tenant_id = $2
+	`, c.Param("domain_id"), tenantID)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Domain not found"})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if domain.VerifiedAt.Valid {
+		return c.JSON(http.StatusOK, withVerificationRecord(domain))
+	}
+
+	found, lookupErr := lookupVerificationRecord(domain)
+	var lastError interface{}
+	if lookupErr != nil {
+		lastError = "DNS lookup failed: " + lookupErr.Error()
+	} else if !found {
+		lastError = "TXT record " + domainVerificationPrefix + domain.Domain + " does not contain the verification value"
+	}
+
+	err = tdb.Get(&domain, `
+		UPDATE tenant_domains
+		SET last_checked_at = NOW(), last_error = $1,
+		    verified_at = CASE WHEN $2 THEN NOW() ELSE NULL END
+		WHERE id = $3
+		RETURNING id, tenant_id, domain, verification_token, verified_at, last_checked_at, last_error, created_by, created_at
+	`, lastError, found, domain.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update domain"})
+	}
+	middleware.ForgetTenantHost(domain.Domain)
+
+	if !found {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":  lastError,
+			"domain": withVerificationRecord(domain),
+		})
+	}
+	return c.JSON(http.StatusOK, withVerificationRecord(domain))
+}
+
+// DeleteTenantDomain removes a custom domain; it stops resolving to the tenant right away
+func DeleteTenantDomain(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
+
+	var domain string
+	err := tdb.Get(&domain, `
+		DELETE FROM tenant_domains WHERE id = $1 AND tenant_id = $2 RETURNING domain
+	`, c.Param("domain_id"), tenantID)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Domain not found"})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete domain"})
+	}
+	middleware.ForgetTenantHost(domain)
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Domain removed"})
+}
@@ -0,0 +1,387 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"rukunos-backend/db"
+	"rukunos-backend/middleware"
+	"rukunos-backend/models"
+	"rukunos-backend/services"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+const tenantDeletionRequestColumns = `
+	r.id, r.tenant_id, r.tenant_name, r.tenant_code, r.status, r.reason, r.requested_by,
+	u.full_name AS requested_by_name, r.requested_via, r.purge_after, r.cancelled_at, r.cancelled_by,
+	r.exported_at, r.archive_path IS NOT NULL AS archive_available, r.archive_expires_at, r.purged_at,
+	r.purge_summary, r.last_error, r.created_at
+`
+
+func finishTenantDeletionRequest(request *models.TenantDeletionRequest) {
+	if len(request.PurgeSummaryJSON) > 0 {
+		request.PurgeSummary = request.PurgeSummaryJSON
+	}
+}
+
+// getPendingTenantDeletion returns the tenant's deletion request that is still in its grace period
+func getPendingTenantDeletion(tenantID string) (models.TenantDeletionRequest, error) {
+	var request models.TenantDeletionRequest
+	err := db.DB.Get(&request, `
+		SELECT `+tenantDeletionRequestColumns+`
+		FROM tenant_deletion_requests r
+		LEFT JOIN users u ON u.id = r.requested_by
+		WHERE r.tenant_id = $1 AND r.status = 'pending'
+	`, tenantID)
+	finishTenantDeletionRequest(&request)
+	return request, err
+}
+
+// notifyTenantDeletion emails the tenant's admins that deletion was requested or cancelled
+func notifyTenantDeletion(request models.TenantDeletionRequest, cancelled bool) {
+	var admins []struct {
+		ID       string `db:"id"`
+		Email    string `db:"email"`
+		FullName string `db:"full_name"`
+	}
+	err := db.DB.Select(&admins, `
+		SELECT u.id, u.email, u.full_name
+		FROM tenant_users tu
+		INNER JOIN users u ON u.id = tu.user_id
+		INNER JOIN roles r ON r.id = tu.role_id
+		WHERE tu.tenant_id = $1 AND r.name = 'Admin' AND tu.status = 'active'
+		AND tu.deleted_at IS NULL AND u.deleted_at IS NULL
+	`, request.TenantID)
+	if err != nil {
+		return
+	}
+
+	for _, admin := range admins {
+		msg := services.Message{TenantID: request.TenantID, UserID: admin.ID, Recipient: admin.Email}
+		if cancelled {
+			msg.Subject = fmt.Sprintf("Penghapusan data %s dibatalkan", request.TenantName)
+			msg.Body = fmt.Sprintf("Halo %s,\n\nPermintaan penghapusan data %s di RukunOS telah dibatalkan. "+
+				"Data RT tetap tersimpan seperti biasa.\n", admin.FullName, request.TenantName)
+		} else {
+			msg.Subject = fmt.Sprintf("Data %s akan dihapus permanen", request.TenantName)
+			msg.Body = fmt.Sprintf("Halo %s,\n\nTelah diajukan penghapusan permanen seluruh data %s di RukunOS. "+
+				"Data akan dihapus setelah %s. Sampai saat itu RT tetap dapat digunakan, data dapat diunduh "+
+				"melalui menu ekspor, dan permintaan dapat dibatalkan oleh pengurus.\n",
+				admin.FullName, request.TenantName, request.PurgeAfter.Format("02-01-2006 15:04"))
+		}
+		services.SendEmail(msg)
+	}
+}
+
+// createTenantDeletion starts the grace period of a tenant deletion.
+// It returns the request, or a non-zero HTTP status with an error message.
+func createTenantDeletion(tenantID, userID, via, reason string, graceDays int) (models.TenantDeletionRequest, int, string) {
+	var request models.TenantDeletionRequest
+
+	var tenant struct {
+		Name string `db:"name"`
+		Code string `db:"code"`
+	}
+	err := db.DB.Get(&tenant, `SELECT name, code FROM tenants WHERE id = $1 AND deleted_at IS NULL`, tenantID)
+	if err == sql.ErrNoRows {
+		return request, http.StatusNotFound, "Tenant not found"
+	} else if err != nil {
+		return request, http.StatusInternalServerError, "Database error"
+	}
+
+	requestedBy := sql.NullString{String: userID, Valid: userID != ""}
+	var requestID string
+	err = db.DB.Get(&requestID, `
+		INSERT INTO tenant_deletion_requests (tenant_id, tenant_name, tenant_code, reason, requested_by, requested_via, purge_after)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, NOW() + make_interval(days => $7))
+		RETURNING id
+	`, tenantID, tenant.Name, tenant.Code, reason, requestedBy, via, graceDays)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		return request, http.StatusConflict, "Tenant deletion has already been requested"
+	} else if err != nil {
+		return request, http.StatusInternalServerError, "Failed to request tenant deletion"
+	}
+
+	request, err = getPendingTenantDeletion(tenantID)
+	if err != nil {
+		return request, http.StatusInternalServerError, "Database error"
+	}
+	go notifyTenantDeletion(request, false)
+	return request, 0, ""
+}
+
+// cancelTenantDeletion ends the grace period of a tenant deletion without purging.
+// It returns the cancelled request, or a non-zero HTTP status with an error message.
+func cancelTenantDeletion(tenantID, userID string) (models.TenantDeletionRequest, int, string) {
+	request, err := getPendingTenantDeletion(tenantID)
+	if err == sql.ErrNoRows {
+		return request, http.StatusNotFound, "No pending tenant deletion"
+	} else if err != nil {
+		return request, http.StatusInternalServerError, "Database error"
+	}
+
+	cancelledBy := sql.NullString{String: userID, Valid: userID != ""}
+	result, err := db.DB.Exec(`
+		UPDATE tenant_deletion_requests
+		SET status = 'cancelled', cancelled_at = NOW(), cancelled_by = $1, updated_at = NOW()
+		WHERE id = $2 AND status = 'pending'
+	`, cancelledBy, request.ID)
+	if err != nil {
+		return request, http.StatusInternalServerError, "Failed to cancel tenant deletion"
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return request, http.StatusConflict, "Tenant deletion can no longer be cancelled"
+	}
+
+	request.Status = "cancelled"
+	request.CancelledAt = sql.NullTime{Time: time.Now(), Valid: true}
+	request.CancelledBy = cancelledBy
+	go notifyTenantDeletion(request, true)
+	return request, 0, ""
+}
+
+// GetTenantDeletion returns the tenant's pending deletion request, or null
+func GetTenantDeletion(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+
+	request, err := getPendingTenantDeletion(tenantID)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusOK, map[string]interface{}{"request": nil})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"request": request})
+}
+
+// RequestTenantDeletion asks for the tenant to be deleted permanently after the grace period.
+// The admin confirms by typing the tenant code.
+func RequestTenantDeletion(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+
+	req := new(models.CreateTenantDeletionRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	var code string
+	if err := middleware.TenantDB(c).Get(&code, `SELECT code FROM tenants WHERE id = $1`, tenantID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if !strings.EqualFold(strings.TrimSpace(req.ConfirmCode), code) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "confirm_code must match the tenant code"})
+	}
+
+	request, status, message := createTenantDeletion(tenantID, userID, "tenant", strings.TrimSpace(req.Reason), services.TenantDeletionGraceDays)
+	if status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+	return c.JSON(http.StatusCreated, request)
+}
+
+// CancelTenantDeletion cancels the tenant's pending deletion during the grace period
+func CancelTenantDeletion(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+
+	request, status, message := cancelTenantDeletion(tenantID, userID)
+	if status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+	return c.JSON(http.StatusOK, request)
+}
+
+// GetTenantRetention lists the tenant's retention policy for every entity that has one.
+// Policies are changed through the retention field of the tenant settings.
+func GetTenantRetention(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+
+	settings, err := services.LoadTenantSettings(tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load settings"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"policies":                  services.TenantRetentionPolicies(settings),
+		"deleted_record_grace_days": services.DeletedRecordGraceDays,
+	})
+}
+
+// ListTenantPurgeLogs lists what retention policies removed from the tenant, newest first
+func ListTenantPurgeLogs(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	tdb := middleware.TenantDB(c)
+	var total int
+	if err := tdb.Get(&total, `SELECT COUNT(*) FROM data_purge_logs WHERE tenant_id = $1`, tenantID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	logs := []models.DataPurgeLog{}
+	err := tdb.Select(&logs, `
+		SELECT id, tenant_id, deletion_request_id, entity, reason, rows_deleted, retention_days, created_at
+		FROM data_purge_logs
+		WHERE tenant_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`, tenantID, limit, (page-1)*limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch purge logs"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"logs": logs,
+		"pagination": map[string]interface{}{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": (total + limit - 1) / limit,
+		},
+	})
+}
+
+// ListPlatformTenantDeletions lists tenant deletion requests, optionally by status
+func ListPlatformTenantDeletions(c echo.Context) error {
+	setPlatformAudit(c, "tenant.deletion.list", nil)
+	page, limit := platformPagination(c)
+
+	where := "1=1"
+	args := []interface{}{}
+	if status := c.QueryParam("status"); status != "" {
+		where = "r.status = $1"
+		args = append(args, status)
+	}
+
+	var total int
+	if err := db.DB.Get(&total, `SELECT COUNT(*) FROM tenant_deletion_requests r WHERE `+where, args...); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	requests := []models.TenantDeletionRequest{}
+	args = append(args, limit, (page-1)*limit)
+	err := db.DB.Select(&requests, fmt.Sprintf(`
+		SELECT `+tenantDeletionRequestColumns+`
+		FROM tenant_deletion_requests r
+		LEFT JOIN users u ON u.id = r.requested_by
+		WHERE `+where+`
+		ORDER BY r.created_at DESC
+		LIMIT $%d OFFSET $%d
+	`, len(args)-1, len(args)), args...)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch tenant deletions"})
+	}
+	for i := range requests {
+		finishTenantDeletionRequest(&requests[i])
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"requests": requests,
+		"pagination": map[string]interface{}{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": (total + limit - 1) / limit,
+		},
+	})
+}
+
+// RequestPlatformTenantDeletion schedules a tenant's deletion from the platform console.
+// grace_days defaults to the tenant grace period; 0 purges on the next hourly run.
+func RequestPlatformTenantDeletion(c echo.Context) error {
+	userID, _ := c.Get(string(middleware.CtxUserID)).(string)
+	req := new(models.CreateTenantDeletionRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	graceDays := services.TenantDeletionGraceDays
+	if req.GraceDays != nil {
+		graceDays = *req.GraceDays
+	}
+	setPlatformAudit(c, "tenant.deletion.request", map[string]interface{}{"reason": req.Reason, "grace_days": graceDays})
+
+	if graceDays < 0 || graceDays > 365 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "grace_days must be between 0 and 365"})
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "reason is required"})
+	}
+	tenant, status, message := getPlatformTenant(c.Param("tenant_id"))
+	if status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+	if !strings.EqualFold(strings.TrimSpace(req.ConfirmCode), tenant.Code) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "confirm_code must match the tenant code"})
+	}
+
+	request, status, message := createTenantDeletion(tenant.ID, userID, "platform", strings.TrimSpace(req.Reason), graceDays)
+	if status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+	setPlatformAudit(c, "tenant.deletion.request", map[string]interface{}{
+		"reason":      req.Reason,
+		"grace_days":  graceDays,
+		"request_id":  request.ID,
+		"purge_after": request.PurgeAfter,
+	})
+	return c.JSON(http.StatusCreated, request)
+}
+
+// CancelPlatformTenantDeletion cancels a tenant's pending deletion from the platform console
+func CancelPlatformTenantDeletion(c echo.Context) error {
+	setPlatformAudit(c, "tenant.deletion.cancel", nil)
+	userID, _ := c.Get(string(middleware.CtxUserID)).(string)
+
+	tenant, status, message := getPlatformTenant(c.Param("tenant_id"))
+	if status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+	request, status, message := cancelTenantDeletion(tenant.ID, userID)
+	if status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+	setPlatformAudit(c, "tenant.deletion.cancel", map[string]interface{}{"request_id": request.ID})
+	return c.JSON(http.StatusOK, request)
+}
+
+// DownloadTenantDeletionArchive downloads the final export made before a tenant was purged
+func DownloadTenantDeletionArchive(c echo.Context) error {
+	requestID := c.Param("request_id")
+	setPlatformAudit(c, "tenant.deletion.archive", map[string]interface{}{"request_id": requestID})
+	if _, err := uuid.Parse(requestID); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Tenant deletion not found"})
+	}
+
+	var archive struct {
+		TenantCode string         `db:"tenant_code"`
+		Path       sql.NullString `db:"archive_path"`
+	}
+	err := db.DB.Get(&archive, `SELECT tenant_code, archive_path FROM tenant_deletion_requests WHERE id = $1`, requestID)
+	if err == sql.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Tenant deletion not found"})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if !archive.Path.Valid {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "No archive is available for this tenant deletion"})
+	}
+	if _, err := os.Stat(archive.Path.String); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Archive file is missing"})
+	}
+	return c.Attachment(archive.Path.String, fmt.Sprintf("rukunos-%s-final%s", archive.TenantCode, filepath.Ext(archive.Path.String)))
+}
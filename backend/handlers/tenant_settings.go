@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"rukunos-backend/middleware"
+	"rukunos-backend/models"
+	"rukunos-backend/services"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// flattenSettings turns a settings document into dotted paths (billing.late_fee.amount) and their values
+func flattenSettings(prefix string, value interface{}, out map[string]interface{}) {
+	if m, ok := value.(map[string]interface{}); ok {
+		for k, v := range m {
+			key := k
+			if prefix != "" {
+				key = prefix + "." + k
+			}
+			flattenSettings(key, v, out)
+		}
+		return
+	}
+	out[prefix] = value
+}
+
+// changedSettingsFields lists the dotted paths that differ between two settings documents
+func changedSettingsFields(previous, next models.TenantSettings) []string {
+	flat := func(s models.TenantSettings) map[string]interface{} {
+		raw, _ := json.Marshal(s)
+		var doc map[string]interface{}
+		json.Unmarshal(raw, &doc)
+		out := map[string]interface{}{}
+		flattenSettings("", doc, out)
+		return out
+	}
+	before, after := flat(previous), flat(next)
+
+	changed := []string{}
+	for key, value := range after {
+		if !reflect.DeepEqual(before[key], value) {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// lockTenantSettings loads the tenant's settings inside tx, locking the row until tx ends
+func lockTenantSettings(tx *sqlx.Tx, tenantID string) (models.TenantSettings, error) {
+	var raw []byte
+	err := tx.Get(&raw, `SELECT COALESCE(settings, '{}'::jsonb) FROM tenants WHERE id = $1 FOR UPDATE`, tenantID)
+	if err != nil {
+		return models.TenantSettings{}, err
+	}
+	return services.ParseTenantSettings(raw)
+}
+
+// saveTenantSettings stores the settings and records the change in the settings history.
+// Keys of tenants.settings outside the typed document are left as they are.
+func saveTenantSettings(tx *sqlx.Tx, tenantID, userID string, previous, next models.TenantSettings) error {
+	changed := changedSettingsFields(previous, next)
+	if len(changed) == 0 {
+		return nil
+	}
+
+	previousJSON, _ := json.Marshal(previous)
+	nextJSON, _ := json.Marshal(next)
+	_, err := tx.Exec(`
+		UPDATE tenants
+		SET settings = COALESCE(settings, '{}'::jsonb) || $1::jsonb, updated_at = NOW()
+		WHERE id = $2
+	`, string(nextJSON), tenantID)
+	if err != nil {
+		return err
+	}
+
+	changedBy := sql.NullString{String: userID, Valid: userID != ""}
+	_, err = tx.Exec(`
+		INSERT INTO tenant_settings_history (tenant_id, changed_by, changed_fields, previous_settings, new_settings)
+		VALUES ($1, $2, $3, $4::jsonb, $5::jsonb)
+	`, tenantID, changedBy, pq.Array(changed), string(previousJSON), string(nextJSON))
+	return err
+}
+
+// validateRequire2FARoles checks that every role that must use 2FA belongs to the tenant
+func validateRequire2FARoles(q sqlx.Queryer, tenantID string, roleIDs []string) (int, string) {
+	for _, roleID := range roleIDs {
+		var exists bool
+		err := sqlx.Get(q, &exists, `
+			SELECT EXISTS(SELECT 1 FROM roles WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL)
+		`, roleID, tenantID)
+		if err != nil {
+			return http.StatusBadRequest, "Invalid role ID: " + roleID
+		}
+		if !exists {
+			return http.StatusNotFound, "Role not found: " + roleID
+		}
+	}
+	return 0, ""
+}
+
+// GetTenantSettings returns the tenant's settings with defaults filled in
+func GetTenantSettings(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+
+	settings, err := services.LoadTenantSettings(tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load settings"})
+	}
+	return c.JSON(http.StatusOK, settings)
+}
+
+// UpdateTenantSettings changes tenant settings; fields left out of the request keep their current value
+func UpdateTenantSettings(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	userID, _ := c.Get(string(middleware.CtxUserID)).(string)
+
+	tx, err := middleware.TenantDB(c).Beginx()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
+	}
+	defer tx.Rollback()
+
+	previous, err := lockTenantSettings(tx, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load settings"})
+	}
+
+	// Binding onto the current settings merges the request into them
+	next := previous
+	next.Security.Require2FARoleIDs = append([]string{}, previous.Security.Require2FARoleIDs...)
+	next.Retention = map[string]int{}
+	for key, days := range previous.Retention {
+		next.Retention[key] = days
+	}
+	if err := c.Bind(&next); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	if next.Security.Require2FARoleIDs == nil {
+		next.Security.Require2FARoleIDs = []string{}
+	}
+
+	if err := services.ValidateTenantSettings(next); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if status, message := validateRequire2FARoles(tx, tenantID, next.Security.Require2FARoleIDs); status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+
+	if err := saveTenantSettings(tx, tenantID, userID, previous, next); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update settings"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit transaction"})
+	}
+
+	return c.JSON(http.StatusOK, next)
+}
+
+// ListTenantSettingsHistory lists changes to the tenant settings, newest first
+func ListTenantSettingsHistory(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	tdb := middleware.TenantDB(c)
+	var total int
+	if err := tdb.Get(&total, `SELECT COUNT(*) FROM tenant_settings_history WHERE tenant_id = $1`, tenantID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	changes := []models.TenantSettingsChange{}
+	err := tdb.Select(&changes, `
+		SELECT h.id, h.tenant_id, h.changed_by, u.full_name AS changed_by_name, h.changed_fields,
+		       h.previous_settings, h.new_settings, h.created_at
+		FROM tenant_settings_history h
+		LEFT JOIN users u ON u.id = h.changed_by
+		WHERE h.tenant_id = $1
+		ORDER BY h.created_at DESC
+		LIMIT $2 OFFSET $3
+	`, tenantID, limit, (page-1)*limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch settings history"})
+	}
+	for i := range changes {
+		changes[i].Previous, _ = services.ParseTenantSettings(changes[i].PreviousJSON)
+		changes[i].Settings, _ = services.ParseTenantSettings(changes[i].SettingsJSON)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"changes": changes,
+		"pagination": map[string]interface{}{
+			"page":        page,
+			"limit":       limit,
+			"total":       total,
+			"total_pages": (total + limit - 1) / limit,
+		},
+	})
+}
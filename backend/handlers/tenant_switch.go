@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"rukunos-backend/db"
+	"rukunos-backend/middleware"
+	"rukunos-backend/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// activeTenantIDs returns the active tenants of a user, the user's default tenant first
+func activeTenantIDs(userID string) ([]string, error) {
+	var tenantIDs []string
+	err := db.DB.Select(&tenantIDs, `
+		SELECT tu.tenant_id
+		FROM tenant_users tu
+		INNER JOIN users u ON u.id = tu.user_id
+		INNER JOIN tenants t ON t.id = tu.tenant_id
+		WHERE tu.user_id = $1
+		AND tu.deleted_at IS NULL
+		AND tu.status = 'active'
+		AND t.status = 'active' AND t.deleted_at IS NULL
+		ORDER BY (tu.tenant_id = u.default_tenant_id) DESC NULLS LAST, tu.created_at
+	`, userID)
+	return tenantIDs, err
+}
+
+// isActiveMember reports whether the user is an active member of an active tenant
+func isActiveMember(userID, tenantID string) (bool, error) {
+	var member bool
+	err := db.DB.Get(&member, `
+		SELECT EXISTS(
+			SELECT 1 FROM tenant_users tu
+			INNER JOIN tenants t ON t.id = tu.tenant_id
+			WHERE tu.user_id = $1 AND tu.tenant_id = $2
+			AND tu.status = 'active' AND tu.deleted_at IS NULL
+			AND t.status = 'active' AND t.deleted_at IS NULL
+		)
+	`, userID, tenantID)
+	return member, err
+}
+
+// ListMyTenants lists every tenant the current user belongs to, with role and unit
+func ListMyTenants(c echo.Context) error {
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+
+	memberships := []models.TenantMembership{}
+	err := db.DB.Select(&memberships, `
+		SELECT t.id as tenant_id, t.name as tenant_name, t.code as tenant_code,
+		       tu.role_id, r.name as role_name, tu.unit_id, un.code as unit_code,
+		       COALESCE(t.id = u.default_tenant_id, false) as is_default
+		FROM tenant_users tu
+		INNER JOIN users u ON u.id = tu.user_id
+		INNER JOIN tenants t ON t.id = tu.tenant_id
+		LEFT JOIN roles r ON r.id = tu.role_id AND r.deleted_at IS NULL
+		LEFT JOIN units un ON un.id = tu.unit_id AND un.deleted_at IS NULL
+		WHERE tu.user_id = $1
+		AND tu.deleted_at IS NULL
+		AND tu.status = 'active'
+		AND t.status = 'active' AND t.deleted_at IS NULL
+		ORDER BY t.name
+	`, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch tenants: " + err.Error()})
+	}
+	for i := range memberships {
+		memberships[i].IsCurrent = memberships[i].TenantID == tenantID
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"tenants": memberships,
+	})
+}
+
+// SwitchTenant reissues the session for another tenant the user belongs to. When 2FA applies in that tenant it
+// returns the same challenge as login instead of tokens.
+func SwitchTenant(c echo.Context) error {
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+	sessionID := c.Get(string(middleware.CtxSessionID)).(string)
+
+	req := new(models.SwitchTenantRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	if req.TenantID == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "tenant_id is required"})
+	}
+
+	member, err := isActiveMember(userID, req.TenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if !member {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "User is not a member of the specified tenant"})
+	}
+
+	// The target tenant's role may require 2FA; the session is only issued once the challenge is passed,
+	// and the current session stays as it is until then
+	challenge, err := startMFAChallenge(userID, req.TenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start two-factor challenge"})
+	}
+	if challenge != nil {
+		return c.JSON(http.StatusOK, challenge)
+	}
+
+	session, err := issueSession(c, userID, req.TenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate token"})
+	}
+
+	// The old session is replaced by the new one
+	_, err = db.DB.Exec(`
+		UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = $1
+		WHERE id = $2 AND revoked_at IS NULL
+	`, middleware.RevokeTenantSwitch, sessionID)
+	if err != nil {
+		c.Logger().Warnf("Failed to revoke previous session %s: %v", sessionID, err)
+	}
+
+	var tenantName string
+	db.DB.Get(&tenantName, `SELECT name FROM tenants WHERE id = $1`, req.TenantID)
+
+	var roleID sql.NullString
+	var roleName sql.NullString
+	db.DB.QueryRow(`
+		SELECT tu.role_id, r.name
+		FROM tenant_users tu
+		LEFT JOIN roles r ON r.id = tu.role_id AND r.deleted_at IS NULL
+		WHERE tu.user_id = $1 AND tu.tenant_id = $2 AND tu.deleted_at IS NULL
+	`, userID, req.TenantID).Scan(&roleID, &roleName)
+
+	permissions, _ := GetUserPermissions(userID, req.TenantID)
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"token":         session.AccessToken,
+		"refresh_token": session.RefreshToken,
+		"expires_in":    session.ExpiresIn,
+		"tenant_id":     req.TenantID,
+		"user": map[string]interface{}{
+			"id":          userID,
+			"tenant_id":   req.TenantID,
+			"tenant_name": tenantName,
+			"role_id":     roleID.String,
+			"role_name":   roleName.String,
+			"permissions": permissions,
+		},
+	})
+}
+
+// SetDefaultTenant sets (or clears) the tenant the user lands in after login
+func SetDefaultTenant(c echo.Context) error {
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+
+	req := new(models.SetDefaultTenantRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	if req.TenantID != nil && *req.TenantID != "" {
+		member, err := isActiveMember(userID, *req.TenantID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		if !member {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "User is not a member of the specified tenant"})
+		}
+	} else {
+		req.TenantID = nil
+	}
+
+	_, err := db.DB.Exec(`UPDATE users SET default_tenant_id = $1, updated_at = NOW() WHERE id = $2`, req.TenantID, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update default tenant"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":           "Default tenant updated successfully",
+		"default_tenant_id": req.TenantID,
+	})
+}
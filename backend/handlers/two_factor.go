@@ -0,0 +1,569 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"net/http"
+	"strings"
+	"time"
+	"rukunos-backend/db"
+	"rukunos-backend/middleware"
+	"rukunos-backend/models"
+	"rukunos-backend/pii"
+	"rukunos-backend/services"
+	"rukunos-backend/totp"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	totpIssuer           = "RukunOS"
+	totpSkew             = 1 // Accept one step (30s) of clock drift either way
+	mfaChallengeTTL      = 5 * time.Minute
+	mfaMaxAttempts       = 5
+	recoveryCodeCount    = 10
+	recoveryCodeByteSize = 5 // 8 base32 characters
+)
+
+// requires2FAByTenant reports whether the tenant forces two-factor authentication for the user's role
+func requires2FAByTenant(q sqlx.Queryer, userID, tenantID string) (bool, error) {
+	var required bool
+	err := sqlx.Get(q, &required, `
+		SELECT EXISTS(
+			SELECT 1 FROM tenants t
+			INNER JOIN tenant_users tu ON tu.tenant_id = t.id
+			WHERE t.id = $1 AND tu.user_id = $2 AND tu.deleted_at IS NULL AND tu.role_id IS NOT NULL
+			AND COALESCE(t.settings->'security'->'require_2fa_role_ids', '[]'::jsonb) @> to_jsonb(tu.role_id::text)
+		)
+	`, tenantID, userID)
+	return required, err
+}
+
+// startMFAChallenge creates a second-factor challenge when the user has 2FA enabled or the tenant requires it.
+// It returns nil when no second step is needed.
+func startMFAChallenge(userID, tenantID string) (map[string]interface{}, error) {
+	var enabled bool
+	if err := db.DB.Get(&enabled, `SELECT totp_enabled_at IS NOT NULL FROM users WHERE id = $1`, userID); err != nil {
+		return nil, err
+	}
+	required, err := requires2FAByTenant(db.DB, userID, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled && !required {
+		return nil, nil
+	}
+
+	token, tokenHash, err := newSecureToken()
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.DB.Exec(`
+		INSERT INTO mfa_challenges (user_id, tenant_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, userID, tenantID, tokenHash, time.Now().Add(mfaChallengeTTL))
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"mfa_required":       true,
+		"mfa_setup_required": !enabled, // Tenant requires 2FA but the user has not enrolled yet
+		"mfa_token":          token,
+		"expires_in":         int(mfaChallengeTTL.Seconds()),
+		"tenant_id":          tenantID,
+	}, nil
+}
+
+// newRecoveryCodes replaces the user's recovery codes and returns the new plain codes
+func newRecoveryCodes(tx *sqlx.Tx, userID string) ([]string, error) {
+	if _, err := tx.Exec(`DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	enc := base32.StdEncoding.WithPadding(base32.NoPadding)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, recoveryCodeByteSize)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(enc.EncodeToString(b))
+		if _, err := tx.Exec(`
+			INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)
+		`, userID, hashToken(raw)); err != nil {
+			return nil, err
+		}
+		codes = append(codes, raw[:4]+"-"+raw[4:])
+	}
+	return codes, nil
+}
+
+// verifySecondFactor accepts a current TOTP code (each time step only once) or an unused recovery code
+func verifySecondFactor(tx *sqlx.Tx, userID, code string) (bool, error) {
+	var user struct {
+		Secret   sql.NullString `db:"totp_secret"`
+		LastStep sql.NullInt64  `db:"totp_last_step"`
+	}
+	err := tx.Get(&user, `
+		SELECT totp_secret, totp_last_step FROM users
+		WHERE id = $1 AND totp_enabled_at IS NOT NULL
+		FOR UPDATE
+	`, userID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if user.Secret.Valid {
+		secret, err := pii.Decrypt(user.Secret.String, userID)
+		if err != nil {
+			return false, err
+		}
+		if step, ok := totp.Validate(secret, code, time.Now(), totpSkew); ok {
+			if user.LastStep.Valid && step <= user.LastStep.Int64 {
+				return false, nil
+			}
+			_, err = tx.Exec(`UPDATE users SET totp_last_step = $1 WHERE id = $2`, step, userID)
+			return err == nil, err
+		}
+	}
+
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	result, err := tx.Exec(`
+		UPDATE user_recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userID, hashToken(normalized))
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// startTOTPEnrolment generates a new (not yet active) secret for the user
+func startTOTPEnrolment(userID string) (map[string]interface{}, int, string) {
+	var user struct {
+		Email   string `db:"email"`
+		Enabled bool   `db:"enabled"`
+	}
+	err := db.DB.Get(&user, `SELECT email, totp_enabled_at IS NOT NULL as enabled FROM users WHERE id = $1`, userID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, "Database error"
+	}
+	if user.Enabled {
+		return nil, http.StatusConflict, "Two-factor authentication is already enabled"
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, http.StatusInternalServerError, "Failed to generate secret"
+	}
+	// Secrets are stored encrypted; a database dump alone cannot generate codes
+	encrypted, err := pii.Encrypt(secret, userID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, "Failed to save secret"
+	}
+	if _, err = db.DB.Exec(`UPDATE users SET totp_secret = $1, updated_at = NOW() WHERE id = $2`, encrypted, userID); err != nil {
+		return nil, http.StatusInternalServerError, "Failed to save secret"
+	}
+
+	return map[string]interface{}{
+		"secret":      secret,
+		"otpauth_url": totp.KeyURI(totpIssuer, user.Email, secret), // Render as QR code
+	}, 0, ""
+}
+
+// activateTOTP confirms enrolment with a code from the authenticator app and returns fresh recovery codes
+func activateTOTP(tx *sqlx.Tx, userID, code string) ([]string, int, string) {
+	var user struct {
+		Secret  sql.NullString `db:"totp_secret"`
+		Enabled bool           `db:"enabled"`
+	}
+	err := tx.Get(&user, `
+		SELECT totp_secret, totp_enabled_at IS NOT NULL as enabled FROM users WHERE id = $1 FOR UPDATE
+	`, userID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, "Database error"
+	}
+	if user.Enabled {
+		return nil, http.StatusConflict, "Two-factor authentication is already enabled"
+	}
+	if !user.Secret.Valid {
+		return nil, http.StatusBadRequest, "Start two-factor setup first"
+	}
+
+	secret, err := pii.Decrypt(user.Secret.String, userID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, "Failed to read secret"
+	}
+	step, ok := totp.Validate(secret, code, time.Now(), totpSkew)
+	if !ok {
+		return nil, http.StatusUnauthorized, "Invalid code"
+	}
+	_, err = tx.Exec(`
+		UPDATE users SET totp_enabled_at = NOW(), totp_last_step = $1, updated_at = NOW() WHERE id = $2
+	`, step, userID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, "Failed to enable two-factor authentication"
+	}
+
+	codes, err := newRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, "Failed to generate recovery codes"
+	}
+	return codes, 0, ""
+}
+
+// mfaChallenge is a pending second login step
+type mfaChallenge struct {
+	ID         string       `db:"id"`
+	UserID     string       `db:"user_id"`
+	TenantID   string       `db:"tenant_id"`
+	Attempts   int          `db:"attempts"`
+	ExpiresAt  time.Time    `db:"expires_at"`
+	ConsumedAt sql.NullTime `db:"consumed_at"`
+}
+
+func getMFAChallenge(q sqlx.Queryer, token string, forUpdate bool) (*mfaChallenge, int, string) {
+	query := `
+		SELECT id, user_id, tenant_id, attempts, expires_at, consumed_at
+		FROM mfa_challenges WHERE token_hash = $1`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+	var challenge mfaChallenge
+	err := sqlx.Get(q, &challenge, query, hashToken(token))
+	if err == sql.ErrNoRows {
+		return nil, http.StatusUnauthorized, "Invalid or expired login challenge"
+	} else if err != nil {
+		return nil, http.StatusInternalServerError, "Database error"
+	}
+	if challenge.ConsumedAt.Valid || time.Now().After(challenge.ExpiresAt) {
+		return nil, http.StatusUnauthorized, "Invalid or expired login challenge, please log in again"
+	}
+	if challenge.Attempts >= mfaMaxAttempts {
+		return nil, http.StatusTooManyRequests, "Too many wrong codes, please log in again"
+	}
+	return &challenge, 0, ""
+}
+
+// SetupMFAChallenge starts TOTP enrolment during login when the tenant requires 2FA and the user has none yet
+func SetupMFAChallenge(c echo.Context) error {
+	req := new(models.MFAChallengeRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	challenge, status, message := getMFAChallenge(db.DB, req.MFAToken, false)
+	if challenge == nil {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+
+	setup, status, message := startTOTPEnrolment(challenge.UserID)
+	if setup == nil {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+	return c.JSON(http.StatusOK, setup)
+}
+
+// VerifyMFAChallenge completes login with a TOTP or recovery code and returns the same token response as Login.
+// When the challenge was issued for enrolment, the code also activates 2FA and the response includes recovery codes.
+func VerifyMFAChallenge(c echo.Context) error {
+	req := new(models.MFAChallengeRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	if req.MFAToken == "" || req.Code == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "mfa_token and code are required"})
+	}
+
+	tx, err := db.DB.Beginx()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
+	}
+	defer tx.Rollback()
+
+	challenge, status, message := getMFAChallenge(tx, req.MFAToken, true)
+	if challenge == nil {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+
+	var enabled bool
+	if err := tx.Get(&enabled, `SELECT totp_enabled_at IS NOT NULL FROM users WHERE id = $1`, challenge.UserID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	var recoveryCodes []string
+	verified := false
+	if enabled {
+		verified, err = verifySecondFactor(tx, challenge.UserID, req.Code)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+	} else {
+		var codeStatus int
+		recoveryCodes, codeStatus, message = activateTOTP(tx, challenge.UserID, req.Code)
+		if codeStatus != 0 && codeStatus != http.StatusUnauthorized {
+			return c.JSON(codeStatus, map[string]string{"error": message})
+		}
+		verified = codeStatus == 0
+	}
+
+	if !verified {
+		tx.Rollback()
+		db.DB.Exec(`UPDATE mfa_challenges SET attempts = attempts + 1 WHERE id = $1`, challenge.ID)
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error":              "Invalid code",
+			"attempts_remaining": mfaMaxAttempts - challenge.Attempts - 1,
+		})
+	}
+
+	if _, err = tx.Exec(`UPDATE mfa_challenges SET consumed_at = NOW() WHERE id = $1`, challenge.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if err = tx.Commit(); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit transaction"})
+	}
+
+	var user models.User
+	err = db.DB.QueryRow(`
+		SELECT id, email, full_name FROM users WHERE id = $1 AND deleted_at IS NULL AND status = 'active'
+	`, challenge.UserID).Scan(&user.ID, &user.Email, &user.FullName)
+	if err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "User account is inactive"})
+	}
+
+	tenantIDs, err := activeTenantIDs(user.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get user tenants"})
+	}
+	member := false
+	for _, tid := range tenantIDs {
+		if tid == challenge.TenantID {
+			member = true
+			break
+		}
+	}
+	if !member {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "User is not a member of the specified tenant"})
+	}
+
+	status, response := sessionLoginResponse(c, user, challenge.TenantID, tenantIDs)
+	if recoveryCodes != nil && status == http.StatusOK {
+		response["recovery_codes"] = recoveryCodes
+	}
+	return c.JSON(status, response)
+}
+
+// GetTwoFactorStatus returns the current user's 2FA state
+func GetTwoFactorStatus(c echo.Context) error {
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+
+	var state struct {
+		EnabledAt sql.NullTime `db:"totp_enabled_at"`
+		Remaining int          `db:"remaining"`
+	}
+	err := db.DB.Get(&state, `
+		SELECT u.totp_enabled_at,
+		       (SELECT COUNT(*) FROM user_recovery_codes rc WHERE rc.user_id = u.id AND rc.used_at IS NULL) as remaining
+		FROM users u WHERE u.id = $1
+	`, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	required, err := requires2FAByTenant(db.DB, userID, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	response := map[string]interface{}{
+		"enabled":                  state.EnabledAt.Valid,
+		"required_by_tenant":       required,
+		"recovery_codes_remaining": state.Remaining,
+	}
+	if state.EnabledAt.Valid {
+		response["enabled_at"] = state.EnabledAt.Time
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// SetupTwoFactor starts TOTP enrolment for the current user
+func SetupTwoFactor(c echo.Context) error {
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+
+	setup, status, message := startTOTPEnrolment(userID)
+	if setup == nil {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+	return c.JSON(http.StatusOK, setup)
+}
+
+// EnableTwoFactor confirms enrolment with a code from the authenticator app
+func EnableTwoFactor(c echo.Context) error {
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+
+	req := new(models.TwoFactorCodeRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	tx, err := db.DB.Beginx()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
+	}
+	defer tx.Rollback()
+
+	codes, status, message := activateTOTP(tx, userID, req.Code)
+	if status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+	if err = tx.Commit(); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit transaction"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":        "Two-factor authentication enabled. Store the recovery codes somewhere safe; they are shown only once.",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor turns 2FA off after checking a current code. Not allowed when the tenant requires 2FA for the user's role.
+func DisableTwoFactor(c echo.Context) error {
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+
+	req := new(models.TwoFactorCodeRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	required, err := requires2FAByTenant(db.DB, userID, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if required {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Two-factor authentication is required for your role in this RT"})
+	}
+
+	tx, err := db.DB.Beginx()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
+	}
+	defer tx.Rollback()
+
+	ok, err := verifySecondFactor(tx, userID, req.Code)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid code"})
+	}
+
+	_, err = tx.Exec(`
+		UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL, updated_at = NOW()
+		WHERE id = $1
+	`, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to disable two-factor authentication"})
+	}
+	if _, err = tx.Exec(`DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete recovery codes"})
+	}
+	if err = tx.Commit(); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit transaction"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes after checking a current code
+func RegenerateRecoveryCodes(c echo.Context) error {
+	userID := c.Get(string(middleware.CtxUserID)).(string)
+
+	req := new(models.TwoFactorCodeRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+
+	tx, err := db.DB.Beginx()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
+	}
+	defer tx.Rollback()
+
+	ok, err := verifySecondFactor(tx, userID, req.Code)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid code"})
+	}
+
+	codes, err := newRecoveryCodes(tx, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate recovery codes"})
+	}
+	if err = tx.Commit(); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit transaction"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
+
+// GetTenantSecuritySettings returns the tenant's security settings
+func GetTenantSecuritySettings(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+
+	settings, err := services.LoadTenantSettings(tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	return c.JSON(http.StatusOK, settings.Security)
+}
+
+// UpdateTenantSecuritySettings sets which roles must use two-factor authentication
+func UpdateTenantSecuritySettings(c echo.Context) error {
+	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	userID, _ := c.Get(string(middleware.CtxUserID)).(string)
+
+	req := new(models.TenantSecuritySettings)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
+	}
+	if req.Require2FARoleIDs == nil {
+		req.Require2FARoleIDs = []string{}
+	}
+
+	// Security settings are part of the tenant settings document and share its history
+	tx, err := middleware.TenantDB(c).Beginx()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
+	}
+	defer tx.Rollback()
+
+	if status, message := validateRequire2FARoles(tx, tenantID, req.Require2FARoleIDs); status != 0 {
+		return c.JSON(status, map[string]string{"error": message})
+	}
+
+	previous, err := lockTenantSettings(tx, tenantID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update settings"})
+	}
+	next := previous
+	next.Security = *req
+	if err := saveTenantSettings(tx, tenantID, userID, previous, next); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update settings"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update settings"})
+	}
+
+	return c.JSON(http.StatusOK, req)
+}
@@ -4,9 +4,9 @@ import (
 	"database/sql"
 	"net/http"
 	"strconv"
-	"rukunos-backend/db"
 	"rukunos-backend/middleware"
 	"rukunos-backend/models"
+	"rukunos-backend/services"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -15,6 +15,7 @@ import (
 // CreateUnit creates a new unit
 func CreateUnit(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 
 	req := new(models.CreateUnitRequest)
 	if err := c.Bind(req); err != nil {
@@ -29,9 +30,15 @@ func CreateUnit(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Type is required"})
 	}
 
+	tx, err := tdb.Beginx()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
+	}
+	defer tx.Rollback()
+
 	// Check if unit code already exists in tenant
 	var exists bool
-	err := db.DB.Get(&exists, `
+	err = tx.Get(&exists, `
 		SELECT EXISTS(
 			SELECT 1 FROM units 
 			WHERE tenant_id = $1 AND code = $2 AND deleted_at IS NULL
@@ -44,6 +51,11 @@ func CreateUnit(c echo.Context) error {
 		return c.JSON(http.StatusConflict, map[string]string{"error": "Unit code already exists"})
 	}
 
+	quota, err := services.CheckQuota(tx, tenantID, services.QuotaUnits, 1)
+	if err != nil {
+		return quotaErrorResponse(c, err)
+	}
+
 	// Create unit
 	unitID := uuid.New().String()
 	query := `INSERT INTO units (id, tenant_id, code, type, owner_name, owner_phone, owner_email, address, status)
@@ -51,19 +63,24 @@ func CreateUnit(c echo.Context) error {
 	          RETURNING id, tenant_id, code, type, owner_name, owner_phone, owner_email, address, status, created_at, updated_at`
 	
 	var unit models.Unit
-	err = db.DB.QueryRow(query, unitID, tenantID, req.Code, req.Type, req.OwnerName, req.OwnerPhone, req.OwnerEmail, req.Address).Scan(
+	err = tx.QueryRowx(query, unitID, tenantID, req.Code, req.Type, req.OwnerName, req.OwnerPhone, req.OwnerEmail, req.Address).Scan(
 		&unit.ID, &unit.TenantID, &unit.Code, &unit.Type, &unit.OwnerName, &unit.OwnerPhone, 
 		&unit.OwnerEmail, &unit.Address, &unit.Status, &unit.CreatedAt, &unit.UpdatedAt)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create unit: " + err.Error()})
 	}
+	if err = tx.Commit(); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit transaction"})
+	}
 
+	setQuotaWarning(c, quota, 1)
 	return c.JSON(http.StatusCreated, unit)
 }
 
 // ListUnits lists all units with pagination and filters
 func ListUnits(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 
 	// Parse query parameters
 	page, _ := strconv.Atoi(c.QueryParam("page"))
@@ -83,51 +100,24 @@ func ListUnits(c echo.Context) error {
 	query := `SELECT id, tenant_id, code, type, owner_name, owner_phone, owner_email, address, status, created_at, updated_at
 	          FROM units
 	          WHERE tenant_id = $1 AND deleted_at IS NULL`
-	args := []interface{}{tenantID}
-	argIndex := 2
-
-	if unitType != "" {
-		query += ` AND type = $` + strconv.Itoa(argIndex)
-		args = append(args, unitType)
-		argIndex++
-	}
-
-	if search != "" {
-		query += ` AND (code ILIKE $` + strconv.Itoa(argIndex) + ` OR owner_name ILIKE $` + strconv.Itoa(argIndex) + `)`
-		searchPattern := "%" + search + "%"
-		args = append(args, searchPattern)
-		argIndex++
-	}
+	query, args := appendUnitFilters(query, []interface{}{tenantID}, unitType, search)
+	argIndex := len(args) + 1
 
 	query += ` ORDER BY code ASC LIMIT $` + strconv.Itoa(argIndex) + ` OFFSET $` + strconv.Itoa(argIndex+1)
 	args = append(args, limit, offset)
 
 	var units []models.Unit
-	err := db.DB.Select(&units, query, args...)
+	err := tdb.Select(&units, query, args...)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch units: " + err.Error()})
 	}
 
 	// Get total count
 	countQuery := `SELECT COUNT(*) FROM units WHERE tenant_id = $1 AND deleted_at IS NULL`
-	countArgs := []interface{}{tenantID}
-	if unitType != "" {
-		countQuery += ` AND type = $2`
-		countArgs = append(countArgs, unitType)
-	}
-	if search != "" {
-		searchPattern := "%" + search + "%"
-		if unitType != "" {
-			countQuery += ` AND (code ILIKE $3 OR owner_name ILIKE $3)`
-			countArgs = append(countArgs, searchPattern)
-		} else {
-			countQuery += ` AND (code ILIKE $2 OR owner_name ILIKE $2)`
-			countArgs = append(countArgs, searchPattern)
-		}
-	}
+	countQuery, countArgs := appendUnitFilters(countQuery, []interface{}{tenantID}, unitType, search)
 
 	var total int
-	err = db.DB.Get(&total, countQuery, countArgs...)
+	err = tdb.Get(&total, countQuery, countArgs...)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to count units"})
 	}
@@ -145,13 +135,27 @@ func ListUnits(c echo.Context) error {
 	})
 }
 
+// appendUnitFilters adds the ListUnits filters (type, search) to a query over units
+func appendUnitFilters(query string, args []interface{}, unitType, search string) (string, []interface{}) {
+	if unitType != "" {
+		args = append(args, unitType)
+		query += ` AND type = $` + strconv.Itoa(len(args))
+	}
+	if search != "" {
+		args = append(args, "%"+search+"%")
+		query += ` AND (code ILIKE $` + strconv.Itoa(len(args)) + ` OR owner_name ILIKE $` + strconv.Itoa(len(args)) + `)`
+	}
+	return query, args
+}
+
 // GetUnit gets a unit by ID with assigned users
 func GetUnit(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	unitID := c.Param("unit_id")
 
 	var unit models.Unit
-	err := db.DB.Get(&unit, `
+	err := tdb.Get(&unit, `
 		SELECT id, tenant_id, code, type, owner_name, owner_phone, owner_email, address, status, created_at, updated_at
 		FROM units
 		WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
@@ -164,7 +168,7 @@ func GetUnit(c echo.Context) error {
 
 	// Get users assigned to this unit
 	var users []map[string]interface{}
-	rows, err := db.DB.Query(`
+	rows, err := tdb.Query(`
 		SELECT 
 			u.id, u.email, u.full_name, u.phone, u.avatar_url, u.status,
 			tu.role_id, tu.status as tenant_user_status
@@ -204,7 +208,7 @@ func GetUnit(c echo.Context) error {
 			// Get role info
 			if roleID.Valid {
 				var roleName string
-				err = db.DB.QueryRow(`
+				err = tdb.QueryRow(`
 					SELECT name FROM roles 
 					WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
 				`, roleID.String, tenantID).Scan(&roleName)
@@ -240,6 +244,7 @@ func GetUnit(c echo.Context) error {
 // UpdateUnit updates a unit
 func UpdateUnit(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	unitID := c.Param("unit_id")
 
 	req := new(models.UpdateUnitRequest)
@@ -249,7 +254,7 @@ func UpdateUnit(c echo.Context) error {
 
 	// Check if unit exists
 	var exists bool
-	err := db.DB.Get(&exists, `
+	err := tdb.Get(&exists, `
 		SELECT EXISTS(
 			SELECT 1 FROM units 
 			WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
@@ -265,7 +270,7 @@ func UpdateUnit(c echo.Context) error {
 	// Check if code already exists (if updating code)
 	if req.Code != nil {
 		var codeExists bool
-		err = db.DB.Get(&codeExists, `
+		err = tdb.Get(&codeExists, `
 			SELECT EXISTS(
 				SELECT 1 FROM units 
 				WHERE tenant_id = $1 AND code = $2 AND id != $3 AND deleted_at IS NULL
@@ -341,7 +346,7 @@ func UpdateUnit(c echo.Context) error {
 	          RETURNING id, tenant_id, code, type, owner_name, owner_phone, owner_email, address, status, created_at, updated_at`
 
 	var unit models.Unit
-	err = db.DB.QueryRow(query, args...).Scan(
+	err = tdb.QueryRow(query, args...).Scan(
 		&unit.ID, &unit.TenantID, &unit.Code, &unit.Type, &unit.OwnerName, &unit.OwnerPhone,
 		&unit.OwnerEmail, &unit.Address, &unit.Status, &unit.CreatedAt, &unit.UpdatedAt)
 	if err != nil {
@@ -354,11 +359,12 @@ func UpdateUnit(c echo.Context) error {
 // DeleteUnit soft deletes a unit
 func DeleteUnit(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	unitID := c.Param("unit_id")
 
 	// Check if unit exists
 	var exists bool
-	err := db.DB.Get(&exists, `
+	err := tdb.Get(&exists, `
 		SELECT EXISTS(
 			SELECT 1 FROM units 
 			WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
@@ -372,7 +378,7 @@ func DeleteUnit(c echo.Context) error {
 	}
 
 	// Soft delete
-	_, err = db.DB.Exec(`
+	_, err = tdb.Exec(`
 		UPDATE units 
 		SET deleted_at = NOW(), updated_at = NOW()
 		WHERE id = $1 AND tenant_id = $2
@@ -387,6 +393,7 @@ func DeleteUnit(c echo.Context) error {
 // AssignUserToUnit assigns a user to a unit
 func AssignUserToUnit(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	unitID := c.Param("unit_id")
 
 	var req struct {
@@ -398,7 +405,7 @@ func AssignUserToUnit(c echo.Context) error {
 
 	// Verify unit exists and belongs to tenant
 	var unitExists bool
-	err := db.DB.Get(&unitExists, `
+	err := tdb.Get(&unitExists, `
 		SELECT EXISTS(
 			SELECT 1 FROM units 
 			WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
@@ -413,7 +420,7 @@ func AssignUserToUnit(c echo.Context) error {
 
 	// Verify user exists and is member of tenant
 	var userExists bool
-	err = db.DB.Get(&userExists, `
+	err = tdb.Get(&userExists, `
 		SELECT EXISTS(
 			SELECT 1 FROM tenant_users 
 			WHERE user_id = $1 AND tenant_id = $2 AND deleted_at IS NULL AND status = 'active'
@@ -427,7 +434,7 @@ func AssignUserToUnit(c echo.Context) error {
 	}
 
 	// Update tenant_users with unit_id
-	_, err = db.DB.Exec(`
+	_, err = tdb.Exec(`
 		UPDATE tenant_users 
 		SET unit_id = $1, updated_at = NOW()
 		WHERE user_id = $2 AND tenant_id = $3
@@ -5,8 +5,8 @@ import (
 	"net/http"
 	"strconv"
 	"time"
-	"rukunos-backend/db"
 	"rukunos-backend/middleware"
+	"rukunos-backend/services"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -16,6 +16,7 @@ import (
 // ListUsers lists all users in a tenant with pagination and filters
 func ListUsers(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 
 	// Parse query parameters
 	page, _ := strconv.Atoi(c.QueryParam("page"))
@@ -44,32 +45,13 @@ func ListUsers(c echo.Context) error {
 		AND u.deleted_at IS NULL 
 		AND tu.deleted_at IS NULL`
 	
-	args := []interface{}{tenantID}
-	argIndex := 2
-
-	if roleID != "" {
-		query += ` AND tu.role_id = $` + strconv.Itoa(argIndex)
-		args = append(args, roleID)
-		argIndex++
-	}
-
-	if unitID != "" {
-		query += ` AND tu.unit_id = $` + strconv.Itoa(argIndex)
-		args = append(args, unitID)
-		argIndex++
-	}
-
-	if search != "" {
-		query += ` AND (u.email ILIKE $` + strconv.Itoa(argIndex) + ` OR u.full_name ILIKE $` + strconv.Itoa(argIndex) + `)`
-		searchPattern := "%" + search + "%"
-		args = append(args, searchPattern)
-		argIndex++
-	}
+	query, args := appendUserFilters(query, []interface{}{tenantID}, roleID, unitID, search)
+	argIndex := len(args) + 1
 
 	query += ` ORDER BY u.created_at DESC LIMIT $` + strconv.Itoa(argIndex) + ` OFFSET $` + strconv.Itoa(argIndex+1)
 	args = append(args, limit, offset)
 
-	rows, err := db.DB.Query(query, args...)
+	rows, err := tdb.Query(query, args...)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch users: " + err.Error()})
 	}
@@ -112,7 +94,7 @@ func ListUsers(c echo.Context) error {
 		if roleIDFromDB.Valid {
 			var roleName string
 			var roleDescription sql.NullString
-			err = db.DB.QueryRow(`
+			err = tdb.QueryRow(`
 				SELECT name, description FROM roles 
 				WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
 			`, roleIDFromDB.String, tenantID).Scan(&roleName, &roleDescription)
@@ -131,7 +113,7 @@ func ListUsers(c echo.Context) error {
 		// Get unit info
 		if unitID.Valid {
 			var unitCode, unitType string
-			err = db.DB.QueryRow(`
+			err = tdb.QueryRow(`
 				SELECT code, type FROM units 
 				WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
 			`, unitID.String, tenantID).Scan(&unitCode, &unitType)
@@ -155,27 +137,10 @@ func ListUsers(c echo.Context) error {
 		WHERE tu.tenant_id = $1 
 		AND u.deleted_at IS NULL 
 		AND tu.deleted_at IS NULL`
-	countArgs := []interface{}{tenantID}
-	
-	countArgIndex := 2
-	if roleID != "" {
-		countQuery += ` AND tu.role_id = $` + strconv.Itoa(countArgIndex)
-		countArgs = append(countArgs, roleID)
-		countArgIndex++
-	}
-	if unitID != "" {
-		countQuery += ` AND tu.unit_id = $` + strconv.Itoa(countArgIndex)
-		countArgs = append(countArgs, unitID)
-		countArgIndex++
-	}
-	if search != "" {
-		searchPattern := "%" + search + "%"
-		countQuery += ` AND (u.email ILIKE $` + strconv.Itoa(countArgIndex) + ` OR u.full_name ILIKE $` + strconv.Itoa(countArgIndex) + `)`
-		countArgs = append(countArgs, searchPattern)
-	}
+	countQuery, countArgs := appendUserFilters(countQuery, []interface{}{tenantID}, roleID, unitID, search)
 
 	var total int
-	err = db.DB.Get(&total, countQuery, countArgs...)
+	err = tdb.Get(&total, countQuery, countArgs...)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to count users"})
 	}
@@ -193,9 +158,27 @@ func ListUsers(c echo.Context) error {
 	})
 }
 
+// appendUserFilters adds the ListUsers filters (role, unit, search) to a query over "users u INNER JOIN tenant_users tu"
+func appendUserFilters(query string, args []interface{}, roleID, unitID, search string) (string, []interface{}) {
+	if roleID != "" {
+		args = append(args, roleID)
+		query += ` AND tu.role_id = $` + strconv.Itoa(len(args))
+	}
+	if unitID != "" {
+		args = append(args, unitID)
+		query += ` AND tu.unit_id = $` + strconv.Itoa(len(args))
+	}
+	if search != "" {
+		args = append(args, "%"+search+"%")
+		query += ` AND (u.email ILIKE $` + strconv.Itoa(len(args)) + ` OR u.full_name ILIKE $` + strconv.Itoa(len(args)) + `)`
+	}
+	return query, args
+}
+
 // GetUser gets a user by ID with role and unit info
 func GetUser(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Param("user_id")
 
 	// Get user with tenant info
@@ -203,7 +186,7 @@ func GetUser(c echo.Context) error {
 	var phone, avatarURL, roleID, unitID sql.NullString
 	var createdAt, updatedAt sql.NullTime
 	
-	err := db.DB.QueryRow(`
+	err := tdb.QueryRow(`
 		SELECT 
 			u.id, u.email, u.full_name, u.phone, u.avatar_url, u.status, 
 			u.created_at, u.updated_at,
@@ -246,7 +229,7 @@ func GetUser(c echo.Context) error {
 	if roleID.Valid {
 		var roleName string
 		var roleDescription sql.NullString
-		err = db.DB.QueryRow(`
+		err = tdb.QueryRow(`
 			SELECT name, description FROM roles 
 			WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
 		`, roleID.String, tenantID).Scan(&roleName, &roleDescription)
@@ -266,7 +249,7 @@ func GetUser(c echo.Context) error {
 	if unitID.Valid {
 		var unitCode, unitType string
 		var ownerName sql.NullString
-		err = db.DB.QueryRow(`
+		err = tdb.QueryRow(`
 			SELECT code, type, owner_name FROM units 
 			WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
 		`, unitID.String, tenantID).Scan(&unitCode, &unitType, &ownerName)
@@ -295,6 +278,7 @@ func GetUser(c echo.Context) error {
 // UpdateUser updates user role or status in tenant
 func UpdateUser(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Param("user_id")
 
 	var req struct {
@@ -308,7 +292,7 @@ func UpdateUser(c echo.Context) error {
 
 	// Check if user exists and is member of tenant
 	var exists bool
-	err := db.DB.Get(&exists, `
+	err := tdb.Get(&exists, `
 		SELECT EXISTS(
 			SELECT 1 FROM tenant_users 
 			WHERE user_id = $1 AND tenant_id = $2 AND deleted_at IS NULL
@@ -325,7 +309,7 @@ func UpdateUser(c echo.Context) error {
 	if req.RoleID != nil {
 		// Verify role exists and belongs to tenant
 		var roleExists bool
-		err = db.DB.Get(&roleExists, `
+		err = tdb.Get(&roleExists, `
 			SELECT EXISTS(
 				SELECT 1 FROM roles 
 				WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
@@ -338,21 +322,28 @@ func UpdateUser(c echo.Context) error {
 			return c.JSON(http.StatusNotFound, map[string]string{"error": "Role not found"})
 		}
 
-		_, err = db.DB.Exec(`
+		result, err := tdb.Exec(`
 			UPDATE tenant_users 
 			SET role_id = $1, updated_at = NOW()
-			WHERE user_id = $2 AND tenant_id = $3
+			WHERE user_id = $2 AND tenant_id = $3 AND role_id IS DISTINCT FROM $1
 		`, *req.RoleID, userID, tenantID)
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update user role"})
 		}
+
+		// A changed role ends the user's sessions in this tenant
+		if n, _ := result.RowsAffected(); n > 0 {
+			if err := middleware.RevokeUserSessions(tdb, userID, tenantID, middleware.RevokeRoleChanged); err != nil {
+				c.Logger().Warnf("Failed to revoke sessions for user %s: %v", userID, err)
+			}
+		}
 	}
 
 	// Update unit_id if provided
 	if req.UnitID != nil {
 		// If unit_id is empty string, set to NULL (unassign from unit)
 		if *req.UnitID == "" {
-			_, err = db.DB.Exec(`
+			_, err = tdb.Exec(`
 				UPDATE tenant_users 
 				SET unit_id = NULL, updated_at = NOW()
 				WHERE user_id = $1 AND tenant_id = $2
@@ -363,7 +354,7 @@ func UpdateUser(c echo.Context) error {
 		} else {
 			// Verify unit exists and belongs to tenant
 			var unitExists bool
-			err = db.DB.Get(&unitExists, `
+			err = tdb.Get(&unitExists, `
 				SELECT EXISTS(
 					SELECT 1 FROM units 
 					WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
@@ -376,7 +367,7 @@ func UpdateUser(c echo.Context) error {
 				return c.JSON(http.StatusNotFound, map[string]string{"error": "Unit not found"})
 			}
 
-			_, err = db.DB.Exec(`
+			_, err = tdb.Exec(`
 				UPDATE tenant_users 
 				SET unit_id = $1, updated_at = NOW()
 				WHERE user_id = $2 AND tenant_id = $3
@@ -389,7 +380,7 @@ func UpdateUser(c echo.Context) error {
 
 	// Update status if provided
 	if req.Status != nil {
-		_, err = db.DB.Exec(`
+		_, err = tdb.Exec(`
 			UPDATE tenant_users 
 			SET status = $1, updated_at = NOW()
 			WHERE user_id = $2 AND tenant_id = $3
@@ -397,6 +388,12 @@ func UpdateUser(c echo.Context) error {
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update user status"})
 		}
+
+		if *req.Status != "active" {
+			if err := middleware.RevokeUserSessions(tdb, userID, tenantID, middleware.RevokeDeactivated); err != nil {
+				c.Logger().Warnf("Failed to revoke sessions for user %s: %v", userID, err)
+			}
+		}
 	}
 
 	// Return updated user
@@ -407,31 +404,49 @@ func UpdateUser(c echo.Context) error {
 // This is different from Register endpoint - it uses tenant_id from context
 func CreateUserByAdmin(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	
 	var req struct {
 		Email    string  `json:"email" validate:"required,email"`
-		Password string  `json:"password" validate:"required,min=6"`
+		Password *string `json:"password,omitempty" validate:"omitempty,min=6"` // Optional: without it the user is invited to choose one
 		FullName string  `json:"full_name" validate:"required"`
+		Phone    *string `json:"phone,omitempty"` // WhatsApp number, enables OTP login
 		RoleID   *string `json:"role_id,omitempty"`
 		UnitID   *string `json:"unit_id,omitempty"`
 	}
 	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request"})
 	}
+	createdBy := c.Get(string(middleware.CtxUserID)).(string)
 
-	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to hash password"})
+	// Hash password if the admin set one; otherwise the account is created as invited
+	var passwordHash *string
+	userStatus := "invited"
+	if req.Password != nil && *req.Password != "" {
+		if len(*req.Password) < 6 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "password must be at least 6 characters"})
+		}
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to hash password"})
+		}
+		hash := string(hashedPassword)
+		passwordHash = &hash
+		userStatus = "active"
 	}
 
 	// Start transaction
-	tx, err := db.DB.Beginx()
+	tx, err := tdb.Beginx()
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction"})
 	}
 	defer tx.Rollback()
 
+	quota, err := services.CheckQuota(tx, tenantID, services.QuotaUsers, 1)
+	if err != nil {
+		return quotaErrorResponse(c, err)
+	}
+
 	// Check if email already exists
 	var existingUserID string
 	err = tx.Get(&existingUserID, `
@@ -448,13 +463,13 @@ func CreateUserByAdmin(c echo.Context) error {
 
 	// Insert user
 	userID := uuid.New().String()
-	query := `INSERT INTO users (id, email, password_hash, full_name, auth_provider, status) 
-	          VALUES ($1, $2, $3, $4, 'email', 'active') 
+	query := `INSERT INTO users (id, email, password_hash, full_name, phone, auth_provider, status) 
+	          VALUES ($1, $2, $3, $4, $5, 'email', $6) 
 	          RETURNING id, created_at, updated_at`
 	
 	var userIDFromInsert string
 	var userCreatedAt, userUpdatedAt time.Time
-	err = tx.QueryRow(query, userID, req.Email, string(hashedPassword), req.FullName).Scan(&userIDFromInsert, &userCreatedAt, &userUpdatedAt)
+	err = tx.QueryRow(query, userID, req.Email, passwordHash, req.FullName, req.Phone, userStatus).Scan(&userIDFromInsert, &userCreatedAt, &userUpdatedAt)
 	if err != nil {
 		tx.Rollback()
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create user: " + err.Error()})
@@ -499,24 +514,41 @@ func CreateUserByAdmin(c echo.Context) error {
 	// Add user to tenant with assigned role and unit
 	_, err = tx.Exec(`
 		INSERT INTO tenant_users (tenant_id, user_id, role_id, unit_id, status)
-		VALUES ($1, $2, $3, $4, 'active')
-	`, tenantID, userID, roleID, req.UnitID)
+		VALUES ($1, $2, $3, $4, $5)
+	`, tenantID, userID, roleID, req.UnitID, userStatus)
 	if err != nil {
 		tx.Rollback()
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to add user to tenant: " + err.Error()})
 	}
 
+	// Invited users set their own password through the invitation link
+	var invitationToken string
+	if userStatus == "invited" {
+		invitationToken, err = createUserInvitation(tx, tenantID, userID, req.Email, req.UnitID, &roleID, createdBy)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create invitation"})
+		}
+	}
+
 	// Commit transaction
 	if err = tx.Commit(); err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit transaction"})
 	}
 
+	if invitationToken != "" {
+		if err := sendInvitation(tenantID, userID, req.Email, req.FullName, invitationToken); err != nil {
+			c.Logger().Warnf("Failed to send invitation to %s: %v", req.Email, err)
+		}
+	} else if err := sendVerificationEmail(userID, req.Email, req.FullName); err != nil {
+		c.Logger().Warnf("Failed to send verification email to %s: %v", req.Email, err)
+	}
+
 	// Return created user info - get full details
 	var userIDFromDB, email, fullName, status string
 	var phone, avatarURL, roleIDFromDB, unitID sql.NullString
 	var userCreatedAtDB, userUpdatedAtDB time.Time
 	
-	err = db.DB.QueryRow(`
+	err = tdb.QueryRow(`
 		SELECT 
 			u.id, u.email, u.full_name, u.phone, u.avatar_url, u.status, 
 			u.created_at, u.updated_at,
@@ -531,6 +563,7 @@ func CreateUserByAdmin(c echo.Context) error {
 	
 	if err != nil {
 		// If we can't get full details, return basic info
+		setQuotaWarning(c, quota, 1)
 		return c.JSON(http.StatusCreated, map[string]interface{}{
 			"id":        userIDFromInsert,
 			"email":     req.Email,
@@ -559,7 +592,7 @@ func CreateUserByAdmin(c echo.Context) error {
 	if roleIDFromDB.Valid {
 		var roleName string
 		var roleDescription sql.NullString
-		err = db.DB.QueryRow(`
+		err = tdb.QueryRow(`
 			SELECT name, description FROM roles 
 			WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
 		`, roleIDFromDB.String, tenantID).Scan(&roleName, &roleDescription)
@@ -578,7 +611,7 @@ func CreateUserByAdmin(c echo.Context) error {
 	// Get unit info
 	if unitID.Valid {
 		var unitCode, unitType string
-		err = db.DB.QueryRow(`
+		err = tdb.QueryRow(`
 			SELECT code, type FROM units 
 			WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
 		`, unitID.String, tenantID).Scan(&unitCode, &unitType)
@@ -591,17 +624,19 @@ func CreateUserByAdmin(c echo.Context) error {
 		}
 	}
 
+	setQuotaWarning(c, quota, 1)
 	return c.JSON(http.StatusCreated, userData)
 }
 
 // RemoveUserFromTenant removes a user from tenant (soft delete tenant_users)
 func RemoveUserFromTenant(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Param("user_id")
 
 	// Check if user exists and is member of tenant
 	var exists bool
-	err := db.DB.Get(&exists, `
+	err := tdb.Get(&exists, `
 		SELECT EXISTS(
 			SELECT 1 FROM tenant_users 
 			WHERE user_id = $1 AND tenant_id = $2 AND deleted_at IS NULL
@@ -615,7 +650,7 @@ func RemoveUserFromTenant(c echo.Context) error {
 	}
 
 	// Soft delete tenant_users entry
-	_, err = db.DB.Exec(`
+	_, err = tdb.Exec(`
 		UPDATE tenant_users 
 		SET deleted_at = NOW(), updated_at = NOW()
 		WHERE user_id = $1 AND tenant_id = $2
@@ -624,6 +659,11 @@ func RemoveUserFromTenant(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to remove user from tenant"})
 	}
 
+	// End the removed user's sessions in this tenant
+	if err := middleware.RevokeUserSessions(tdb, userID, tenantID, middleware.RevokeRemoved); err != nil {
+		c.Logger().Warnf("Failed to revoke sessions for user %s: %v", userID, err)
+	}
+
 	return c.JSON(http.StatusOK, map[string]string{"message": "User removed from tenant successfully"})
 }
 
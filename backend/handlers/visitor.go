@@ -5,7 +5,6 @@ import (
 	"net/http"
 	"strconv"
 	"time"
-	"rukunos-backend/db"
 	"rukunos-backend/middleware"
 	"rukunos-backend/models"
 
@@ -16,6 +15,7 @@ import (
 // ListVisitorLogs lists all visitor logs for the tenant
 func ListVisitorLogs(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 
 	// Get query parameters
 	page, _ := strconv.Atoi(c.QueryParam("page"))
@@ -69,7 +69,7 @@ func ListVisitorLogs(c echo.Context) error {
 	query += ` ORDER BY v.checked_in_at DESC LIMIT $` + strconv.Itoa(argIndex) + ` OFFSET $` + strconv.Itoa(argIndex+1)
 	args = append(args, limit, offset)
 
-	rows, err := db.DB.Query(query, args...)
+	rows, err := tdb.Query(query, args...)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
 	}
@@ -146,7 +146,7 @@ func ListVisitorLogs(c echo.Context) error {
 		countQuery += ` AND checked_out_at IS NOT NULL`
 	}
 
-	err = db.DB.Get(&total, countQuery, countArgs...)
+	err = tdb.Get(&total, countQuery, countArgs...)
 	if err != nil {
 		total = len(visitors)
 	}
@@ -165,6 +165,7 @@ func ListVisitorLogs(c echo.Context) error {
 // CreateVisitorLog creates a new visitor log entry
 func CreateVisitorLog(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Get(string(middleware.CtxUserID)).(string)
 
 	req := new(models.CreateVisitorLogRequest)
@@ -180,7 +181,7 @@ func CreateVisitorLog(c echo.Context) error {
 	// Validate unit if provided
 	if req.UnitID != nil && *req.UnitID != "" {
 		var unitExists bool
-		err := db.DB.Get(&unitExists, `
+		err := tdb.Get(&unitExists, `
 			SELECT EXISTS(
 				SELECT 1 FROM units 
 				WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
@@ -201,7 +202,7 @@ func CreateVisitorLog(c echo.Context) error {
 
 	var checkedInAt time.Time
 	var returnedID string
-	err := db.DB.QueryRow(query,
+	err := tdb.QueryRow(query,
 		visitorID, tenantID, req.UnitID, req.VisitorName, req.VisitorPhone,
 		req.VisitorIDNumber, req.VisitorVehicle, req.Purpose, req.HostName, req.Notes, userID,
 	).Scan(&returnedID, &checkedInAt)
@@ -219,13 +220,14 @@ func CreateVisitorLog(c echo.Context) error {
 // CheckOutVisitor checks out a visitor
 func CheckOutVisitor(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	userID := c.Get(string(middleware.CtxUserID)).(string)
 	visitorID := c.Param("visitor_id")
 
 	// Check if visitor log exists and is not already checked out
 	var exists bool
 	var alreadyCheckedOut bool
-	err := db.DB.QueryRow(`
+	err := tdb.QueryRow(`
 		SELECT 
 			EXISTS(SELECT 1 FROM visitor_logs WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL),
 			EXISTS(SELECT 1 FROM visitor_logs WHERE id = $1 AND tenant_id = $2 AND checked_out_at IS NOT NULL)
@@ -241,7 +243,7 @@ func CheckOutVisitor(c echo.Context) error {
 	}
 
 	// Update checked_out_at
-	_, err = db.DB.Exec(`
+	_, err = tdb.Exec(`
 		UPDATE visitor_logs 
 		SET checked_out_at = CURRENT_TIMESTAMP, checked_out_by = $1, updated_at = CURRENT_TIMESTAMP
 		WHERE id = $2 AND tenant_id = $3
@@ -258,11 +260,12 @@ func CheckOutVisitor(c echo.Context) error {
 // DeleteVisitorLog deletes a visitor log (soft delete)
 func DeleteVisitorLog(c echo.Context) error {
 	tenantID := c.Get(string(middleware.CtxTenantID)).(string)
+	tdb := middleware.TenantDB(c)
 	visitorID := c.Param("visitor_id")
 
 	// Check if visitor log exists
 	var exists bool
-	err := db.DB.Get(&exists, `
+	err := tdb.Get(&exists, `
 		SELECT EXISTS(
 			SELECT 1 FROM visitor_logs 
 			WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
@@ -276,7 +279,7 @@ func DeleteVisitorLog(c echo.Context) error {
 	}
 
 	// Soft delete
-	_, err = db.DB.Exec(`
+	_, err = tdb.Exec(`
 		UPDATE visitor_logs 
 		SET deleted_at = CURRENT_TIMESTAMP 
 		WHERE id = $1 AND tenant_id = $2
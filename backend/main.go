@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
+	_ "time/tzdata" // Tenant timezones must load even where the image has no zoneinfo
 	"rukunos-backend/db"
 	"rukunos-backend/handlers"
 	customMiddleware "rukunos-backend/middleware"
@@ -16,6 +18,11 @@ import (
 func main() {
 	// Initialize Database
 	db.Init()
+	services.EncryptTOTPSecrets()
+
+	// Register the email channel (SMTP, file or log) and SMS/WhatsApp providers
+	services.InitMailer()
+	services.InitMessaging()
 
 	// Start background scheduler
 	go func() {
@@ -34,6 +41,8 @@ func main() {
 
 func EchoServer() *echo.Echo {
 	e := echo.New()
+	// Client IPs key the rate limits and are recorded on sessions; forwarded headers count only from trusted proxies
+	e.IPExtractor = customMiddleware.IPExtractor()
 
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
@@ -45,9 +54,18 @@ func EchoServer() *echo.Echo {
 	}
 	
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: corsOrigins,
-		AllowMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions},
-		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization},
+		// Tenant subdomains and verified custom domains serve the frontend too
+		AllowOriginFunc: func(origin string) (bool, error) {
+			for _, allowed := range corsOrigins {
+				if origin == allowed {
+					return true, nil
+				}
+			}
+			return customMiddleware.IsTenantOrigin(origin), nil
+		},
+		AllowMethods:  []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions},
+		AllowHeaders:  []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, "X-API-Key", customMiddleware.ChildTenantHeader, customMiddleware.TenantHostHeader},
+		ExposeHeaders: []string{"X-Quota-Warning"},
 	}))
 
 	e.GET("/", func(c echo.Context) error {
@@ -63,37 +81,172 @@ func EchoServer() *echo.Echo {
 		})
 	})
 
+	// Per-IP limits on credential endpoints (brute force and message flooding)
+	loginLimit := customMiddleware.RateLimit(customMiddleware.RateLimitConfig{Name: "login", Limit: 20, Window: 15 * time.Minute})
+	registerLimit := customMiddleware.RateLimit(customMiddleware.RateLimitConfig{Name: "register", Limit: 10, Window: time.Hour})
+	otpLimit := customMiddleware.RateLimit(customMiddleware.RateLimitConfig{Name: "otp", Limit: 20, Window: 15 * time.Minute})
+	secondFactorLimit := customMiddleware.RateLimit(customMiddleware.RateLimitConfig{Name: "2fa", Limit: 20, Window: 15 * time.Minute})
+	recoveryLimit := customMiddleware.RateLimit(customMiddleware.RateLimitConfig{Name: "recovery", Limit: 10, Window: time.Hour})
+	refreshLimit := customMiddleware.RateLimit(customMiddleware.RateLimitConfig{Name: "refresh", Limit: 60, Window: time.Minute})
+
 	// Auth Routes
 	auth := e.Group("/api/auth")
-	auth.POST("/register", handlers.Register)
-	auth.POST("/login", handlers.Login)
+	auth.POST("/register", handlers.Register, registerLimit)
+	auth.POST("/login", handlers.Login, loginLimit)
 	auth.GET("/google", handlers.GetGoogleAuthURL)
 	auth.GET("/google/callback", handlers.GoogleAuthCallback)
+	auth.GET("/oidc/providers", handlers.ListTenantIdentityProviders, customMiddleware.ResolveTenantHost())
+	auth.GET("/oidc/callback", handlers.OIDCCallback, loginLimit)
+	auth.GET("/oidc/:provider_id", handlers.StartOIDCLogin, loginLimit)
+	auth.POST("/refresh", handlers.RefreshToken, refreshLimit)
+	auth.POST("/invitations/accept", handlers.AcceptInvitation, recoveryLimit)
+	auth.GET("/invitations/:token", handlers.GetInvitationPreview, recoveryLimit)
+	auth.POST("/otp/request", handlers.RequestLoginOTP, otpLimit)
+	auth.POST("/otp/verify", handlers.VerifyLoginOTP, otpLimit)
+	auth.POST("/2fa/setup", handlers.SetupMFAChallenge, secondFactorLimit)
+	auth.POST("/2fa/verify", handlers.VerifyMFAChallenge, secondFactorLimit)
+	auth.POST("/password/forgot", handlers.ForgotPassword, recoveryLimit)
+	auth.POST("/password/reset", handlers.ResetPassword, recoveryLimit)
+	auth.POST("/email/verify", handlers.VerifyEmail, recoveryLimit)
+
+	// Public tenant pages (login branding, document verification): the tenant comes from the subdomain or custom domain
+	public := e.Group("/api/public", customMiddleware.ResolveTenantHost())
+	public.GET("/tenant", handlers.GetPublicTenant)
+	public.GET("/documents/:document_id/verify", handlers.VerifyPublicDocument)
 
 	// Public: Create Tenant (for initial setup)
 	e.POST("/api/tenants", handlers.CreateTenant)
 
+	// Platform super-admin console: separate tokens and sessions, every request is audited
+	platform := e.Group("/api/platform", customMiddleware.PlatformAudit())
+	platform.POST("/auth/login", handlers.PlatformLogin, loginLimit)
+
+	console := platform.Group("", customMiddleware.PlatformAuthMiddleware())
+	console.POST("/auth/logout", handlers.PlatformLogout)
+	console.GET("/stats", handlers.GetPlatformStats)
+	console.GET("/tenants", handlers.ListPlatformTenants)
+	console.POST("/tenants/import", handlers.ImportTenantArchive)
+	console.GET("/tenants/:tenant_id", handlers.GetPlatformTenant)
+	console.GET("/tenants/:tenant_id/export", handlers.ExportPlatformTenantArchive)
+	console.POST("/tenants/:tenant_id/deletion", handlers.RequestPlatformTenantDeletion)
+	console.DELETE("/tenants/:tenant_id/deletion", handlers.CancelPlatformTenantDeletion)
+	console.GET("/tenant-deletions", handlers.ListPlatformTenantDeletions)
+	console.GET("/tenant-deletions/:request_id/archive", handlers.DownloadTenantDeletionArchive)
+	console.GET("/tenants/:tenant_id/stats", handlers.GetPlatformTenantStats)
+	console.POST("/tenants/:tenant_id/suspend", handlers.SuspendTenant)
+	console.POST("/tenants/:tenant_id/reactivate", handlers.ReactivateTenant)
+	console.PUT("/tenants/:tenant_id/hierarchy", handlers.SetTenantHierarchy)
+	console.POST("/tenants/:tenant_id/admin-access/reset", handlers.ResetTenantAdminAccess)
+	console.GET("/plans", handlers.ListPlatformPlans)
+	console.GET("/tenants/:tenant_id/plan", handlers.GetPlatformTenantPlan)
+	console.PUT("/tenants/:tenant_id/plan", handlers.ChangeTenantPlan)
+	console.GET("/audit-logs", handlers.ListPlatformAuditLogs)
+
 	// Protected Routes
 	api := e.Group("/api")
+	api.Use(customMiddleware.APIKeyMiddleware())
 	api.Use(customMiddleware.JWTMiddleware())
 	api.Use(customMiddleware.TenantMiddleware())
+	api.Use(customMiddleware.ImpersonationAudit())
 	api.Use(customMiddleware.RequireTenantMembership())
+	api.Use(customMiddleware.RestrictUnverifiedEmail())
+	api.Use(customMiddleware.ModuleMiddleware())
 	
+	// Payments and account security are off-limits while impersonating a warga
+	noImpersonation := customMiddleware.ForbidImpersonation()
+
 	// User routes
 	api.GET("/me", handlers.GetCurrentUser)
+
+	// Session routes
+	api.POST("/auth/logout", handlers.Logout, noImpersonation)
+	api.POST("/auth/logout-all", handlers.LogoutAll, noImpersonation)
+	api.POST("/auth/email/resend-verification", handlers.ResendVerificationEmail, noImpersonation)
+	api.GET("/me/sessions", handlers.ListMySessions, noImpersonation)
+	api.DELETE("/me/sessions/:session_id", handlers.RevokeMySession, noImpersonation)
+
+	// Two-factor authentication routes
+	api.GET("/me/2fa", handlers.GetTwoFactorStatus)
+	api.POST("/me/2fa/setup", handlers.SetupTwoFactor, noImpersonation)
+	api.POST("/me/2fa/enable", handlers.EnableTwoFactor, noImpersonation)
+	api.POST("/me/2fa/disable", handlers.DisableTwoFactor, noImpersonation)
+	api.POST("/me/2fa/recovery-codes", handlers.RegenerateRecoveryCodes, noImpersonation)
+
+	// Google account linking
+	api.POST("/me/google/link", handlers.LinkGoogleAccount, noImpersonation)
+	api.DELETE("/me/google", handlers.UnlinkGoogleAccount, noImpersonation)
+
+	// Tenant switching routes (users who belong to several RTs)
+	api.GET("/me/tenants", handlers.ListMyTenants)
+	api.PUT("/me/default-tenant", handlers.SetDefaultTenant, noImpersonation)
+	api.POST("/auth/switch-tenant", handlers.SwitchTenant, noImpersonation)
+
+	// Impersonation routes ("lihat sebagai warga"); every impersonated request is audited
+	api.POST("/users/:user_id/impersonate", handlers.StartImpersonation, noImpersonation, customMiddleware.RequirePermission("user.impersonate"))
+	api.POST("/impersonation/end", handlers.EndImpersonation)
+	impersonations := api.Group("/impersonations", noImpersonation, customMiddleware.RequirePermission("user.impersonate"))
+	impersonations.GET("", handlers.ListImpersonations)
+	impersonations.GET("/:impersonation_id/requests", handlers.ListImpersonationRequests)
+	impersonations.DELETE("/:impersonation_id", handlers.RevokeImpersonation)
 	
 	// Tenant routes
+	api.GET("/tenants/security", handlers.GetTenantSecuritySettings, customMiddleware.RequirePermission("tenant.settings"))
+	api.PUT("/tenants/security", handlers.UpdateTenantSecuritySettings, customMiddleware.RequirePermission("tenant.settings"))
+	api.GET("/tenants/settings", handlers.GetTenantSettings, customMiddleware.RequirePermission("tenant.settings"))
+	api.PUT("/tenants/settings", handlers.UpdateTenantSettings, customMiddleware.RequirePermission("tenant.settings"))
+	api.GET("/tenants/settings/history", handlers.ListTenantSettingsHistory, customMiddleware.RequirePermission("tenant.settings"))
+	api.GET("/tenants/modules", handlers.ListTenantModules, customMiddleware.RequirePermission("tenant.settings"))
+	api.PUT("/tenants/modules", handlers.UpdateTenantModules, customMiddleware.RequirePermission("tenant.settings"))
+	api.GET("/tenants/export", handlers.ExportTenantArchive, noImpersonation, customMiddleware.RequirePermission("tenant.export"))
+	tenantDomains := api.Group("/tenants/domains", customMiddleware.RequirePermission("tenant.settings"))
+	tenantDomains.GET("", handlers.ListTenantDomains)
+	tenantDomains.POST("", handlers.CreateTenantDomain)
+	tenantDomains.POST("/:domain_id/verify", handlers.VerifyTenantDomain)
+	tenantDomains.DELETE("/:domain_id", handlers.DeleteTenantDomain)
+	api.GET("/tenants/plan", handlers.GetTenantPlan, customMiddleware.RequirePermission("tenant.settings"))
+	api.GET("/tenants/retention", handlers.GetTenantRetention, customMiddleware.RequirePermission("tenant.settings"))
+	api.GET("/tenants/purge-logs", handlers.ListTenantPurgeLogs, customMiddleware.RequirePermission("tenant.settings"))
+	api.GET("/tenants/deletion", handlers.GetTenantDeletion, customMiddleware.RequirePermission("tenant.delete"))
+	api.POST("/tenants/deletion", handlers.RequestTenantDeletion, noImpersonation, customMiddleware.RequirePermission("tenant.delete"))
+	api.DELETE("/tenants/deletion", handlers.CancelTenantDeletion, noImpersonation, customMiddleware.RequirePermission("tenant.delete"))
+	identityProviders := api.Group("/tenants/identity-providers", customMiddleware.RequirePermission("tenant.settings"))
+	identityProviders.GET("", handlers.ListIdentityProviders)
+	identityProviders.POST("", handlers.CreateIdentityProvider)
+	identityProviders.PUT("/:provider_id", handlers.UpdateIdentityProvider)
+	identityProviders.DELETE("/:provider_id", handlers.DeleteIdentityProvider)
 	api.GET("/tenants/:tenant_id", handlers.GetTenant)
 
+	// RW routes (rollups across the RTs of an RW; RT data routes are opened with the X-Child-Tenant-ID header)
+	rw := api.Group("/rw", customMiddleware.RequirePermission("rw.view"))
+	rw.GET("/tenants", handlers.ListRWTenants)
+	rw.GET("/summary", handlers.GetRWSummary)
+
 	// Unit routes
 	units := api.Group("/units")
 	units.POST("", handlers.CreateUnit)
 	units.GET("", handlers.ListUnits)
+	units.GET("/export", handlers.ExportUnits, customMiddleware.RequirePermission("unit.view"))
 	units.GET("/:unit_id", handlers.GetUnit)
 	units.PUT("/:unit_id", handlers.UpdateUnit)
 	units.DELETE("/:unit_id", handlers.DeleteUnit)
 	units.POST("/:unit_id/assign", handlers.AssignUserToUnit)
 
+	// Resident registry routes (family cards and their members, with or without a login)
+	viewResidents := customMiddleware.RequirePermission("resident.view")
+	manageResidents := customMiddleware.RequirePermission("resident.manage")
+	households := api.Group("/households")
+	households.GET("", handlers.ListHouseholds, viewResidents)
+	households.POST("", handlers.CreateHousehold, manageResidents)
+	households.GET("/:household_id", handlers.GetHousehold, viewResidents)
+	households.PUT("/:household_id", handlers.UpdateHousehold, manageResidents)
+	households.DELETE("/:household_id", handlers.DeleteHousehold, manageResidents)
+	residents := api.Group("/residents")
+	residents.GET("", handlers.ListResidents, viewResidents)
+	residents.POST("", handlers.CreateResident, manageResidents)
+	residents.GET("/:resident_id", handlers.GetResident, viewResidents)
+	residents.PUT("/:resident_id", handlers.UpdateResident, manageResidents)
+	residents.DELETE("/:resident_id", handlers.DeleteResident, manageResidents)
+
 	// Role routes
 	roles := api.Group("/roles")
 	roles.POST("", handlers.CreateRole)
@@ -107,22 +260,67 @@ func EchoServer() *echo.Echo {
 	users := api.Group("/users")
 	users.POST("", handlers.CreateUserByAdmin) // Admin create user
 	users.GET("", handlers.ListUsers)
+	users.GET("/export", handlers.ExportUsers, customMiddleware.RequirePermission("user.manage"))
 	users.GET("/:user_id", handlers.GetUser)
 	users.PUT("/:user_id", handlers.UpdateUser)
 	users.DELETE("/:user_id", handlers.RemoveUserFromTenant)
+	users.POST("/:user_id/unlock", handlers.UnlockUser, customMiddleware.RequirePermission("user.manage"))
 
 	// User role assignment (alternative endpoint)
 	api.POST("/users/:user_id/roles", handlers.AssignRoleToUser)
 
+	// Invitation and join request routes
+	invitations := api.Group("/invitations", customMiddleware.RequirePermission("user.manage"))
+	invitations.GET("", handlers.ListInvitations)
+	invitations.POST("", handlers.CreateInvitation)
+	invitations.DELETE("/:invitation_id", handlers.RevokeInvitation)
+
+	joinRequests := api.Group("/join-requests", customMiddleware.RequirePermission("user.manage"))
+	joinRequests.GET("", handlers.ListJoinRequests)
+	joinRequests.POST("/:request_id/approve", handlers.ApproveJoinRequest)
+	joinRequests.POST("/:request_id/reject", handlers.RejectJoinRequest)
+
+	api.POST("/me/invitations/join", handlers.JoinWithInvitation, noImpersonation)
+	api.GET("/me/join-requests", handlers.ListMyJoinRequests)
+	api.POST("/me/join-requests", handlers.CreateJoinRequest, noImpersonation)
+
+	// API key routes (machine integrations; API keys cannot manage API keys)
+	apiKeys := api.Group("/api-keys", noImpersonation, customMiddleware.RequirePermission("tenant.api_keys"))
+	apiKeys.GET("", handlers.ListAPIKeys)
+	apiKeys.POST("", handlers.CreateAPIKey)
+	apiKeys.DELETE("/:key_id", handlers.RevokeAPIKey)
+
+	// Import routes (bulk units/residents from CSV/XLSX)
+	imports := api.Group("/imports", customMiddleware.RequirePermission("tenant.import"))
+	imports.GET("", handlers.ListImportJobs)
+	imports.POST("", handlers.CreateImportJob)
+	imports.GET("/:job_id", handlers.GetImportJob)
+	imports.POST("/:job_id/apply", handlers.ApplyImportJob)
+
 	// Billing routes
 	billing := api.Group("/billing")
 	billing.GET("", handlers.ListBills)
 	billing.POST("", handlers.CreateBill)
 	billing.POST("/bulk", handlers.BulkCreateBills) // Bulk create bills
+	billing.GET("/export", handlers.ExportBills, customMiddleware.RequirePermission("billing.view"))
+	billing.GET("/payments/export", handlers.ExportPayments, customMiddleware.RequirePermission("billing.view"))
 	billing.GET("/:bill_id", handlers.GetBill)
 	billing.PUT("/:bill_id", handlers.UpdateBill)
 	billing.DELETE("/:bill_id", handlers.DeleteBill)
-	billing.POST("/:bill_id/payment", handlers.ProcessPayment)
+	billing.POST("/:bill_id/payment", handlers.ProcessPayment, noImpersonation)
+	billing.GET("/:bill_id/reminders", handlers.ListBillReminders)
+
+	// Billing reminder (dunning) routes
+	reminderRules := api.Group("/billing/reminder-rules", customMiddleware.RequirePermission("billing.reminder.manage"))
+	reminderRules.GET("", handlers.ListBillingReminderRules)
+	reminderRules.POST("", handlers.CreateBillingReminderRule)
+	reminderRules.PUT("/:rule_id", handlers.UpdateBillingReminderRule)
+	reminderRules.DELETE("/:rule_id", handlers.DeleteBillingReminderRule)
+	api.PUT("/me/billing-reminders", handlers.UpdateMyReminderPreference, noImpersonation)
+
+	// Treasurer task routes
+	api.GET("/billing/tasks", handlers.ListTreasurerTasks, customMiddleware.RequirePermission("billing.task.view"))
+	api.PUT("/billing/tasks/:task_id", handlers.UpdateTreasurerTask, customMiddleware.RequirePermission("billing.task.update"))
 
 	// Billing template routes
 	billingTemplates := api.Group("/billing/templates")
@@ -140,6 +338,7 @@ func EchoServer() *echo.Echo {
 	announcements.GET("/:announcement_id", handlers.GetAnnouncement)
 	announcements.PUT("/:announcement_id", handlers.UpdateAnnouncement)
 	announcements.DELETE("/:announcement_id", handlers.DeleteAnnouncement)
+	announcements.POST("/:announcement_id/broadcast", handlers.BroadcastAnnouncement, customMiddleware.RequirePermission("communication.announcement.create"))
 
 	// Visitor routes
 	visitors := api.Group("/visitors")
@@ -151,7 +350,9 @@ func EchoServer() *echo.Echo {
 	// Panic alert routes
 	panicAlerts := api.Group("/panic-alerts")
 	panicAlerts.GET("", handlers.ListPanicAlerts)
-	panicAlerts.POST("", handlers.CreatePanicAlert)
+	panicAlerts.POST("", handlers.CreatePanicAlert, customMiddleware.RateLimit(customMiddleware.RateLimitConfig{
+		Name: "panic", Limit: 5, Window: 10 * time.Minute, KeyFunc: customMiddleware.RateLimitByUser,
+	}))
 	panicAlerts.PUT("/:alert_id", handlers.UpdatePanicAlert)
 
 	// Complaint routes
@@ -170,7 +371,7 @@ func EchoServer() *echo.Echo {
 	documents.PUT("/:request_id", handlers.UpdateDocumentRequest)
 	documents.DELETE("/:request_id", handlers.DeleteDocumentRequest)
 
-	// Family routes (get family members in same unit)
+	// Family routes (family members in the same unit and on the same family card)
 	api.GET("/family", handlers.GetFamilyMembers)
 
 	// Dashboard routes
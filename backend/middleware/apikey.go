@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+	"rukunos-backend/db"
+
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+const CtxAPIKeyID TenantContextKey = "apiKeyID"
+
+// APIKeyPrefix starts every API key, which tells them apart from JWTs in the Authorization header
+const APIKeyPrefix = "rk_"
+
+// apiKeyRoutes lists every route an API key may call, with the permission the key needs for it.
+// Many routes authorize by membership or role name rather than RequirePermission, so keys fail closed:
+// a route missing here (personal-account routes, API keys, tenant administration) is never open to a key.
+var apiKeyRoutes = map[string]string{
+	"GET /api/units":                                    "unit.view",
+	"POST /api/units":                                   "unit.create",
+	"GET /api/units/export":                             "unit.view",
+	"GET /api/units/:unit_id":                           "unit.view",
+	"PUT /api/units/:unit_id":                           "unit.update",
+	"DELETE /api/units/:unit_id":                        "unit.delete",
+	"GET /api/households":                               "resident.view",
+	"POST /api/households":                              "resident.manage",
+	"GET /api/households/:household_id":                 "resident.view",
+	"PUT /api/households/:household_id":                 "resident.manage",
+	"DELETE /api/households/:household_id":              "resident.manage",
+	"GET /api/residents":                                "resident.view",
+	"POST /api/residents":                               "resident.manage",
+	"GET /api/residents/:resident_id":                   "resident.view",
+	"PUT /api/residents/:resident_id":                   "resident.manage",
+	"DELETE /api/residents/:resident_id":                "resident.manage",
+	"GET /api/roles":                                    "role.view",
+	"GET /api/roles/:role_id":                           "role.view",
+	"GET /api/roles/permissions":                        "role.view",
+	"GET /api/users":                                    "user.view",
+	"GET /api/users/:user_id":                           "user.view",
+	"GET /api/billing":                                  "billing.view",
+	"POST /api/billing":                                 "billing.create",
+	"POST /api/billing/bulk":                            "billing.create",
+	"GET /api/billing/export":                           "billing.view",
+	"GET /api/billing/payments/export":                  "billing.view",
+	"GET /api/billing/:bill_id":                         "billing.view",
+	"PUT /api/billing/:bill_id":                         "billing.update",
+	"DELETE /api/billing/:bill_id":                      "billing.delete",
+	"POST /api/billing/:bill_id/payment":                "billing.payment",
+	"GET /api/billing/:bill_id/reminders":               "billing.view",
+	"GET /api/billing/tasks":                            "billing.task.view",
+	"PUT /api/billing/tasks/:task_id":                   "billing.task.update",
+	"GET /api/billing/templates":                        "billing.view",
+	"GET /api/billing/templates/:template_id":           "billing.view",
+	"POST /api/billing/templates/:template_id/generate": "billing.create",
+	"GET /api/billing/dashboard":                        "billing.view",
+	"GET /api/announcements":                            "communication.announcement.view",
+	"POST /api/announcements":                           "communication.announcement.create",
+	"GET /api/announcements/:announcement_id":           "communication.announcement.view",
+	"PUT /api/announcements/:announcement_id":           "communication.announcement.update",
+	"DELETE /api/announcements/:announcement_id":        "communication.announcement.delete",
+	"GET /api/visitors":                                 "security.visitor.view",
+	"POST /api/visitors":                                "security.visitor.create",
+	"POST /api/visitors/:visitor_id/checkout":           "security.visitor.update",
+	"DELETE /api/visitors/:visitor_id":                  "security.visitor.delete",
+	"GET /api/panic-alerts":                             "security.alert.view",
+	"PUT /api/panic-alerts/:alert_id":                   "security.alert.respond",
+}
+
+// apiKeyRoutePermission returns the permission an API key needs for the matched route, or false
+// when keys may not call it at all
+func apiKeyRoutePermission(method, path string) (string, bool) {
+	permission, ok := apiKeyRoutes[method+" "+path]
+	return permission, ok
+}
+
+// apiKeyFromRequest returns the key from "X-API-Key" or "Authorization: Bearer rk_..."
+func apiKeyFromRequest(c echo.Context) string {
+	if key := c.Request().Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	authHeader := c.Request().Header.Get("Authorization")
+	if strings.HasPrefix(authHeader, "Bearer "+APIKeyPrefix) {
+		return strings.TrimPrefix(authHeader, "Bearer ")
+	}
+	return ""
+}
+
+// IsAPIKeyRequest reports whether the request was authenticated with an API key
+func IsAPIKeyRequest(c echo.Context) bool {
+	id, ok := c.Get(string(CtxAPIKeyID)).(string)
+	return ok && id != ""
+}
+
+// APIKeyMiddleware authenticates requests that carry an API key and sets the same context as
+// TenantMiddleware (tenant, acting user, permissions). Requests without a key fall through to JWT.
+// A key's permissions are limited to what its creator can still do in the tenant.
+func APIKeyMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := apiKeyFromRequest(c)
+			if key == "" {
+				return next(c)
+			}
+
+			routePermission, ok := apiKeyRoutePermission(c.Request().Method, c.Path())
+			if !ok {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "This endpoint is not available to API keys"})
+			}
+
+			sum := sha256.Sum256([]byte(key))
+			var apiKey struct {
+				ID          string         `db:"id"`
+				TenantID    string         `db:"tenant_id"`
+				CreatedBy   sql.NullString `db:"created_by"`
+				Permissions pq.StringArray `db:"permissions"`
+				ExpiresAt   sql.NullTime   `db:"expires_at"`
+				RevokedAt   sql.NullTime   `db:"revoked_at"`
+			}
+			err := db.DB.Get(&apiKey, `
+				SELECT k.id, k.tenant_id, k.created_by, k.permissions, k.expires_at, k.revoked_at
+				FROM api_keys k
+				INNER JOIN tenants t ON t.id = k.tenant_id
+				WHERE k.key_hash = $1 AND t.status = 'active' AND t.deleted_at IS NULL
+			`, hex.EncodeToString(sum[:]))
+			if err == sql.ErrNoRows {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid API key"})
+			} else if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to verify API key"})
+			}
+			if apiKey.RevokedAt.Valid {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "API key has been revoked"})
+			}
+			if apiKey.ExpiresAt.Valid && time.Now().After(apiKey.ExpiresAt.Time) {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "API key has expired"})
+			}
+			if !apiKey.CreatedBy.Valid {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "API key owner no longer exists"})
+			}
+
+			creatorPermissions, err := GetUserPermissions(apiKey.CreatedBy.String, apiKey.TenantID)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load permissions"})
+			}
+			allowed := make(map[string]bool, len(creatorPermissions))
+			for _, p := range creatorPermissions {
+				allowed[p] = true
+			}
+			permissions := []string{}
+			for _, p := range apiKey.Permissions {
+				if allowed[p] {
+					permissions = append(permissions, p)
+				}
+			}
+
+			if !hasPermission(permissions, routePermission) {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied: API key lacks permission " + routePermission})
+			}
+
+			// Throttled so busy integrations do not write on every request
+			_, err = db.DB.Exec(`
+				UPDATE api_keys SET last_used_at = NOW(), last_used_ip = $1
+				WHERE id = $2 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+			`, c.RealIP(), apiKey.ID)
+			if err != nil {
+				c.Logger().Warnf("Failed to record API key usage for %s: %v", apiKey.ID, err)
+			}
+
+			c.Set(string(CtxAPIKeyID), apiKey.ID)
+			c.Set(string(CtxTenantID), apiKey.TenantID)
+			c.Set(string(CtxUserID), apiKey.CreatedBy.String)
+			c.Set(string(CtxUserPermissions), permissions)
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"net/http"
+	"rukunos-backend/db"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// ChildTenantHeader lets a user of an RW tenant work on one of its RTs without logging in to it
+const ChildTenantHeader = "X-Child-Tenant-ID"
+
+// CtxParentTenantID is the RW tenant of the token when the request is scoped to one of its RTs
+const CtxParentTenantID TenantContextKey = "parentTenantID"
+
+// childScopedRoutes are the route groups holding RT data that an RW user may open with ChildTenantHeader.
+// Tenant administration (settings, modules, domains, plan, export, deletion, identity providers,
+// API keys, roles, users and impersonation) always stays on the token's own tenant.
+var childScopedRoutes = []string{
+	"/api/units",
+	"/api/households",
+	"/api/residents",
+	"/api/billing",
+	"/api/announcements",
+	"/api/visitors",
+	"/api/panic-alerts",
+	"/api/complaints",
+	"/api/document-requests",
+}
+
+// childScopedRoute reports whether the matched route path may be scoped to an RT
+func childScopedRoute(path string) bool {
+	for _, prefix := range childScopedRoutes {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPermission reports whether key is among the permissions loaded for the request
+func hasPermission(permissions []string, key string) bool {
+	for _, p := range permissions {
+		if p == key {
+			return true
+		}
+	}
+	return false
+}
+
+// scopeToChildTenant switches the request tenant from the token's RW tenant to one of its RTs.
+// It needs rw.view (read-only) or rw.manage (any method); the RW role's permissions keep applying.
+// Only direct children of the token's tenant are reachable, so an RT user can never reach another RT,
+// and only on childScopedRoutes, so the header never turns RW rights into admin rights over the RT.
+func scopeToChildTenant(c echo.Context, parentTenantID, childTenantID string, permissions []string) (int, string) {
+	if !childScopedRoute(c.Path()) {
+		return http.StatusForbidden, "Access denied: this route cannot be opened for an RT"
+	}
+	if !hasPermission(permissions, "rw.view") {
+		return http.StatusForbidden, "Access denied: RW access is required to open RT data"
+	}
+	if c.Request().Method != http.MethodGet && c.Request().Method != http.MethodHead && !hasPermission(permissions, "rw.manage") {
+		return http.StatusForbidden, "Access denied: RT data is read-only for your RW role"
+	}
+	if _, err := uuid.Parse(childTenantID); err != nil {
+		return http.StatusNotFound, "RT not found in this RW"
+	}
+
+	var exists bool
+	err := db.DB.Get(&exists, `
+		SELECT EXISTS(
+			SELECT 1 FROM tenants
+			WHERE id = $1 AND parent_tenant_id = $2 AND status = 'active' AND deleted_at IS NULL
+		)
+	`, childTenantID, parentTenantID)
+	if err != nil {
+		return http.StatusInternalServerError, "Failed to verify RT"
+	}
+	if !exists {
+		return http.StatusNotFound, "RT not found in this RW"
+	}
+
+	c.Set(string(CtxParentTenantID), parentTenantID)
+	c.Set(string(CtxTenantID), childTenantID)
+	c.Set(string(CtxTenantDB), db.ForTenant(childTenantID))
+	return 0, ""
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestChildScopedRoute(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/api/units", true},
+		{"/api/units/:unit_id", true},
+		{"/api/residents/:resident_id", true},
+		{"/api/billing/templates/:template_id/generate", true},
+		{"/api/document-requests/:request_id", true},
+		{"/api/tenants/deletion", false},
+		{"/api/tenants/export", false},
+		{"/api/tenants/settings", false},
+		{"/api/tenants/modules", false},
+		{"/api/tenants/domains", false},
+		{"/api/tenants/plan", false},
+		{"/api/tenants/identity-providers/:provider_id", false},
+		{"/api/api-keys", false},
+		{"/api/roles", false},
+		{"/api/users/:user_id/impersonate", false},
+		{"/api/unitsx", false},
+		{"/api/me", false},
+		{"/api/rw/summary", false},
+	}
+	for _, tt := range tests {
+		if got := childScopedRoute(tt.path); got != tt.want {
+			t.Errorf("childScopedRoute(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestScopeToChildTenantRejectsAdminRoutes(t *testing.T) {
+	e := echo.New()
+	var status int
+	e.DELETE("/api/tenants/deletion", func(c echo.Context) error {
+		// Checked before any database access, so the test needs no database
+		status, _ = scopeToChildTenant(c, "parent", "child", []string{"rw.view", "rw.manage"})
+		return c.NoContent(http.StatusNoContent)
+	})
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/api/tenants/deletion", nil))
+	if status != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d", status, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"database/sql"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"rukunos-backend/db"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TenantHostHeader carries the host of the page when the frontend calls the API from another host (e.g. during SSR)
+const TenantHostHeader = "X-Tenant-Host"
+
+// CtxHostTenantID is the tenant resolved from the request host by ResolveTenantHost
+const CtxHostTenantID TenantContextKey = "hostTenantID"
+
+// reservedSubdomains of the base domain never resolve to a tenant
+var reservedSubdomains = map[string]bool{
+	"www": true, "api": true, "app": true, "admin": true, "platform": true, "mail": true, "status": true,
+}
+
+// TenantBaseDomain is the domain whose subdomains are tenant codes, e.g. rt05.rukunos.id (TENANT_BASE_DOMAIN)
+func TenantBaseDomain() string {
+	if domain := os.Getenv("TENANT_BASE_DOMAIN"); domain != "" {
+		return strings.ToLower(strings.Trim(domain, "."))
+	}
+	return "rukunos.id"
+}
+
+// hostCacheTTL is how long a resolved host is remembered; CORS preflights would otherwise query on every call
+const hostCacheTTL = time.Minute
+
+// hostCacheSize bounds the cache, since unknown hosts are remembered too
+const hostCacheSize = 10000
+
+type hostCacheEntry struct {
+	tenantID string
+	expires  time.Time
+}
+
+var (
+	hostCacheMu sync.Mutex
+	hostCache   = map[string]hostCacheEntry{}
+)
+
+// NormalizeHost lowercases a host and strips its port and trailing dot
+func NormalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(host, ".")
+}
+
+// LookupTenantHost returns the active tenant a host belongs to: <code>.TenantBaseDomain() or a verified
+// custom domain. It returns "" when the host is not a tenant's.
+func LookupTenantHost(host string) (string, error) {
+	host = NormalizeHost(host)
+	if host == "" {
+		return "", nil
+	}
+
+	hostCacheMu.Lock()
+	entry, ok := hostCache[host]
+	hostCacheMu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.tenantID, nil
+	}
+
+	var tenantID string
+	var err error
+	if base := TenantBaseDomain(); strings.HasSuffix(host, "."+base) {
+		code := strings.TrimSuffix(host, "."+base)
+		if strings.Contains(code, ".") || reservedSubdomains[code] {
+			return "", nil
+		}
+		err = db.DB.Get(&tenantID, `
+			SELECT id FROM tenants
+			WHERE LOWER(code) = $1 AND status = 'active' AND deleted_at IS NULL
+		`, code)
+	} else {
+		err = db.DB.Get(&tenantID, `
+			SELECT d.tenant_id FROM tenant_domains d
+			INNER JOIN tenants t ON t.id = d.tenant_id
+			WHERE d.domain = $1 AND d.verified_at IS NOT NULL
+			AND t.status = 'active' AND t.deleted_at IS NULL
+		`, host)
+	}
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	hostCacheMu.Lock()
+	if len(hostCache) >= hostCacheSize {
+		hostCache = map[string]hostCacheEntry{}
+	}
+	hostCache[host] = hostCacheEntry{tenantID: tenantID, expires: time.Now().Add(hostCacheTTL)}
+	hostCacheMu.Unlock()
+	return tenantID, nil
+}
+
+// ForgetTenantHost drops a host from the cache, e.g. after its custom domain was removed
+func ForgetTenantHost(host string) {
+	hostCacheMu.Lock()
+	delete(hostCache, NormalizeHost(host))
+	hostCacheMu.Unlock()
+}
+
+// requestTenantHost is the host of the page the request comes from: X-Tenant-Host, the Origin, then the Host
+func requestTenantHost(c echo.Context) string {
+	if host := c.Request().Header.Get(TenantHostHeader); host != "" {
+		return host
+	}
+	if origin := c.Request().Header.Get(echo.HeaderOrigin); origin != "" {
+		if u, err := url.Parse(origin); err == nil && u.Host != "" {
+			return u.Host
+		}
+	}
+	return c.Request().Host
+}
+
+// ResolveTenantHost sets CtxHostTenantID (and a tenant database handle) when the request comes from a tenant's
+// subdomain or custom domain. It never rejects a request; public handlers answer 404 without a tenant.
+func ResolveTenantHost() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			tenantID, err := LookupTenantHost(requestTenantHost(c))
+			if err != nil {
+				c.Logger().Warnf("Failed to resolve tenant host: %v", err)
+			}
+			if tenantID != "" {
+				c.Set(string(CtxHostTenantID), tenantID)
+				c.Set(string(CtxTenantDB), db.ForTenant(tenantID))
+			}
+			return next(c)
+		}
+	}
+}
+
+// IsTenantOrigin reports whether a CORS origin is a tenant's subdomain or verified custom domain
+func IsTenantOrigin(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	tenantID, err := LookupTenantHost(u.Host)
+	return err == nil && tenantID != ""
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"net/http"
+	"rukunos-backend/db"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Set by TenantMiddleware when the access token is an impersonation token. CtxUserID is then the
+// impersonated warga and CtxImpersonatorID the admin behind the request.
+const (
+	CtxImpersonationID TenantContextKey = "impersonationID"
+	CtxImpersonatorID  TenantContextKey = "impersonatorID"
+)
+
+// IsImpersonating reports whether the request was made with an impersonation token
+func IsImpersonating(c echo.Context) bool {
+	id, _ := c.Get(string(CtxImpersonationID)).(string)
+	return id != ""
+}
+
+// isImpersonationActive reports whether the impersonation has not ended or expired and the admin's own
+// session behind it is still active (logging out or losing the role ends the impersonation too)
+func isImpersonationActive(impersonationID, actorID, targetUserID, tenantID string) (bool, error) {
+	var active bool
+	err := db.DB.Get(&active, `
+		SELECT EXISTS(
+			SELECT 1 FROM impersonation_sessions i
+			INNER JOIN user_sessions s ON s.id = i.actor_session_id
+			WHERE i.id = $1 AND i.actor_user_id = $2 AND i.target_user_id = $3 AND i.tenant_id = $4
+			AND i.ended_at IS NULL AND i.expires_at > NOW()
+			AND s.revoked_at IS NULL AND s.expires_at > NOW()
+		)
+	`, impersonationID, actorID, targetUserID, tenantID)
+	return active, err
+}
+
+// ForbidImpersonation blocks sensitive actions (payments, account security) for impersonation tokens
+func ForbidImpersonation() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if IsImpersonating(c) {
+				return c.JSON(http.StatusForbidden, map[string]interface{}{
+					"error":         "Aksi ini tidak tersedia saat melihat sebagai warga lain",
+					"impersonating": true,
+				})
+			}
+			return next(c)
+		}
+	}
+}
+
+// ImpersonationAudit records every request made with an impersonation token, including blocked ones
+func ImpersonationAudit() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !IsImpersonating(c) {
+				return next(c)
+			}
+
+			err := next(c)
+
+			status := c.Response().Status
+			if err != nil {
+				if he, ok := err.(*echo.HTTPError); ok {
+					status = he.Code
+				} else {
+					status = http.StatusInternalServerError
+				}
+			}
+			_, dbErr := db.DB.Exec(`
+				INSERT INTO impersonation_audit_logs (impersonation_id, tenant_id, method, path, query, status_code, ip_address)
+				VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7)
+			`, c.Get(string(CtxImpersonationID)), c.Get(string(CtxTenantID)), c.Request().Method,
+				c.Request().URL.Path, c.Request().URL.RawQuery, status, c.RealIP())
+			if dbErr != nil {
+				c.Logger().Errorf("Failed to write impersonation audit log: %v", dbErr)
+			}
+			return err
+		}
+	}
+}
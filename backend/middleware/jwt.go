@@ -17,6 +17,8 @@ func JWTMiddleware() echo.MiddlewareFunc {
 	config := echojwt.Config{
 		SigningKey: []byte(jwtSecret),
 		ContextKey: "user",
+		// Requests already authenticated by APIKeyMiddleware carry no JWT
+		Skipper: IsAPIKeyRequest,
 		ErrorHandler: func(c echo.Context, err error) error {
 			// Check if token is missing
 			authHeader := c.Request().Header.Get("Authorization")
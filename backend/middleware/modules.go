@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"rukunos-backend/db"
+	"rukunos-backend/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Module is a feature area a tenant can switch on or off in tenants.modules
+type Module struct {
+	Key            string
+	Name           string
+	Description    string
+	DefaultEnabled bool
+	// RoutePrefixes are the /api route groups that belong to the module
+	RoutePrefixes []string
+}
+
+// Modules is the registry of tenant modules; defaults match the tenants.modules column default
+var Modules = []Module{
+	{
+		Key:            "billing",
+		Name:           "Keuangan",
+		Description:    "Tagihan iuran, pembayaran, pengingat dan laporan keuangan",
+		DefaultEnabled: true,
+		RoutePrefixes:  []string{"/api/billing", "/api/me/billing-reminders"},
+	},
+	{
+		Key:            "communication",
+		Name:           "Komunikasi",
+		Description:    "Pengumuman dan pengaduan warga",
+		DefaultEnabled: true,
+		RoutePrefixes:  []string{"/api/announcements", "/api/complaints"},
+	},
+	{
+		Key:            "administration",
+		Name:           "Administrasi",
+		Description:    "Permohonan surat pengantar dan dokumen",
+		DefaultEnabled: false,
+		RoutePrefixes:  []string{"/api/document-requests"},
+	},
+	{
+		Key:            "security",
+		Name:           "Keamanan",
+		Description:    "Buku tamu dan tombol darurat",
+		DefaultEnabled: false,
+		RoutePrefixes:  []string{"/api/visitors", "/api/panic-alerts"},
+	},
+}
+
+// FindModule returns the registered module with the given key
+func FindModule(key string) (Module, bool) {
+	for _, m := range Modules {
+		if m.Key == key {
+			return m, true
+		}
+	}
+	return Module{}, false
+}
+
+// moduleForPath returns the module owning a route path, matching whole path segments only
+func moduleForPath(path string) (Module, bool) {
+	for _, m := range Modules {
+		for _, prefix := range m.RoutePrefixes {
+			if path == prefix || strings.HasPrefix(path, prefix+"/") {
+				return m, true
+			}
+		}
+	}
+	return Module{}, false
+}
+
+// GetTenantModules returns every registered module with whether the tenant has it enabled.
+// Keys missing from tenants.modules fall back to the registry default; modules outside the tenant's plan are off.
+func GetTenantModules(tenantID string) (map[string]bool, error) {
+	var raw []byte
+	err := db.DB.Get(&raw, `SELECT COALESCE(modules, '{}'::jsonb) FROM tenants WHERE id = $1`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	stored := map[string]bool{}
+	if err := json.Unmarshal(raw, &stored); err != nil {
+		return nil, err
+	}
+	plan, err := services.TenantPlan(db.DB, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	modules := make(map[string]bool, len(Modules))
+	for _, m := range Modules {
+		enabled, ok := stored[m.Key]
+		if !ok {
+			enabled = m.DefaultEnabled
+		}
+		modules[m.Key] = enabled && services.PlanAllowsModule(plan, m.Key)
+	}
+	return modules, nil
+}
+
+// ModuleMiddleware rejects requests to routes of a module the tenant has disabled.
+// It must run after TenantMiddleware so an RW scoped to an RT is checked against the RT's modules.
+func ModuleMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			module, ok := moduleForPath(c.Path())
+			if !ok {
+				return next(c)
+			}
+
+			tenantID, _ := c.Get(string(CtxTenantID)).(string)
+			if tenantID == "" {
+				return next(c)
+			}
+
+			modules, err := GetTenantModules(tenantID)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{
+					"error": "Failed to load tenant modules",
+				})
+			}
+			if !modules[module.Key] {
+				return c.JSON(http.StatusForbidden, map[string]string{
+					"error":  fmt.Sprintf("Modul %s tidak aktif untuk RT ini. Hubungi pengurus untuk mengaktifkannya.", module.Name),
+					"code":   "module_disabled",
+					"module": module.Key,
+				})
+			}
+			return next(c)
+		}
+	}
+}
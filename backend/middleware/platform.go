@@ -0,0 +1,167 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"rukunos-backend/db"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// PlatformTokenAudience marks super-admin console tokens; tenant tokens carry no audience and a tenant_id instead
+const PlatformTokenAudience = "platform"
+
+const (
+	CtxPlatformSessionID TenantContextKey = "platformSessionID"
+	CtxAuditAction       TenantContextKey = "auditAction"
+	CtxAuditDetails      TenantContextKey = "auditDetails"
+	CtxAuditTargetUserID TenantContextKey = "auditTargetUserID"
+)
+
+// PlatformAuditEntry is one row of the platform audit log
+type PlatformAuditEntry struct {
+	ActorUserID    string
+	SessionID      string
+	Action         string
+	Method         string
+	Path           string
+	StatusCode     int
+	TargetTenantID string
+	TargetUserID   string
+	Details        map[string]interface{}
+	IPAddress      string
+	UserAgent      string
+}
+
+// RecordPlatformAudit writes an audit log entry; failures are logged, never returned to the caller
+func RecordPlatformAudit(c echo.Context, entry PlatformAuditEntry) {
+	if entry.Details == nil {
+		entry.Details = map[string]interface{}{}
+	}
+	// A malformed ID in the URL must not make the audit insert fail; keep it in details instead
+	if _, err := uuid.Parse(entry.TargetTenantID); entry.TargetTenantID != "" && err != nil {
+		entry.Details["target_tenant_id"] = entry.TargetTenantID
+		entry.TargetTenantID = ""
+	}
+	if _, err := uuid.Parse(entry.TargetUserID); entry.TargetUserID != "" && err != nil {
+		entry.Details["target_user_id"] = entry.TargetUserID
+		entry.TargetUserID = ""
+	}
+	details, _ := json.Marshal(entry.Details)
+	_, err := db.DB.Exec(`
+		INSERT INTO platform_audit_logs (actor_user_id, actor_email, session_id, action, method, path, status_code,
+		                                 target_tenant_id, target_user_id, details, ip_address, user_agent)
+		VALUES (NULLIF($1, '')::uuid, (SELECT email FROM users WHERE id = NULLIF($1, '')::uuid), NULLIF($2, '')::uuid,
+		        $3, $4, $5, $6, NULLIF($7, '')::uuid, NULLIF($8, '')::uuid, $9, $10, $11)
+	`, entry.ActorUserID, entry.SessionID, entry.Action, entry.Method, entry.Path, entry.StatusCode,
+		entry.TargetTenantID, entry.TargetUserID, details, entry.IPAddress, entry.UserAgent)
+	if err != nil {
+		c.Logger().Errorf("Failed to write platform audit log (%s): %v", entry.Action, err)
+	}
+}
+
+// PlatformAuthMiddleware authenticates super-admin console tokens. It runs instead of the tenant
+// JWT flow: tokens must have the platform audience, an active platform session and a super admin user.
+func PlatformAuthMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			authHeader := c.Request().Header.Get("Authorization")
+			if !strings.HasPrefix(authHeader, "Bearer ") {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Authorization header is missing"})
+			}
+
+			secret := os.Getenv("JWT_SECRET")
+			if secret == "" {
+				secret = "secret" // Default for development only
+			}
+			claims := jwt.MapClaims{}
+			_, err := jwt.ParseWithClaims(strings.TrimPrefix(authHeader, "Bearer "), claims, func(token *jwt.Token) (interface{}, error) {
+				return []byte(secret), nil
+			}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithAudience(PlatformTokenAudience), jwt.WithExpirationRequired())
+			if err != nil {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid platform token"})
+			}
+
+			userID, _ := claims["user_id"].(string)
+			sessionID, _ := claims["sid"].(string)
+			if _, err := uuid.Parse(userID); err != nil {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid platform token"})
+			}
+			if _, err := uuid.Parse(sessionID); err != nil {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid platform token"})
+			}
+			var active bool
+			err = db.DB.Get(&active, `
+				SELECT EXISTS(
+					SELECT 1 FROM platform_sessions s
+					INNER JOIN users u ON u.id = s.user_id
+					WHERE s.id = $1 AND s.user_id = $2 AND s.revoked_at IS NULL AND s.expires_at > NOW()
+					AND u.is_super_admin = true AND u.status = 'active' AND u.deleted_at IS NULL
+				)
+			`, sessionID, userID)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to verify session"})
+			}
+			if !active {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Platform session has expired or been revoked"})
+			}
+
+			c.Set(string(CtxUserID), userID)
+			c.Set(string(CtxPlatformSessionID), sessionID)
+			return next(c)
+		}
+	}
+}
+
+// PlatformAudit records every console request after it is handled. Handlers name the action and add
+// details with CtxAuditAction / CtxAuditDetails / CtxAuditTargetUserID; the default action is "METHOD /path".
+func PlatformAudit() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := next(c)
+
+			action, _ := c.Get(string(CtxAuditAction)).(string)
+			if action == "" {
+				action = c.Request().Method + " " + c.Path()
+			}
+			details, _ := c.Get(string(CtxAuditDetails)).(map[string]interface{})
+			if details == nil {
+				details = map[string]interface{}{}
+			}
+			if query := c.QueryParams(); len(query) > 0 {
+				details["query"] = query
+			}
+			userID, _ := c.Get(string(CtxUserID)).(string)
+			sessionID, _ := c.Get(string(CtxPlatformSessionID)).(string)
+			targetUserID, _ := c.Get(string(CtxAuditTargetUserID)).(string)
+
+			status := c.Response().Status
+			if err != nil {
+				if he, ok := err.(*echo.HTTPError); ok {
+					status = he.Code
+				} else {
+					status = http.StatusInternalServerError
+				}
+			}
+
+			RecordPlatformAudit(c, PlatformAuditEntry{
+				ActorUserID:    userID,
+				SessionID:      sessionID,
+				Action:         action,
+				Method:         c.Request().Method,
+				Path:           c.Request().URL.Path,
+				StatusCode:     status,
+				TargetTenantID: c.Param("tenant_id"),
+				TargetUserID:   targetUserID,
+				Details:        details,
+				IPAddress:      c.RealIP(),
+				UserAgent:      c.Request().UserAgent(),
+			})
+			return err
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"rukunos-backend/ratelimit"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RateLimitConfig describes one limit: at most Limit requests per Window for each key
+type RateLimitConfig struct {
+	Name    string // Namespaces the counters, e.g. "login"
+	Limit   int
+	Window  time.Duration
+	KeyFunc func(c echo.Context) string // Defaults to RateLimitByIP
+	Store   ratelimit.Store             // Defaults to ratelimit.Default()
+}
+
+// IPExtractor decides how c.RealIP() finds the client IP. Without TRUSTED_PROXIES it is the address of the
+// connection, since X-Forwarded-For and X-Real-IP can be set by any client. TRUSTED_PROXIES is a comma-separated
+// list of IPs or CIDR ranges (e.g. 172.16.0.0/12 for a reverse proxy reaching the API through Docker); only
+// X-Forwarded-For entries added by those proxies are skipped to find the client.
+func IPExtractor() echo.IPExtractor {
+	proxies := strings.TrimSpace(os.Getenv("TRUSTED_PROXIES"))
+	if proxies == "" {
+		return echo.ExtractIPDirect()
+	}
+
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, proxy := range strings.Split(proxies, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() == nil {
+				proxy += "/128"
+			} else {
+				proxy += "/32"
+			}
+		}
+		_, ipRange, err := net.ParseCIDR(proxy)
+		if err != nil {
+			log.Fatalf("Invalid TRUSTED_PROXIES entry %q: %v", proxy, err)
+		}
+		options = append(options, echo.TrustIPRange(ipRange))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// RateLimitByIP keys requests by client IP (see IPExtractor)
+func RateLimitByIP(c echo.Context) string {
+	return "ip:" + c.RealIP()
+}
+
+// RateLimitByUser keys requests by authenticated user, falling back to IP
+func RateLimitByUser(c echo.Context) string {
+	if userID, ok := c.Get(string(CtxUserID)).(string); ok && userID != "" {
+		return "user:" + userID
+	}
+	return RateLimitByIP(c)
+}
+
+// RateLimit rejects requests over the configured limit with 429 and a Retry-After header
+func RateLimit(config RateLimitConfig) echo.MiddlewareFunc {
+	if config.KeyFunc == nil {
+		config.KeyFunc = RateLimitByIP
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			store := config.Store
+			if store == nil {
+				store = ratelimit.Default()
+			}
+
+			key := fmt.Sprintf("rl:%s:%s", config.Name, config.KeyFunc(c))
+			count, resetAt, err := store.Incr(key, config.Window)
+			if err != nil {
+				// Fail open: a broken limiter must not take the API down
+				c.Logger().Warnf("Rate limiter unavailable for %s: %v", config.Name, err)
+				return next(c)
+			}
+
+			remaining := config.Limit - count
+			if remaining < 0 {
+				remaining = 0
+			}
+			c.Response().Header().Set("X-RateLimit-Limit", strconv.Itoa(config.Limit))
+			c.Response().Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+
+			if count > config.Limit {
+				retryAfter := int(time.Until(resetAt).Seconds()) + 1
+				c.Response().Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				return c.JSON(http.StatusTooManyRequests, map[string]interface{}{
+					"error":       "Too many requests, please try again later",
+					"retry_after": retryAfter,
+				})
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"rukunos-backend/db"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// CtxSessionID holds the server-side session backing the access token
+const CtxSessionID TenantContextKey = "sessionID"
+
+// Session revocation reasons
+const (
+	RevokeLogout        = "logout"
+	RevokeLogoutAll     = "logout_all"
+	RevokeRoleChanged   = "role_changed"
+	RevokeRemoved       = "removed"
+	RevokeDeactivated   = "deactivated"
+	RevokeTokenReuse    = "token_reuse"
+	RevokeTenantSwitch  = "tenant_switch"
+	RevokePasswordReset = "password_reset"
+)
+
+// isSessionActive reports whether the session exists for this user and tenant and is neither revoked nor expired
+func isSessionActive(sessionID, userID, tenantID string) (bool, error) {
+	var active bool
+	err := db.DB.Get(&active, `
+		SELECT EXISTS(
+			SELECT 1 FROM user_sessions
+			WHERE id = $1 AND user_id = $2 AND tenant_id = $3
+			AND revoked_at IS NULL AND expires_at > NOW()
+		)
+	`, sessionID, userID, tenantID)
+	return active, err
+}
+
+// RevokeUserSessions revokes every active session of a user in a tenant (all tenants when tenantID is empty)
+func RevokeUserSessions(q sqlx.Execer, userID, tenantID, reason string) error {
+	if tenantID == "" {
+		_, err := q.Exec(`
+			UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = $1
+			WHERE user_id = $2 AND revoked_at IS NULL
+		`, reason, userID)
+		return err
+	}
+	_, err := q.Exec(`
+		UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = $1
+		WHERE user_id = $2 AND tenant_id = $3 AND revoked_at IS NULL
+	`, reason, userID, tenantID)
+	return err
+}
@@ -14,11 +14,28 @@ const CtxTenantID TenantContextKey = "tenantID"
 const CtxUserID TenantContextKey = "userID"
 const CtxUserRole TenantContextKey = "userRole"
 const CtxUserPermissions TenantContextKey = "userPermissions"
+const CtxTenantDB TenantContextKey = "tenantDB"
+
+// TenantDB returns the request's database handle, limited to the tenant by row-level security.
+// Outside a tenant request it returns a handle that sees no tenant rows.
+func TenantDB(c echo.Context) *db.TenantDB {
+	if tdb, ok := c.Get(string(CtxTenantDB)).(*db.TenantDB); ok {
+		return tdb
+	}
+	return db.ForTenant("")
+}
 
 // TenantMiddleware extracts tenant_id from JWT and sets it in context
 func TenantMiddleware() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
+			// APIKeyMiddleware has already set the tenant, user and permissions
+			if IsAPIKeyRequest(c) {
+				tenantID, _ := c.Get(string(CtxTenantID)).(string)
+				c.Set(string(CtxTenantDB), db.ForTenant(tenantID))
+				return next(c)
+			}
+
 			// Get user from JWT (set by JWTMiddleware)
 			user := c.Get("user")
 			if user == nil {
@@ -64,11 +81,53 @@ func TenantMiddleware() echo.MiddlewareFunc {
 				})
 			}
 
-			// Set tenant_id in context
+			userID, _ := claims["user_id"].(string)
+			if impersonationID, ok := claims["imp"].(string); ok && impersonationID != "" {
+				// Impersonation tokens have no session of their own; they live as long as the impersonation
+				act, _ := claims["act"].(map[string]interface{})
+				actorID, _ := act["user_id"].(string)
+				active, err := isImpersonationActive(impersonationID, actorID, userID, tenantID)
+				if err != nil {
+					return c.JSON(http.StatusInternalServerError, map[string]string{
+						"error": "Failed to verify impersonation",
+					})
+				}
+				if !active {
+					return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+						"error":         "Impersonation has ended",
+						"impersonating": true,
+					})
+				}
+				c.Set(string(CtxImpersonationID), impersonationID)
+				c.Set(string(CtxImpersonatorID), actorID)
+			} else {
+				// Verify the session behind the token has not been revoked (logout, role change, removal)
+				sessionID, ok := claims["sid"].(string)
+				if !ok || sessionID == "" {
+					return c.JSON(http.StatusUnauthorized, map[string]string{
+						"error": "Session expired, please log in again",
+					})
+				}
+				active, err := isSessionActive(sessionID, userID, tenantID)
+				if err != nil {
+					return c.JSON(http.StatusInternalServerError, map[string]string{
+						"error": "Failed to verify session",
+					})
+				}
+				if !active {
+					return c.JSON(http.StatusUnauthorized, map[string]string{
+						"error": "Session has been revoked, please log in again",
+					})
+				}
+				c.Set(string(CtxSessionID), sessionID)
+			}
+
+			// Set tenant_id in context, and the database handle row-level security limits to it
 			c.Set(string(CtxTenantID), tenantID)
-			
+			c.Set(string(CtxTenantDB), db.ForTenant(tenantID))
+
 			// Set user_id if available
-			if userID, ok := claims["user_id"].(string); ok {
+			if userID != "" {
 				c.Set(string(CtxUserID), userID)
 			}
 
@@ -78,8 +137,9 @@ func TenantMiddleware() echo.MiddlewareFunc {
 			}
 
 			// Fetch and set user permissions for the tenant
+			var permissions []string
 			if userID, ok := claims["user_id"].(string); ok {
-				permissions, err := GetUserPermissions(userID, tenantID)
+				permissions, err = GetUserPermissions(userID, tenantID)
 				if err == nil {
 					c.Set(string(CtxUserPermissions), permissions)
 				} else {
@@ -87,6 +147,13 @@ func TenantMiddleware() echo.MiddlewareFunc {
 				}
 			}
 
+			// RW users may scope the request to one of the RW's RTs
+			if childTenantID := c.Request().Header.Get(ChildTenantHeader); childTenantID != "" {
+				if status, message := scopeToChildTenant(c, tenantID, childTenantID, permissions); status != 0 {
+					return c.JSON(status, map[string]string{"error": message})
+				}
+			}
+
 			return next(c)
 		}
 	}
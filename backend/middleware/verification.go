@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"rukunos-backend/db"
+
+	"github.com/labstack/echo/v4"
+)
+
+// unverifiedAllowedRoutes are the write endpoints an account with an unverified email may still call
+var unverifiedAllowedRoutes = map[string]bool{
+	"/api/auth/logout":                    true,
+	"/api/auth/logout-all":                true,
+	"/api/auth/switch-tenant":             true,
+	"/api/auth/email/resend-verification": true,
+	"/api/me/default-tenant":              true,
+}
+
+// RestrictUnverifiedEmail limits accounts whose email is not verified yet to read-only access
+func RestrictUnverifiedEmail() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			switch c.Request().Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				return next(c)
+			}
+			if unverifiedAllowedRoutes[c.Path()] || strings.HasPrefix(c.Path(), "/api/me/sessions") {
+				return next(c)
+			}
+
+			userID, ok := c.Get(string(CtxUserID)).(string)
+			if !ok || userID == "" {
+				return next(c)
+			}
+
+			var verified bool
+			err := db.DB.Get(&verified, `
+				SELECT email_verified_at IS NOT NULL FROM users WHERE id = $1
+			`, userID)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to verify account"})
+			}
+			if !verified {
+				return c.JSON(http.StatusForbidden, map[string]string{
+					"error": "Email address is not verified",
+					"code":  "email_unverified",
+				})
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+-- Migration: Create Billing Reminder (Dunning) Tables
+-- Description: Per-tenant reminder rules, per-bill reminder log, resident opt-out and treasurer tasks
+-- Date: 2026-10
+
+-- 1. Reminder rules (offset_days relative to due_date: negative = before, 0 = on due date, positive = after)
+CREATE TABLE IF NOT EXISTS billing_reminder_rules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    offset_days INTEGER NOT NULL CHECK (offset_days >= -60 AND offset_days <= 365),
+    channel VARCHAR(50) NOT NULL DEFAULT 'log',
+    message_template TEXT,
+    is_final BOOLEAN DEFAULT false,
+    is_active BOOLEAN DEFAULT true,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_billing_reminder_rules_tenant_offset
+    ON billing_reminder_rules(tenant_id, offset_days) WHERE deleted_at IS NULL;
+
+-- 2. Reminder log (one row per bill per rule, so a rule never fires twice for the same bill)
+CREATE TABLE IF NOT EXISTS bill_reminder_logs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    bill_id UUID NOT NULL REFERENCES bills(id) ON DELETE CASCADE,
+    rule_id UUID NOT NULL REFERENCES billing_reminder_rules(id) ON DELETE CASCADE,
+    channel VARCHAR(50) NOT NULL,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('sent', 'failed', 'skipped')),
+    recipients_count INTEGER DEFAULT 0,
+    error TEXT,
+    sent_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(bill_id, rule_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_bill_reminder_logs_tenant_id ON bill_reminder_logs(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_bill_reminder_logs_bill_id ON bill_reminder_logs(bill_id);
+
+-- 3. Resident opt-out (per tenant membership)
+ALTER TABLE tenant_users
+ADD COLUMN IF NOT EXISTS billing_reminder_opt_out BOOLEAN DEFAULT false;
+
+-- 4. Treasurer task list (escalations after the final reminder)
+CREATE TABLE IF NOT EXISTS treasurer_tasks (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    bill_id UUID REFERENCES bills(id) ON DELETE CASCADE,
+    type VARCHAR(50) NOT NULL DEFAULT 'dunning_escalation',
+    title VARCHAR(255) NOT NULL,
+    description TEXT,
+    status VARCHAR(20) DEFAULT 'open' CHECK (status IN ('open', 'in_progress', 'done', 'dismissed')),
+    resolved_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at TIMESTAMP,
+    notes TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_treasurer_tasks_tenant_status ON treasurer_tasks(tenant_id, status);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_treasurer_tasks_bill_type ON treasurer_tasks(bill_id, type) WHERE bill_id IS NOT NULL;
+
+-- Trigger untuk auto-update updated_at
+DROP TRIGGER IF EXISTS update_billing_reminder_rules_updated_at ON billing_reminder_rules;
+CREATE TRIGGER update_billing_reminder_rules_updated_at
+    BEFORE UPDATE ON billing_reminder_rules
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+DROP TRIGGER IF EXISTS update_treasurer_tasks_updated_at ON treasurer_tasks;
+CREATE TRIGGER update_treasurer_tasks_updated_at
+    BEFORE UPDATE ON treasurer_tasks
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- 5. Permissions
+INSERT INTO permissions (key, name, description, module) VALUES
+('billing.reminder.manage', 'Manage Billing Reminders', 'Mengelola aturan pengingat tagihan', 'billing'),
+('billing.task.view', 'View Treasurer Tasks', 'Melihat daftar tugas bendahara', 'billing'),
+('billing.task.update', 'Update Treasurer Tasks', 'Menyelesaikan tugas bendahara', 'billing')
+ON CONFLICT (key) DO NOTHING;
+
+-- Grant new permissions to existing Admin and Bendahara roles
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+CROSS JOIN permissions p
+WHERE r.name IN ('Admin', 'Bendahara') AND r.is_system = true AND r.deleted_at IS NULL
+AND p.key IN ('billing.reminder.manage', 'billing.task.view', 'billing.task.update')
+ON CONFLICT DO NOTHING;
+
+-- 6. Default reminder rules: H-3, hari H, H+7, H+14, H+30 (final)
+CREATE OR REPLACE FUNCTION create_default_reminder_rules_for_tenant(p_tenant_id UUID)
+RETURNS VOID AS $$
+BEGIN
+    INSERT INTO billing_reminder_rules (tenant_id, name, offset_days, channel, is_final)
+    SELECT p_tenant_id, v.name, v.offset_days, 'log', v.is_final
+    FROM (VALUES
+        ('3 hari sebelum jatuh tempo', -3, false),
+        ('Hari jatuh tempo', 0, false),
+        ('7 hari terlambat', 7, false),
+        ('14 hari terlambat', 14, false),
+        ('30 hari terlambat', 30, true)
+    ) AS v(name, offset_days, is_final)
+    WHERE NOT EXISTS (
+        SELECT 1 FROM billing_reminder_rules
+        WHERE tenant_id = p_tenant_id AND deleted_at IS NULL
+    );
+END;
+$$ LANGUAGE plpgsql;
+
+SELECT create_default_reminder_rules_for_tenant(id) FROM tenants WHERE deleted_at IS NULL;
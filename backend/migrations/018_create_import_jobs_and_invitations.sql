@@ -0,0 +1,62 @@
+-- Migration: Create Import Jobs and Invitations Tables
+-- Description: Spreadsheet import jobs for units/residents and invitations for imported residents
+-- Date: 2026-10
+
+-- 1. Invitations (token is stored hashed; the plain token is only sent to the invitee)
+CREATE TABLE IF NOT EXISTS invitations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE, -- Pre-created invited user (e.g. from import)
+    email VARCHAR(255),
+    unit_id UUID REFERENCES units(id) ON DELETE SET NULL,
+    role_id UUID REFERENCES roles(id) ON DELETE SET NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    accepted_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_invitations_tenant_id ON invitations(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_invitations_user_id ON invitations(user_id) WHERE accepted_at IS NULL;
+
+-- 2. Import jobs
+CREATE TABLE IF NOT EXISTS import_jobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('units', 'residents')),
+    filename VARCHAR(255),
+    status VARCHAR(20) NOT NULL DEFAULT 'validated' CHECK (status IN ('validated', 'applied', 'failed')),
+    total_rows INTEGER DEFAULT 0,
+    valid_rows INTEGER DEFAULT 0,
+    error_rows INTEGER DEFAULT 0,
+    rows JSONB DEFAULT '[]',   -- Parsed rows, kept so a dry run can be applied later
+    report JSONB DEFAULT '[]', -- Row-level validation errors
+    error TEXT,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    applied_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    applied_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_import_jobs_tenant_id ON import_jobs(tenant_id, created_at DESC);
+
+DROP TRIGGER IF EXISTS update_import_jobs_updated_at ON import_jobs;
+CREATE TRIGGER update_import_jobs_updated_at
+    BEFORE UPDATE ON import_jobs
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- 3. Permissions
+INSERT INTO permissions (key, name, description, module) VALUES
+('tenant.import', 'Import Data', 'Impor data unit dan warga dari spreadsheet', 'tenant')
+ON CONFLICT (key) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+CROSS JOIN permissions p
+WHERE r.name = 'Admin' AND r.is_system = true AND r.deleted_at IS NULL
+AND p.key = 'tenant.import'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,6 @@
+-- Migration: Add Default Tenant to Users
+-- Description: Lets users who belong to several RTs choose which tenant they land in after login
+-- Date: 2026-10
+
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS default_tenant_id UUID REFERENCES tenants(id) ON DELETE SET NULL;
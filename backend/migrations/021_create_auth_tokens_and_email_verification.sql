@@ -0,0 +1,22 @@
+-- Migration: Create Auth Tokens and Email Verification
+-- Description: Single-use, time-limited tokens for password reset and email verification
+-- Date: 2026-10
+
+-- 1. Email verification status (existing accounts are treated as verified)
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP;
+
+UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL;
+
+-- 2. Auth tokens (stored hashed; the plain token is only sent by email)
+CREATE TABLE IF NOT EXISTS auth_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose VARCHAR(30) NOT NULL CHECK (purpose IN ('password_reset', 'email_verification')),
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_tokens_user_purpose ON auth_tokens(user_id, purpose) WHERE used_at IS NULL;
@@ -0,0 +1,18 @@
+-- Migration: Create OTP Codes Table
+-- Description: One-time codes for phone (SMS/WhatsApp) login
+-- Date: 2026-10
+
+CREATE TABLE IF NOT EXISTS otp_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    phone VARCHAR(50) NOT NULL, -- Normalised, e.g. 6281234567890
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose VARCHAR(20) NOT NULL DEFAULT 'login',
+    code_hash VARCHAR(64) NOT NULL,
+    channel VARCHAR(50) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    consumed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_otp_codes_phone ON otp_codes(phone, created_at DESC);
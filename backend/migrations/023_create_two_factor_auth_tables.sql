@@ -0,0 +1,34 @@
+-- Migration: Create Two-Factor Authentication Tables
+-- Description: TOTP secrets, recovery codes and pending login challenges
+-- Date: 2026-10
+
+-- 1. TOTP enrolment on users
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS totp_secret VARCHAR(64),      -- Base32 secret (set during enrolment, active once totp_enabled_at is set)
+ADD COLUMN IF NOT EXISTS totp_enabled_at TIMESTAMP,
+ADD COLUMN IF NOT EXISTS totp_last_step BIGINT;        -- Last accepted time step, prevents code replay
+
+-- 2. Recovery codes (stored hashed, shown once)
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_recovery_codes_user_id ON user_recovery_codes(user_id) WHERE used_at IS NULL;
+
+-- 3. Login challenges: password/OAuth step passed, waiting for the second factor
+CREATE TABLE IF NOT EXISTS mfa_challenges (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    consumed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_mfa_challenges_expires_at ON mfa_challenges(expires_at);
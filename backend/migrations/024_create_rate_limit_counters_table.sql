@@ -0,0 +1,11 @@
+-- Migration: Create Rate Limit Counters Table
+-- Description: Shared fixed-window counters for rate limiting and account lockout (RATE_LIMIT_BACKEND=postgres)
+-- Date: 2026-10
+
+CREATE TABLE IF NOT EXISTS rate_limit_counters (
+    key VARCHAR(255) PRIMARY KEY,     -- e.g. rl:login:ip:203.0.113.7, lockout:lock:email:budi@example.com
+    count INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL     -- End of the current window
+);
+
+CREATE INDEX IF NOT EXISTS idx_rate_limit_counters_expires_at ON rate_limit_counters(expires_at);
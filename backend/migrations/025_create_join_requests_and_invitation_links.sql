@@ -0,0 +1,35 @@
+-- Migration: Create Join Requests and Invitation Links
+-- Description: Multi-use shareable invitation links and an approval queue for self-registered warga
+-- Date: 2026-10
+
+-- 1. Invitations: shareable links may be used several times (max_uses NULL = unlimited)
+ALTER TABLE invitations
+ADD COLUMN IF NOT EXISTS max_uses INTEGER DEFAULT 1,
+ADD COLUMN IF NOT EXISTS use_count INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS note VARCHAR(255);   -- Admin label, e.g. "Grup WhatsApp Blok A"
+
+UPDATE invitations SET use_count = 1 WHERE accepted_at IS NOT NULL AND use_count = 0;
+
+-- 2. Join requests (self-registration with the tenant code waits for admin approval)
+CREATE TABLE IF NOT EXISTS join_requests (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    message TEXT,                                                -- e.g. "Penghuni baru Blok A No. 5"
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected', 'cancelled')),
+    unit_id UUID REFERENCES units(id) ON DELETE SET NULL,        -- Assigned at approval
+    role_id UUID REFERENCES roles(id) ON DELETE SET NULL,        -- Assigned at approval
+    reviewed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    reviewed_at TIMESTAMP,
+    rejection_reason TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_join_requests_tenant_id ON join_requests(tenant_id, status, created_at DESC);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_join_requests_pending ON join_requests(tenant_id, user_id) WHERE status = 'pending';
+
+DROP TRIGGER IF EXISTS update_join_requests_updated_at ON join_requests;
+CREATE TRIGGER update_join_requests_updated_at
+    BEFORE UPDATE ON join_requests
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,18 @@
+-- Migration: Create OAuth States Table
+-- Description: Server-side OAuth state with PKCE verifier for Google sign-in and account linking
+-- Date: 2026-10
+
+CREATE TABLE IF NOT EXISTS oauth_states (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    provider VARCHAR(20) NOT NULL DEFAULT 'google',
+    purpose VARCHAR(20) NOT NULL CHECK (purpose IN ('login', 'link')),
+    state_hash VARCHAR(64) UNIQUE NOT NULL,
+    browser_binding_hash VARCHAR(64),     -- Hash of the cookie set on the browser that started the flow (login)
+    code_verifier VARCHAR(128) NOT NULL,  -- PKCE verifier, sent with the code exchange
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE, -- Account being linked (purpose = 'link')
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_oauth_states_expires_at ON oauth_states(expires_at);
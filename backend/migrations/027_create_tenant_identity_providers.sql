@@ -0,0 +1,45 @@
+-- Migration: Create Tenant Identity Providers
+-- Description: Per-tenant OpenID Connect providers, linked external identities and OIDC login state
+-- Date: 2026-10
+
+-- 1. OIDC providers configured by a tenant (e.g. the developer's or municipality's identity provider)
+CREATE TABLE IF NOT EXISTS tenant_identity_providers (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,                 -- Button label, e.g. "Login Warga Citraland"
+    issuer_url VARCHAR(500) NOT NULL,           -- Discovery at {issuer_url}/.well-known/openid-configuration
+    client_id VARCHAR(255) NOT NULL,
+    client_secret TEXT,
+    scopes VARCHAR(255) NOT NULL DEFAULT 'openid email profile',
+    claim_mapping JSONB NOT NULL DEFAULT '{}',  -- e.g. {"email": "email", "name": "name", "phone": "phone_number"}
+    default_role_id UUID REFERENCES roles(id) ON DELETE SET NULL, -- Role for just-in-time provisioned users (Warga when NULL)
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_tenant_identity_providers_tenant_id ON tenant_identity_providers(tenant_id) WHERE deleted_at IS NULL;
+
+DROP TRIGGER IF EXISTS update_tenant_identity_providers_updated_at ON tenant_identity_providers;
+CREATE TRIGGER update_tenant_identity_providers_updated_at
+    BEFORE UPDATE ON tenant_identity_providers
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- 2. External identities (provider + subject) linked to users
+CREATE TABLE IF NOT EXISTS user_identities (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    identity_provider_id UUID NOT NULL REFERENCES tenant_identity_providers(id) ON DELETE CASCADE,
+    subject VARCHAR(255) NOT NULL,              -- "sub" claim
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    last_login_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(identity_provider_id, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);
+
+-- 3. OIDC login state
+ALTER TABLE oauth_states
+ADD COLUMN IF NOT EXISTS identity_provider_id UUID REFERENCES tenant_identity_providers(id) ON DELETE CASCADE,
+ADD COLUMN IF NOT EXISTS nonce VARCHAR(64);
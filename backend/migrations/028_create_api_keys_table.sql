@@ -0,0 +1,35 @@
+-- Migration: Create API Keys Table
+-- Description: Tenant-scoped API keys for machine integrations (gate systems, spreadsheet scripts)
+-- Date: 2026-10
+
+-- 1. API keys (stored hashed; the plain key is shown once at creation)
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,                  -- e.g. "Sistem Gerbang Pos Satpam"
+    key_prefix VARCHAR(20) NOT NULL,             -- First characters of the key, to recognise it in lists
+    key_hash VARCHAR(64) UNIQUE NOT NULL,        -- SHA-256 of the full key
+    permissions TEXT[] NOT NULL DEFAULT '{}',    -- Permission keys granted to the key
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL, -- Requests act on behalf of this user
+    expires_at TIMESTAMP,                        -- NULL = never expires
+    last_used_at TIMESTAMP,
+    last_used_ip VARCHAR(64),
+    revoked_at TIMESTAMP,
+    revoked_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_tenant_id ON api_keys(tenant_id, created_at DESC);
+
+-- 2. Permission
+INSERT INTO permissions (key, name, description, module) VALUES
+('tenant.api_keys', 'Manage API Keys', 'Mengelola API key untuk integrasi sistem', 'tenant')
+ON CONFLICT (key) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+CROSS JOIN permissions p
+WHERE r.name = 'Admin' AND r.is_system = true AND r.deleted_at IS NULL
+AND p.key = 'tenant.api_keys'
+ON CONFLICT DO NOTHING;
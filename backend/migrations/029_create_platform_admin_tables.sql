@@ -0,0 +1,42 @@
+-- Migration: Create Platform Admin Tables
+-- Description: Super-admin console sessions, audit log and tenant suspension details
+-- Date: 2026-10
+
+-- 1. Tenant suspension
+ALTER TABLE tenants
+ADD COLUMN IF NOT EXISTS suspended_at TIMESTAMP,
+ADD COLUMN IF NOT EXISTS suspension_reason TEXT;
+
+-- 2. Platform console sessions (separate from tenant sessions; no refresh tokens)
+CREATE TABLE IF NOT EXISTS platform_sessions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_agent TEXT,
+    ip_address VARCHAR(64),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_platform_sessions_user_id ON platform_sessions(user_id) WHERE revoked_at IS NULL;
+
+-- 3. Audit log of everything done through the platform console
+CREATE TABLE IF NOT EXISTS platform_audit_logs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    actor_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    actor_email VARCHAR(255),                 -- Kept when the actor account is deleted
+    session_id UUID,
+    action VARCHAR(100) NOT NULL,             -- e.g. tenant.suspend, tenant.list, auth.login_failed
+    method VARCHAR(10),
+    path VARCHAR(255),
+    status_code INTEGER,
+    target_tenant_id UUID,
+    target_user_id UUID,
+    details JSONB DEFAULT '{}',
+    ip_address VARCHAR(64),
+    user_agent TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_platform_audit_logs_created_at ON platform_audit_logs(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_platform_audit_logs_target_tenant ON platform_audit_logs(target_tenant_id, created_at DESC);
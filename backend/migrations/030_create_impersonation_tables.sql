@@ -0,0 +1,49 @@
+-- Migration: Create Impersonation Tables
+-- Description: Admins viewing RukunOS as a resident ("lihat sebagai warga") with a full request audit
+-- Date: 2026-10
+
+-- 1. Impersonation sessions (short-lived; tied to the admin's own session)
+CREATE TABLE IF NOT EXISTS impersonation_sessions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    actor_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,   -- Admin doing the impersonation
+    actor_session_id UUID REFERENCES user_sessions(id) ON DELETE CASCADE, -- Ends when the admin logs out
+    target_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,  -- Warga being viewed
+    reason TEXT NOT NULL,
+    ip_address VARCHAR(64),
+    user_agent TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    ended_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_impersonation_sessions_tenant_id ON impersonation_sessions(tenant_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_impersonation_sessions_target ON impersonation_sessions(target_user_id, created_at DESC);
+
+-- 2. Every request made with an impersonation token
+CREATE TABLE IF NOT EXISTS impersonation_audit_logs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    impersonation_id UUID NOT NULL REFERENCES impersonation_sessions(id) ON DELETE CASCADE,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    method VARCHAR(10) NOT NULL,
+    path VARCHAR(255) NOT NULL,
+    query TEXT,
+    status_code INTEGER,
+    ip_address VARCHAR(64),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_impersonation_audit_logs_impersonation ON impersonation_audit_logs(impersonation_id, created_at);
+
+-- 3. Permission
+INSERT INTO permissions (key, name, description, module) VALUES
+('user.impersonate', 'Impersonate Users', 'Melihat aplikasi sebagai warga lain untuk membantu menyelesaikan masalah', 'user')
+ON CONFLICT (key) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+CROSS JOIN permissions p
+WHERE r.name = 'Admin' AND r.is_system = true AND r.deleted_at IS NULL
+AND p.key = 'user.impersonate'
+ON CONFLICT DO NOTHING;
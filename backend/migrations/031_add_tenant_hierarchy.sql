@@ -0,0 +1,40 @@
+-- Migration: Add Tenant Hierarchy
+-- Description: RW tenants containing RT tenants, RW-level permissions and announcements cascading to RTs
+-- Date: 2026-10
+
+-- 1. Parent/child tenants (two levels: an RW has RTs, an RT has no children)
+ALTER TABLE tenants
+ADD COLUMN IF NOT EXISTS level VARCHAR(10) DEFAULT 'rt', -- rt, rw
+ADD COLUMN IF NOT EXISTS parent_tenant_id UUID REFERENCES tenants(id) ON DELETE SET NULL;
+
+ALTER TABLE tenants DROP CONSTRAINT IF EXISTS tenants_parent_not_self;
+ALTER TABLE tenants ADD CONSTRAINT tenants_parent_not_self CHECK (parent_tenant_id IS NULL OR parent_tenant_id <> id);
+
+CREATE INDEX IF NOT EXISTS idx_tenants_parent_tenant_id ON tenants(parent_tenant_id) WHERE deleted_at IS NULL;
+
+-- 2. RW announcements shown in every RT of the RW
+ALTER TABLE announcements
+ADD COLUMN IF NOT EXISTS cascade_to_children BOOLEAN DEFAULT false;
+
+-- 3. Permissions for RW roles (read or act on RT data with the X-Child-Tenant-ID header, RW dashboards)
+INSERT INTO permissions (key, name, description, module) VALUES
+('rw.view', 'View RT Data', 'Melihat data dan rekap seluruh RT dalam RW', 'rw'),
+('rw.manage', 'Manage RT Data', 'Mengelola data RT dalam RW (sesuai izin peran di RW)', 'rw')
+ON CONFLICT (key) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+CROSS JOIN permissions p
+WHERE r.name = 'Admin' AND r.is_system = true AND r.deleted_at IS NULL
+AND p.key IN ('rw.view', 'rw.manage')
+ON CONFLICT DO NOTHING;
+
+-- The treasurer of an RW needs the consolidated view across RTs
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+CROSS JOIN permissions p
+WHERE r.name = 'Bendahara' AND r.is_system = true AND r.deleted_at IS NULL
+AND p.key = 'rw.view'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,19 @@
+-- Migration: Backfill Tenant Modules
+-- Description: Complete tenants.modules and keep modules switched on for tenants already using them, now that modules are enforced
+-- Date: 2026-10
+
+-- 1. Every tenant gets every module key; stored values win over the defaults
+UPDATE tenants
+SET modules = '{"billing": true, "communication": true, "administration": false, "security": false}'::jsonb
+    || COALESCE(modules, '{}'::jsonb);
+
+-- 2. Tenants with visitor logs or panic alerts already use the security module
+UPDATE tenants t
+SET modules = t.modules || '{"security": true}'::jsonb
+WHERE EXISTS (SELECT 1 FROM visitor_logs v WHERE v.tenant_id = t.id)
+   OR EXISTS (SELECT 1 FROM panic_alerts p WHERE p.tenant_id = t.id);
+
+-- 3. Tenants with document requests already use the administration module
+UPDATE tenants t
+SET modules = t.modules || '{"administration": true}'::jsonb
+WHERE EXISTS (SELECT 1 FROM document_requests d WHERE d.tenant_id = t.id);
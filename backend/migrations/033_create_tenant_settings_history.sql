@@ -0,0 +1,15 @@
+-- Migration: Create Tenant Settings History
+-- Description: Change history of the typed tenant settings (timezone, rounding, billing defaults, letterhead, reminders, security)
+-- Date: 2026-10
+
+CREATE TABLE IF NOT EXISTS tenant_settings_history (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    changed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    changed_fields TEXT[] NOT NULL DEFAULT '{}', -- Dotted paths, e.g. billing.late_fee.amount
+    previous_settings JSONB NOT NULL,
+    new_settings JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_tenant_settings_history_tenant_id ON tenant_settings_history(tenant_id, created_at DESC);
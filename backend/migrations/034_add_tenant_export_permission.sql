@@ -0,0 +1,15 @@
+-- Migration: Add Tenant Export Permission
+-- Description: Lets tenant admins download their whole tenant as a portability archive
+-- Date: 2026-10
+
+INSERT INTO permissions (key, name, description, module) VALUES
+('tenant.export', 'Export Tenant Data', 'Mengunduh seluruh data RT sebagai arsip untuk dipindahkan', 'tenant')
+ON CONFLICT (key) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+CROSS JOIN permissions p
+WHERE r.name = 'Admin' AND r.is_system = true AND r.deleted_at IS NULL
+AND p.key = 'tenant.export'
+ON CONFLICT DO NOTHING;
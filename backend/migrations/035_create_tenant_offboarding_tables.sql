@@ -0,0 +1,62 @@
+-- Migration: Create Tenant Offboarding Tables
+-- Description: Tenant deletion requests (grace period, final export, purge) and a log of permanently removed data
+-- Date: 2026-10
+
+-- 1. Tenant deletion requests. tenant_id has no foreign key: the request outlives the purged tenant.
+CREATE TABLE IF NOT EXISTS tenant_deletion_requests (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL,
+    tenant_name VARCHAR(255) NOT NULL,
+    tenant_code VARCHAR(50) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'cancelled', 'purged')),
+    reason TEXT,
+    requested_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    requested_via VARCHAR(20) NOT NULL DEFAULT 'tenant' CHECK (requested_via IN ('tenant', 'platform')),
+    purge_after TIMESTAMP NOT NULL,             -- End of the grace period
+    cancelled_at TIMESTAMP,
+    cancelled_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    exported_at TIMESTAMP,
+    archive_path TEXT,                          -- Final export, removed after archive_expires_at
+    archive_expires_at TIMESTAMP,
+    purged_at TIMESTAMP,
+    purge_summary JSONB,                        -- Rows removed per table
+    last_error TEXT,                            -- Last failed purge attempt; retried hourly
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tenant_deletion_requests_pending
+    ON tenant_deletion_requests(tenant_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_tenant_deletion_requests_status ON tenant_deletion_requests(status, purge_after);
+
+DROP TRIGGER IF EXISTS update_tenant_deletion_requests_updated_at ON tenant_deletion_requests;
+CREATE TRIGGER update_tenant_deletion_requests_updated_at
+    BEFORE UPDATE ON tenant_deletion_requests
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- 2. Purge log: what retention policies and tenant deletions removed for good
+CREATE TABLE IF NOT EXISTS data_purge_logs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL,
+    deletion_request_id UUID REFERENCES tenant_deletion_requests(id) ON DELETE SET NULL,
+    entity VARCHAR(100) NOT NULL,
+    reason VARCHAR(30) NOT NULL CHECK (reason IN ('retention', 'deleted_records', 'tenant_deletion')),
+    rows_deleted INTEGER NOT NULL,
+    retention_days INTEGER,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_data_purge_logs_tenant_id ON data_purge_logs(tenant_id, created_at DESC);
+
+-- 3. Permission
+INSERT INTO permissions (key, name, description, module) VALUES
+('tenant.delete', 'Delete Tenant', 'Mengajukan penghapusan permanen seluruh data RT', 'tenant')
+ON CONFLICT (key) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+CROSS JOIN permissions p
+WHERE r.name = 'Admin' AND r.is_system = true AND r.deleted_at IS NULL
+AND p.key = 'tenant.delete'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,68 @@
+-- Migration: Enable Tenant Row-Level Security
+-- Description: Second line of tenant isolation. Tenant-scoped queries run as rukunos_tenant with app.tenant_id set
+--              per transaction (db.TenantDB); policies limit that role to the rows of app.tenant_id.
+--              The application user owns the tables and bypasses the policies (logins, platform console, jobs).
+--              New tables with a tenant_id column need the same tenant_isolation policy in their own migration.
+-- Date: 2026-10
+
+-- 1. Role tenant-scoped transactions switch to
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'rukunos_tenant') THEN
+        CREATE ROLE rukunos_tenant NOLOGIN;
+    END IF;
+    EXECUTE format('GRANT rukunos_tenant TO %I', current_user);
+END $$;
+
+GRANT USAGE ON SCHEMA public TO rukunos_tenant;
+GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO rukunos_tenant;
+GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA public TO rukunos_tenant;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO rukunos_tenant;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT USAGE, SELECT ON SEQUENCES TO rukunos_tenant;
+
+-- 2. Every table with a tenant_id column: rows of app.tenant_id only, for reads and writes.
+--    An unset app.tenant_id matches nothing.
+DO $$
+DECLARE
+    v_table TEXT;
+BEGIN
+    FOR v_table IN
+        SELECT c.table_name
+        FROM information_schema.columns c
+        INNER JOIN information_schema.tables t ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+        WHERE c.table_schema = 'public' AND c.column_name = 'tenant_id' AND t.table_type = 'BASE TABLE'
+    LOOP
+        EXECUTE format('ALTER TABLE %I ENABLE ROW LEVEL SECURITY', v_table);
+        EXECUTE format('DROP POLICY IF EXISTS tenant_isolation ON %I', v_table);
+        EXECUTE format(
+            'CREATE POLICY tenant_isolation ON %I TO rukunos_tenant
+             USING (tenant_id = NULLIF(current_setting(''app.tenant_id'', true), '''')::uuid)
+             WITH CHECK (tenant_id = NULLIF(current_setting(''app.tenant_id'', true), '''')::uuid)',
+            v_table);
+    END LOOP;
+END $$;
+
+-- 3. Tables scoped through their parent row (the parent's policy applies inside EXISTS)
+ALTER TABLE billing_template_amount_rules ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON billing_template_amount_rules;
+CREATE POLICY tenant_isolation ON billing_template_amount_rules TO rukunos_tenant
+    USING (EXISTS (SELECT 1 FROM billing_templates bt WHERE bt.id = billing_template_amount_rules.template_id))
+    WITH CHECK (EXISTS (SELECT 1 FROM billing_templates bt WHERE bt.id = billing_template_amount_rules.template_id));
+
+ALTER TABLE role_permissions ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON role_permissions;
+CREATE POLICY tenant_isolation ON role_permissions TO rukunos_tenant
+    USING (EXISTS (SELECT 1 FROM roles r WHERE r.id = role_permissions.role_id))
+    WITH CHECK (EXISTS (SELECT 1 FROM roles r WHERE r.id = role_permissions.role_id));
+
+ALTER TABLE announcement_reads ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON announcement_reads;
+CREATE POLICY tenant_isolation ON announcement_reads TO rukunos_tenant
+    USING (EXISTS (SELECT 1 FROM announcements a WHERE a.id = announcement_reads.announcement_id))
+    WITH CHECK (EXISTS (SELECT 1 FROM announcements a WHERE a.id = announcement_reads.announcement_id));
+
+-- 4. RTs read the announcements their RW cascades to them
+DROP POLICY IF EXISTS tenant_cascade_read ON announcements;
+CREATE POLICY tenant_cascade_read ON announcements FOR SELECT TO rukunos_tenant
+    USING (cascade_to_children = true AND tenant_id = (
+        SELECT parent_tenant_id FROM tenants WHERE id = NULLIF(current_setting('app.tenant_id', true), '')::uuid));
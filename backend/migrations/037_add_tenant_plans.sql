@@ -0,0 +1,40 @@
+-- Migration: Add Tenant Plans
+-- Description: Subscription plan of every tenant (limits are defined in services/plans.go), measured storage
+--              and a log of announcements sent over paid channels, counted against the plan's monthly limit
+-- Date: 2026-10
+
+-- 1. Plan and storage usage per tenant. Tenants that existed before plans keep everything they had (pro);
+--    new tenants start on free.
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS plan VARCHAR(20);
+UPDATE tenants SET plan = 'pro' WHERE plan IS NULL;
+ALTER TABLE tenants ALTER COLUMN plan SET DEFAULT 'free';
+ALTER TABLE tenants ALTER COLUMN plan SET NOT NULL;
+ALTER TABLE tenants DROP CONSTRAINT IF EXISTS tenants_plan_check;
+ALTER TABLE tenants ADD CONSTRAINT tenants_plan_check CHECK (plan IN ('free', 'basic', 'pro'));
+
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS plan_changed_at TIMESTAMP;
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS storage_bytes BIGINT NOT NULL DEFAULT 0; -- Measured daily
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS storage_measured_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_tenants_plan ON tenants(plan);
+
+-- 2. Announcements sent to residents over WhatsApp or SMS
+CREATE TABLE IF NOT EXISTS announcement_broadcasts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    announcement_id UUID NOT NULL REFERENCES announcements(id) ON DELETE CASCADE,
+    channel VARCHAR(20) NOT NULL CHECK (channel IN ('whatsapp', 'sms')),
+    recipients INTEGER NOT NULL DEFAULT 0,
+    delivered INTEGER NOT NULL DEFAULT 0,
+    sent_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_announcement_broadcasts_tenant ON announcement_broadcasts(tenant_id, created_at);
+
+-- 3. Tenant isolation (see migration 036)
+ALTER TABLE announcement_broadcasts ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON announcement_broadcasts;
+CREATE POLICY tenant_isolation ON announcement_broadcasts TO rukunos_tenant
+    USING (tenant_id = NULLIF(current_setting('app.tenant_id', true), '')::uuid)
+    WITH CHECK (tenant_id = NULLIF(current_setting('app.tenant_id', true), '')::uuid);
@@ -0,0 +1,29 @@
+-- Migration: Create Tenant Domains Table
+-- Description: Custom domains of tenants for public pages and login. A domain resolves to its tenant only after
+--              the tenant publishes the TXT record _rukunos.<domain> = rukunos-verification=<token>.
+--              Subdomains of TENANT_BASE_DOMAIN (e.g. rt05.rukunos.id) resolve by tenant code and need no row here.
+-- Date: 2026-10
+
+CREATE TABLE IF NOT EXISTS tenant_domains (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    domain VARCHAR(253) NOT NULL UNIQUE, -- Lowercase, without port or trailing dot
+    verification_token VARCHAR(64) NOT NULL,
+    verified_at TIMESTAMP,
+    last_checked_at TIMESTAMP,
+    last_error TEXT,                     -- Why the last verification failed
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_tenant_domains_tenant_id ON tenant_domains(tenant_id);
+
+-- Subdomains are looked up by lowercase tenant code
+CREATE INDEX IF NOT EXISTS idx_tenants_lower_code ON tenants(LOWER(code));
+
+-- Tenant isolation (see migration 036)
+ALTER TABLE tenant_domains ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON tenant_domains;
+CREATE POLICY tenant_isolation ON tenant_domains TO rukunos_tenant
+    USING (tenant_id = NULLIF(current_setting('app.tenant_id', true), '')::uuid)
+    WITH CHECK (tenant_id = NULLIF(current_setting('app.tenant_id', true), '')::uuid);
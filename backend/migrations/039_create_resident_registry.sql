@@ -0,0 +1,85 @@
+-- Migration: Create Resident Registry
+-- Description: Data warga register of family cards (KK) and their members, independent of user accounts.
+--              NIK and KK numbers are encrypted by the application (PII_ENCRYPTION_KEY); the *_hash columns
+--              hold an HMAC blind index for exact search and uniqueness.
+-- Date: 2026-10
+
+CREATE TABLE IF NOT EXISTS households (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    unit_id UUID REFERENCES units(id) ON DELETE SET NULL,
+    kk_number_encrypted TEXT NOT NULL,
+    kk_number_hash VARCHAR(64) NOT NULL,
+    address TEXT, -- Address on the card, when it differs from the unit
+    notes TEXT,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_households_tenant_id ON households(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_households_unit_id ON households(unit_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_households_kk_number
+    ON households(tenant_id, kk_number_hash) WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS residents (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    household_id UUID NOT NULL REFERENCES households(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL, -- Set when the resident has a login
+    full_name VARCHAR(255) NOT NULL,
+    nik_encrypted TEXT NOT NULL,
+    nik_hash VARCHAR(64) NOT NULL,
+    gender CHAR(1) NOT NULL CHECK (gender IN ('L', 'P')),
+    birth_place VARCHAR(100),
+    birth_date DATE NOT NULL,
+    relationship VARCHAR(30) NOT NULL CHECK (relationship IN (
+        'kepala_keluarga', 'suami', 'istri', 'anak', 'menantu', 'cucu', 'orang_tua', 'mertua', 'famili_lain', 'lainnya'
+    )),
+    religion VARCHAR(30),
+    marital_status VARCHAR(30),
+    occupation VARCHAR(100),
+    domicile_status VARCHAR(20) NOT NULL DEFAULT 'tetap' CHECK (domicile_status IN ('tetap', 'kontrak', 'kos')),
+    phone VARCHAR(50),
+    moved_in_at DATE,
+    notes TEXT,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_residents_tenant_id ON residents(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_residents_household_id ON residents(household_id);
+CREATE INDEX IF NOT EXISTS idx_residents_full_name ON residents(tenant_id, LOWER(full_name));
+CREATE UNIQUE INDEX IF NOT EXISTS idx_residents_nik
+    ON residents(tenant_id, nik_hash) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_residents_user_id
+    ON residents(tenant_id, user_id) WHERE user_id IS NOT NULL AND deleted_at IS NULL;
+
+-- Tenant isolation (see migration 036)
+ALTER TABLE households ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON households;
+CREATE POLICY tenant_isolation ON households TO rukunos_tenant
+    USING (tenant_id = NULLIF(current_setting('app.tenant_id', true), '')::uuid)
+    WITH CHECK (tenant_id = NULLIF(current_setting('app.tenant_id', true), '')::uuid);
+
+ALTER TABLE residents ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON residents;
+CREATE POLICY tenant_isolation ON residents TO rukunos_tenant
+    USING (tenant_id = NULLIF(current_setting('app.tenant_id', true), '')::uuid)
+    WITH CHECK (tenant_id = NULLIF(current_setting('app.tenant_id', true), '')::uuid);
+
+INSERT INTO permissions (key, name, description, module) VALUES
+('resident.view', 'View Residents', 'Melihat data warga dan kartu keluarga', 'resident'),
+('resident.manage', 'Manage Residents', 'Menambah, mengubah dan menghapus data warga dan kartu keluarga', 'resident')
+ON CONFLICT (key) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+CROSS JOIN permissions p
+WHERE r.name = 'Admin' AND r.is_system = true AND r.deleted_at IS NULL
+AND p.key IN ('resident.view', 'resident.manage')
+ON CONFLICT DO NOTHING;
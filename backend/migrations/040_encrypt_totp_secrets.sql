@@ -0,0 +1,7 @@
+-- Migration: Encrypt TOTP Secrets
+-- Description: TOTP secrets are encrypted by the application (PII_ENCRYPTION_KEY) like NIK and KK numbers.
+--              The ciphertext does not fit the old VARCHAR(64); secrets stored in plain text before this
+--              migration are encrypted by the backend when it starts (services.EncryptTOTPSecrets).
+-- Date: 2026-10
+
+ALTER TABLE users ALTER COLUMN totp_secret TYPE TEXT;
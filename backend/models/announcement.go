@@ -19,6 +19,7 @@ type Announcement struct {
 	SentAt          sql.NullTime   `json:"sent_at,omitempty" db:"sent_at"`
 	ExpiresAt       sql.NullTime   `json:"expires_at,omitempty" db:"expires_at"`
 	Metadata        sql.NullString `json:"metadata,omitempty" db:"metadata"`
+	CascadeToChildren bool         `json:"cascade_to_children" db:"cascade_to_children"` // RW announcement shown in its RTs
 	CreatedAt       time.Time      `json:"created_at" db:"created_at"`
 	UpdatedAt       time.Time      `json:"updated_at" db:"updated_at"`
 	DeletedAt       sql.NullTime   `json:"-" db:"deleted_at"`
@@ -35,6 +36,7 @@ type CreateAnnouncementRequest struct {
 	Category  *string `json:"category,omitempty"`
 	IsPinned  *bool   `json:"is_pinned,omitempty"`
 	ExpiresAt *string `json:"expires_at,omitempty"` // ISO 8601 format
+	CascadeToChildren *bool `json:"cascade_to_children,omitempty"` // RW only: also show in every RT
 }
 
 type UpdateAnnouncementRequest struct {
@@ -44,6 +46,7 @@ type UpdateAnnouncementRequest struct {
 	Category  *string `json:"category,omitempty"`
 	IsPinned  *bool   `json:"is_pinned,omitempty"`
 	ExpiresAt *string `json:"expires_at,omitempty"`
+	CascadeToChildren *bool `json:"cascade_to_children,omitempty"`
 }
 
 
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type APIKey struct {
+	ID          string         `json:"id" db:"id"`
+	TenantID    string         `json:"tenant_id" db:"tenant_id"`
+	Name        string         `json:"name" db:"name"`
+	KeyPrefix   string         `json:"key_prefix" db:"key_prefix"`
+	Permissions pq.StringArray `json:"permissions" db:"permissions"`
+	CreatedBy   sql.NullString `json:"created_by,omitempty" db:"created_by"`
+	ExpiresAt   sql.NullTime   `json:"expires_at,omitempty" db:"expires_at"`
+	LastUsedAt  sql.NullTime   `json:"last_used_at,omitempty" db:"last_used_at"`
+	LastUsedIP  sql.NullString `json:"last_used_ip,omitempty" db:"last_used_ip"`
+	RevokedAt   sql.NullTime   `json:"revoked_at,omitempty" db:"revoked_at"`
+	RevokedBy   sql.NullString `json:"revoked_by,omitempty" db:"revoked_by"`
+	CreatedAt   time.Time      `json:"created_at" db:"created_at"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" validate:"required"`
+	Permissions   []string `json:"permissions" validate:"required"` // Subset of the creator's permissions
+	ExpiresInDays *int     `json:"expires_in_days,omitempty"`       // Omit for a key that does not expire
+}
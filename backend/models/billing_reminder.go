@@ -0,0 +1,77 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type BillingReminderRule struct {
+	ID              string         `json:"id" db:"id"`
+	TenantID        string         `json:"tenant_id" db:"tenant_id"`
+	Name            string         `json:"name" db:"name"`
+	OffsetDays      int            `json:"offset_days" db:"offset_days"` // Negative = before due date, positive = after
+	Channel         string         `json:"channel" db:"channel"`
+	MessageTemplate sql.NullString `json:"message_template,omitempty" db:"message_template"`
+	IsFinal         bool           `json:"is_final" db:"is_final"`
+	IsActive        bool           `json:"is_active" db:"is_active"`
+	CreatedAt       time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at" db:"updated_at"`
+	DeletedAt       sql.NullTime   `json:"-" db:"deleted_at"`
+}
+
+type BillReminderLog struct {
+	ID              string         `json:"id" db:"id"`
+	TenantID        string         `json:"tenant_id" db:"tenant_id"`
+	BillID          string         `json:"bill_id" db:"bill_id"`
+	RuleID          string         `json:"rule_id" db:"rule_id"`
+	Channel         string         `json:"channel" db:"channel"`
+	Status          string         `json:"status" db:"status"`
+	RecipientsCount int            `json:"recipients_count" db:"recipients_count"`
+	Error           sql.NullString `json:"error,omitempty" db:"error"`
+	SentAt          time.Time      `json:"sent_at" db:"sent_at"`
+	// Joined fields
+	RuleName        sql.NullString `json:"rule_name,omitempty" db:"rule_name"`
+	OffsetDays      sql.NullInt64  `json:"offset_days,omitempty" db:"offset_days"`
+}
+
+type TreasurerTask struct {
+	ID          string         `json:"id" db:"id"`
+	TenantID    string         `json:"tenant_id" db:"tenant_id"`
+	BillID      sql.NullString `json:"bill_id,omitempty" db:"bill_id"`
+	Type        string         `json:"type" db:"type"`
+	Title       string         `json:"title" db:"title"`
+	Description sql.NullString `json:"description,omitempty" db:"description"`
+	Status      string         `json:"status" db:"status"`
+	ResolvedBy  sql.NullString `json:"resolved_by,omitempty" db:"resolved_by"`
+	ResolvedAt  sql.NullTime   `json:"resolved_at,omitempty" db:"resolved_at"`
+	Notes       sql.NullString `json:"notes,omitempty" db:"notes"`
+	CreatedAt   time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+type CreateBillingReminderRuleRequest struct {
+	Name            string  `json:"name" validate:"required"`
+	OffsetDays      int     `json:"offset_days" validate:"min=-60,max=365"`
+	Channel         *string `json:"channel,omitempty"`
+	MessageTemplate *string `json:"message_template,omitempty"`
+	IsFinal         *bool   `json:"is_final,omitempty"`
+	IsActive        *bool   `json:"is_active,omitempty"`
+}
+
+type UpdateBillingReminderRuleRequest struct {
+	Name            *string `json:"name,omitempty"`
+	OffsetDays      *int    `json:"offset_days,omitempty" validate:"omitempty,min=-60,max=365"`
+	Channel         *string `json:"channel,omitempty"`
+	MessageTemplate *string `json:"message_template,omitempty"`
+	IsFinal         *bool   `json:"is_final,omitempty"`
+	IsActive        *bool   `json:"is_active,omitempty"`
+}
+
+type UpdateTreasurerTaskRequest struct {
+	Status *string `json:"status,omitempty" validate:"omitempty,oneof=open in_progress done dismissed"`
+	Notes  *string `json:"notes,omitempty"`
+}
+
+type UpdateReminderPreferenceRequest struct {
+	OptOut bool `json:"opt_out"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// IdentityProvider is a tenant's OpenID Connect provider
+type IdentityProvider struct {
+	ID               string            `json:"id" db:"id"`
+	TenantID         string            `json:"tenant_id" db:"tenant_id"`
+	Name             string            `json:"name" db:"name"`
+	IssuerURL        string            `json:"issuer_url" db:"issuer_url"`
+	ClientID         string            `json:"client_id" db:"client_id"`
+	ClientSecret     sql.NullString    `json:"-" db:"client_secret"`
+	HasClientSecret  bool              `json:"has_client_secret" db:"-"`
+	Scopes           string            `json:"scopes" db:"scopes"`
+	ClaimMappingJSON []byte            `json:"-" db:"claim_mapping"` // JSONB: ClaimMapping
+	ClaimMapping     map[string]string `json:"claim_mapping" db:"-"`
+	DefaultRoleID    sql.NullString    `json:"default_role_id,omitempty" db:"default_role_id"`
+	Enabled          bool              `json:"enabled" db:"enabled"`
+	CreatedAt        time.Time         `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time         `json:"updated_at" db:"updated_at"`
+}
+
+// IdentityProviderRequest creates or updates a provider; on update, omitted fields are unchanged
+type IdentityProviderRequest struct {
+	Name          *string           `json:"name,omitempty"`
+	IssuerURL     *string           `json:"issuer_url,omitempty"`
+	ClientID      *string           `json:"client_id,omitempty"`
+	ClientSecret  *string           `json:"client_secret,omitempty"`
+	Scopes        *string           `json:"scopes,omitempty"`
+	ClaimMapping  map[string]string `json:"claim_mapping,omitempty"` // Keys: email, name, phone
+	DefaultRoleID *string           `json:"default_role_id,omitempty"`
+	Enabled       *bool             `json:"enabled,omitempty"`
+}
+
+// PublicIdentityProvider is what the login page sees
+type PublicIdentityProvider struct {
+	ID   string `json:"id" db:"id"`
+	Name string `json:"name" db:"name"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type StartImpersonationRequest struct {
+	Reason string `json:"reason" validate:"required"` // e.g. "Warga melapor halaman tagihan kosong"
+}
+
+type ImpersonationSession struct {
+	ID           string         `json:"id" db:"id"`
+	TenantID     string         `json:"tenant_id" db:"tenant_id"`
+	ActorUserID  string         `json:"actor_user_id" db:"actor_user_id"`
+	ActorName    string         `json:"actor_name" db:"actor_name"`
+	TargetUserID string         `json:"target_user_id" db:"target_user_id"`
+	TargetName   string         `json:"target_name" db:"target_name"`
+	Reason       string         `json:"reason" db:"reason"`
+	IPAddress    sql.NullString `json:"ip_address,omitempty" db:"ip_address"`
+	RequestCount int            `json:"request_count" db:"request_count"`
+	CreatedAt    time.Time      `json:"created_at" db:"created_at"`
+	ExpiresAt    time.Time      `json:"expires_at" db:"expires_at"`
+	EndedAt      sql.NullTime   `json:"ended_at,omitempty" db:"ended_at"`
+}
+
+// ImpersonationRequestLog is one request made while impersonating
+type ImpersonationRequestLog struct {
+	ID         string         `json:"id" db:"id"`
+	Method     string         `json:"method" db:"method"`
+	Path       string         `json:"path" db:"path"`
+	Query      sql.NullString `json:"query,omitempty" db:"query"`
+	StatusCode sql.NullInt64  `json:"status_code,omitempty" db:"status_code"`
+	IPAddress  sql.NullString `json:"ip_address,omitempty" db:"ip_address"`
+	CreatedAt  time.Time      `json:"created_at" db:"created_at"`
+}
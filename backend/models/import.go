@@ -0,0 +1,33 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type ImportJob struct {
+	ID        string         `json:"id" db:"id"`
+	TenantID  string         `json:"tenant_id" db:"tenant_id"`
+	Type      string         `json:"type" db:"type"`
+	Filename  sql.NullString `json:"filename,omitempty" db:"filename"`
+	Status    string         `json:"status" db:"status"`
+	TotalRows int            `json:"total_rows" db:"total_rows"`
+	ValidRows int            `json:"valid_rows" db:"valid_rows"`
+	ErrorRows int            `json:"error_rows" db:"error_rows"`
+	Rows      []byte         `json:"-" db:"rows"`   // JSONB: parsed rows
+	Report    []byte         `json:"-" db:"report"` // JSONB: []ImportRowError
+	Error     sql.NullString `json:"error,omitempty" db:"error"`
+	CreatedBy sql.NullString `json:"created_by,omitempty" db:"created_by"`
+	AppliedBy sql.NullString `json:"applied_by,omitempty" db:"applied_by"`
+	AppliedAt sql.NullTime   `json:"applied_at,omitempty" db:"applied_at"`
+	CreatedAt time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+// ImportRowError is one validation problem in an import file. Row is the spreadsheet row number (header = 1).
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Value   string `json:"value,omitempty"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type Invitation struct {
+	ID         string         `json:"id" db:"id"`
+	TenantID   string         `json:"tenant_id" db:"tenant_id"`
+	UserID     sql.NullString `json:"user_id,omitempty" db:"user_id"`
+	Email      sql.NullString `json:"email,omitempty" db:"email"`
+	UnitID     sql.NullString `json:"unit_id,omitempty" db:"unit_id"`
+	RoleID     sql.NullString `json:"role_id,omitempty" db:"role_id"`
+	TokenHash  string         `json:"-" db:"token_hash"`
+	ExpiresAt  time.Time      `json:"expires_at" db:"expires_at"`
+	AcceptedAt sql.NullTime   `json:"accepted_at,omitempty" db:"accepted_at"`
+	RevokedAt  sql.NullTime   `json:"revoked_at,omitempty" db:"revoked_at"`
+	MaxUses    sql.NullInt64  `json:"max_uses,omitempty" db:"max_uses"` // NULL = unlimited
+	UseCount   int            `json:"use_count" db:"use_count"`
+	Note       sql.NullString `json:"note,omitempty" db:"note"`
+	CreatedBy  sql.NullString `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt  time.Time      `json:"created_at" db:"created_at"`
+}
+
+type AcceptInvitationRequest struct {
+	Token    string  `json:"token" validate:"required"`
+	Password *string `json:"password,omitempty" validate:"omitempty,min=6"` // Required when the invited account has no password yet
+}
+
+// CreateInvitationRequest invites one person by email, or creates a shareable link when email is empty
+type CreateInvitationRequest struct {
+	Email         *string `json:"email,omitempty" validate:"omitempty,email"`
+	UnitID        *string `json:"unit_id,omitempty"`
+	RoleID        *string `json:"role_id,omitempty"`         // Defaults to Warga
+	MaxUses       *int    `json:"max_uses,omitempty"`        // Links only; 0 = unlimited, default 1
+	ExpiresInDays *int    `json:"expires_in_days,omitempty"` // Default 7
+	Note          *string `json:"note,omitempty"`
+}
+
+type JoinWithInvitationRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// InvitationListItem is an invitation with its derived state and names for the admin list
+type InvitationListItem struct {
+	Invitation
+	State    string         `json:"state" db:"state"` // active, used, revoked, expired
+	UnitCode sql.NullString `json:"unit_code,omitempty" db:"unit_code"`
+	RoleName sql.NullString `json:"role_name,omitempty" db:"role_name"`
+}
+
+type JoinRequest struct {
+	ID              string         `json:"id" db:"id"`
+	TenantID        string         `json:"tenant_id" db:"tenant_id"`
+	UserID          string         `json:"user_id" db:"user_id"`
+	Message         sql.NullString `json:"message,omitempty" db:"message"`
+	Status          string         `json:"status" db:"status"`
+	UnitID          sql.NullString `json:"unit_id,omitempty" db:"unit_id"`
+	RoleID          sql.NullString `json:"role_id,omitempty" db:"role_id"`
+	ReviewedBy      sql.NullString `json:"reviewed_by,omitempty" db:"reviewed_by"`
+	ReviewedAt      sql.NullTime   `json:"reviewed_at,omitempty" db:"reviewed_at"`
+	RejectionReason sql.NullString `json:"rejection_reason,omitempty" db:"rejection_reason"`
+	CreatedAt       time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+// JoinRequestListItem adds the requester (admin queue) and tenant (requester's own list)
+type JoinRequestListItem struct {
+	JoinRequest
+	UserEmail    string         `json:"user_email" db:"user_email"`
+	UserFullName string         `json:"user_full_name" db:"user_full_name"`
+	UserPhone    sql.NullString `json:"user_phone,omitempty" db:"user_phone"`
+	TenantName   string         `json:"tenant_name" db:"tenant_name"`
+}
+
+type CreateJoinRequestRequest struct {
+	TenantCode string  `json:"tenant_code" validate:"required"`
+	Message    *string `json:"message,omitempty"`
+}
+
+type ApproveJoinRequestRequest struct {
+	UnitID *string `json:"unit_id,omitempty"`
+	RoleID *string `json:"role_id,omitempty"` // Defaults to Warga
+}
+
+type RejectJoinRequestRequest struct {
+	Reason *string `json:"reason,omitempty"`
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Plan is a subscription plan. A limit of -1 is unlimited.
+type Plan struct {
+	Key                  string   `json:"key"`
+	Name                 string   `json:"name"`
+	PriceMonthly         float64  `json:"price_monthly"`
+	MaxUnits             int      `json:"max_units"`
+	MaxUsers             int      `json:"max_users"`
+	MaxPaidAnnouncements int      `json:"max_paid_announcements"` // Per calendar month in the tenant's timezone
+	MaxStorageMB         int      `json:"max_storage_mb"`
+	Modules              []string `json:"modules"`
+}
+
+// QuotaUsage is how much of one plan limit a tenant uses
+type QuotaUsage struct {
+	Quota    string `json:"quota"`
+	Name     string `json:"name"`
+	Used     int64  `json:"used"`
+	Limit    int64  `json:"limit"`    // -1 = unlimited
+	Warning  bool   `json:"warning"`  // Close to the limit
+	Exceeded bool   `json:"exceeded"` // At or over the limit; creating more is refused
+}
+
+// TenantPlanUsage is a tenant's plan with its usage of every limit
+type TenantPlanUsage struct {
+	Plan              Plan         `json:"plan"`
+	PlanChangedAt     sql.NullTime `json:"plan_changed_at,omitempty"`
+	Quotas            []QuotaUsage `json:"quotas"`
+	Warnings          []string     `json:"warnings"`
+	StorageMeasuredAt sql.NullTime `json:"storage_measured_at,omitempty"`
+}
+
+// ChangeTenantPlanRequest is a super admin moving a tenant to another plan
+type ChangeTenantPlanRequest struct {
+	Plan   string `json:"plan"`
+	Reason string `json:"reason"`
+}
+
+// AnnouncementBroadcast is an announcement sent to the residents over a paid channel
+type AnnouncementBroadcast struct {
+	ID             string    `json:"id" db:"id"`
+	TenantID       string    `json:"tenant_id" db:"tenant_id"`
+	AnnouncementID string    `json:"announcement_id" db:"announcement_id"`
+	Channel        string    `json:"channel" db:"channel"`
+	Recipients     int       `json:"recipients" db:"recipients"`
+	Delivered      int       `json:"delivered" db:"delivered"`
+	SentBy         string    `json:"sent_by" db:"sent_by"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+// BroadcastAnnouncementRequest picks the paid channel an announcement is sent over
+type BroadcastAnnouncementRequest struct {
+	Channel string `json:"channel"` // whatsapp or sms
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type PlatformLoginRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code,omitempty"` // TOTP or recovery code, required when 2FA is enabled
+}
+
+// PlatformTenant is a tenant row in the super-admin console
+type PlatformTenant struct {
+	ID               string         `json:"id" db:"id"`
+	Name             string         `json:"name" db:"name"`
+	Code             string         `json:"code" db:"code"`
+	Status           string         `json:"status" db:"status"`
+	Plan             string         `json:"plan" db:"plan"`
+	Level            string         `json:"level" db:"level"`
+	ParentTenantID   sql.NullString `json:"parent_tenant_id,omitempty" db:"parent_tenant_id"`
+	Email            sql.NullString `json:"email,omitempty" db:"email"`
+	Phone            sql.NullString `json:"phone,omitempty" db:"phone"`
+	SuspendedAt      sql.NullTime   `json:"suspended_at,omitempty" db:"suspended_at"`
+	SuspensionReason sql.NullString `json:"suspension_reason,omitempty" db:"suspension_reason"`
+	MemberCount      int            `json:"member_count" db:"member_count"`
+	UnitCount        int            `json:"unit_count" db:"unit_count"`
+	CreatedAt        time.Time      `json:"created_at" db:"created_at"`
+}
+
+// TenantUsageStats summarises how a tenant uses RukunOS
+type TenantUsageStats struct {
+	ActiveMembers   int          `json:"active_members" db:"active_members"`
+	Units           int          `json:"units" db:"units"`
+	Bills           int          `json:"bills" db:"bills"`
+	PaidBills       int          `json:"paid_bills" db:"paid_bills"`
+	Collected30Days float64      `json:"collected_30_days" db:"collected_30_days"`
+	Announcements   int          `json:"announcements" db:"announcements"`
+	Complaints      int          `json:"complaints" db:"complaints"`
+	PanicAlerts     int          `json:"panic_alerts" db:"panic_alerts"`
+	VisitorLogs     int          `json:"visitor_logs" db:"visitor_logs"`
+	ActiveSessions  int          `json:"active_sessions" db:"active_sessions"`
+	LastActivityAt  sql.NullTime `json:"last_activity_at,omitempty" db:"last_activity_at"`
+}
+
+type SuspendTenantRequest struct {
+	Reason string `json:"reason" validate:"required"`
+}
+
+// ResetTenantAdminRequest restores a tenant admin's access to their account
+type ResetTenantAdminRequest struct {
+	UserID            string `json:"user_id" validate:"required"`
+	GrantAdminRole    bool   `json:"grant_admin_role"`    // Make the user Admin of the tenant (e.g. no admin left)
+	DisableTwoFactor  bool   `json:"disable_two_factor"`  // Lost authenticator and recovery codes
+	SendPasswordReset *bool  `json:"send_password_reset"` // Default true
+}
+
+type PlatformAuditLog struct {
+	ID             string                 `json:"id" db:"id"`
+	ActorUserID    sql.NullString         `json:"actor_user_id,omitempty" db:"actor_user_id"`
+	ActorEmail     sql.NullString         `json:"actor_email,omitempty" db:"actor_email"`
+	Action         string                 `json:"action" db:"action"`
+	Method         sql.NullString         `json:"method,omitempty" db:"method"`
+	Path           sql.NullString         `json:"path,omitempty" db:"path"`
+	StatusCode     sql.NullInt64          `json:"status_code,omitempty" db:"status_code"`
+	TargetTenantID sql.NullString         `json:"target_tenant_id,omitempty" db:"target_tenant_id"`
+	TargetUserID   sql.NullString         `json:"target_user_id,omitempty" db:"target_user_id"`
+	DetailsJSON    []byte                 `json:"-" db:"details"` // JSONB: Details
+	Details        map[string]interface{} `json:"details" db:"-"`
+	IPAddress      sql.NullString         `json:"ip_address,omitempty" db:"ip_address"`
+	CreatedAt      time.Time              `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,97 @@
+package models
+
+import "time"
+
+// Household is a family card (Kartu Keluarga) living in a unit. The KK number is stored encrypted.
+type Household struct {
+	ID          string     `json:"id" db:"id"`
+	TenantID    string     `json:"tenant_id" db:"tenant_id"`
+	UnitID      *string    `json:"unit_id" db:"unit_id"`
+	UnitCode    *string    `json:"unit_code" db:"unit_code"`
+	KKNumber    string     `json:"kk_number" db:"-"`
+	KKEncrypted string     `json:"-" db:"kk_number_encrypted"`
+	Address     *string    `json:"address" db:"address"`
+	Notes       *string    `json:"notes" db:"notes"`
+	HeadName    *string    `json:"head_name" db:"head_name"`
+	MemberCount int        `json:"member_count" db:"member_count"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+	Members     []Resident `json:"members,omitempty" db:"-"`
+}
+
+// Resident is a person in the data warga register, whether or not they have a login.
+// The NIK is stored encrypted; lists only show it masked.
+type Resident struct {
+	ID             string    `json:"id" db:"id"`
+	TenantID       string    `json:"tenant_id" db:"tenant_id"`
+	HouseholdID    string    `json:"household_id" db:"household_id"`
+	UnitID         *string   `json:"unit_id" db:"unit_id"`
+	UnitCode       *string   `json:"unit_code" db:"unit_code"`
+	UserID         *string   `json:"user_id" db:"user_id"`
+	FullName       string    `json:"full_name" db:"full_name"`
+	NIK            string    `json:"nik" db:"-"`
+	NIKEncrypted   string    `json:"-" db:"nik_encrypted"`
+	Gender         string    `json:"gender" db:"gender"`
+	BirthPlace     *string   `json:"birth_place" db:"birth_place"`
+	BirthDate      string    `json:"birth_date" db:"birth_date"` // YYYY-MM-DD
+	Relationship   string    `json:"relationship" db:"relationship"`
+	Religion       *string   `json:"religion" db:"religion"`
+	MaritalStatus  *string   `json:"marital_status" db:"marital_status"`
+	Occupation     *string   `json:"occupation" db:"occupation"`
+	DomicileStatus string    `json:"domicile_status" db:"domicile_status"`
+	Phone          *string   `json:"phone" db:"phone"`
+	MovedInAt      *string   `json:"moved_in_at" db:"moved_in_at"` // YYYY-MM-DD
+	Notes          *string   `json:"notes" db:"notes"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type CreateHouseholdRequest struct {
+	KKNumber string  `json:"kk_number" validate:"required,len=16,numeric"`
+	UnitID   *string `json:"unit_id,omitempty"`
+	Address  *string `json:"address,omitempty"`
+	Notes    *string `json:"notes,omitempty"`
+}
+
+type UpdateHouseholdRequest struct {
+	KKNumber *string `json:"kk_number,omitempty" validate:"omitempty,len=16,numeric"`
+	UnitID   *string `json:"unit_id,omitempty"` // "" moves the household out of its unit
+	Address  *string `json:"address,omitempty"`
+	Notes    *string `json:"notes,omitempty"`
+}
+
+type CreateResidentRequest struct {
+	HouseholdID    string  `json:"household_id" validate:"required"`
+	UserID         *string `json:"user_id,omitempty"`
+	FullName       string  `json:"full_name" validate:"required"`
+	NIK            string  `json:"nik" validate:"required,len=16,numeric"`
+	Gender         string  `json:"gender" validate:"required,oneof=L P"`
+	BirthPlace     *string `json:"birth_place,omitempty"`
+	BirthDate      string  `json:"birth_date" validate:"required"` // YYYY-MM-DD
+	Relationship   string  `json:"relationship" validate:"required"`
+	Religion       *string `json:"religion,omitempty"`
+	MaritalStatus  *string `json:"marital_status,omitempty"`
+	Occupation     *string `json:"occupation,omitempty"`
+	DomicileStatus string  `json:"domicile_status" validate:"required,oneof=tetap kontrak kos"`
+	Phone          *string `json:"phone,omitempty"`
+	MovedInAt      *string `json:"moved_in_at,omitempty"` // YYYY-MM-DD
+	Notes          *string `json:"notes,omitempty"`
+}
+
+type UpdateResidentRequest struct {
+	HouseholdID    *string `json:"household_id,omitempty"`
+	UserID         *string `json:"user_id,omitempty"` // "" unlinks the user account
+	FullName       *string `json:"full_name,omitempty"`
+	NIK            *string `json:"nik,omitempty" validate:"omitempty,len=16,numeric"`
+	Gender         *string `json:"gender,omitempty" validate:"omitempty,oneof=L P"`
+	BirthPlace     *string `json:"birth_place,omitempty"`
+	BirthDate      *string `json:"birth_date,omitempty"`
+	Relationship   *string `json:"relationship,omitempty"`
+	Religion       *string `json:"religion,omitempty"`
+	MaritalStatus  *string `json:"marital_status,omitempty"`
+	Occupation     *string `json:"occupation,omitempty"`
+	DomicileStatus *string `json:"domicile_status,omitempty" validate:"omitempty,oneof=tetap kontrak kos"`
+	Phone          *string `json:"phone,omitempty"`
+	MovedInAt      *string `json:"moved_in_at,omitempty"`
+	Notes          *string `json:"notes,omitempty"`
+}
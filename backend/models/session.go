@@ -0,0 +1,29 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type UserSession struct {
+	ID            string         `json:"id" db:"id"`
+	UserID        string         `json:"user_id" db:"user_id"`
+	TenantID      string         `json:"tenant_id" db:"tenant_id"`
+	TenantName    string         `json:"tenant_name,omitempty" db:"tenant_name"`
+	UserAgent     sql.NullString `json:"user_agent,omitempty" db:"user_agent"`
+	IPAddress     sql.NullString `json:"ip_address,omitempty" db:"ip_address"`
+	CreatedAt     time.Time      `json:"created_at" db:"created_at"`
+	LastUsedAt    time.Time      `json:"last_used_at" db:"last_used_at"`
+	ExpiresAt     time.Time      `json:"expires_at" db:"expires_at"`
+	RevokedAt     sql.NullTime   `json:"revoked_at,omitempty" db:"revoked_at"`
+	RevokedReason sql.NullString `json:"revoked_reason,omitempty" db:"revoked_reason"`
+	Current       bool           `json:"current" db:"-"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type LogoutAllRequest struct {
+	KeepCurrent bool `json:"keep_current"` // Keep the session making the request logged in
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"database/sql"
 	"time"
 )
 
@@ -14,11 +15,20 @@ type Tenant struct {
 	Settings  string    `json:"settings" db:"settings"` // JSONB stored as string
 	Modules   string    `json:"modules" db:"modules"`   // JSONB stored as string
 	Status    string    `json:"status" db:"status"`
+	Plan      string    `json:"plan" db:"plan"`
+	Level          string         `json:"level" db:"level"`                               // rt or rw
+	ParentTenantID sql.NullString `json:"parent_tenant_id,omitempty" db:"parent_tenant_id"` // RW of an RT
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
 }
 
+// Tenant levels: an RW groups several RTs
+const (
+	TenantLevelRT = "rt"
+	TenantLevelRW = "rw"
+)
+
 type CreateTenantRequest struct {
 	Name    string  `json:"name" validate:"required"`
 	Code    string  `json:"code" validate:"required,alphanum"`
@@ -48,3 +58,116 @@ type UpdateTenantRequest struct {
 
 
 
+
+// TenantMembership is one tenant the current user belongs to
+type TenantMembership struct {
+	TenantID   string         `json:"tenant_id" db:"tenant_id"`
+	TenantName string         `json:"tenant_name" db:"tenant_name"`
+	TenantCode string         `json:"tenant_code" db:"tenant_code"`
+	RoleID     sql.NullString `json:"role_id,omitempty" db:"role_id"`
+	RoleName   sql.NullString `json:"role_name,omitempty" db:"role_name"`
+	UnitID     sql.NullString `json:"unit_id,omitempty" db:"unit_id"`
+	UnitCode   sql.NullString `json:"unit_code,omitempty" db:"unit_code"`
+	IsDefault  bool           `json:"is_default" db:"is_default"`
+	IsCurrent  bool           `json:"is_current" db:"-"`
+}
+
+type SwitchTenantRequest struct {
+	TenantID string `json:"tenant_id" validate:"required"`
+}
+
+type SetDefaultTenantRequest struct {
+	TenantID *string `json:"tenant_id"` // null clears the default
+}
+
+// TenantSecuritySettings is stored under tenants.settings -> 'security'
+type TenantSecuritySettings struct {
+	Require2FARoleIDs []string `json:"require_2fa_role_ids"` // Roles that must use two-factor authentication
+}
+
+// TenantModule is a registered module and whether the tenant has it enabled
+type TenantModule struct {
+	Key         string `json:"key"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Enabled     bool   `json:"enabled"`
+	InPlan      bool   `json:"in_plan"` // Only modules of the tenant's plan can be enabled
+}
+
+// UpdateTenantModulesRequest switches modules on or off; keys left out keep their current state
+type UpdateTenantModulesRequest struct {
+	Modules map[string]bool `json:"modules"`
+}
+
+// ChildTenant is an RT as seen from its RW
+type ChildTenant struct {
+	ID          string `json:"id" db:"id"`
+	Name        string `json:"name" db:"name"`
+	Code        string `json:"code" db:"code"`
+	Status      string `json:"status" db:"status"`
+	MemberCount int    `json:"member_count" db:"member_count"`
+	UnitCount   int    `json:"unit_count" db:"unit_count"`
+}
+
+// RWTenantSummary is one row of the RW dashboard rollup
+type RWTenantSummary struct {
+	TenantID           string  `json:"tenant_id,omitempty" db:"tenant_id"`
+	TenantName         string  `json:"tenant_name" db:"tenant_name"`
+	Level              string  `json:"level,omitempty" db:"level"`
+	PendingCount       int     `json:"pending_count" db:"pending_count"`
+	OverdueCount       int     `json:"overdue_count" db:"overdue_count"`
+	OutstandingAmount  float64 `json:"outstanding_amount" db:"outstanding_amount"`
+	CollectedThisMonth float64 `json:"collected_this_month" db:"collected_this_month"`
+	OpenComplaints     int     `json:"open_complaints" db:"open_complaints"`
+	Complaints30Days   int     `json:"complaints_30_days" db:"complaints_30_days"`
+	ActivePanicAlerts  int     `json:"active_panic_alerts" db:"active_panic_alerts"`
+	PanicAlerts30Days  int     `json:"panic_alerts_30_days" db:"panic_alerts_30_days"`
+}
+
+// SetTenantHierarchyRequest places a tenant in the RW/RT structure (platform console)
+type SetTenantHierarchyRequest struct {
+	Level          string  `json:"level" validate:"required,oneof=rt rw"`
+	ParentTenantID *string `json:"parent_tenant_id"` // RW of an RT; null for a standalone RT or an RW
+}
+
+// TenantDomain is a custom domain mapped to a tenant; it resolves only once its DNS TXT record is verified
+type TenantDomain struct {
+	ID                string         `json:"id" db:"id"`
+	TenantID          string         `json:"tenant_id" db:"tenant_id"`
+	Domain            string         `json:"domain" db:"domain"`
+	VerificationToken string         `json:"verification_token" db:"verification_token"`
+	VerifiedAt        sql.NullTime   `json:"verified_at,omitempty" db:"verified_at"`
+	LastCheckedAt     sql.NullTime   `json:"last_checked_at,omitempty" db:"last_checked_at"`
+	LastError         sql.NullString `json:"last_error,omitempty" db:"last_error"`
+	CreatedBy         sql.NullString `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt         time.Time      `json:"created_at" db:"created_at"`
+	// DNS record to create for verification
+	RecordName  string `json:"record_name" db:"-"`
+	RecordValue string `json:"record_value" db:"-"`
+}
+
+type CreateTenantDomainRequest struct {
+	Domain string `json:"domain"`
+}
+
+// PublicTenant is the branding public pages and the login page show for a tenant resolved from the host
+type PublicTenant struct {
+	Name              string                   `json:"name"`
+	Code              string                   `json:"code"`
+	Level             string                   `json:"level"`
+	Address           *string                  `json:"address,omitempty"`
+	Phone             *string                  `json:"phone,omitempty"`
+	Email             *string                  `json:"email,omitempty"`
+	Letterhead        LetterheadSettings       `json:"letterhead"`
+	IdentityProviders []PublicIdentityProvider `json:"identity_providers"`
+}
+
+// PublicDocumentVerification confirms that a letter was issued by the tenant, without personal details
+type PublicDocumentVerification struct {
+	ID            string     `json:"id"`
+	DocumentType  string     `json:"document_type"`
+	Status        string     `json:"status"`
+	ApplicantName string     `json:"applicant_name"` // Masked, e.g. "Bu** Sa*****"
+	ApprovedAt    *time.Time `json:"approved_at,omitempty"`
+	IssuedBy      string     `json:"issued_by"`
+}
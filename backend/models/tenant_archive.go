@@ -0,0 +1,68 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// TenantArchiveFormat identifies a RukunOS tenant archive; the version changes when entity files change shape
+const (
+	TenantArchiveFormat  = "rukunos-tenant-archive"
+	TenantArchiveVersion = 1
+)
+
+// TenantArchiveManifest is manifest.json at the root of a tenant archive
+type TenantArchiveManifest struct {
+	Format     string              `json:"format"`
+	Version    int                 `json:"version"`
+	ExportedAt time.Time           `json:"exported_at"`
+	Source     TenantArchiveSource `json:"source"`
+	Entities   map[string]int      `json:"entities"` // Entity file name (without .json) and its row count
+	Notes      []string            `json:"notes,omitempty"`
+}
+
+// TenantArchiveSource describes the tenant an archive was exported from
+type TenantArchiveSource struct {
+	TenantID string `json:"tenant_id"`
+	Name     string `json:"name"`
+	Code     string `json:"code"`
+}
+
+// TenantArchiveTenant is tenant.json: the tenant's own profile, settings and modules
+type TenantArchiveTenant struct {
+	Name     string          `json:"name"`
+	Code     string          `json:"code"`
+	Address  *string         `json:"address"`
+	Phone    *string         `json:"phone"`
+	Email    *string         `json:"email"`
+	Level    string          `json:"level"`
+	Settings json.RawMessage `json:"settings"`
+	Modules  json.RawMessage `json:"modules"`
+}
+
+// TenantArchiveConflict is a row of the archive that could not be imported as-is
+type TenantArchiveConflict struct {
+	Entity   string `json:"entity"`
+	SourceID string `json:"source_id,omitempty"`
+	Action   string `json:"action"` // skipped, linked, cleared
+	Message  string `json:"message"`
+}
+
+// TenantArchiveEntityResult counts what happened to the rows of one entity file
+type TenantArchiveEntityResult struct {
+	Imported int `json:"imported"`
+	Linked   int `json:"linked,omitempty"` // Rows mapped onto an existing record (users by email, system roles by name)
+	Skipped  int `json:"skipped"`
+}
+
+// TenantImportReport is returned by a tenant archive import (or its dry run)
+type TenantImportReport struct {
+	DryRun    bool                                 `json:"dry_run"`
+	TenantID  string                               `json:"tenant_id,omitempty"`
+	Name      string                               `json:"name"`
+	Code      string                               `json:"code"`
+	Source    TenantArchiveSource                  `json:"source"`
+	Entities  map[string]TenantArchiveEntityResult `json:"entities"`
+	Conflicts []TenantArchiveConflict              `json:"conflicts"`
+	Notes     []string                             `json:"notes,omitempty"`
+}
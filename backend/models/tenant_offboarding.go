@@ -0,0 +1,60 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// TenantDeletionRequest is a request to delete a tenant permanently. The tenant keeps working during
+// the grace period and can cancel; afterwards it is exported to an archive and purged.
+type TenantDeletionRequest struct {
+	ID               string          `json:"id" db:"id"`
+	TenantID         string          `json:"tenant_id" db:"tenant_id"` // Kept after the tenant is purged
+	TenantName       string          `json:"tenant_name" db:"tenant_name"`
+	TenantCode       string          `json:"tenant_code" db:"tenant_code"`
+	Status           string          `json:"status" db:"status"` // pending, cancelled, purged
+	Reason           sql.NullString  `json:"reason,omitempty" db:"reason"`
+	RequestedBy      sql.NullString  `json:"requested_by,omitempty" db:"requested_by"`
+	RequestedByName  sql.NullString  `json:"requested_by_name,omitempty" db:"requested_by_name"`
+	RequestedVia     string          `json:"requested_via" db:"requested_via"` // tenant, platform
+	PurgeAfter       time.Time       `json:"purge_after" db:"purge_after"`     // End of the grace period
+	CancelledAt      sql.NullTime    `json:"cancelled_at,omitempty" db:"cancelled_at"`
+	CancelledBy      sql.NullString  `json:"cancelled_by,omitempty" db:"cancelled_by"`
+	ExportedAt       sql.NullTime    `json:"exported_at,omitempty" db:"exported_at"`
+	ArchiveAvailable bool            `json:"archive_available" db:"archive_available"`
+	ArchiveExpiresAt sql.NullTime    `json:"archive_expires_at,omitempty" db:"archive_expires_at"`
+	PurgedAt         sql.NullTime    `json:"purged_at,omitempty" db:"purged_at"`
+	PurgeSummaryJSON []byte          `json:"-" db:"purge_summary"` // JSONB: PurgeSummary
+	PurgeSummary     json.RawMessage `json:"purge_summary,omitempty" db:"-"`
+	LastError        sql.NullString  `json:"last_error,omitempty" db:"last_error"` // Last failed purge attempt; retried hourly
+	CreatedAt        time.Time       `json:"created_at" db:"created_at"`
+}
+
+type CreateTenantDeletionRequest struct {
+	Reason      string `json:"reason"`
+	ConfirmCode string `json:"confirm_code"` // Must equal the tenant code
+	GraceDays   *int   `json:"grace_days"`   // Platform console only; tenants always get the default grace period
+}
+
+// DataPurgeLog records rows removed permanently, by a retention policy or a tenant deletion
+type DataPurgeLog struct {
+	ID                string         `json:"id" db:"id"`
+	TenantID          string         `json:"tenant_id" db:"tenant_id"`
+	DeletionRequestID sql.NullString `json:"deletion_request_id,omitempty" db:"deletion_request_id"`
+	Entity            string         `json:"entity" db:"entity"`
+	Reason            string         `json:"reason" db:"reason"` // retention, deleted_records, tenant_deletion
+	RowsDeleted       int            `json:"rows_deleted" db:"rows_deleted"`
+	RetentionDays     sql.NullInt64  `json:"retention_days,omitempty" db:"retention_days"`
+	CreatedAt         time.Time      `json:"created_at" db:"created_at"`
+}
+
+// TenantRetentionPolicy is the retention of one entity as shown to tenant admins
+type TenantRetentionPolicy struct {
+	Entity      string `json:"entity"`
+	Name        string `json:"name"`
+	Days        int    `json:"days"` // 0 = kept until the tenant is deleted
+	DefaultDays int    `json:"default_days"`
+	MinDays     int    `json:"min_days"`
+	Applies     string `json:"applies"` // Which records are removed once they are old enough
+}
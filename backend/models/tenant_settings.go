@@ -0,0 +1,70 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// TenantSettings is the typed document stored in tenants.settings
+type TenantSettings struct {
+	Timezone   string                 `json:"timezone"` // IANA name, e.g. Asia/Jakarta (WIB), Asia/Makassar (WITA), Asia/Jayapura (WIT)
+	Currency   CurrencySettings       `json:"currency"`
+	Billing    BillingSettings        `json:"billing"`
+	Letterhead LetterheadSettings     `json:"letterhead"`
+	Reminders  ReminderSettings       `json:"reminders"`
+	Security   TenantSecuritySettings `json:"security"`
+	Retention  map[string]int         `json:"retention"` // Days to keep each entity (visitor_logs, ...); 0 = until the tenant is deleted
+}
+
+// CurrencySettings controls how computed amounts (late fees) are rounded
+type CurrencySettings struct {
+	RoundingUnit int    `json:"rounding_unit"` // 1, 10, 100, 500 or 1000 rupiah
+	RoundingMode string `json:"rounding_mode"` // nearest, up, down
+}
+
+// BillingSettings are used when a bill or billing template does not say otherwise
+type BillingSettings struct {
+	DefaultDueDay int             `json:"default_due_day"` // Day of the period month; clamped to the month's last day
+	LateFee       LateFeeSettings `json:"late_fee"`
+}
+
+// LateFeeSettings is the tenant's late fee when a bill's billing template has none
+type LateFeeSettings struct {
+	Type       string  `json:"type"`       // fixed, percentage, none
+	Amount     float64 `json:"amount"`     // Per day overdue (fixed)
+	Percentage float64 `json:"percentage"` // Of the bill amount per day overdue (percentage)
+	Max        float64 `json:"max"`        // 0 = no cap
+	GraceDays  int     `json:"grace_days"` // Days after the due date before late fees start
+}
+
+// LetterheadSettings appear on letters issued by the tenant (surat pengantar)
+type LetterheadSettings struct {
+	Title           string `json:"title"` // e.g. "RUKUN TETANGGA 05 / RUKUN WARGA 02"
+	Address         string `json:"address"`
+	City            string `json:"city"` // Place of signing
+	ChairpersonName string `json:"chairperson_name"`
+	SecretaryName   string `json:"secretary_name"`
+}
+
+// ReminderSettings are tenant-wide preferences for automated bill reminders
+type ReminderSettings struct {
+	Enabled  bool   `json:"enabled"`
+	SendHour int    `json:"send_hour"` // Local hour (tenant timezone) reminders go out
+	SignOff  string `json:"sign_off"`  // Appended to every reminder, e.g. "Bendahara RT 05"
+}
+
+// TenantSettingsChange is one entry of the tenant settings history
+type TenantSettingsChange struct {
+	ID            string         `json:"id" db:"id"`
+	TenantID      string         `json:"tenant_id" db:"tenant_id"`
+	ChangedBy     sql.NullString `json:"changed_by,omitempty" db:"changed_by"`
+	ChangedByName sql.NullString `json:"changed_by_name,omitempty" db:"changed_by_name"`
+	ChangedFields pq.StringArray `json:"changed_fields" db:"changed_fields"` // Dotted paths, e.g. billing.late_fee.amount
+	PreviousJSON  []byte         `json:"-" db:"previous_settings"`           // JSONB: Previous
+	Previous      TenantSettings `json:"previous" db:"-"`
+	SettingsJSON  []byte         `json:"-" db:"new_settings"` // JSONB: Settings
+	Settings      TenantSettings `json:"settings" db:"-"`
+	CreatedAt     time.Time      `json:"created_at" db:"created_at"`
+}
@@ -34,6 +34,8 @@ type RegisterRequest struct {
 	TenantAddress   *string `json:"tenant_address,omitempty"`
 	// For warga registration (join existing tenant)
 	TenantCodeJoin  *string `json:"tenant_code_join,omitempty"` // Alias for tenant_code when joining
+	InvitationToken *string `json:"invitation_token,omitempty"` // Joins immediately instead of waiting for approval
+	JoinMessage     *string `json:"join_message,omitempty"`     // Shown to admins with the join request
 }
 
 type LoginRequest struct {
@@ -49,3 +51,36 @@ type AuthResponse struct {
 	Tenants  []string `json:"tenants,omitempty"` // List of tenant IDs if user has multiple
 }
 
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=6"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type RequestOTPRequest struct {
+	Phone   string `json:"phone" validate:"required"`
+	Channel string `json:"channel,omitempty"` // whatsapp (default) or sms
+}
+
+type VerifyOTPRequest struct {
+	Phone    string  `json:"phone" validate:"required"`
+	Code     string  `json:"code" validate:"required"`
+	TenantID *string `json:"tenant_id,omitempty"` // Optional: jika user punya multiple tenants
+}
+
+type MFAChallengeRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code,omitempty"` // TOTP code or recovery code
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required"` // TOTP code or recovery code
+}
@@ -0,0 +1,404 @@
+// Package oidc implements the relying-party side of OpenID Connect: provider discovery,
+// JWKS caching and ID token validation (RS256/ES256).
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	discoveryTTL = time.Hour
+	jwksTTL      = time.Hour
+	// jwksMinRefresh limits refetching the key set when a token has an unknown kid (key rotation)
+	jwksMinRefresh = time.Minute
+)
+
+// maxResponseSize caps discovery, JWKS and userinfo responses
+const maxResponseSize = 1 << 20
+
+// Issuers are entered by tenant admins, so every request to a provider is an outbound request an admin
+// controls. Provider URLs must be https and may only resolve to public addresses, checked when dialing
+// so DNS cannot point a checked name at an internal address afterwards.
+var (
+	// ErrInsecureURL is returned for an issuer or provider endpoint that is not an https URL
+	ErrInsecureURL = errors.New("provider URLs must be https")
+	// ErrDisallowedAddress is returned when a provider resolves to a loopback, private or link-local address
+	ErrDisallowedAddress = errors.New("provider address is not public")
+)
+
+// allowLocalProviders lets tests run providers over plain HTTP on loopback
+var allowLocalProviders = false
+
+// blockedNetworks are non-public ranges net.IP has no predicate for
+var blockedNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range []string{"0.0.0.0/8", "100.64.0.0/10", "192.0.0.0/24", "198.18.0.0/15", "240.0.0.0/4", "64:ff9b::/96"} {
+		_, network, _ := net.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+var httpClient = newHTTPClient()
+
+// HTTPClient is the client for every request to a provider, including the token exchange
+func HTTPClient() *http.Client {
+	return httpClient
+}
+
+func newHTTPClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: checkDialAddress}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // A proxy would dial on our behalf, past the address check
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return checkURL(req.URL.String())
+		},
+	}
+}
+
+// publicAddress reports whether ip is on the public internet
+func publicAddress(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkDialAddress runs for every connection, after DNS resolution
+func checkDialAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return ErrDisallowedAddress
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ErrDisallowedAddress
+	}
+	if allowLocalProviders && ip.IsLoopback() {
+		return nil
+	}
+	if !publicAddress(ip) {
+		return ErrDisallowedAddress
+	}
+	return nil
+}
+
+// checkURL requires an absolute https URL
+func checkURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.User != nil {
+		return ErrInsecureURL
+	}
+	if u.Scheme != "https" && !(allowLocalProviders && u.Scheme == "http") {
+		return ErrInsecureURL
+	}
+	return nil
+}
+
+// checkMetadata requires every endpoint of a discovery document to be an https URL
+func checkMetadata(metadata *Metadata) error {
+	endpoints := []string{metadata.AuthorizationEndpoint, metadata.TokenEndpoint, metadata.JWKSURI}
+	if metadata.UserinfoEndpoint != "" {
+		endpoints = append(endpoints, metadata.UserinfoEndpoint)
+	}
+	for _, endpoint := range endpoints {
+		if err := checkURL(endpoint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Metadata is the subset of the discovery document (/.well-known/openid-configuration) we use
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type cachedMetadata struct {
+	metadata  *Metadata
+	fetchedAt time.Time
+}
+
+type keySet struct {
+	keys      map[string]interface{} // kid -> *rsa.PublicKey or *ecdsa.PublicKey
+	fetchedAt time.Time
+}
+
+var (
+	mu            sync.Mutex
+	metadataCache = map[string]cachedMetadata{}
+	keySetCache   = map[string]*keySet{}
+)
+
+// Discover fetches (and caches) the provider metadata for issuer
+func Discover(issuer string) (*Metadata, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+	if err := checkURL(issuer); err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	cached, ok := metadataCache[issuer]
+	mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < discoveryTTL {
+		return cached.metadata, nil
+	}
+
+	var metadata Metadata
+	if err := getJSON(issuer+"/.well-known/openid-configuration", &metadata); err != nil {
+		return nil, fmt.Errorf("discovery failed: %w", err)
+	}
+	// The issuer in the document must match the configured one (OIDC Discovery 4.3)
+	if strings.TrimSuffix(metadata.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("discovery issuer %q does not match %q", metadata.Issuer, issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document is missing required endpoints")
+	}
+	if err := checkMetadata(&metadata); err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	metadataCache[issuer] = cachedMetadata{metadata: &metadata, fetchedAt: time.Now()}
+	mu.Unlock()
+	return &metadata, nil
+}
+
+// VerifyIDToken checks the ID token signature against the provider's JWKS and validates
+// iss, aud, exp and nonce. It returns the token claims.
+func VerifyIDToken(metadata *Metadata, clientID, rawToken, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return publicKey(metadata.JWKSURI, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384"}),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %v", err)
+	}
+
+	if nonce != "" {
+		if claimed, _ := claims["nonce"].(string); claimed != nonce {
+			return nil, fmt.Errorf("invalid ID token: nonce mismatch")
+		}
+	}
+	// With several audiences the token must be issued to us (OIDC Core 3.1.3.7)
+	if azp, ok := claims["azp"].(string); ok && azp != clientID {
+		return nil, fmt.Errorf("invalid ID token: azp %q is not this client", azp)
+	}
+	return claims, nil
+}
+
+// FetchUserinfo calls the userinfo endpoint with an access token
+func FetchUserinfo(metadata *Metadata, accessToken string) (map[string]interface{}, error) {
+	if metadata.UserinfoEndpoint == "" {
+		return nil, fmt.Errorf("provider has no userinfo endpoint")
+	}
+	req, err := http.NewRequest(http.MethodGet, metadata.UserinfoEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("userinfo returned status %d", resp.StatusCode)
+	}
+
+	claims := map[string]interface{}{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// publicKey returns the key for kid, refetching the key set when it is stale or kid is unknown
+func publicKey(jwksURI, kid string) (interface{}, error) {
+	mu.Lock()
+	set := keySetCache[jwksURI]
+	mu.Unlock()
+
+	if set != nil && time.Since(set.fetchedAt) < jwksTTL {
+		if key := set.lookup(kid); key != nil {
+			return key, nil
+		}
+		if time.Since(set.fetchedAt) < jwksMinRefresh {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+	}
+
+	fresh, err := fetchKeySet(jwksURI)
+	if err != nil {
+		return nil, err
+	}
+	mu.Lock()
+	keySetCache[jwksURI] = fresh
+	mu.Unlock()
+
+	if key := fresh.lookup(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookup finds a key by kid; tokens without kid are accepted when the set holds a single key
+func (s *keySet) lookup(kid string) interface{} {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key
+		}
+	}
+	return s.keys[kid]
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func fetchKeySet(jwksURI string) (*keySet, error) {
+	var document struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(jwksURI, &document); err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+
+	set := &keySet{keys: map[string]interface{}{}, fetchedAt: time.Now()}
+	for _, jwk := range document.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue // Skip key types we do not support
+		}
+		set.keys[jwk.Kid] = key
+	}
+	if len(set.keys) == 0 {
+		return nil, fmt.Errorf("JWKS contains no usable signing keys")
+	}
+	return set, nil
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// getJSON fetches a provider document of at most maxResponseSize bytes
+func getJSON(url string, v interface{}) error {
+	if err := checkURL(url); err != nil {
+		return err
+	}
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		// Keep the URL out of the error; admins see it, and it would echo internal details
+		for _, sentinel := range []error{ErrDisallowedAddress, ErrInsecureURL} {
+			if errors.Is(err, sentinel) {
+				return sentinel
+			}
+		}
+		return errors.New("request failed")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize+1))
+	if err != nil {
+		return err
+	}
+	if len(body) > maxResponseSize {
+		return fmt.Errorf("response is larger than %d bytes", maxResponseSize)
+	}
+	return json.Unmarshal(body, v)
+}
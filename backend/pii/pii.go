@@ -0,0 +1,112 @@
+// Package pii encrypts personal identifiers (NIK, KK numbers) at rest with AES-256-GCM and derives
+// blind indexes (HMAC-SHA256) so an exact value can be searched and kept unique without decrypting.
+// The key is PII_ENCRYPTION_KEY: 32 bytes, base64-encoded (e.g. `openssl rand -base64 32`).
+// Every ciphertext is bound to the ID of its owner (the tenant of a NIK, the user of a TOTP secret),
+// so a value copied into another tenant's row does not decrypt there.
+package pii
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// version prefixes every ciphertext so the scheme or key can be rotated later
+const version = "v1:"
+
+// ErrNoKey is returned when PII_ENCRYPTION_KEY is missing or not a base64-encoded 32-byte key
+var ErrNoKey = errors.New("PII_ENCRYPTION_KEY is not set to a base64-encoded 32-byte key")
+
+var (
+	loadOnce sync.Once
+	aead     cipher.AEAD
+	indexKey []byte
+	loadErr  error
+)
+
+func load() error {
+	loadOnce.Do(func() {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(os.Getenv("PII_ENCRYPTION_KEY")))
+		if err != nil || len(key) != 32 {
+			loadErr = ErrNoKey
+			return
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			loadErr = err
+			return
+		}
+		if aead, err = cipher.NewGCM(block); err != nil {
+			loadErr = err
+			return
+		}
+		// The blind index gets its own key, so an index value reveals nothing about the encryption key
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte("rukunos blind index"))
+		indexKey = mac.Sum(nil)
+	})
+	return loadErr
+}
+
+// Encrypt returns the plaintext sealed with a random nonce, as "v1:" + base64(nonce || ciphertext).
+// owner is authenticated with it (GCM additional data) and must be given again to decrypt.
+func Encrypt(plaintext, owner string) (string, error) {
+	if err := load(); err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(owner))
+	return version + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value produced by Encrypt for the same owner
+func Decrypt(value, owner string) (string, error) {
+	if err := load(); err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(value, version) {
+		return "", fmt.Errorf("unsupported ciphertext version")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, version))
+	if err != nil {
+		return "", fmt.Errorf("invalid ciphertext: %v", err)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("invalid ciphertext: too short")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(owner))
+	if err != nil {
+		return "", fmt.Errorf("invalid ciphertext: %v", err)
+	}
+	return string(plaintext), nil
+}
+
+// BlindIndex returns a deterministic hex digest of the value, for exact-match lookups and unique indexes
+func BlindIndex(value string) (string, error) {
+	if err := load(); err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, indexKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Mask keeps the first six digits (the region code of a NIK or KK number) and the last two, e.g. 320101********07
+func Mask(value string) string {
+	if len(value) <= 8 {
+		return strings.Repeat("*", len(value))
+	}
+	return value[:6] + strings.Repeat("*", len(value)-8) + value[len(value)-2:]
+}
@@ -0,0 +1,113 @@
+package pii
+
+import (
+	"encoding/base64"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testKey = "cnVrdW5vcy1kZXYtcGlpLWtleS1ub3QtZm9yLXByb2Q="
+
+// useKey sets PII_ENCRYPTION_KEY and makes the next call load it again
+func useKey(t *testing.T, key string) {
+	t.Helper()
+	t.Setenv("PII_ENCRYPTION_KEY", key)
+	loadOnce, aead, indexKey, loadErr = sync.Once{}, nil, nil, nil
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	useKey(t, testKey)
+
+	encrypted, err := Encrypt("3201010101900007", "tenant-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encrypted, version) || strings.Contains(encrypted, "3201010101900007") {
+		t.Fatalf("Encrypt returned %q", encrypted)
+	}
+	if again, _ := Encrypt("3201010101900007", "tenant-1"); again == encrypted {
+		t.Fatal("Two encryptions of the same value are identical; the nonce is not random")
+	}
+
+	value, err := Decrypt(encrypted, "tenant-1")
+	if err != nil || value != "3201010101900007" {
+		t.Fatalf("Decrypt = %q, %v", value, err)
+	}
+}
+
+func TestDecryptRejectsTampering(t *testing.T) {
+	useKey(t, testKey)
+	encrypted, err := Encrypt("3201010101900007", "tenant-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(encrypted, version))
+
+	for _, i := range []int{0, len(sealed) / 2, len(sealed) - 1} {
+		tampered := append([]byte{}, sealed...)
+		tampered[i] ^= 0x01
+		if _, err := Decrypt(version+base64.StdEncoding.EncodeToString(tampered), "tenant-1"); err == nil {
+			t.Errorf("Decrypt accepted a ciphertext with byte %d flipped", i)
+		}
+	}
+	for _, bad := range []string{"", "3201010101900007", "v0:" + strings.TrimPrefix(encrypted, version), version + "not base64!", version + "AAAA"} {
+		if _, err := Decrypt(bad, "tenant-1"); err == nil {
+			t.Errorf("Decrypt accepted %q", bad)
+		}
+	}
+}
+
+func TestDecryptRejectsOtherOwner(t *testing.T) {
+	useKey(t, testKey)
+	encrypted, err := Encrypt("3201010101900007", "tenant-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decrypt(encrypted, "tenant-2"); err == nil {
+		t.Fatal("A ciphertext of one tenant decrypted for another")
+	}
+}
+
+func TestDecryptRejectsWrongKey(t *testing.T) {
+	useKey(t, testKey)
+	encrypted, err := Encrypt("3201010101900007", "tenant-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, _ := BlindIndex("3201010101900007")
+
+	useKey(t, base64.StdEncoding.EncodeToString([]byte("another-32-byte-key-for-testing!")))
+	if _, err := Decrypt(encrypted, "tenant-1"); err == nil {
+		t.Fatal("Decrypt succeeded with another key")
+	}
+	if other, _ := BlindIndex("3201010101900007"); other == hash {
+		t.Fatal("The blind index does not depend on the key")
+	}
+}
+
+func TestMissingKey(t *testing.T) {
+	for _, key := range []string{"", "not base64!", base64.StdEncoding.EncodeToString([]byte("too short"))} {
+		useKey(t, key)
+		if _, err := Encrypt("3201010101900007", "tenant-1"); err != ErrNoKey {
+			t.Errorf("Encrypt with key %q: err = %v, want ErrNoKey", key, err)
+		}
+		if _, err := BlindIndex("3201010101900007"); err != ErrNoKey {
+			t.Errorf("BlindIndex with key %q: err = %v, want ErrNoKey", key, err)
+		}
+	}
+}
+
+func TestMask(t *testing.T) {
+	for _, tc := range []struct{ value, want string }{
+		{"", ""},
+		{"1234", "****"},
+		{"12345678", "********"},
+		{"123456789", "123456*89"},
+		{"3201010101900007", "320101********07"},
+	} {
+		if got := Mask(tc.value); got != tc.want {
+			t.Errorf("Mask(%q) = %q, want %q", tc.value, got, tc.want)
+		}
+	}
+}
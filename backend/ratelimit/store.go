@@ -0,0 +1,147 @@
+// Package ratelimit provides fixed-window counters and progressive account lockout,
+// backed in memory (single instance) or by Postgres (shared across instances).
+package ratelimit
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"sync"
+	"time"
+	"rukunos-backend/db"
+)
+
+// Store keeps expiring counters
+type Store interface {
+	// Incr increments the counter for key, starting a new window of length window if none is active,
+	// and returns the new count and when the window ends
+	Incr(key string, window time.Duration) (int, time.Time, error)
+	// Peek returns the current count and window end without incrementing (0 when no active window)
+	Peek(key string) (int, time.Time, error)
+	// Reset deletes the counter
+	Reset(key string) error
+}
+
+var (
+	defaultStore     Store
+	defaultStoreOnce sync.Once
+)
+
+// Default returns the store selected by RATE_LIMIT_BACKEND ("postgres" or "memory", default "memory")
+func Default() Store {
+	defaultStoreOnce.Do(func() {
+		switch os.Getenv("RATE_LIMIT_BACKEND") {
+		case "postgres":
+			defaultStore = &PostgresStore{}
+			log.Println("Rate limiting: Postgres backend")
+		default:
+			defaultStore = NewMemoryStore()
+			log.Println("Rate limiting: in-memory backend")
+		}
+	})
+	return defaultStore
+}
+
+// MemoryStore keeps counters in process memory; limits are per instance
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	lastSweep time.Time
+}
+
+type memoryEntry struct {
+	count     int
+	expiresAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]*memoryEntry{}, lastSweep: time.Now()}
+}
+
+func (m *MemoryStore) Incr(key string, window time.Duration) (int, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.sweep(now)
+
+	e, ok := m.entries[key]
+	if !ok || !now.Before(e.expiresAt) {
+		e = &memoryEntry{expiresAt: now.Add(window)}
+		m.entries[key] = e
+	}
+	e.count++
+	return e.count, e.expiresAt, nil
+}
+
+func (m *MemoryStore) Peek(key string) (int, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[key]
+	if !ok || !time.Now().Before(e.expiresAt) {
+		return 0, time.Time{}, nil
+	}
+	return e.count, e.expiresAt, nil
+}
+
+func (m *MemoryStore) Reset(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+// sweep drops expired entries at most once a minute
+func (m *MemoryStore) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < time.Minute {
+		return
+	}
+	for key, e := range m.entries {
+		if !now.Before(e.expiresAt) {
+			delete(m.entries, key)
+		}
+	}
+	m.lastSweep = now
+}
+
+// PostgresStore keeps counters in the rate_limit_counters table so all API instances share them
+type PostgresStore struct{}
+
+func (PostgresStore) Incr(key string, window time.Duration) (int, time.Time, error) {
+	var row struct {
+		Count     int       `db:"count"`
+		ExpiresAt time.Time `db:"expires_at"`
+	}
+	err := db.DB.Get(&row, `
+		INSERT INTO rate_limit_counters (key, count, expires_at)
+		VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			count = CASE WHEN rate_limit_counters.expires_at <= NOW() THEN 1 ELSE rate_limit_counters.count + 1 END,
+			expires_at = CASE WHEN rate_limit_counters.expires_at <= NOW() THEN EXCLUDED.expires_at ELSE rate_limit_counters.expires_at END
+		RETURNING count, expires_at
+	`, key, time.Now().Add(window))
+	return row.Count, row.ExpiresAt, err
+}
+
+func (PostgresStore) Peek(key string) (int, time.Time, error) {
+	var row struct {
+		Count     int       `db:"count"`
+		ExpiresAt time.Time `db:"expires_at"`
+	}
+	err := db.DB.Get(&row, `
+		SELECT count, expires_at FROM rate_limit_counters WHERE key = $1 AND expires_at > NOW()
+	`, key)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, time.Time{}, nil
+		}
+		return 0, time.Time{}, err
+	}
+	return row.Count, row.ExpiresAt, nil
+}
+
+func (PostgresStore) Reset(key string) error {
+	_, err := db.DB.Exec(`DELETE FROM rate_limit_counters WHERE key = $1`, key)
+	return err
+}
@@ -0,0 +1,67 @@
+-- Checks that tenant row-level security (migration 036) holds even for queries without a tenant_id filter.
+-- Creates two tenants inside a transaction, acts as tenant A the way db.TenantDB does, and fails
+-- if anything of tenant B can be read or written. Everything is rolled back.
+-- Usage: psql -v ON_ERROR_STOP=1 -f scripts/check-rls.sql
+
+BEGIN;
+
+INSERT INTO tenants (id, name, code) VALUES
+    ('00000000-0000-0000-0000-00000000000a', 'RLS Check A', 'rls-check-a'),
+    ('00000000-0000-0000-0000-00000000000b', 'RLS Check B', 'rls-check-b');
+INSERT INTO units (id, tenant_id, code, type) VALUES
+    ('00000000-0000-0000-0000-0000000000a1', '00000000-0000-0000-0000-00000000000a', 'A-1', 'house'),
+    ('00000000-0000-0000-0000-0000000000b1', '00000000-0000-0000-0000-00000000000b', 'B-1', 'house');
+
+SELECT set_config('app.tenant_id', '00000000-0000-0000-0000-00000000000a', true),
+       set_config('role', 'rukunos_tenant', true);
+
+DO $$
+DECLARE
+    v_count INT;
+BEGIN
+    -- Reads without a tenant filter only see tenant A
+    SELECT COUNT(*) INTO v_count FROM units WHERE code IN ('A-1', 'B-1');
+    IF v_count <> 1 THEN
+        RAISE EXCEPTION 'cross-tenant read: % units visible, expected 1', v_count;
+    END IF;
+
+    -- Updates and deletes of tenant B rows touch nothing
+    UPDATE units SET address = 'changed' WHERE id = '00000000-0000-0000-0000-0000000000b1';
+    GET DIAGNOSTICS v_count = ROW_COUNT;
+    IF v_count <> 0 THEN
+        RAISE EXCEPTION 'cross-tenant update changed % rows', v_count;
+    END IF;
+
+    DELETE FROM units WHERE id = '00000000-0000-0000-0000-0000000000b1';
+    GET DIAGNOSTICS v_count = ROW_COUNT;
+    IF v_count <> 0 THEN
+        RAISE EXCEPTION 'cross-tenant delete removed % rows', v_count;
+    END IF;
+
+    -- Inserts into tenant B are rejected
+    BEGIN
+        INSERT INTO units (tenant_id, code, type) VALUES ('00000000-0000-0000-0000-00000000000b', 'B-2', 'house');
+        RAISE EXCEPTION 'cross-tenant insert succeeded';
+    EXCEPTION WHEN insufficient_privilege THEN
+        NULL;
+    END;
+
+    -- Moving a row to tenant B is rejected
+    BEGIN
+        UPDATE units SET tenant_id = '00000000-0000-0000-0000-00000000000b' WHERE id = '00000000-0000-0000-0000-0000000000a1';
+        RAISE EXCEPTION 'moving a row to another tenant succeeded';
+    EXCEPTION WHEN insufficient_privilege THEN
+        NULL;
+    END;
+
+    -- Without app.tenant_id nothing is visible
+    PERFORM set_config('app.tenant_id', '', true);
+    SELECT COUNT(*) INTO v_count FROM units WHERE code IN ('A-1', 'B-1');
+    IF v_count <> 0 THEN
+        RAISE EXCEPTION 'read without tenant: % units visible, expected 0', v_count;
+    END IF;
+
+    RAISE NOTICE 'Tenant row-level security OK';
+END $$;
+
+ROLLBACK;
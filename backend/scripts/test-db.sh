@@ -0,0 +1,41 @@
+#!/bin/bash
+
+# Creates a fresh test database and applies every migration, for `make test` and CI
+# Usage: ./scripts/test-db.sh
+#   By default psql runs in the docker compose db container; set PSQL_DIRECT=1 to use a local psql
+#   (connection from the usual PGHOST/PGPORT/PGPASSWORD variables), e.g. in CI.
+
+set -e
+
+DB_USER=${DB_USER:-rukunos_user}
+TEST_DB_NAME=${TEST_DB_NAME:-rukunos_test}
+
+SCRIPT_DIR="$( cd "$( dirname "${BASH_SOURCE[0]}" )" && pwd )"
+MIGRATIONS_DIR="$SCRIPT_DIR/../migrations"
+
+run_psql() {
+    if [ "$PSQL_DIRECT" = "1" ]; then
+        psql -U "$DB_USER" "$@"
+    else
+        docker compose exec -T db psql -U "$DB_USER" "$@"
+    fi
+}
+
+echo "Recreating test database $TEST_DB_NAME..."
+run_psql -d postgres -q -c "DROP DATABASE IF EXISTS $TEST_DB_NAME" -c "CREATE DATABASE $TEST_DB_NAME"
+
+# File names sort in the same order as the deploy.sh migration list
+for migration in "$MIGRATIONS_DIR"/*.sql; do
+    name=$(basename "$migration")
+    if output=$(run_psql -v ON_ERROR_STOP=1 -q -d "$TEST_DB_NAME" < "$migration" 2>&1); then
+        echo "✓ $name"
+    elif echo "$output" | grep -q "already exists\|duplicate"; then
+        echo "  $name already applied, skipping..."
+    else
+        echo "✗ Migration $name failed:"
+        echo "$output"
+        exit 1
+    fi
+done
+
+echo "Test database ready: $TEST_DB_NAME"
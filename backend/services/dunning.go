@@ -0,0 +1,291 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"rukunos-backend/db"
+	"rukunos-backend/models"
+)
+
+// Default reminder texts, used when a rule has no message_template
+const (
+	defaultReminderBeforeDue = "Yth. {{name}}, tagihan {{category}} periode {{period}} untuk unit {{unit_code}} sebesar Rp{{total}} akan jatuh tempo pada {{due_date}}."
+	defaultReminderOnDue     = "Yth. {{name}}, tagihan {{category}} periode {{period}} untuk unit {{unit_code}} sebesar Rp{{total}} jatuh tempo hari ini ({{due_date}})."
+	defaultReminderAfterDue  = "Yth. {{name}}, tagihan {{category}} periode {{period}} untuk unit {{unit_code}} sebesar Rp{{total}} telah terlambat {{days}} hari sejak {{due_date}}. Mohon segera melakukan pembayaran."
+)
+
+// dueReminder is a bill together with the reminder rule that applies to it today
+type dueReminder struct {
+	BillID          string
+	TenantID        string
+	UnitID          string
+	UnitCode        string
+	Category        string
+	Period          string
+	Total           float64
+	DueDate         time.Time
+	BillNumber      sql.NullString
+	RuleID          string
+	RuleName        string
+	OffsetDays      int
+	Channel         string
+	MessageTemplate sql.NullString
+	IsFinal         bool
+	SignOff         string // From the tenant's reminder settings
+}
+
+type reminderRecipient struct {
+	UserID   string
+	FullName string
+	Email    sql.NullString
+	Phone    sql.NullString
+}
+
+// sendBillReminders sends the reminder for the latest applicable rule of every unpaid bill.
+// Each (bill, rule) pair is sent at most once; a failed send is retried at the next send hour.
+// Earlier rules missed while the server was down are skipped.
+// It runs hourly and only handles tenants whose reminder send hour it is in their own timezone.
+func sendBillReminders() {
+	log.Println("Running bill reminder job...")
+
+	query := `
+		WITH applicable AS (
+			SELECT DISTINCT ON (b.id)
+				b.id AS bill_id, b.tenant_id, b.unit_id, u.code AS unit_code,
+				b.category, b.period, (b.amount + COALESCE(b.late_fee, 0)) AS total,
+				b.due_date, b.bill_number,
+				r.id AS rule_id, r.name AS rule_name, r.offset_days, r.channel,
+				r.message_template, COALESCE(r.is_final, false) AS is_final
+			FROM bills b
+			INNER JOIN units u ON b.unit_id = u.id
+			INNER JOIN tenants t ON b.tenant_id = t.id AND t.status = 'active' AND t.deleted_at IS NULL
+			INNER JOIN billing_reminder_rules r ON r.tenant_id = b.tenant_id
+				AND r.is_active = true AND r.deleted_at IS NULL
+			WHERE b.status IN ('pending', 'overdue')
+			AND b.due_date IS NOT NULL
+			AND b.deleted_at IS NULL
+			AND b.due_date + r.offset_days <= ` + TenantTodaySQL + `
+			ORDER BY b.id, r.offset_days DESC
+		)
+		SELECT a.bill_id, a.tenant_id, a.unit_id, a.unit_code, a.category, a.period, a.total,
+		       a.due_date, a.bill_number, a.rule_id, a.rule_name, a.offset_days, a.channel,
+		       a.message_template, a.is_final
+		FROM applicable a
+		WHERE NOT EXISTS (
+			SELECT 1 FROM bill_reminder_logs l
+			WHERE l.bill_id = a.bill_id AND l.rule_id = a.rule_id AND l.status <> 'failed'
+		)
+	`
+
+	rows, err := db.DB.Query(query)
+	if err != nil {
+		log.Printf("Error querying bills for reminders: %v", err)
+		return
+	}
+
+	var reminders []dueReminder
+	tenantSettings := map[string]models.TenantSettings{}
+	now := time.Now()
+	for rows.Next() {
+		var r dueReminder
+		err := rows.Scan(&r.BillID, &r.TenantID, &r.UnitID, &r.UnitCode, &r.Category, &r.Period, &r.Total,
+			&r.DueDate, &r.BillNumber, &r.RuleID, &r.RuleName, &r.OffsetDays, &r.Channel,
+			&r.MessageTemplate, &r.IsFinal)
+		if err != nil {
+			log.Printf("Error scanning bill reminder: %v", err)
+			continue
+		}
+
+		settings, ok := tenantSettings[r.TenantID]
+		if !ok {
+			settings, err = LoadTenantSettings(r.TenantID)
+			if err != nil {
+				log.Printf("Error loading settings for tenant %s, using defaults: %v", r.TenantID, err)
+			}
+			tenantSettings[r.TenantID] = settings
+		}
+		// Reminders not sent now stay unlogged and go out at the tenant's next send hour
+		if !settings.Reminders.Enabled || now.In(TenantLocation(settings)).Hour() != settings.Reminders.SendHour {
+			continue
+		}
+		r.SignOff = settings.Reminders.SignOff
+		reminders = append(reminders, r)
+	}
+	rows.Close()
+
+	sentCount := 0
+	escalatedCount := 0
+	for _, r := range reminders {
+		status, recipients, sendErr := deliverReminder(r)
+		if status == "sent" {
+			sentCount++
+		}
+
+		var errText sql.NullString
+		if sendErr != nil {
+			errText = sql.NullString{String: sendErr.Error(), Valid: true}
+		}
+		_, err := db.DB.Exec(`
+			INSERT INTO bill_reminder_logs (tenant_id, bill_id, rule_id, channel, status, recipients_count, error)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (bill_id, rule_id) DO UPDATE
+			SET channel = EXCLUDED.channel, status = EXCLUDED.status, recipients_count = EXCLUDED.recipients_count,
+			    error = EXCLUDED.error, sent_at = NOW()
+			WHERE bill_reminder_logs.status = 'failed'
+		`, r.TenantID, r.BillID, r.RuleID, r.Channel, status, recipients, errText)
+		if err != nil {
+			log.Printf("Error writing reminder log for bill %s: %v", r.BillID, err)
+			continue
+		}
+
+		// A failed final reminder is retried first; the treasurer takes over once it went out,
+		// or when no resident of the unit can be reminded at all
+		if r.IsFinal && status != "failed" {
+			created, err := escalateToTreasurer(r, status)
+			if err != nil {
+				log.Printf("Error escalating bill %s to treasurer: %v", r.BillID, err)
+			} else if created {
+				escalatedCount++
+			}
+		}
+	}
+
+	log.Printf("Bill reminder job completed. Processed %d bills, sent %d reminders, escalated %d bills.",
+		len(reminders), sentCount, escalatedCount)
+}
+
+// deliverReminder sends the reminder to every resident of the bill's unit who has not opted out.
+// It returns the log status, the number of residents reached and the last delivery error.
+func deliverReminder(r dueReminder) (string, int, error) {
+	channel, err := GetChannel(r.Channel)
+	if err != nil {
+		return "failed", 0, err
+	}
+
+	var recipients []reminderRecipient
+	rows, err := db.DB.Query(`
+		SELECT u.id, u.full_name, u.email, u.phone
+		FROM tenant_users tu
+		INNER JOIN users u ON tu.user_id = u.id
+		WHERE tu.tenant_id = $1 AND tu.unit_id = $2
+		AND tu.status = 'active'
+		AND COALESCE(tu.billing_reminder_opt_out, false) = false
+		AND tu.deleted_at IS NULL AND u.deleted_at IS NULL
+	`, r.TenantID, r.UnitID)
+	if err != nil {
+		return "failed", 0, err
+	}
+	for rows.Next() {
+		var rcpt reminderRecipient
+		if err := rows.Scan(&rcpt.UserID, &rcpt.FullName, &rcpt.Email, &rcpt.Phone); err != nil {
+			continue
+		}
+		recipients = append(recipients, rcpt)
+	}
+	rows.Close()
+
+	if len(recipients) == 0 {
+		return "skipped", 0, nil
+	}
+
+	delivered := 0
+	var lastErr error
+	for _, rcpt := range recipients {
+		address := reminderAddress(channel.Name(), rcpt)
+		if address == "" {
+			continue
+		}
+		err := channel.Send(Message{
+			TenantID:  r.TenantID,
+			UserID:    rcpt.UserID,
+			Recipient: address,
+			Subject:   fmt.Sprintf("Pengingat tagihan %s %s", r.Category, r.Period),
+			Body:      renderReminder(r, rcpt.FullName),
+		})
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		delivered++
+	}
+
+	if delivered == 0 {
+		if lastErr == nil {
+			return "skipped", 0, nil
+		}
+		return "failed", 0, lastErr
+	}
+	return "sent", delivered, lastErr
+}
+
+// reminderAddress picks the address a channel delivers to: email for "email", phone otherwise
+func reminderAddress(channel string, rcpt reminderRecipient) string {
+	if channel == "email" {
+		return rcpt.Email.String
+	}
+	if rcpt.Phone.Valid && rcpt.Phone.String != "" {
+		return rcpt.Phone.String
+	}
+	return rcpt.Email.String
+}
+
+// renderReminder fills the rule's message template (or a default one) for a recipient
+func renderReminder(r dueReminder, name string) string {
+	tmpl := r.MessageTemplate.String
+	if !r.MessageTemplate.Valid || tmpl == "" {
+		switch {
+		case r.OffsetDays < 0:
+			tmpl = defaultReminderBeforeDue
+		case r.OffsetDays == 0:
+			tmpl = defaultReminderOnDue
+		default:
+			tmpl = defaultReminderAfterDue
+		}
+	}
+
+	days := r.OffsetDays
+	if days < 0 {
+		days = -days
+	}
+
+	replacer := strings.NewReplacer(
+		"{{name}}", name,
+		"{{unit_code}}", r.UnitCode,
+		"{{category}}", r.Category,
+		"{{period}}", r.Period,
+		"{{bill_number}}", r.BillNumber.String,
+		"{{total}}", fmt.Sprintf("%.0f", r.Total),
+		"{{due_date}}", r.DueDate.Format("2006-01-02"),
+		"{{days}}", fmt.Sprintf("%d", days),
+	)
+	message := replacer.Replace(tmpl)
+	if r.SignOff != "" {
+		message += "\n\n" + r.SignOff
+	}
+	return message
+}
+
+// escalateToTreasurer opens a treasurer task for a bill that passed its final reminder.
+// It returns false when the bill already has an escalation task.
+func escalateToTreasurer(r dueReminder, status string) (bool, error) {
+	title := fmt.Sprintf("Tindak lanjut tagihan %s %s unit %s", r.Category, r.Period, r.UnitCode)
+	description := fmt.Sprintf("Tagihan sebesar Rp%.0f belum dibayar setelah pengingat terakhir (%s).", r.Total, r.RuleName)
+	if status == "skipped" {
+		description = fmt.Sprintf("Tagihan sebesar Rp%.0f belum dibayar. Pengingat terakhir (%s) tidak terkirim karena "+
+			"tidak ada warga unit ini yang dapat dihubungi.", r.Total, r.RuleName)
+	}
+
+	result, err := db.DB.Exec(`
+		INSERT INTO treasurer_tasks (tenant_id, bill_id, type, title, description, status)
+		VALUES ($1, $2, 'dunning_escalation', $3, $4, 'open')
+		ON CONFLICT (bill_id, type) WHERE bill_id IS NOT NULL DO NOTHING
+	`, r.TenantID, r.BillID, title, description)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected > 0, nil
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// InitMailer registers the "email" message channel selected by MAIL_DRIVER:
+//   - smtp: send through SMTP_HOST/SMTP_PORT (e.g. a local Mailpit in development)
+//   - file: write .eml files to MAIL_DIR (default ./mail)
+//
+// Without MAIL_DRIVER no email channel is registered and SendEmail fails. Emails carry password reset,
+// verification and invitation links, so they never fall back to the log channel.
+func InitMailer() {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "RukunOS <no-reply@rukunos.local>"
+	}
+
+	switch os.Getenv("MAIL_DRIVER") {
+	case "smtp":
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		RegisterChannel(&SMTPChannel{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		})
+		log.Printf("Mailer: SMTP via %s:%s", os.Getenv("SMTP_HOST"), port)
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "./mail"
+		}
+		RegisterChannel(&FileMailChannel{Dir: dir, From: from})
+		log.Printf("Mailer: writing emails to %s", dir)
+	case "":
+		log.Println("Mailer: MAIL_DRIVER not set, emails are not sent")
+	default:
+		log.Printf("Mailer: unknown MAIL_DRIVER %q, emails are not sent", os.Getenv("MAIL_DRIVER"))
+	}
+}
+
+// ErrNoMailer is returned by SendEmail when MAIL_DRIVER did not register an email channel
+var ErrNoMailer = errors.New("no email channel is configured (MAIL_DRIVER)")
+
+// SendEmail delivers an email over the registered email channel
+func SendEmail(msg Message) error {
+	channel, ok := RegisteredChannel("email")
+	if !ok {
+		return ErrNoMailer
+	}
+	return channel.Send(msg)
+}
+
+// buildEmail renders a plain-text RFC 5322 message
+func buildEmail(from string, msg Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.Recipient)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return buf.Bytes()
+}
+
+// SMTPChannel sends email through an SMTP server
+type SMTPChannel struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTPChannel) Name() string { return "email" }
+
+func (s *SMTPChannel) Send(msg Message) error {
+	if msg.Recipient == "" {
+		return fmt.Errorf("email recipient is empty")
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	sender := s.From
+	if start := strings.LastIndex(sender, "<"); start >= 0 {
+		sender = strings.TrimSuffix(sender[start+1:], ">")
+	}
+
+	return smtp.SendMail(s.Host+":"+s.Port, auth, sender, []string{msg.Recipient}, buildEmail(s.From, msg))
+}
+
+// FileMailChannel writes each email as an .eml file, a stand-in for a real mail server in development
+type FileMailChannel struct {
+	Dir  string
+	From string
+}
+
+var unsafeFilenameChars = regexp.MustCompile(`[^a-zA-Z0-9@._-]`)
+
+func (f *FileMailChannel) Name() string { return "email" }
+
+func (f *FileMailChannel) Send(msg Message) error {
+	if msg.Recipient == "" {
+		return fmt.Errorf("email recipient is empty")
+	}
+	if err := os.MkdirAll(f.Dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000000"),
+		unsafeFilenameChars.ReplaceAllString(msg.Recipient, "_"))
+	return os.WriteFile(filepath.Join(f.Dir, name), buildEmail(f.From, msg), 0o644)
+}
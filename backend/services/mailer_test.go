@@ -0,0 +1,36 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSendEmailWithoutMailer(t *testing.T) {
+	channelsMu.Lock()
+	previous, had := channels["email"]
+	delete(channels, "email")
+	channelsMu.Unlock()
+	t.Cleanup(func() {
+		channelsMu.Lock()
+		delete(channels, "email")
+		if had {
+			channels["email"] = previous
+		}
+		channelsMu.Unlock()
+	})
+
+	// Reset and verification links must not fall back to the log channel
+	err := SendEmail(Message{Recipient: "warga@example.com", Subject: "Reset", Body: "token=secret"})
+	if !errors.Is(err, ErrNoMailer) {
+		t.Fatalf("SendEmail without a mailer = %v, want ErrNoMailer", err)
+	}
+
+	mailer := NewFakeChannel("email")
+	RegisterChannel(mailer)
+	if err := SendEmail(Message{Recipient: "warga@example.com", Subject: "Reset", Body: "token=secret"}); err != nil {
+		t.Fatalf("SendEmail: %v", err)
+	}
+	if msg, ok := mailer.LastMessageTo("warga@example.com"); !ok || msg.Body != "token=secret" {
+		t.Fatalf("Delivered message = %+v, %v", msg, ok)
+	}
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// InitMessaging registers the SMS and WhatsApp channels configured in the environment:
+//   - WHATSAPP_GATEWAY_URL / WHATSAPP_GATEWAY_TOKEN: HTTP gateway registered as "whatsapp"
+//   - SMS_GATEWAY_URL / SMS_GATEWAY_TOKEN: HTTP gateway registered as "sms"
+//   - MESSAGING_DRIVER=fake: in-memory fake registered as both "whatsapp" and "sms" (development and tests)
+func InitMessaging() {
+	if os.Getenv("MESSAGING_DRIVER") == "fake" {
+		fake := NewFakeChannel("whatsapp")
+		RegisterChannel(fake)
+		RegisterChannel(&namedChannel{name: "sms", MessageChannel: fake})
+		log.Println("Messaging: using fake SMS/WhatsApp provider")
+		return
+	}
+
+	if url := os.Getenv("WHATSAPP_GATEWAY_URL"); url != "" {
+		RegisterChannel(NewHTTPGatewayChannel("whatsapp", url, os.Getenv("WHATSAPP_GATEWAY_TOKEN")))
+		log.Println("Messaging: WhatsApp gateway configured")
+	}
+	if url := os.Getenv("SMS_GATEWAY_URL"); url != "" {
+		RegisterChannel(NewHTTPGatewayChannel("sms", url, os.Getenv("SMS_GATEWAY_TOKEN")))
+		log.Println("Messaging: SMS gateway configured")
+	}
+}
+
+// HTTPGatewayChannel posts messages as JSON ({"to", "message"}) to an SMS/WhatsApp gateway with a bearer token
+type HTTPGatewayChannel struct {
+	name   string
+	url    string
+	token  string
+	client *http.Client
+}
+
+func NewHTTPGatewayChannel(name, url, token string) *HTTPGatewayChannel {
+	return &HTTPGatewayChannel{
+		name:   name,
+		url:    url,
+		token:  token,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (g *HTTPGatewayChannel) Name() string { return g.name }
+
+func (g *HTTPGatewayChannel) Send(msg Message) error {
+	if msg.Recipient == "" {
+		return fmt.Errorf("%s recipient is empty", g.name)
+	}
+
+	payload, err := json.Marshal(map[string]string{
+		"to":      msg.Recipient,
+		"message": msg.Body,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, g.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.token)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s gateway returned status %d", g.name, resp.StatusCode)
+	}
+	return nil
+}
+
+// FakeChannel records messages in memory instead of sending them
+type FakeChannel struct {
+	name     string
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewFakeChannel(name string) *FakeChannel {
+	return &FakeChannel{name: name}
+}
+
+func (f *FakeChannel) Name() string { return f.name }
+
+func (f *FakeChannel) Send(msg Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.messages = append(f.messages, msg)
+	log.Printf("[fake %s] to=%s body=%q", f.name, msg.Recipient, msg.Body)
+	return nil
+}
+
+// Messages returns a copy of every message sent so far
+func (f *FakeChannel) Messages() []Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Message(nil), f.messages...)
+}
+
+// LastMessageTo returns the most recent message sent to recipient
+func (f *FakeChannel) LastMessageTo(recipient string) (Message, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := len(f.messages) - 1; i >= 0; i-- {
+		if f.messages[i].Recipient == recipient {
+			return f.messages[i], true
+		}
+	}
+	return Message{}, false
+}
+
+// namedChannel registers an existing channel under another name
+type namedChannel struct {
+	name string
+	MessageChannel
+}
+
+func (n *namedChannel) Name() string { return n.name }
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Message is a single outbound notification to one recipient
+type Message struct {
+	TenantID  string
+	UserID    string
+	Recipient string // Email address or phone number, depending on the channel
+	Subject   string
+	Body      string
+}
+
+// MessageChannel delivers messages over a transport (log, email, WhatsApp, SMS, ...)
+type MessageChannel interface {
+	Name() string
+	Send(msg Message) error
+}
+
+var (
+	channelsMu sync.RWMutex
+	channels   = map[string]MessageChannel{}
+)
+
+func init() {
+	RegisterChannel(LogChannel{})
+}
+
+// RegisterChannel makes a channel available by name, replacing any existing channel with that name
+func RegisterChannel(ch MessageChannel) {
+	channelsMu.Lock()
+	defer channelsMu.Unlock()
+	channels[ch.Name()] = ch
+}
+
+// GetChannel returns the channel registered under name
+func GetChannel(name string) (MessageChannel, error) {
+	channelsMu.RLock()
+	defer channelsMu.RUnlock()
+	ch, ok := channels[name]
+	if !ok {
+		return nil, fmt.Errorf("message channel %q is not registered", name)
+	}
+	return ch, nil
+}
+
+// ChannelNames lists all registered channel names
+func ChannelNames() []string {
+	channelsMu.RLock()
+	defer channelsMu.RUnlock()
+	names := make([]string, 0, len(channels))
+	for name := range channels {
+		names = append(names, name)
+	}
+	return names
+}
+
+// LogChannel writes messages to the server log (default channel for development)
+type LogChannel struct{}
+
+func (LogChannel) Name() string { return "log" }
+
+func (LogChannel) Send(msg Message) error {
+	log.Printf("[message] tenant=%s user=%s to=%s subject=%q body=%q",
+		msg.TenantID, msg.UserID, msg.Recipient, msg.Subject, msg.Body)
+	return nil
+}
+
+// RegisteredChannel returns the first registered channel among names, without falling back
+func RegisteredChannel(names ...string) (MessageChannel, bool) {
+	for _, name := range names {
+		if ch, err := GetChannel(name); err == nil {
+			return ch, true
+		}
+	}
+	return nil, false
+}
+
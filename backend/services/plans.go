@@ -0,0 +1,320 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"rukunos-backend/db"
+	"rukunos-backend/models"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Unlimited is a plan limit without a cap
+const Unlimited = -1
+
+// DefaultPlan is the plan of a new tenant
+const DefaultPlan = "free"
+
+// Plans are the subscription plans a super admin can put a tenant on, cheapest first
+var Plans = []models.Plan{
+	{
+		Key:                  "free",
+		Name:                 "Gratis",
+		PriceMonthly:         0,
+		MaxUnits:             30,
+		MaxUsers:             50,
+		MaxPaidAnnouncements: 0,
+		MaxStorageMB:         100,
+		Modules:              []string{"billing", "communication"},
+	},
+	{
+		Key:                  "basic",
+		Name:                 "Basic",
+		PriceMonthly:         50000,
+		MaxUnits:             150,
+		MaxUsers:             300,
+		MaxPaidAnnouncements: 4,
+		MaxStorageMB:         1024,
+		Modules:              []string{"billing", "communication", "administration"},
+	},
+	{
+		Key:                  "pro",
+		Name:                 "Pro",
+		PriceMonthly:         150000,
+		MaxUnits:             Unlimited,
+		MaxUsers:             Unlimited,
+		MaxPaidAnnouncements: 30,
+		MaxStorageMB:         10240,
+		Modules:              []string{"billing", "communication", "administration", "security"},
+	},
+}
+
+// Plan quotas
+const (
+	QuotaUnits             = "units"
+	QuotaUsers             = "users"
+	QuotaPaidAnnouncements = "paid_announcements"
+	QuotaStorage           = "storage"
+)
+
+// quotaWarningPercent is the share of a limit from which the tenant is warned
+const quotaWarningPercent = 80
+
+// FindPlan returns the plan with the given key
+func FindPlan(key string) (models.Plan, bool) {
+	for _, p := range Plans {
+		if p.Key == key {
+			return p, true
+		}
+	}
+	return models.Plan{}, false
+}
+
+// PlanAllowsModule reports whether a module can be enabled on the plan
+func PlanAllowsModule(plan models.Plan, module string) bool {
+	for _, m := range plan.Modules {
+		if m == module {
+			return true
+		}
+	}
+	return false
+}
+
+// TenantPlan returns the plan the tenant is on; an unknown plan key falls back to DefaultPlan
+func TenantPlan(q sqlx.Queryer, tenantID string) (models.Plan, error) {
+	var key sql.NullString
+	if err := sqlx.Get(q, &key, `SELECT plan FROM tenants WHERE id = $1`, tenantID); err != nil {
+		return models.Plan{}, err
+	}
+	return planOrDefault(key.String), nil
+}
+
+// planOrDefault returns the plan with the given key, or DefaultPlan for an unknown key
+func planOrDefault(key string) models.Plan {
+	plan, ok := FindPlan(key)
+	if !ok {
+		plan, _ = FindPlan(DefaultPlan)
+	}
+	return plan
+}
+
+// planLimit returns the limit of a quota on the plan, in the unit the quota is counted in
+func planLimit(plan models.Plan, quota string) int64 {
+	var limit int
+	switch quota {
+	case QuotaUnits:
+		limit = plan.MaxUnits
+	case QuotaUsers:
+		limit = plan.MaxUsers
+	case QuotaPaidAnnouncements:
+		limit = plan.MaxPaidAnnouncements
+	case QuotaStorage:
+		if plan.MaxStorageMB == Unlimited {
+			return Unlimited
+		}
+		return int64(plan.MaxStorageMB) * 1024 * 1024
+	}
+	return int64(limit)
+}
+
+// quotaNames are shown to the tenant's admins
+var quotaNames = map[string]string{
+	QuotaUnits:             "Unit",
+	QuotaUsers:             "Pengguna",
+	QuotaPaidAnnouncements: "Pengumuman WhatsApp/SMS bulan ini",
+	QuotaStorage:           "Penyimpanan",
+}
+
+// quotaUsageQueries count what a tenant uses of each quota. Users include invited members, since they hold
+// a seat once they accept; paid announcements are broadcasts in the current month of the tenant's timezone.
+var quotaUsageQueries = map[string]string{
+	QuotaUnits: `SELECT COUNT(*) FROM units WHERE tenant_id = $1 AND deleted_at IS NULL`,
+	QuotaUsers: `
+		SELECT COUNT(*) FROM tenant_users
+		WHERE tenant_id = $1 AND status IN ('active', 'invited') AND deleted_at IS NULL`,
+	QuotaPaidAnnouncements: `
+		SELECT COUNT(*) FROM announcement_broadcasts b
+		INNER JOIN tenants t ON t.id = b.tenant_id
+		WHERE b.tenant_id = $1
+		AND (b.created_at::timestamptz AT TIME ZONE ` + TenantTimezoneSQL + `)
+		    >= date_trunc('month', NOW() AT TIME ZONE ` + TenantTimezoneSQL + `)`,
+	QuotaStorage: `SELECT COALESCE(storage_bytes, 0) FROM tenants WHERE id = $1`,
+}
+
+// quotaUsage fills in how much of a quota the tenant uses
+func quotaUsage(q sqlx.Queryer, tenantID string, plan models.Plan, quota string) (models.QuotaUsage, error) {
+	usage := models.QuotaUsage{Quota: quota, Name: quotaNames[quota], Limit: planLimit(plan, quota)}
+	if err := sqlx.Get(q, &usage.Used, quotaUsageQueries[quota], tenantID); err != nil {
+		return usage, err
+	}
+	if usage.Limit != Unlimited {
+		usage.Exceeded = usage.Used >= usage.Limit
+		// A limit of 0 means the plan does not include it at all, which is not worth a warning
+		usage.Warning = usage.Limit > 0 && usage.Used*100 >= usage.Limit*quotaWarningPercent
+	}
+	return usage, nil
+}
+
+// quotaWarning is the soft warning shown when a quota is near or at its limit
+func quotaWarning(usage models.QuotaUsage) string {
+	if usage.Quota == QuotaStorage {
+		return fmt.Sprintf("Penyimpanan terpakai %d dari %d MB", usage.Used/(1024*1024), usage.Limit/(1024*1024))
+	}
+	if usage.Exceeded {
+		return fmt.Sprintf("Batas %s paket sudah tercapai (%d dari %d)", usage.Name, usage.Used, usage.Limit)
+	}
+	return fmt.Sprintf("%s hampir mencapai batas paket (%d dari %d)", usage.Name, usage.Used, usage.Limit)
+}
+
+// TenantPlanUsage returns the tenant's plan with its usage of every quota and warnings for those near their limit
+func TenantPlanUsage(tenantID string) (models.TenantPlanUsage, error) {
+	var result models.TenantPlanUsage
+	plan, err := TenantPlan(db.DB, tenantID)
+	if err != nil {
+		return result, err
+	}
+	result.Plan = plan
+	result.Warnings = []string{}
+
+	err = db.DB.QueryRow(`SELECT plan_changed_at, storage_measured_at FROM tenants WHERE id = $1`, tenantID).
+		Scan(&result.PlanChangedAt, &result.StorageMeasuredAt)
+	if err != nil {
+		return result, err
+	}
+
+	for _, quota := range []string{QuotaUnits, QuotaUsers, QuotaPaidAnnouncements, QuotaStorage} {
+		usage, err := quotaUsage(db.DB, tenantID, plan, quota)
+		if err != nil {
+			return result, err
+		}
+		result.Quotas = append(result.Quotas, usage)
+		if usage.Warning {
+			result.Warnings = append(result.Warnings, quotaWarning(usage))
+		}
+	}
+	return result, nil
+}
+
+// QuotaExceededError is returned when adding to a quota would go over the tenant's plan
+type QuotaExceededError struct {
+	Usage models.QuotaUsage
+	Plan  models.Plan
+}
+
+func (e *QuotaExceededError) Error() string {
+	if e.Usage.Quota == QuotaStorage {
+		return fmt.Sprintf("Penyimpanan paket %s sudah penuh (%d MB). Hubungi admin RukunOS untuk meningkatkan paket.",
+			e.Plan.Name, e.Usage.Limit/(1024*1024))
+	}
+	return fmt.Sprintf("Batas %s paket %s adalah %d (terpakai %d). Hubungi admin RukunOS untuk meningkatkan paket.",
+		e.Usage.Name, e.Plan.Name, e.Usage.Limit, e.Usage.Used)
+}
+
+// CheckQuota returns a *QuotaExceededError when adding n more to a quota would go over the tenant's plan.
+// Storage is only measured daily, so for it n is ignored and the check fails once the limit is reached;
+// a tenant over its storage limit cannot add to any other quota either.
+// It must run in the transaction that adds the rows: it locks the tenant row, so a concurrent addition
+// waits for this transaction and then counts its rows. On success it returns the usage before the
+// addition, for soft warnings.
+func CheckQuota(tx *sqlx.Tx, tenantID, quota string, n int) (models.QuotaUsage, error) {
+	var key sql.NullString
+	if err := tx.Get(&key, `SELECT plan FROM tenants WHERE id = $1 FOR NO KEY UPDATE`, tenantID); err != nil {
+		return models.QuotaUsage{}, err
+	}
+	plan := planOrDefault(key.String)
+
+	usage, err := quotaUsage(tx, tenantID, plan, quota)
+	if err != nil {
+		return usage, err
+	}
+	if quota != QuotaStorage && n > 0 {
+		storage, err := quotaUsage(tx, tenantID, plan, QuotaStorage)
+		if err != nil {
+			return usage, err
+		}
+		if storage.Limit != Unlimited && storage.Exceeded {
+			return usage, &QuotaExceededError{Usage: storage, Plan: plan}
+		}
+	}
+	if usage.Limit == Unlimited {
+		return usage, nil
+	}
+	if quota == QuotaStorage {
+		if !usage.Exceeded {
+			return usage, nil
+		}
+	} else if usage.Used+int64(n) <= usage.Limit {
+		return usage, nil
+	}
+	return usage, &QuotaExceededError{Usage: usage, Plan: plan}
+}
+
+// QuotaWarningAfter returns the soft warning for a quota after n were added, or "" when it is not near its limit
+func QuotaWarningAfter(usage models.QuotaUsage, n int) string {
+	if usage.Limit == Unlimited || usage.Quota == QuotaStorage {
+		return ""
+	}
+	usage.Used += int64(n)
+	usage.Exceeded = usage.Used >= usage.Limit
+	if usage.Limit == 0 || usage.Used*100 < usage.Limit*quotaWarningPercent {
+		return ""
+	}
+	return quotaWarning(usage)
+}
+
+// measureTenantStorage records how much database storage every tenant uses, summed over the rows of all
+// tables with a tenant_id column. It runs daily because the sum scans every tenant table.
+func measureTenantStorage() {
+	log.Println("Running tenant storage measurement job...")
+
+	var tables []string
+	err := db.DB.Select(&tables, `
+		SELECT c.table_name
+		FROM information_schema.columns c
+		INNER JOIN information_schema.tables t ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+		WHERE c.table_schema = 'public' AND c.column_name = 'tenant_id' AND t.table_type = 'BASE TABLE'
+		ORDER BY c.table_name
+	`)
+	if err != nil {
+		log.Printf("Error listing tenant tables: %v", err)
+		return
+	}
+
+	usage := map[string]int64{}
+	for _, table := range tables {
+		var sizes []struct {
+			TenantID string `db:"tenant_id"`
+			Bytes    int64  `db:"bytes"`
+		}
+		query := fmt.Sprintf(`
+			SELECT tenant_id, SUM(pg_column_size(x.*))::bigint AS bytes
+			FROM %s x WHERE tenant_id IS NOT NULL
+			GROUP BY tenant_id
+		`, pq.QuoteIdentifier(table))
+		if err := db.DB.Select(&sizes, query); err != nil {
+			log.Printf("Error measuring storage of %s: %v", table, err)
+			continue
+		}
+		for _, s := range sizes {
+			usage[s.TenantID] += s.Bytes
+		}
+	}
+
+	updated := 0
+	for tenantID, bytes := range usage {
+		result, err := db.DB.Exec(`
+			UPDATE tenants SET storage_bytes = $1, storage_measured_at = NOW() WHERE id = $2
+		`, bytes, tenantID)
+		if err != nil {
+			log.Printf("Error saving storage of tenant %s: %v", tenantID, err)
+			continue
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			updated++
+		}
+	}
+
+	log.Printf("Tenant storage measurement completed. Measured %d tenants.", updated)
+}
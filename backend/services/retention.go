@@ -0,0 +1,217 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"rukunos-backend/db"
+	"rukunos-backend/models"
+)
+
+// RetentionEntity is a kind of record that is removed permanently once it is older than the tenant's policy
+type RetentionEntity struct {
+	Key         string
+	Name        string
+	Table       string
+	DateColumn  string // A record's age is measured from this column
+	Condition   string // Only matching records are removed, e.g. closed complaints; the table is aliased as x
+	Applies     string
+	DefaultDays int // 0 = kept until the tenant is deleted
+	MinDays     int
+}
+
+// RetentionEntities can be given a retention policy in the tenant settings.
+// Bills and units are financial and membership records and are only removed with the tenant.
+var RetentionEntities = []RetentionEntity{
+	{
+		Key:         "visitor_logs",
+		Name:        "Buku Tamu",
+		Table:       "visitor_logs",
+		DateColumn:  "checked_in_at",
+		Condition:   "TRUE",
+		Applies:     "Semua kunjungan (termasuk nomor KTP/SIM tamu)",
+		DefaultDays: 365,
+		MinDays:     30,
+	},
+	{
+		Key:         "panic_alerts",
+		Name:        "Panic Alert",
+		Table:       "panic_alerts",
+		DateColumn:  "created_at",
+		Condition:   "x.status = 'resolved'",
+		Applies:     "Panic alert yang sudah selesai",
+		DefaultDays: 0,
+		MinDays:     90,
+	},
+	{
+		Key:         "complaints",
+		Name:        "Pengaduan",
+		Table:       "complaints",
+		DateColumn:  "created_at",
+		Condition:   "x.status IN ('resolved', 'rejected')",
+		Applies:     "Pengaduan yang sudah selesai atau ditolak",
+		DefaultDays: 0,
+		MinDays:     90,
+	},
+	{
+		Key:         "document_requests",
+		Name:        "Permohonan Surat",
+		Table:       "document_requests",
+		DateColumn:  "created_at",
+		Condition:   "x.status IN ('completed', 'rejected')",
+		Applies:     "Permohonan surat yang sudah selesai atau ditolak",
+		DefaultDays: 0,
+		MinDays:     90,
+	},
+	{
+		Key:         "announcements",
+		Name:        "Pengumuman",
+		Table:       "announcements",
+		DateColumn:  "created_at",
+		Condition:   "TRUE",
+		Applies:     "Semua pengumuman",
+		DefaultDays: 0,
+		MinDays:     30,
+	},
+}
+
+// DeletedRecordGraceDays is how long soft-deleted records of the retention entities are kept before they are purged
+const DeletedRecordGraceDays = 30
+
+// maxRetentionDays caps a retention policy at ten years
+const maxRetentionDays = 3650
+
+// FindRetentionEntity returns the retention entity with the given key
+func FindRetentionEntity(key string) (RetentionEntity, bool) {
+	for _, e := range RetentionEntities {
+		if e.Key == key {
+			return e, true
+		}
+	}
+	return RetentionEntity{}, false
+}
+
+// DefaultRetention is the retention of a tenant that never changed it
+func DefaultRetention() map[string]int {
+	retention := map[string]int{}
+	for _, e := range RetentionEntities {
+		retention[e.Key] = e.DefaultDays
+	}
+	return retention
+}
+
+// validateRetention checks that every policy names a known entity and keeps records long enough
+func validateRetention(retention map[string]int) error {
+	for key, days := range retention {
+		entity, ok := FindRetentionEntity(key)
+		if !ok {
+			return fmt.Errorf("retention.%s is not a known entity", key)
+		}
+		if days == 0 {
+			continue
+		}
+		if days < entity.MinDays || days > maxRetentionDays {
+			return fmt.Errorf("retention.%s must be 0 (keep) or between %d and %d days", key, entity.MinDays, maxRetentionDays)
+		}
+	}
+	return nil
+}
+
+// TenantRetentionPolicies lists the retention of every entity with its limits
+func TenantRetentionPolicies(settings models.TenantSettings) []models.TenantRetentionPolicy {
+	policies := make([]models.TenantRetentionPolicy, 0, len(RetentionEntities))
+	for _, e := range RetentionEntities {
+		days, ok := settings.Retention[e.Key]
+		if !ok {
+			days = e.DefaultDays
+		}
+		policies = append(policies, models.TenantRetentionPolicy{
+			Entity:      e.Key,
+			Name:        e.Name,
+			Days:        days,
+			DefaultDays: e.DefaultDays,
+			MinDays:     e.MinDays,
+			Applies:     e.Applies,
+		})
+	}
+	return policies
+}
+
+// retentionDaysSQL is the retention of an entity for the tenant aliased as t, defaulting like DefaultRetention
+func retentionDaysSQL(e RetentionEntity) string {
+	return fmt.Sprintf(`COALESCE(NULLIF(t.settings->'retention'->>'%s', '')::int, %d)`, e.Key, e.DefaultDays)
+}
+
+// purgeExpiredRecords removes records older than each tenant's retention policy, and soft-deleted records
+// of the same entities after DeletedRecordGraceDays. Every removal is recorded in data_purge_logs.
+func purgeExpiredRecords() {
+	log.Println("Running data retention purge job...")
+
+	total := 0
+	for _, e := range RetentionEntities {
+		days := retentionDaysSQL(e)
+		query := fmt.Sprintf(`
+			WITH purged AS (
+				DELETE FROM %[1]s x
+				USING tenants t
+				WHERE t.id = x.tenant_id
+				AND (
+					(%[2]s > 0 AND x.%[3]s < NOW() - make_interval(days => %[2]s) AND %[4]s)
+					OR x.deleted_at < NOW() - make_interval(days => %[5]d)
+				)
+				RETURNING x.tenant_id,
+				          CASE WHEN x.deleted_at < NOW() - make_interval(days => %[5]d)
+				               THEN 'deleted_records' ELSE 'retention' END AS reason,
+				          %[2]s AS retention_days
+			)
+			SELECT tenant_id, reason, retention_days, COUNT(*) AS rows_deleted
+			FROM purged
+			GROUP BY tenant_id, reason, retention_days
+		`, e.Table, days, e.DateColumn, e.Condition, DeletedRecordGraceDays)
+
+		var purged []struct {
+			TenantID      string `db:"tenant_id"`
+			Reason        string `db:"reason"`
+			RetentionDays int    `db:"retention_days"`
+			RowsDeleted   int    `db:"rows_deleted"`
+		}
+		// The delete and its log entries commit together
+		tx, err := db.DB.Beginx()
+		if err != nil {
+			log.Printf("Error starting purge of %s: %v", e.Key, err)
+			continue
+		}
+		if err := tx.Select(&purged, query); err != nil {
+			tx.Rollback()
+			log.Printf("Error purging expired %s: %v", e.Key, err)
+			continue
+		}
+
+		for _, p := range purged {
+			if p.Reason == "deleted_records" {
+				p.RetentionDays = 0
+			}
+			_, err = tx.Exec(`
+				INSERT INTO data_purge_logs (tenant_id, entity, reason, rows_deleted, retention_days)
+				VALUES ($1, $2, $3, $4, NULLIF($5, 0))
+			`, p.TenantID, e.Key, p.Reason, p.RowsDeleted, p.RetentionDays)
+			if err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			tx.Rollback()
+			log.Printf("Error recording purge of %s: %v", e.Key, err)
+			continue
+		}
+
+		for _, p := range purged {
+			log.Printf("Retention purge: removed %d %s of tenant %s (%s)", p.RowsDeleted, e.Key, p.TenantID, p.Reason)
+			total += p.RowsDeleted
+		}
+	}
+
+	log.Printf("Data retention purge completed. Removed %d records.", total)
+}
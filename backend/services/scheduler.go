@@ -5,18 +5,34 @@ import (
 	"log"
 	"time"
 	"rukunos-backend/db"
+	"rukunos-backend/models"
 )
 
 // StartScheduler starts all scheduled background jobs
 func StartScheduler() {
 	log.Println("Starting scheduler...")
 	
-	// Start late fee calculation job (runs daily at 00:00)
-	go runDailyJob(calculateLateFees, time.Hour*24, "00:00")
+	// Start late fee calculation job (runs every hour so each tenant's fees change at its own midnight)
+	go runHourlyJob(calculateLateFees)
 	
-	// Start bill status update job (runs every hour)
+	// Start bill status update job (runs every hour; bills become overdue at the tenant's midnight)
 	go runHourlyJob(updateBillStatus)
-	
+
+	// Start bill reminder (dunning) job (runs every hour; each tenant at its reminder send hour, 08:00 by default)
+	go runHourlyJob(sendBillReminders)
+
+	// Start expired session/token cleanup job (runs daily at 03:00)
+	go runDailyJob(purgeExpiredAuthRecords, time.Hour*24, "03:00")
+
+	// Start data retention purge job (runs daily at 02:00)
+	go runDailyJob(purgeExpiredRecords, time.Hour*24, "02:00")
+
+	// Start tenant storage measurement job (runs daily at 04:00; storage quotas use the last measurement)
+	go runDailyJob(measureTenantStorage, time.Hour*24, "04:00")
+
+	// Start tenant deletion job (runs every hour; purges tenants whose grace period has ended)
+	go runHourlyJob(processTenantDeletions)
+
 	log.Println("Scheduler started")
 }
 
@@ -51,12 +67,15 @@ func runDailyJob(job func(), interval time.Duration, timeStr string) {
 	}
 }
 
-// runHourlyJob runs a job every hour
+// runHourlyJob runs a job every hour, on the hour. Tenant timezones (WIB, WITA, WIT) are whole hours
+// apart, so a tenant's midnight and its reminder send hour always start on a run.
 func runHourlyJob(job func()) {
 	// Run immediately
 	job()
 	
-	// Then run every hour
+	// Then run at the start of every hour
+	time.Sleep(time.Until(time.Now().Truncate(time.Hour).Add(time.Hour)))
+	job()
 	ticker := time.NewTicker(time.Hour)
 	defer ticker.Stop()
 	
@@ -76,10 +95,11 @@ func calculateLateFees() {
 			bt.late_fee_type, bt.late_fee as template_late_fee, 
 			bt.late_fee_percentage, bt.late_fee_max
 		FROM bills b
+		INNER JOIN tenants t ON b.tenant_id = t.id
 		LEFT JOIN billing_templates bt ON b.category = bt.name AND b.tenant_id = bt.tenant_id AND bt.deleted_at IS NULL
 		WHERE b.status IN ('pending', 'overdue')
 		AND b.due_date IS NOT NULL
-		AND b.due_date < CURRENT_DATE
+		AND b.due_date < ` + TenantTodaySQL + `
 		AND b.deleted_at IS NULL
 	`
 	
@@ -91,8 +111,11 @@ func calculateLateFees() {
 	defer rows.Close()
 	
 	updatedCount := 0
+	now := time.Now()
+	tenantSettings := map[string]models.TenantSettings{}
 	for rows.Next() {
-		var billID, tenantID, status, lateFeeType string
+		var billID, tenantID, status string
+		var lateFeeType sql.NullString
 		var amount, currentLateFee, templateLateFee sql.NullFloat64
 		var lateFeePercentage, lateFeeMax sql.NullFloat64
 		var dueDate time.Time
@@ -103,9 +126,19 @@ func calculateLateFees() {
 			log.Printf("Error scanning bill: %v", err)
 			continue
 		}
+
+		settings, ok := tenantSettings[tenantID]
+		if !ok {
+			settings, err = LoadTenantSettings(tenantID)
+			if err != nil {
+				log.Printf("Error loading settings for tenant %s, using defaults: %v", tenantID, err)
+			}
+			tenantSettings[tenantID] = settings
+		}
+		defaults := settings.Billing.LateFee
 		
-		// Calculate days overdue
-		daysOverdue := int(time.Since(dueDate).Hours() / 24)
+		// Calculate days overdue; late fees start after the tenant's grace period
+		daysOverdue := DaysOverdue(dueDate, now, TenantLocation(settings)) - defaults.GraceDays
 		if daysOverdue <= 0 {
 			continue
 		}
@@ -113,46 +146,56 @@ func calculateLateFees() {
 		// Calculate new late fee
 		var newLateFee float64
 		
-		if lateFeeType == "percentage" && lateFeePercentage.Valid && amount.Valid {
+		if lateFeeType.String == "percentage" && lateFeePercentage.Valid && amount.Valid {
 			// Percentage-based: percentage of amount per day
 			dailyLateFee := (amount.Float64 * lateFeePercentage.Float64) / 100.0
 			newLateFee = dailyLateFee * float64(daysOverdue)
+		} else if lateFeeType.Valid && templateLateFee.Valid {
+			// Fixed amount per day from the billing template
+			newLateFee = templateLateFee.Float64 * float64(daysOverdue)
+		} else if currentLateFee.Valid && currentLateFee.Float64 > 0 {
+			// Keep a late fee that was set manually
+			newLateFee = currentLateFee.Float64
 		} else {
-			// Fixed amount per day
-			dailyLateFee := 0.0
-			if templateLateFee.Valid {
-				dailyLateFee = templateLateFee.Float64
-			} else if currentLateFee.Valid {
-				// Use existing late fee as daily rate (if it was set manually)
-				dailyLateFee = currentLateFee.Float64 / float64(daysOverdue)
-			} else {
-				// Default: 5000 per day
-				dailyLateFee = 5000.0
+			// No template: the tenant's late fee defaults
+			switch defaults.Type {
+			case "percentage":
+				if amount.Valid {
+					newLateFee = (amount.Float64 * defaults.Percentage) / 100.0 * float64(daysOverdue)
+				}
+			case "fixed":
+				newLateFee = defaults.Amount * float64(daysOverdue)
+			}
+			if defaults.Max > 0 && !lateFeeMax.Valid {
+				lateFeeMax = sql.NullFloat64{Float64: defaults.Max, Valid: true}
 			}
-			newLateFee = dailyLateFee * float64(daysOverdue)
 		}
 		
 		// Apply max late fee if configured
 		if lateFeeMax.Valid && newLateFee > lateFeeMax.Float64 {
 			newLateFee = lateFeeMax.Float64
 		}
+		newLateFee = RoundAmount(settings.Currency, newLateFee)
 		
-		// Update bill
+		// Update bill; the job runs hourly, so bills whose fee did not change are left alone
 		updateQuery := `
 			UPDATE bills 
 			SET late_fee = $1, 
 			    status = CASE WHEN status = 'pending' THEN 'overdue' ELSE status END,
 			    updated_at = NOW()
 			WHERE id = $2 AND tenant_id = $3
+			AND (late_fee IS DISTINCT FROM $1 OR status = 'pending')
 		`
 		
-		_, err = db.DB.Exec(updateQuery, newLateFee, billID, tenantID)
+		result, err := db.DB.Exec(updateQuery, newLateFee, billID, tenantID)
 		if err != nil {
 			log.Printf("Error updating late fee for bill %s: %v", billID, err)
 			continue
 		}
 		
-		updatedCount++
+		if n, _ := result.RowsAffected(); n > 0 {
+			updatedCount++
+		}
 	}
 	
 	log.Printf("Late fee calculation completed. Updated %d bills.", updatedCount)
@@ -162,14 +205,16 @@ func calculateLateFees() {
 func updateBillStatus() {
 	log.Println("Running bill status update job...")
 	
-	// Update bills that are pending and past due date to overdue
+	// Update bills that are pending and past due date (in the tenant's timezone) to overdue
 	query := `
-		UPDATE bills 
+		UPDATE bills b
 		SET status = 'overdue', updated_at = NOW()
-		WHERE status = 'pending'
-		AND due_date IS NOT NULL
-		AND due_date < CURRENT_DATE
-		AND deleted_at IS NULL
+		FROM tenants t
+		WHERE t.id = b.tenant_id
+		AND b.status = 'pending'
+		AND b.due_date IS NOT NULL
+		AND b.due_date < ` + TenantTodaySQL + `
+		AND b.deleted_at IS NULL
 	`
 	
 	result, err := db.DB.Exec(query)
@@ -182,3 +227,35 @@ func updateBillStatus() {
 	log.Printf("Bill status update completed. Updated %d bills to overdue.", rowsAffected)
 }
 
+
+// purgeExpiredAuthRecords deletes sessions, one-time codes and login challenges that are no longer usable
+func purgeExpiredAuthRecords() {
+	log.Println("Running expired session cleanup job...")
+
+	result, err := db.DB.Exec(`
+		DELETE FROM user_sessions
+		WHERE expires_at < NOW() - INTERVAL '30 days'
+		OR revoked_at < NOW() - INTERVAL '30 days'
+	`)
+	if err != nil {
+		log.Printf("Error purging expired sessions: %v", err)
+		return
+	}
+	rowsAffected, _ := result.RowsAffected()
+
+	cleanups := map[string]string{
+		"auth tokens":         `DELETE FROM auth_tokens WHERE expires_at < NOW() - INTERVAL '7 days'`,
+		"OTP codes":           `DELETE FROM otp_codes WHERE expires_at < NOW() - INTERVAL '1 day'`,
+		"MFA challenges":      `DELETE FROM mfa_challenges WHERE expires_at < NOW() - INTERVAL '1 day'`,
+		"rate limit counters": `DELETE FROM rate_limit_counters WHERE expires_at < NOW()`,
+		"OAuth states":        `DELETE FROM oauth_states WHERE expires_at < NOW() - INTERVAL '1 day'`,
+		"platform sessions":   `DELETE FROM platform_sessions WHERE expires_at < NOW() - INTERVAL '30 days'`,
+	}
+	for name, query := range cleanups {
+		if _, err := db.DB.Exec(query); err != nil {
+			log.Printf("Error purging expired %s: %v", name, err)
+		}
+	}
+
+	log.Printf("Expired session cleanup completed. Deleted %d sessions.", rowsAffected)
+}
@@ -0,0 +1,375 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"rukunos-backend/db"
+	"rukunos-backend/models"
+	"rukunos-backend/pii"
+)
+
+// ArchiveRef is a column of an archive entity that points at a row of an entity imported before it
+type ArchiveRef struct {
+	Column   string
+	Entity   string
+	Required bool // Rows whose reference was not imported are skipped; otherwise the column is cleared
+}
+
+// ArchiveSecret is an encrypted identity number. Archives carry it in plain text, because the target
+// instance has its own PII_ENCRYPTION_KEY; the import encrypts it again and recomputes its blind index.
+type ArchiveSecret struct {
+	Field  string // Plain-text field in the archive
+	Column string // Encrypted column
+	Hash   string // Blind index column
+}
+
+// ArchiveEntity is one JSON file of a tenant archive
+type ArchiveEntity struct {
+	Name      string   // File name without .json
+	Table     string   // Aliased as x in Filter and Extra
+	Columns   []string // Exported and restored, besides id and tenant_id
+	Extra     []string // Exported only, e.g. the permission keys of a role
+	Filter    string   // Rows of the tenant ($1)
+	Refs      []ArchiveRef
+	Secrets   []ArchiveSecret
+	HasTenant bool // Restored rows get the new tenant's ID in tenant_id
+}
+
+const archiveTenantRows = "x.tenant_id = $1 AND x.deleted_at IS NULL"
+
+// TenantArchiveEntities are listed in import order. Roles and users are matched against what exists
+// on the target instance; every other entity is inserted with new IDs and its references remapped.
+// Secrets (password hashes, 2FA, sessions, API keys) and logs are never exported.
+var TenantArchiveEntities = []ArchiveEntity{
+	{
+		Name:    "roles",
+		Table:   "roles",
+		Columns: []string{"name", "description", "is_system", "created_at"},
+		Extra: []string{`ARRAY(SELECT p.key FROM role_permissions rp INNER JOIN permissions p ON p.id = rp.permission_id
+		                       WHERE rp.role_id = x.id ORDER BY p.key) AS permission_keys`},
+		Filter: archiveTenantRows,
+	},
+	{
+		Name:    "users",
+		Table:   "users",
+		Columns: []string{"email", "full_name", "phone", "avatar_url", "status", "email_verified_at", "created_at"},
+		Filter:  "x.deleted_at IS NULL AND x.id IN (SELECT user_id FROM tenant_users WHERE tenant_id = $1 AND deleted_at IS NULL)",
+	},
+	{
+		Name:      "units",
+		Table:     "units",
+		Columns:   []string{"code", "type", "owner_name", "owner_phone", "owner_email", "address", "status", "created_at", "updated_at"},
+		Filter:    archiveTenantRows,
+		HasTenant: true,
+	},
+	{
+		Name:    "memberships",
+		Table:   "tenant_users",
+		Columns: []string{"user_id", "role_id", "unit_id", "status", "joined_at", "billing_reminder_opt_out", "created_at", "updated_at"},
+		Filter:  archiveTenantRows,
+		Refs: []ArchiveRef{
+			{"user_id", "users", true},
+			{"role_id", "roles", false},
+			{"unit_id", "units", false},
+		},
+		HasTenant: true,
+	},
+	{
+		Name:    "households",
+		Table:   "households",
+		Columns: []string{"unit_id", "address", "notes", "created_by", "created_at", "updated_at"},
+		Filter:  archiveTenantRows,
+		Refs: []ArchiveRef{
+			{"unit_id", "units", false},
+			{"created_by", "users", false},
+		},
+		Secrets:   []ArchiveSecret{{"kk_number", "kk_number_encrypted", "kk_number_hash"}},
+		HasTenant: true,
+	},
+	{
+		Name:  "residents",
+		Table: "residents",
+		Columns: []string{"household_id", "user_id", "full_name", "gender", "birth_place", "birth_date", "relationship", "religion",
+			"marital_status", "occupation", "domicile_status", "phone", "moved_in_at", "notes", "created_by", "created_at", "updated_at"},
+		Filter: archiveTenantRows + " AND x.household_id IN (SELECT id FROM households WHERE tenant_id = $1 AND deleted_at IS NULL)",
+		Refs: []ArchiveRef{
+			{"household_id", "households", true},
+			{"user_id", "users", false},
+			{"created_by", "users", false},
+		},
+		Secrets:   []ArchiveSecret{{"nik", "nik_encrypted", "nik_hash"}},
+		HasTenant: true,
+	},
+	{
+		Name:  "billing_templates",
+		Table: "billing_templates",
+		Columns: []string{"name", "category", "type", "description", "amount", "late_fee", "is_system", "due_day", "recurring_type",
+			"late_fee_type", "late_fee_percentage", "late_fee_max", "is_active", "created_by", "created_at", "updated_at"},
+		Filter:    archiveTenantRows,
+		Refs:      []ArchiveRef{{"created_by", "users", false}},
+		HasTenant: true,
+	},
+	{
+		Name:    "billing_template_amount_rules",
+		Table:   "billing_template_amount_rules",
+		Columns: []string{"template_id", "unit_type", "amount", "created_at", "updated_at"},
+		Filter:  "x.template_id IN (SELECT id FROM billing_templates WHERE tenant_id = $1 AND deleted_at IS NULL)",
+		Refs:    []ArchiveRef{{"template_id", "billing_templates", true}},
+	},
+	{
+		Name:      "billing_reminder_rules",
+		Table:     "billing_reminder_rules",
+		Columns:   []string{"name", "offset_days", "channel", "message_template", "is_final", "is_active", "created_at", "updated_at"},
+		Filter:    archiveTenantRows,
+		HasTenant: true,
+	},
+	{
+		Name:  "bills",
+		Table: "bills",
+		Columns: []string{"bill_number", "unit_id", "category", "period", "amount", "late_fee", "due_date", "status", "paid_at",
+			"payment_method", "payment_reference", "notes", "created_by", "created_at", "updated_at"},
+		Filter: archiveTenantRows,
+		Refs: []ArchiveRef{
+			{"unit_id", "units", true},
+			{"created_by", "users", false},
+		},
+		HasTenant: true,
+	},
+	{
+		Name:  "announcements",
+		Table: "announcements",
+		Columns: []string{"author_id", "title", "content", "priority", "category", "is_pinned", "sent_notification", "sent_whatsapp",
+			"sent_at", "expires_at", "metadata", "cascade_to_children", "created_at", "updated_at"},
+		Filter:    archiveTenantRows,
+		Refs:      []ArchiveRef{{"author_id", "users", true}},
+		HasTenant: true,
+	},
+	{
+		Name:  "complaints",
+		Table: "complaints",
+		Columns: []string{"user_id", "unit_id", "category", "priority", "title", "description", "status", "assigned_to",
+			"resolved_at", "resolution_notes", "attachment_urls", "metadata", "created_at", "updated_at"},
+		Filter: archiveTenantRows,
+		Refs: []ArchiveRef{
+			{"user_id", "users", true},
+			{"unit_id", "units", false},
+			{"assigned_to", "users", false},
+		},
+		HasTenant: true,
+	},
+	{
+		Name:  "document_requests",
+		Table: "document_requests",
+		Columns: []string{"user_id", "document_type", "purpose", "status", "approved_by", "approved_at", "rejected_reason",
+			"attachment_ids", "notes", "metadata", "created_at", "updated_at"},
+		Filter: archiveTenantRows,
+		Refs: []ArchiveRef{
+			{"user_id", "users", true},
+			{"approved_by", "users", false},
+		},
+		HasTenant: true,
+	},
+	{
+		Name:  "visitor_logs",
+		Table: "visitor_logs",
+		Columns: []string{"unit_id", "visitor_name", "visitor_phone", "visitor_id_number", "visitor_vehicle", "purpose", "host_name",
+			"checked_in_at", "checked_out_at", "notes", "checked_in_by", "checked_out_by", "created_at", "updated_at"},
+		Filter: archiveTenantRows,
+		Refs: []ArchiveRef{
+			{"unit_id", "units", false},
+			{"checked_in_by", "users", false},
+			{"checked_out_by", "users", false},
+		},
+		HasTenant: true,
+	},
+	{
+		Name:  "panic_alerts",
+		Table: "panic_alerts",
+		Columns: []string{"user_id", "unit_id", "location", "status", "responded_by", "responded_at", "resolved_at", "notes",
+			"created_at", "updated_at"},
+		Filter: archiveTenantRows,
+		Refs: []ArchiveRef{
+			{"user_id", "users", true},
+			{"unit_id", "units", false},
+			{"responded_by", "users", false},
+		},
+		HasTenant: true,
+	},
+}
+
+// archiveAttachmentsQuery lists the attachments referenced by complaints (URLs) and document requests (file IDs).
+// RukunOS does not store the files themselves, so the archive carries the references only.
+const archiveAttachmentsQuery = `
+	SELECT COALESCE(json_agg(a ORDER BY a.entity, a.source_id), '[]'), COUNT(*)
+	FROM (
+		SELECT 'complaints' AS entity, x.id AS source_id, 'url' AS kind, url AS reference
+		FROM complaints x, unnest(x.attachment_urls) AS url
+		WHERE x.tenant_id = $1 AND x.deleted_at IS NULL
+		UNION ALL
+		SELECT 'document_requests', x.id, 'file_id', file_id::text
+		FROM document_requests x, unnest(x.attachment_ids) AS file_id
+		WHERE x.tenant_id = $1 AND x.deleted_at IS NULL
+	) a
+`
+
+// ArchiveAttachment is one entry of attachments.json
+type ArchiveAttachment struct {
+	Entity    string `json:"entity"`
+	SourceID  string `json:"source_id"`
+	Kind      string `json:"kind"` // url, file_id
+	Reference string `json:"reference"`
+}
+
+// openArchiveSecrets replaces the encrypted columns of the tenant's exported rows with their plain-text values
+func openArchiveSecrets(entity ArchiveEntity, data []byte, tenantID string) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var rows []map[string]interface{}
+	if err := decoder.Decode(&rows); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		for _, secret := range entity.Secrets {
+			encrypted, _ := row[secret.Column].(string)
+			value, err := pii.Decrypt(encrypted, tenantID)
+			if err != nil {
+				return nil, fmt.Errorf("%s of %v: %w", secret.Field, row["id"], err)
+			}
+			row[secret.Field] = value
+			delete(row, secret.Column)
+		}
+	}
+	return json.Marshal(rows)
+}
+
+// SealArchiveSecrets encrypts the plain-text identity numbers of an archive row for insertion into the tenant,
+// filling in the encrypted and blind index columns
+func SealArchiveSecrets(entity ArchiveEntity, row map[string]interface{}, tenantID string) error {
+	for _, secret := range entity.Secrets {
+		value, _ := row[secret.Field].(string)
+		if value == "" {
+			return fmt.Errorf("%s is missing", secret.Field)
+		}
+		encrypted, err := pii.Encrypt(value, tenantID)
+		if err != nil {
+			return err
+		}
+		hash, err := pii.BlindIndex(value)
+		if err != nil {
+			return err
+		}
+		row[secret.Column] = encrypted
+		row[secret.Hash] = hash
+		delete(row, secret.Field)
+	}
+	return nil
+}
+
+// BuildTenantArchive writes the tenant into a ZIP archive. Everything is read from one snapshot
+// so bills, units and memberships in the archive agree with each other.
+func BuildTenantArchive(tenantID string) ([]byte, models.TenantArchiveManifest, error) {
+	manifest := models.TenantArchiveManifest{
+		Format:     models.TenantArchiveFormat,
+		Version:    models.TenantArchiveVersion,
+		ExportedAt: time.Now().UTC(),
+		Entities:   map[string]int{},
+		Notes: []string{
+			"Deleted records, passwords, 2FA secrets, sessions, API keys and audit logs are not included.",
+			"attachments.json lists attachment URLs and file IDs; the files themselves are not included.",
+			"households.json and residents.json hold family card (KK) numbers and NIKs in plain text; store the archive accordingly.",
+		},
+	}
+
+	tx, err := db.DB.BeginTxx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, manifest, err
+	}
+	defer tx.Rollback()
+
+	var tenantJSON []byte
+	err = tx.Get(&tenantJSON, `
+		SELECT json_build_object(
+			'name', name, 'code', code, 'address', address, 'phone', phone, 'email', email,
+			'level', COALESCE(level, 'rt'), 'settings', COALESCE(settings, '{}'), 'modules', COALESCE(modules, '{}'))
+		FROM tenants
+		WHERE id = $1 AND deleted_at IS NULL
+	`, tenantID)
+	if err != nil {
+		return nil, manifest, err
+	}
+	var tenant models.TenantArchiveTenant
+	if err := json.Unmarshal(tenantJSON, &tenant); err != nil {
+		return nil, manifest, err
+	}
+	manifest.Source = models.TenantArchiveSource{TenantID: tenantID, Name: tenant.Name, Code: tenant.Code}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	writeFile := func(name string, data []byte) error {
+		w, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	if err := writeFile("tenant.json", tenantJSON); err != nil {
+		return nil, manifest, err
+	}
+
+	for _, entity := range TenantArchiveEntities {
+		selects := []string{"x.id"}
+		for _, col := range entity.Columns {
+			selects = append(selects, "x."+col)
+		}
+		for _, secret := range entity.Secrets {
+			selects = append(selects, "x."+secret.Column)
+		}
+		selects = append(selects, entity.Extra...)
+		query := `
+			SELECT COALESCE(json_agg(row_to_json(e)), '[]'), COUNT(*)
+			FROM (SELECT ` + strings.Join(selects, ", ") + ` FROM ` + entity.Table + ` x
+			      WHERE ` + entity.Filter + ` ORDER BY x.created_at, x.id) e`
+
+		var data []byte
+		var count int
+		if err := tx.QueryRow(query, tenantID).Scan(&data, &count); err != nil {
+			return nil, manifest, fmt.Errorf("%s: %w", entity.Name, err)
+		}
+		if len(entity.Secrets) > 0 && count > 0 {
+			// Fails without PII_ENCRYPTION_KEY, so a tenant is never purged with its register left out
+			if data, err = openArchiveSecrets(entity, data, tenantID); err != nil {
+				return nil, manifest, fmt.Errorf("%s: %w", entity.Name, err)
+			}
+		}
+		if err := writeFile(entity.Name+".json", data); err != nil {
+			return nil, manifest, err
+		}
+		manifest.Entities[entity.Name] = count
+	}
+
+	var attachments []byte
+	var attachmentCount int
+	if err := tx.QueryRow(archiveAttachmentsQuery, tenantID).Scan(&attachments, &attachmentCount); err != nil {
+		return nil, manifest, fmt.Errorf("attachments: %w", err)
+	}
+	if err := writeFile("attachments.json", attachments); err != nil {
+		return nil, manifest, err
+	}
+	manifest.Entities["attachments"] = attachmentCount
+
+	manifestJSON, _ := json.MarshalIndent(manifest, "", "  ")
+	if err := writeFile("manifest.json", manifestJSON); err != nil {
+		return nil, manifest, err
+	}
+	if err := archive.Close(); err != nil {
+		return nil, manifest, err
+	}
+	return buf.Bytes(), manifest, nil
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+	"rukunos-backend/pii"
+)
+
+func archiveEntity(t *testing.T, name string) ArchiveEntity {
+	t.Helper()
+	for _, entity := range TenantArchiveEntities {
+		if entity.Name == name {
+			return entity
+		}
+	}
+	t.Fatalf("%s is not an archive entity", name)
+	return ArchiveEntity{}
+}
+
+func TestArchiveSecretsRoundTrip(t *testing.T) {
+	t.Setenv("PII_ENCRYPTION_KEY", "cnVrdW5vcy1kZXYtcGlpLWtleS1ub3QtZm9yLXByb2Q=")
+	residents := archiveEntity(t, "residents")
+
+	encrypted, err := pii.Encrypt("3201010101900007", "tenant-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported, _ := json.Marshal([]map[string]interface{}{
+		{"id": "r1", "full_name": "Budi", "nik_encrypted": encrypted},
+	})
+
+	// Export: the archive carries the NIK in plain text and no ciphertext
+	opened, err := openArchiveSecrets(residents, exported, "tenant-1")
+	if err != nil {
+		t.Fatalf("openArchiveSecrets: %v", err)
+	}
+	var rows []map[string]interface{}
+	if err := json.Unmarshal(opened, &rows); err != nil {
+		t.Fatal(err)
+	}
+	row := rows[0]
+	if row["nik"] != "3201010101900007" {
+		t.Fatalf("nik = %v, want the decrypted NIK", row["nik"])
+	}
+	if _, ok := row["nik_encrypted"]; ok {
+		t.Fatal("The archive row still carries the encrypted column")
+	}
+
+	// Import: encrypted again for the new tenant, with a blind index that finds it
+	if err := SealArchiveSecrets(residents, row, "tenant-2"); err != nil {
+		t.Fatalf("SealArchiveSecrets: %v", err)
+	}
+	if _, ok := row["nik"]; ok {
+		t.Fatal("The plain-text NIK is still in the row to insert")
+	}
+	if value, err := pii.Decrypt(row["nik_encrypted"].(string), "tenant-2"); err != nil || value != "3201010101900007" {
+		t.Fatalf("Re-encrypted NIK decrypts to %q, %v", value, err)
+	}
+	if hash, _ := pii.BlindIndex("3201010101900007"); row["nik_hash"] != hash {
+		t.Fatalf("nik_hash = %v, want %s", row["nik_hash"], hash)
+	}
+
+	if err := SealArchiveSecrets(residents, map[string]interface{}{"id": "r2"}, "tenant-2"); err == nil {
+		t.Fatal("A resident without a NIK was accepted")
+	}
+}
+
+func TestArchiveRegistryOrder(t *testing.T) {
+	// References must point at entities imported earlier
+	seen := map[string]bool{}
+	for _, entity := range TenantArchiveEntities {
+		for _, ref := range entity.Refs {
+			if !seen[ref.Entity] {
+				t.Errorf("%s.%s refers to %s, which is imported later", entity.Name, ref.Column, ref.Entity)
+			}
+		}
+		seen[entity.Name] = true
+	}
+	for _, name := range []string{"households", "residents"} {
+		if !seen[name] {
+			t.Errorf("%s is not archived", name)
+		}
+	}
+}
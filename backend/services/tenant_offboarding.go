@@ -0,0 +1,212 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+	"rukunos-backend/db"
+
+	"github.com/lib/pq"
+)
+
+// TenantDeletionGraceDays is how long a tenant can cancel its deletion request
+const TenantDeletionGraceDays = 30
+
+// tenantArchiveRetention is how long the final export of a purged tenant is kept for the platform admins
+const tenantArchiveRetention = 90 * 24 * time.Hour
+
+// TenantArchiveDir is where final exports of deleted tenants are stored (TENANT_ARCHIVE_DIR, default ./data/tenant-archives)
+func TenantArchiveDir() string {
+	if dir := os.Getenv("TENANT_ARCHIVE_DIR"); dir != "" {
+		return dir
+	}
+	return "./data/tenant-archives"
+}
+
+// processTenantDeletions exports and purges every tenant whose deletion grace period has ended,
+// then removes final exports that are past their retention. A failed tenant is retried on the next run.
+func processTenantDeletions() {
+	log.Println("Running tenant deletion job...")
+
+	var due []struct {
+		ID       string `db:"id"`
+		TenantID string `db:"tenant_id"`
+	}
+	err := db.DB.Select(&due, `
+		SELECT id, tenant_id FROM tenant_deletion_requests
+		WHERE status = 'pending' AND purge_after <= NOW()
+		ORDER BY purge_after
+	`)
+	if err != nil {
+		log.Printf("Error fetching due tenant deletions: %v", err)
+		return
+	}
+
+	purged := 0
+	for _, request := range due {
+		if err := purgeTenant(request.ID, request.TenantID); err != nil {
+			log.Printf("Error purging tenant %s (deletion request %s): %v", request.TenantID, request.ID, err)
+			db.DB.Exec(`UPDATE tenant_deletion_requests SET last_error = $1, updated_at = NOW() WHERE id = $2`,
+				err.Error(), request.ID)
+			continue
+		}
+		purged++
+	}
+
+	removeExpiredTenantArchives()
+	log.Printf("Tenant deletion job completed. Purged %d tenants.", purged)
+}
+
+// exportTenantForDeletion writes the tenant's final archive to TenantArchiveDir and returns its path
+func exportTenantForDeletion(requestID, tenantID string) (string, error) {
+	data, _, err := BuildTenantArchive(tenantID)
+	if err != nil {
+		return "", fmt.Errorf("export failed: %w", err)
+	}
+	dir := TenantArchiveDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("export failed: %w", err)
+	}
+	path := filepath.Join(dir, requestID+".zip")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", fmt.Errorf("export failed: %w", err)
+	}
+	return path, nil
+}
+
+// purgeTenant exports a tenant and deletes it with everything that belongs to it. Rows of every table that
+// cascades from tenants are counted first, so the purge log says what was removed. Accounts that were only
+// members of this tenant are removed too; super admins are kept.
+func purgeTenant(requestID, tenantID string) error {
+	path, err := exportTenantForDeletion(requestID, tenantID)
+	if err != nil {
+		return err
+	}
+	_, err = db.DB.Exec(`
+		UPDATE tenant_deletion_requests
+		SET exported_at = NOW(), archive_path = $1, archive_expires_at = $2, updated_at = NOW()
+		WHERE id = $3
+	`, path, time.Now().Add(tenantArchiveRetention), requestID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Cancelled while the archive was being written
+	var status string
+	if err := tx.Get(&status, `SELECT status FROM tenant_deletion_requests WHERE id = $1 FOR UPDATE`, requestID); err != nil {
+		return err
+	}
+	if status != "pending" {
+		return nil
+	}
+
+	var tables []struct {
+		Table  string `db:"table_name"`
+		Column string `db:"column_name"`
+	}
+	err = tx.Select(&tables, `
+		SELECT c.conrelid::regclass::text AS table_name, a.attname AS column_name
+		FROM pg_constraint c
+		INNER JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = c.conkey[1]
+		WHERE c.contype = 'f' AND c.confrelid = 'tenants'::regclass AND c.confdeltype = 'c'
+		ORDER BY 1
+	`)
+	if err != nil {
+		return err
+	}
+
+	summary := map[string]int{}
+	for _, t := range tables {
+		var count int
+		query := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s = $1`, t.Table, pq.QuoteIdentifier(t.Column))
+		if err := tx.Get(&count, query, tenantID); err != nil {
+			return err
+		}
+		if count > 0 {
+			summary[t.Table] += count
+		}
+	}
+
+	var memberIDs []string
+	if err := tx.Select(&memberIDs, `SELECT user_id FROM tenant_users WHERE tenant_id = $1`, tenantID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM tenants WHERE id = $1`, tenantID); err != nil {
+		return err
+	}
+	summary["tenants"] = 1
+
+	result, err := tx.Exec(`
+		DELETE FROM users u
+		WHERE u.id = ANY($1) AND COALESCE(u.is_super_admin, false) = false
+		AND NOT EXISTS (SELECT 1 FROM tenant_users tu WHERE tu.user_id = u.id)
+	`, pq.Array(memberIDs))
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		summary["users"] = int(n)
+	}
+
+	for entity, count := range summary {
+		_, err := tx.Exec(`
+			INSERT INTO data_purge_logs (tenant_id, deletion_request_id, entity, reason, rows_deleted)
+			VALUES ($1, $2, $3, 'tenant_deletion', $4)
+		`, tenantID, requestID, entity, count)
+		if err != nil {
+			return err
+		}
+	}
+
+	summaryJSON, _ := json.Marshal(summary)
+	_, err = tx.Exec(`
+		UPDATE tenant_deletion_requests
+		SET status = 'purged', purged_at = NOW(), purge_summary = $1::jsonb, last_error = NULL, updated_at = NOW()
+		WHERE id = $2
+	`, string(summaryJSON), requestID)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for entity, count := range summary {
+		log.Printf("Tenant purge: removed %d %s of tenant %s", count, entity, tenantID)
+	}
+	return nil
+}
+
+// removeExpiredTenantArchives deletes final exports past their retention
+func removeExpiredTenantArchives() {
+	var expired []struct {
+		ID   string `db:"id"`
+		Path string `db:"archive_path"`
+	}
+	err := db.DB.Select(&expired, `
+		SELECT id, archive_path FROM tenant_deletion_requests
+		WHERE archive_path IS NOT NULL AND archive_expires_at < NOW()
+	`)
+	if err != nil {
+		log.Printf("Error fetching expired tenant archives: %v", err)
+		return
+	}
+	for _, archive := range expired {
+		if err := os.Remove(archive.Path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error removing tenant archive %s: %v", archive.Path, err)
+			continue
+		}
+		db.DB.Exec(`UPDATE tenant_deletion_requests SET archive_path = NULL, updated_at = NOW() WHERE id = $1`, archive.ID)
+		log.Printf("Removed expired tenant archive %s", archive.Path)
+	}
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+	"rukunos-backend/db"
+	"rukunos-backend/models"
+)
+
+// DefaultTenantSettings are the settings of a tenant that never changed them.
+// Bills without a billing template get no late fee unless the tenant configures one.
+func DefaultTenantSettings() models.TenantSettings {
+	return models.TenantSettings{
+		Timezone: "Asia/Jakarta",
+		Currency: models.CurrencySettings{
+			RoundingUnit: 1,
+			RoundingMode: "nearest",
+		},
+		Billing: models.BillingSettings{
+			DefaultDueDay: 10,
+			LateFee: models.LateFeeSettings{
+				Type: "none",
+			},
+		},
+		Reminders: models.ReminderSettings{
+			Enabled:  true,
+			SendHour: 8,
+		},
+		Security:  models.TenantSecuritySettings{Require2FARoleIDs: []string{}},
+		Retention: DefaultRetention(),
+	}
+}
+
+// ParseTenantSettings reads a tenants.settings document; missing fields keep their defaults
+func ParseTenantSettings(raw []byte) (models.TenantSettings, error) {
+	settings := DefaultTenantSettings()
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &settings); err != nil {
+			return DefaultTenantSettings(), err
+		}
+	}
+	if settings.Security.Require2FARoleIDs == nil {
+		settings.Security.Require2FARoleIDs = []string{}
+	}
+	if settings.Retention == nil {
+		settings.Retention = DefaultRetention()
+	}
+	return settings, nil
+}
+
+// LoadTenantSettings returns the typed settings of a tenant
+func LoadTenantSettings(tenantID string) (models.TenantSettings, error) {
+	var raw []byte
+	err := db.DB.Get(&raw, `SELECT COALESCE(settings, '{}'::jsonb) FROM tenants WHERE id = $1`, tenantID)
+	if err != nil {
+		return DefaultTenantSettings(), err
+	}
+	return ParseTenantSettings(raw)
+}
+
+// ValidateTenantSettings checks every field; role IDs in security are checked by the caller against the tenant
+func ValidateTenantSettings(s models.TenantSettings) error {
+	if s.Timezone == "" {
+		return fmt.Errorf("timezone is required")
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone: %s", s.Timezone)
+	}
+
+	switch s.Currency.RoundingUnit {
+	case 1, 10, 100, 500, 1000:
+	default:
+		return fmt.Errorf("currency.rounding_unit must be 1, 10, 100, 500 or 1000")
+	}
+	switch s.Currency.RoundingMode {
+	case "nearest", "up", "down":
+	default:
+		return fmt.Errorf("currency.rounding_mode must be nearest, up or down")
+	}
+
+	if s.Billing.DefaultDueDay < 1 || s.Billing.DefaultDueDay > 31 {
+		return fmt.Errorf("billing.default_due_day must be between 1 and 31")
+	}
+	lateFee := s.Billing.LateFee
+	switch lateFee.Type {
+	case "fixed", "percentage", "none":
+	default:
+		return fmt.Errorf("billing.late_fee.type must be fixed, percentage or none")
+	}
+	if lateFee.Amount < 0 || lateFee.Max < 0 {
+		return fmt.Errorf("billing.late_fee amounts cannot be negative")
+	}
+	if lateFee.Percentage < 0 || lateFee.Percentage > 100 {
+		return fmt.Errorf("billing.late_fee.percentage must be between 0 and 100")
+	}
+	if lateFee.GraceDays < 0 || lateFee.GraceDays > 90 {
+		return fmt.Errorf("billing.late_fee.grace_days must be between 0 and 90")
+	}
+
+	letterhead := []struct{ field, value string }{
+		{"letterhead.title", s.Letterhead.Title},
+		{"letterhead.address", s.Letterhead.Address},
+		{"letterhead.city", s.Letterhead.City},
+		{"letterhead.chairperson_name", s.Letterhead.ChairpersonName},
+		{"letterhead.secretary_name", s.Letterhead.SecretaryName},
+	}
+	for _, l := range letterhead {
+		if len(l.value) > 255 {
+			return fmt.Errorf("%s is too long (max 255 characters)", l.field)
+		}
+	}
+
+	if s.Reminders.SendHour < 0 || s.Reminders.SendHour > 23 {
+		return fmt.Errorf("reminders.send_hour must be between 0 and 23")
+	}
+	if len(s.Reminders.SignOff) > 160 {
+		return fmt.Errorf("reminders.sign_off is too long (max 160 characters)")
+	}
+	return validateRetention(s.Retention)
+}
+
+// RoundAmount rounds a computed amount to the tenant's currency rounding unit
+func RoundAmount(currency models.CurrencySettings, amount float64) float64 {
+	unit := float64(currency.RoundingUnit)
+	if unit <= 1 {
+		unit = 1
+	}
+	switch currency.RoundingMode {
+	case "up":
+		return math.Ceil(amount/unit) * unit
+	case "down":
+		return math.Floor(amount/unit) * unit
+	default:
+		return math.Round(amount/unit) * unit
+	}
+}
+
+// TenantLocation is the tenant's timezone; it falls back to WIB if the stored name cannot be loaded
+func TenantLocation(settings models.TenantSettings) *time.Location {
+	loc, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		loc, _ = time.LoadLocation(DefaultTenantSettings().Timezone)
+	}
+	if loc == nil {
+		return time.FixedZone("WIB", 7*60*60)
+	}
+	return loc
+}
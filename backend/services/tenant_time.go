@@ -0,0 +1,32 @@
+package services
+
+import (
+	"time"
+)
+
+// Dates are calendar dates in the tenant's timezone (WIB, WITA or WIT), never the server's.
+// Bill due dates are DATE columns; other timestamps are stored in the database session timezone,
+// so SQL converts them with ::timestamptz AT TIME ZONE before comparing with a tenant's dates.
+
+// TenantTimezoneSQL is the timezone of the tenant aliased as t, defaulting like DefaultTenantSettings
+const TenantTimezoneSQL = `COALESCE(NULLIF(t.settings->>'timezone', ''), 'Asia/Jakarta')`
+
+// TenantTodaySQL is today's date in the timezone of the tenant aliased as t
+const TenantTodaySQL = `(NOW() AT TIME ZONE ` + TenantTimezoneSQL + `)::date`
+
+// LocalDate is the calendar date of t in loc, as midnight UTC so it compares like a DATE column
+func LocalDate(t time.Time, loc *time.Location) time.Time {
+	y, m, d := t.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// DaysOverdue counts whole days from a due date to today in loc; 0 on the due date itself
+func DaysOverdue(dueDate, now time.Time, loc *time.Location) int {
+	due := time.Date(dueDate.Year(), dueDate.Month(), dueDate.Day(), 0, 0, 0, 0, time.UTC)
+	return int(LocalDate(now, loc).Sub(due).Hours() / 24)
+}
+
+// LocalDayStart is midnight of a calendar date in loc, as an instant to compare timestamps against
+func LocalDayStart(date time.Time, loc *time.Location) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, loc)
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// zone loads one of the Indonesian tenant timezones
+func zone(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+// at parses "2006-01-02 15:04" in loc
+func at(t *testing.T, value string, loc *time.Location) time.Time {
+	t.Helper()
+	parsed, err := time.ParseInLocation("2006-01-02 15:04", value, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func date(t *testing.T, value string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestLocalDate(t *testing.T) {
+	tests := []struct {
+		zone string
+		utc  string // the instant, in UTC
+		want string
+	}{
+		// 17:30 UTC is already the next day in all three zones
+		{"Asia/Jakarta", "2026-10-19 17:30", "2026-10-20"},
+		{"Asia/Makassar", "2026-10-19 17:30", "2026-10-20"},
+		{"Asia/Jayapura", "2026-10-19 17:30", "2026-10-20"},
+		// One minute before local midnight in WIB, but after it in WITA and WIT
+		{"Asia/Jakarta", "2026-10-19 16:59", "2026-10-19"},
+		{"Asia/Makassar", "2026-10-19 16:59", "2026-10-20"},
+		{"Asia/Jayapura", "2026-10-19 16:59", "2026-10-20"},
+		// Exactly local midnight
+		{"Asia/Jakarta", "2026-10-19 17:00", "2026-10-20"},
+		{"Asia/Makassar", "2026-10-19 16:00", "2026-10-20"},
+		{"Asia/Jayapura", "2026-10-19 15:00", "2026-10-20"},
+		{"Asia/Jayapura", "2026-10-19 14:59", "2026-10-19"},
+		// Same date in UTC and locally
+		{"Asia/Jakarta", "2026-10-20 03:00", "2026-10-20"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.zone+" "+tt.utc, func(t *testing.T) {
+			got := LocalDate(at(t, tt.utc, time.UTC), zone(t, tt.zone))
+			if want := date(t, tt.want); !got.Equal(want) {
+				t.Fatalf("LocalDate = %s, want %s", got.Format("2006-01-02"), tt.want)
+			}
+			if got.Location() != time.UTC {
+				t.Fatalf("LocalDate location = %s, want UTC", got.Location())
+			}
+		})
+	}
+}
+
+func TestDaysOverdue(t *testing.T) {
+	due := date(t, "2026-10-20")
+	tests := []struct {
+		name   string
+		zone   string
+		now    string // local wall time in zone
+		nowUTC string // the instant in UTC instead, when set
+		want   int
+	}{
+		{name: "day before, last minute", zone: "Asia/Jakarta", now: "2026-10-19 23:59", want: -1},
+		{name: "due date at midnight", zone: "Asia/Jakarta", now: "2026-10-20 00:00", want: 0},
+		{name: "due date, last minute", zone: "Asia/Jakarta", now: "2026-10-20 23:59", want: 0},
+		{name: "day after at midnight", zone: "Asia/Jakarta", now: "2026-10-21 00:00", want: 1},
+		{name: "due date at midnight", zone: "Asia/Makassar", now: "2026-10-20 00:00", want: 0},
+		{name: "day after at midnight", zone: "Asia/Makassar", now: "2026-10-21 00:00", want: 1},
+		{name: "due date at midnight", zone: "Asia/Jayapura", now: "2026-10-20 00:00", want: 0},
+		{name: "day after, first minute", zone: "Asia/Jayapura", now: "2026-10-21 00:01", want: 1},
+		{name: "a month later", zone: "Asia/Jayapura", now: "2026-11-19 08:00", want: 30},
+		// 16:30 UTC on the due date: still the due date in WIB, already the next day in WITA and WIT
+		{name: "UTC still on the due date", zone: "Asia/Jakarta", nowUTC: "2026-10-20 16:30", want: 0},
+		{name: "UTC still on the due date", zone: "Asia/Makassar", nowUTC: "2026-10-20 16:30", want: 1},
+		{name: "UTC still on the due date", zone: "Asia/Jayapura", nowUTC: "2026-10-20 16:30", want: 1},
+		// 18:00 UTC the day before: the due date locally everywhere
+		{name: "UTC still on the day before", zone: "Asia/Jakarta", nowUTC: "2026-10-19 18:00", want: 0},
+		{name: "UTC still on the day before", zone: "Asia/Jayapura", nowUTC: "2026-10-19 18:00", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.zone+" "+tt.name, func(t *testing.T) {
+			loc := zone(t, tt.zone)
+			var now time.Time
+			if tt.nowUTC != "" {
+				now = at(t, tt.nowUTC, time.UTC)
+			} else {
+				now = at(t, tt.now, loc)
+			}
+			if got := DaysOverdue(due, now, loc); got != tt.want {
+				t.Fatalf("DaysOverdue = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDaysOverdueIgnoresDueDateLocation(t *testing.T) {
+	// A DATE column scanned in another zone keeps its calendar date
+	loc := zone(t, "Asia/Jakarta")
+	due := time.Date(2026, 10, 20, 0, 0, 0, 0, zone(t, "Asia/Jayapura"))
+	if got := DaysOverdue(due, at(t, "2026-10-21 00:00", loc), loc); got != 1 {
+		t.Fatalf("DaysOverdue = %d, want 1", got)
+	}
+}
+
+func TestLocalDayStart(t *testing.T) {
+	tests := []struct {
+		zone string
+		want string // local midnight of 2026-10-20, in UTC
+	}{
+		{"Asia/Jakarta", "2026-10-19 17:00"},
+		{"Asia/Makassar", "2026-10-19 16:00"},
+		{"Asia/Jayapura", "2026-10-19 15:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.zone, func(t *testing.T) {
+			loc := zone(t, tt.zone)
+			got := LocalDayStart(date(t, "2026-10-20"), loc)
+			if want := at(t, tt.want, time.UTC); !got.Equal(want) {
+				t.Fatalf("LocalDayStart = %s, want %s", got.UTC().Format("2006-01-02 15:04"), tt.want)
+			}
+			// The round trip through LocalDate lands on the same calendar date
+			if back := LocalDate(got, loc); !back.Equal(date(t, "2026-10-20")) {
+				t.Fatalf("LocalDate(LocalDayStart) = %s, want 2026-10-20", back.Format("2006-01-02"))
+			}
+			// One nanosecond earlier is still the day before
+			if before := LocalDate(got.Add(-time.Nanosecond), loc); !before.Equal(date(t, "2026-10-19")) {
+				t.Fatalf("LocalDate just before midnight = %s, want 2026-10-19", before.Format("2006-01-02"))
+			}
+		})
+	}
+}
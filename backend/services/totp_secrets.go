@@ -0,0 +1,44 @@
+package services
+
+import (
+	"log"
+	"strings"
+	"rukunos-backend/db"
+	"rukunos-backend/pii"
+)
+
+// EncryptTOTPSecrets encrypts TOTP secrets still stored in plain text (enrolled before migration 040).
+// It runs at startup and does nothing once every secret is encrypted.
+func EncryptTOTPSecrets() {
+	var users []struct {
+		ID     string `db:"id"`
+		Secret string `db:"totp_secret"`
+	}
+	err := db.DB.Select(&users, `SELECT id, totp_secret FROM users WHERE totp_secret IS NOT NULL AND totp_secret NOT LIKE 'v1:%'`)
+	if err != nil {
+		log.Printf("Error listing plain-text TOTP secrets: %v", err)
+		return
+	}
+
+	encrypted := 0
+	for _, u := range users {
+		if strings.HasPrefix(u.Secret, "v1:") {
+			continue
+		}
+		value, err := pii.Encrypt(u.Secret, u.ID)
+		if err != nil {
+			log.Printf("Error encrypting TOTP secrets, %d left in plain text: %v", len(users)-encrypted, err)
+			return
+		}
+		// Only if the user has not re-enrolled in the meantime
+		_, err = db.DB.Exec(`UPDATE users SET totp_secret = $1 WHERE id = $2 AND totp_secret = $3`, value, u.ID, u.Secret)
+		if err != nil {
+			log.Printf("Error encrypting TOTP secret of user %s: %v", u.ID, err)
+			continue
+		}
+		encrypted++
+	}
+	if encrypted > 0 {
+		log.Printf("Encrypted %d plain-text TOTP secrets", encrypted)
+	}
+}
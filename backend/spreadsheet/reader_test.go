@@ -0,0 +1,89 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// sheetXLSX builds a minimal workbook whose first sheet holds sheetData
+func sheetXLSX(t *testing.T, sheetData string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	files := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData>` + sheetData + `</sheetData></worksheet>`,
+	}
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestColumnIndex(t *testing.T) {
+	tests := []struct {
+		ref     string
+		want    int
+		wantErr bool
+	}{
+		{"A1", 0, false},
+		{"C12", 2, false},
+		{"Z3", 25, false},
+		{"AA1", 26, false},
+		{"XFD1", 16383, false},
+		{"XFE1", 0, true},
+		{"ZZZZZZZ1", 0, true},
+		{strings.Repeat("Z", 40) + "1", 0, true}, // Would overflow int
+		{"12", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := columnIndex(tt.ref)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("columnIndex(%q) = %d, %v; want %d, error %v", tt.ref, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestReadXLSX(t *testing.T) {
+	data := sheetXLSX(t, `<row r="1"><c r="A1" t="inlineStr"><is><t>code</t></is></c><c r="C1" t="inlineStr"><is><t>type</t></is></c></row>`+
+		`<row r="2"><c r="A2"><v>A-1</v></c></row>`)
+	rows, err := ReadAll(data, FormatXLSX)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if len(rows) != 2 || len(rows[0]) != 3 || len(rows[1]) != 3 || rows[0][2] != "type" || rows[1][0] != "A-1" {
+		t.Fatalf("rows = %q", rows)
+	}
+}
+
+func TestReadXLSXRejectsFarColumns(t *testing.T) {
+	for _, ref := range []string{"ZZZZZZZ1", strings.Repeat("Z", 40) + "1", "XFD1", "IW1"} {
+		data := sheetXLSX(t, `<row r="1"><c r="`+ref+`"><v>x</v></c></row>`)
+		if _, err := ReadAll(data, FormatXLSX); err == nil || !strings.Contains(err.Error(), "row 1") {
+			t.Errorf("Cell %s: error = %v, want a row error", ref, err)
+		}
+	}
+	// The last allowed column
+	data := sheetXLSX(t, `<row r="1"><c r="IV1"><v>x</v></c></row>`)
+	rows, err := ReadAll(data, FormatXLSX)
+	if err != nil || len(rows[0]) != MaxColumns {
+		t.Fatalf("Cell IV1: %d columns, %v; want %d", len(rows[0]), err, MaxColumns)
+	}
+}
+
+func TestReadCSVRejectsWideRows(t *testing.T) {
+	data := []byte("code,type\n" + strings.Repeat(",", MaxColumns) + "\n")
+	if _, err := ReadAll(data, FormatCSV); err == nil || !strings.Contains(err.Error(), "row 2") {
+		t.Fatalf("error = %v, want row 2 rejected", err)
+	}
+}
@@ -0,0 +1,63 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of RFC 6238 Appendix B, "12345678901234567890", base32-encoded
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// The RFC 6238 Appendix B SHA-1 vectors are 8 digits; a 6-digit code is their last six
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "94287082"},
+	{1111111109, "07081804"},
+	{1111111111, "14050471"},
+	{1234567890, "89005924"},
+	{2000000000, "69279037"},
+	{20000000000, "65353130"},
+}
+
+func TestCodeAtRFC6238Vectors(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		got, err := CodeAt(rfc6238Secret, Step(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatalf("CodeAt(%d): %v", v.unix, err)
+		}
+		if want := v.code[len(v.code)-Digits:]; got != want {
+			t.Errorf("CodeAt(%d) = %s, want %s", v.unix, got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+
+	code, _ := CodeAt(rfc6238Secret, step-1)
+	if got, ok := Validate(rfc6238Secret, code, now, 1); !ok || got != step-1 {
+		t.Errorf("Validate(previous step) = %d, %v; want %d, true", got, ok, step-1)
+	}
+	if _, ok := Validate(rfc6238Secret, code, now, 0); ok {
+		t.Error("Validate accepted a code outside the skew")
+	}
+
+	code, _ = CodeAt(rfc6238Secret, step)
+	if _, ok := Validate(rfc6238Secret, code[:3]+" "+code[3:], now, 0); !ok {
+		t.Error("Validate rejected a code with a space")
+	}
+	for _, bad := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok := Validate(rfc6238Secret, bad, now, 1); ok {
+			t.Errorf("Validate accepted %q", bad)
+		}
+	}
+}
+
+func TestCodeAtRejectsInvalidSecret(t *testing.T) {
+	if _, err := CodeAt("not base32!", 1); err == nil {
+		t.Error("CodeAt accepted an invalid secret")
+	}
+}
@@ -8,7 +8,8 @@ export const useApi = () => {
 
     const fetch = async <T>(
         endpoint: string,
-        options: RequestInit = {}
+        options: RequestInit = {},
+        retried = false
     ): Promise<T> => {
         const url = `${apiUrl}${endpoint}`
         
@@ -31,6 +32,20 @@ export const useApi = () => {
             })
             return response
         } catch (error: any) {
+            // Access token expired or session revoked: try the refresh token once
+            const status = error.status || error.statusCode
+            if (status === 401 && !retried && !endpoint.startsWith('/api/auth/')) {
+                // An expired impersonation token is not refreshed; go back to the admin's own session
+                if (authStore.isImpersonating) {
+                    await authStore.endImpersonation()
+                    throw { data: error.data, message: 'Impersonation ended', status }
+                }
+                if (await authStore.refreshSession()) {
+                    return fetch<T>(endpoint, options, true)
+                }
+                authStore.logout()
+            }
+
             // Handle error response - $fetch throws error with data property
             console.error('API Error:', error)
             console.error('API Error URL:', url)
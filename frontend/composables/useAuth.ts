@@ -81,6 +81,7 @@ export const useAuth = () => {
     hasPermission: (permission: string) => {
       if (isAdmin.value) return true
       return authStore.hasPermission(permission)
-    }
+    },
+    hasModule: authStore.hasModule
   }
 }
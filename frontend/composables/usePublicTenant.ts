@@ -0,0 +1,42 @@
+export interface PublicTenant {
+    name: string
+    code: string
+    level: string
+    address?: string
+    phone?: string
+    email?: string
+    letterhead: {
+        title: string
+        address: string
+        city: string
+    }
+    identity_providers: { id: string; name: string }[]
+}
+
+// Public pages work without a login: the API finds the tenant from the subdomain or custom domain
+// the page is served on, passed along in X-Tenant-Host (also during server-side rendering).
+export const usePublicApi = () => {
+    const config = useRuntimeConfig()
+    const host = useRequestURL().host
+    const apiUrl = process.server ? config.apiInternal : config.public.apiBase
+
+    const get = <T>(endpoint: string): Promise<T> => {
+        return $fetch<T>(`${apiUrl}${endpoint}`, {
+            headers: { 'X-Tenant-Host': host },
+        })
+    }
+
+    return { get }
+}
+
+// The tenant the current host belongs to, or null on the platform's own domain
+export const usePublicTenant = () => {
+    const { get } = usePublicApi()
+    return useAsyncData('public-tenant', async () => {
+        try {
+            return await get<PublicTenant>('/api/public/tenant')
+        } catch {
+            return null
+        }
+    })
+}
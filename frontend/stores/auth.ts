@@ -12,6 +12,17 @@ export interface User {
     unit_id?: string
     permissions?: string[]
     role?: string
+    impersonation?: Impersonation
+    modules?: Record<string, boolean>
+}
+
+// Present on /api/me while an admin is viewing the app as this user
+export interface Impersonation {
+    id: string
+    actor_id: string
+    actor_name: string
+    banner: string
+    expires_at: string
 }
 
 export const useAuthStore = defineStore('auth', () => {
@@ -24,26 +35,70 @@ export const useAuthStore = defineStore('auth', () => {
         secure: isSecure
     })
     
+    const refreshToken = useCookie<string | null>('refresh_token', {
+        maxAge: 60 * 60 * 24 * 30, // 30 days, matches server-side session lifetime
+        sameSite: 'lax',
+        secure: isSecure
+    })
+
     const user = useCookie<User | null>('user', {
         maxAge: 60 * 60 * 24 * 3, // 3 days
         sameSite: 'lax',
         secure: isSecure
     })
 
+    // The admin's own token and user, kept aside while impersonating a warga
+    const impersonatorToken = useCookie<string | null>('impersonator_token', {
+        maxAge: 60 * 60 * 24, // 1 day
+        sameSite: 'lax',
+        secure: isSecure
+    })
+    const impersonatorUser = useCookie<User | null>('impersonator_user', {
+        maxAge: 60 * 60 * 24, // 1 day
+        sameSite: 'lax',
+        secure: isSecure
+    })
+
     const isAuthenticated = computed(() => !!token.value)
+    const isImpersonating = computed(() => !!impersonatorToken.value)
     const hasPermission = (permission: string) => {
         return user.value?.permissions?.includes(permission) || false
     }
+    // Modules the RT has switched off are rejected by the API; sessions from before modules were reported allow all
+    const hasModule = (module: string) => {
+        return user.value?.modules?.[module] ?? true
+    }
 
-    function setToken(newToken: string) {
+    function setToken(newToken: string, newRefreshToken?: string) {
         if (!newToken) {
             console.warn('Attempting to set empty token')
             return
         }
         token.value = newToken
+        if (newRefreshToken) {
+            refreshToken.value = newRefreshToken
+        }
         console.log('Token set successfully, length:', newToken.length)
     }
 
+    // Exchange the refresh token for a new access token; returns false when the session is gone
+    async function refreshSession(): Promise<boolean> {
+        if (!refreshToken.value) return false
+        const config = useRuntimeConfig()
+        const apiUrl = process.server ? config.apiInternal : config.public.apiBase
+        try {
+            const response = await $fetch<{ token: string; refresh_token: string }>(`${apiUrl}/api/auth/refresh`, {
+                method: 'POST',
+                body: { refresh_token: refreshToken.value },
+            })
+            setToken(response.token, response.refresh_token)
+            return true
+        } catch (error) {
+            console.error('Failed to refresh session:', error)
+            return false
+        }
+    }
+
     function setUser(newUser: User) {
         user.value = newUser
     }
@@ -77,20 +132,71 @@ export const useAuthStore = defineStore('auth', () => {
         }
     }
 
-    function logout() {
+    // Switch to a short-lived token that sees the app as another member of the RT
+    async function startImpersonation(userId: string, reason: string) {
+        const { post } = useApi()
+        const response = await post<{ token: string }>(`/api/users/${userId}/impersonate`, { reason })
+        impersonatorToken.value = token.value
+        impersonatorUser.value = user.value
+        token.value = response.token
+        user.value = null
+        await fetchCurrentUser()
+        navigateTo('/dashboard')
+    }
+
+    // Return to the admin's own account; also used when the impersonation has expired
+    async function endImpersonation() {
+        if (!impersonatorToken.value) return
+        const config = useRuntimeConfig()
+        const apiUrl = process.server ? config.apiInternal : config.public.apiBase
+        try {
+            await $fetch(`${apiUrl}/api/impersonation/end`, {
+                method: 'POST',
+                headers: { Authorization: `Bearer ${token.value}` },
+            })
+        } catch (error) {
+            console.error('Failed to end impersonation:', error)
+        }
+        token.value = impersonatorToken.value
+        user.value = impersonatorUser.value
+        impersonatorToken.value = null
+        impersonatorUser.value = null
+        await fetchCurrentUser()
+        navigateTo('/users')
+    }
+
+    async function logout() {
+        if (impersonatorToken.value) {
+            await endImpersonation()
+        }
+        if (token.value) {
+            const { post } = useApi()
+            try {
+                await post('/api/auth/logout', {})
+            } catch (error) {
+                console.error('Failed to revoke session on logout:', error)
+            }
+        }
         token.value = null
+        refreshToken.value = null
         user.value = null
         navigateTo('/login')
     }
 
     return {
         token,
+        refreshToken,
         user,
         isAuthenticated,
+        isImpersonating,
         hasPermission,
+        hasModule,
         setToken,
+        refreshSession,
         setUser,
         fetchCurrentUser,
+        startImpersonation,
+        endImpersonation,
         logout
     }
 })
@@ -120,6 +120,29 @@ migrate() {
         "014_update_billing_templates_add_fields.sql"
         "015_create_billing_template_amount_rules.sql"
         "016_add_bill_number_to_bills.sql"
+        "017_create_billing_reminders_tables.sql"
+        "018_create_import_jobs_and_invitations.sql"
+        "019_create_user_sessions_table.sql"
+        "020_add_default_tenant_to_users.sql"
+        "021_create_auth_tokens_and_email_verification.sql"
+        "022_create_otp_codes_table.sql"
+        "023_create_two_factor_auth_tables.sql"
+        "024_create_rate_limit_counters_table.sql"
+        "025_create_join_requests_and_invitation_links.sql"
+        "026_create_oauth_states_table.sql"
+        "027_create_tenant_identity_providers.sql"
+        "028_create_api_keys_table.sql"
+        "029_create_platform_admin_tables.sql"
+        "030_create_impersonation_tables.sql"
+        "031_add_tenant_hierarchy.sql"
+        "032_backfill_tenant_modules.sql"
+        "033_create_tenant_settings_history.sql"
+        "034_add_tenant_export_permission.sql"
+        "035_create_tenant_offboarding_tables.sql"
+        "036_enable_tenant_row_level_security.sql"
+        "037_add_tenant_plans.sql"
+        "038_create_tenant_domains_table.sql"
+        "039_create_resident_registry.sql"
     )
     
     # Load environment variables